@@ -0,0 +1,440 @@
+package database
+
+import (
+	"fmt"
+	"godb/disktree"
+	. "godb/entity"
+	"godb/logger"
+	"strings"
+)
+
+// @Title        aggregate.go
+// @Description  COUNT/SUM/MIN/MAX/AVG aggregate functions
+
+// aggregator 聚合函数的累加状态，NULL 值不参与聚合
+type aggregator interface {
+	add(value interface{}) error
+	result() interface{}
+}
+
+func newAggregator(column *ColumnNode) aggregator {
+	switch column.Function {
+	case "COUNT":
+		return &countAggregator{}
+	case "SUM":
+		return &sumAggregator{}
+	case "AVG":
+		return &avgAggregator{}
+	case "MIN":
+		return &extremeAggregator{sign: -1}
+	default:
+		return &extremeAggregator{sign: 1}
+	}
+}
+
+// countAggregator COUNT 返回非 NULL 值的个数，COUNT(*) 统计所有行
+type countAggregator struct {
+	count uint32
+}
+
+func (a *countAggregator) add(value interface{}) error {
+	if value != nil {
+		a.count++
+	}
+	return nil
+}
+
+func (a *countAggregator) result() interface{} {
+	return a.count
+}
+
+// sumAggregator SUM 用 uint64 累加避免溢出，没有非 NULL 值时结果为 NULL
+type sumAggregator struct {
+	sum  uint64
+	seen bool
+}
+
+func (a *sumAggregator) add(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	v, ok := value.(uint32)
+	if !ok {
+		return fmt.Errorf("SUM requires an INT column, got %T", value)
+	}
+	a.sum += uint64(v)
+	a.seen = true
+	return nil
+}
+
+func (a *sumAggregator) result() interface{} {
+	if !a.seen {
+		return nil
+	}
+	return a.sum
+}
+
+// avgAggregator AVG 结果为 float64，没有非 NULL 值时结果为 NULL
+type avgAggregator struct {
+	sum   uint64
+	count uint64
+}
+
+func (a *avgAggregator) add(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	v, ok := value.(uint32)
+	if !ok {
+		return fmt.Errorf("AVG requires an INT column, got %T", value)
+	}
+	a.sum += uint64(v)
+	a.count++
+	return nil
+}
+
+func (a *avgAggregator) result() interface{} {
+	if a.count == 0 {
+		return nil
+	}
+	return float64(a.sum) / float64(a.count)
+}
+
+// extremeAggregator MIN（sign 为 -1）和 MAX（sign 为 1），结果与列的类型相同
+type extremeAggregator struct {
+	sign  int
+	value interface{}
+}
+
+func (a *extremeAggregator) add(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	if a.value == nil {
+		a.value = value
+		return nil
+	}
+	cmp, ok := compareValues(value, a.value)
+	if !ok {
+		return fmt.Errorf("cannot compare %T with %T", value, a.value)
+	}
+	if cmp*a.sign > 0 {
+		a.value = value
+	}
+	return nil
+}
+
+func (a *extremeAggregator) result() interface{} {
+	return a.value
+}
+
+// hasAggregate 判断 SELECT 列表中是否有聚合函数
+func hasAggregate(columns []*ColumnNode) bool {
+	for _, column := range columns {
+		if column.ColumnType == FUNCTION_CALL {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregateArgument 返回聚合函数参数在一行中的值，COUNT(*) 对每一行都返回非 NULL
+func aggregateArgument(row map[string]interface{}, column *ColumnNode) interface{} {
+	if column.Argument.ColumnType == WILDCARDN {
+		return true
+	}
+	return columnValue(row, column.Argument)
+}
+
+// aggregateQuery 聚合查询要计算的分组列和聚合函数
+type aggregateQuery struct {
+	scope   *joinScope
+	groupBy []*ColumnNode
+	// SELECT、HAVING、ORDER BY 中出现的所有聚合函数，按列名去重
+	functions []*ColumnNode
+	columns   []string
+}
+
+// newAggregateQuery 检查聚合查询中的列：SELECT、HAVING、ORDER BY 中不在聚合函数里的列必须出现在 GROUP BY 中
+func newAggregateQuery(scope *joinScope, node *SelectNode) (*aggregateQuery, error) {
+	q := &aggregateQuery{scope: scope, groupBy: node.GroupBy}
+	for _, column := range node.GroupBy {
+		if column.ColumnType == WILDCARDN {
+			return nil, fmt.Errorf("cannot group by *")
+		}
+		if _, err := scope.resolve(column); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, column := range node.Columns {
+		if column.ColumnType == WILDCARDN {
+			return nil, fmt.Errorf("SELECT * cannot be used with aggregate functions or GROUP BY")
+		}
+		if err := q.check(column); err != nil {
+			return nil, err
+		}
+		q.columns = append(q.columns, column.String())
+	}
+	for _, column := range referencedColumns(node.Having) {
+		if err := q.check(column); err != nil {
+			return nil, err
+		}
+	}
+	for _, order := range node.OrderByColumns {
+		if err := q.check(order.Column); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// check 聚合函数加入待计算的列表，普通列必须是分组列
+func (q *aggregateQuery) check(column *ColumnNode) error {
+	if column.ColumnType != FUNCTION_CALL {
+		if !q.isGroupColumn(column) {
+			return fmt.Errorf("column %s must appear in GROUP BY or be used in an aggregate function", column)
+		}
+		return nil
+	}
+	for _, function := range q.functions {
+		if function.String() == column.String() {
+			return nil
+		}
+	}
+	if column.Argument.ColumnType != WILDCARDN {
+		table, err := q.scope.resolve(column.Argument)
+		if err != nil {
+			return err
+		}
+		if column.Function == "SUM" || column.Function == "AVG" {
+			col := q.scope.getTable(table).GetColumn(column.Argument.ColumnName)
+			if col.DataType != TypeInt {
+				return fmt.Errorf("%s requires an INT column, %s is %v", column.Function, column.Argument, col.DataType)
+			}
+		}
+	}
+	q.functions = append(q.functions, column)
+	return nil
+}
+
+// isGroupColumn 判断列是否就是某个分组列，带不带表名前缀都可以
+func (q *aggregateQuery) isGroupColumn(column *ColumnNode) bool {
+	table, err := q.scope.resolve(column)
+	if err != nil {
+		return false
+	}
+	for _, group := range q.groupBy {
+		groupTable, _ := q.scope.resolve(group)
+		if groupTable == table && group.ColumnName == column.ColumnName {
+			return true
+		}
+	}
+	return false
+}
+
+// input 取出一行中聚合需要的值：前面是分组列的值，后面是每个聚合函数的参数
+func (q *aggregateQuery) input(row map[string]interface{}) []interface{} {
+	input := make([]interface{}, 0, len(q.groupBy)+len(q.functions))
+	for _, column := range q.groupBy {
+		input = append(input, columnValue(row, column))
+	}
+	for _, function := range q.functions {
+		input = append(input, aggregateArgument(row, function))
+	}
+	return input
+}
+
+// output 把一个分组的结果组成一行，分组列同时以 table.column 和列名为键，聚合函数以函数调用为键
+func (q *aggregateQuery) output(values []interface{}, results []interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, 2*len(values)+len(results))
+	for i, column := range q.groupBy {
+		table, _ := q.scope.resolve(column)
+		row[qualifiedName(table, column.ColumnName)] = values[i]
+		if len(q.scope.columns[column.ColumnName]) == 1 {
+			row[column.ColumnName] = values[i]
+		}
+	}
+	for i, function := range q.functions {
+		row[function.String()] = results[i]
+	}
+	return row
+}
+
+// aggregateOperator 在 Open 时读完子算子做哈希聚合，之后逐个输出分组
+// 没有 GROUP BY 时所有行聚合为一行，空表也输出一行
+type aggregateOperator struct {
+	rowState
+	child     operator
+	query     *aggregateQuery
+	directory string
+	budget    int
+	hash      *hashAggregator
+	groups    *groupIterator
+}
+
+func newAggregateOperator(child operator, query *aggregateQuery, directory string, budget int) *aggregateOperator {
+	return &aggregateOperator{child: child, query: query, directory: directory, budget: budget}
+}
+
+func (o *aggregateOperator) Open() error {
+	if err := o.child.Open(); err != nil {
+		return err
+	}
+	o.hash = newHashAggregator(o.query.functions, len(o.query.groupBy), o.directory, o.budget, 0)
+	count := 0
+	for o.child.Next() {
+		if err := o.hash.Add(o.query.input(o.child.Row())); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := o.child.Err(); err != nil {
+		return err
+	}
+	if len(o.query.groupBy) == 0 && o.hash.Len() == 0 {
+		o.hash.newGroup("", nil)
+	}
+	logger.Debug("aggregate %d rows", count)
+	o.groups = o.hash.Groups()
+	return nil
+}
+
+func (o *aggregateOperator) Next() bool {
+	if !o.groups.Next() {
+		o.err = o.groups.Err()
+		return false
+	}
+	o.row = o.query.output(o.groups.Values(), o.groups.Results())
+	return true
+}
+
+func (o *aggregateOperator) Close() {
+	if o.groups != nil {
+		o.groups.Close()
+	}
+	if o.hash != nil {
+		o.hash.Close()
+	}
+	o.child.Close()
+}
+
+func (o *aggregateOperator) explain() *planNode {
+	columns := make([]string, 0, len(o.query.groupBy)+len(o.query.functions))
+	for _, column := range o.query.functions {
+		columns = append(columns, column.String())
+	}
+	detail := strings.Join(columns, ", ")
+	if len(o.query.groupBy) > 0 {
+		groups := make([]string, len(o.query.groupBy))
+		for i, column := range o.query.groupBy {
+			groups[i] = column.String()
+		}
+		detail = fmt.Sprintf("group by %s: %s", strings.Join(groups, ", "), detail)
+	}
+	node := newPlanNode("HashAggregate", detail, o.child.explain())
+	if len(o.query.groupBy) == 0 {
+		node.rows = 1
+	}
+	return node
+}
+
+// canAggregateFromIndex 单表、没有 WHERE 且只有 COUNT(*)、COUNT(主键)、MIN(主键)、MAX(主键) 时，
+// 可以直接从主键 B+ 树的叶子链和最左、最右路径得到结果，不需要反序列化任何一行
+// 多列主键的键按第一列排序，这里的主键指主键的第一列
+func canAggregateFromIndex(node *SelectNode, definition *SqlTableDefinition) bool {
+	if len(node.Join) > 0 || node.WhereClause != nil || len(node.GroupBy) > 0 || node.Having != nil {
+		return false
+	}
+	priKeyColumns, err := getPrimaryKeyColumns(definition)
+	if err != nil {
+		return false
+	}
+	priKeyName := priKeyColumns[0]
+	for _, column := range node.Columns {
+		if column.ColumnType != FUNCTION_CALL {
+			return false
+		}
+		onPrimaryKey := column.Argument.ColumnType != WILDCARDN && column.Argument.ColumnName == priKeyName
+		switch column.Function {
+		case "COUNT":
+			if column.Argument.ColumnType != WILDCARDN && !onPrimaryKey {
+				return false
+			}
+		case "MIN", "MAX":
+			if !onPrimaryKey {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// indexAggregateOperator 从主键索引得到聚合结果，只输出一行
+type indexAggregateOperator struct {
+	rowState
+	tree       *disktree.BPTree
+	definition *SqlTableDefinition
+	columns    []*ColumnNode
+	done       bool
+}
+
+func newIndexAggregateOperator(tree *disktree.BPTree, definition *SqlTableDefinition, columns []*ColumnNode) *indexAggregateOperator {
+	return &indexAggregateOperator{tree: tree, definition: definition, columns: columns}
+}
+
+func (o *indexAggregateOperator) Open() error {
+	o.done = false
+	o.row = make(map[string]interface{}, len(o.columns))
+	for _, column := range o.columns {
+		var value interface{}
+		switch column.Function {
+		case "COUNT":
+			count, err := o.tree.Count()
+			if err != nil {
+				return err
+			}
+			value = count
+		case "MIN", "MAX":
+			var key []byte
+			var found bool
+			var err error
+			if column.Function == "MIN" {
+				key, found, err = o.tree.MinKey()
+			} else {
+				key, found, err = o.tree.MaxKey()
+			}
+			if err != nil {
+				return err
+			}
+			if found {
+				value = decodeKeyValue(key, o.definition.GetColumn(column.Argument.ColumnName).DataType)
+			}
+		}
+		o.row[column.String()] = value
+	}
+	logger.Debug("aggregate %s answered from primary index", o.definition.TableName)
+	return nil
+}
+
+func (o *indexAggregateOperator) Next() bool {
+	if o.done {
+		return false
+	}
+	o.done = true
+	return true
+}
+
+func (o *indexAggregateOperator) Close() {}
+
+func (o *indexAggregateOperator) explain() *planNode {
+	columns := make([]string, len(o.columns))
+	for i, column := range o.columns {
+		columns[i] = column.String()
+	}
+	node := newPlanNode("IndexAggregate", fmt.Sprintf("%s from primary index of %s", strings.Join(columns, ", "), o.definition.TableName))
+	node.rows = 1
+	return node
+}
@@ -0,0 +1,440 @@
+package database
+
+import (
+	"fmt"
+	. "godb/entity"
+	"math"
+)
+
+// @Title        condition.go
+// @Description  evaluate where conditions against rows and derive index key ranges
+
+// truth SQL 的三值逻辑，与 NULL 比较的结果是 unknown
+type truth int
+
+const (
+	truthFalse truth = iota
+	truthTrue
+	truthUnknown
+)
+
+func toTruth(b bool) truth {
+	if b {
+		return truthTrue
+	}
+	return truthFalse
+}
+
+// matchRow 判断行是否满足 where 条件，没有条件时所有行都满足，结果为 unknown 时不满足
+// 条件中有无法计算的表达式时返回错误，而不是当作满足或不满足
+func matchRow(row map[string]interface{}, where ASTNode) (bool, error) {
+	if where == nil {
+		return true, nil
+	}
+	result, err := evaluate(row, where)
+	return result == truthTrue, err
+}
+
+// evaluate 递归计算布尔表达式树
+func evaluate(row map[string]interface{}, expression ASTNode) (truth, error) {
+	switch n := expression.(type) {
+	case *UnaryOpNode:
+		if n.Operator != NOT {
+			return truthFalse, fmt.Errorf("unsupported operator %v in condition", n.Operator)
+		}
+		operand, err := evaluate(row, n.Operand)
+		if err != nil {
+			return truthFalse, err
+		}
+		switch operand {
+		case truthTrue:
+			return truthFalse, nil
+		case truthFalse:
+			return truthTrue, nil
+		default:
+			return truthUnknown, nil
+		}
+	case *BinaryOpNode:
+		if n.Operator != AND && n.Operator != OR {
+			return matchCondition(row, n)
+		}
+		left, err := evaluate(row, n.Left)
+		if err != nil {
+			return truthFalse, err
+		}
+		right, err := evaluate(row, n.Right)
+		if err != nil {
+			return truthFalse, err
+		}
+		if n.Operator == AND {
+			if left == truthFalse || right == truthFalse {
+				return truthFalse, nil
+			}
+			if left == truthUnknown || right == truthUnknown {
+				return truthUnknown, nil
+			}
+			return truthTrue, nil
+		}
+		if left == truthTrue || right == truthTrue {
+			return truthTrue, nil
+		}
+		if left == truthUnknown || right == truthUnknown {
+			return truthUnknown, nil
+		}
+		return truthFalse, nil
+	default:
+		return truthFalse, fmt.Errorf("unsupported expression %v in condition", expression)
+	}
+}
+
+// splitConjuncts 把顶层由 AND 连接的表达式拆成比较条件列表，供索引选择使用
+// OR / NOT 子树无法直接走索引，不会出现在结果中，由 evaluate 负责过滤
+func splitConjuncts(expression ASTNode) []*BinaryOpNode {
+	node, ok := expression.(*BinaryOpNode)
+	if !ok {
+		return nil
+	}
+	switch node.Operator {
+	case AND:
+		return append(splitConjuncts(node.Left), splitConjuncts(node.Right)...)
+	case OR:
+		return nil
+	default:
+		return []*BinaryOpNode{node}
+	}
+}
+
+// splitAnd 把顶层由 AND 连接的表达式拆开，与 splitConjuncts 不同，OR 和 NOT 子树原样保留
+func splitAnd(expression ASTNode) []ASTNode {
+	if expression == nil {
+		return nil
+	}
+	if node, ok := expression.(*BinaryOpNode); ok && node.Operator == AND {
+		return append(splitAnd(node.Left), splitAnd(node.Right)...)
+	}
+	return []ASTNode{expression}
+}
+
+// andAll 用 AND 连接多个表达式，没有表达式时返回 nil
+func andAll(expressions []ASTNode) ASTNode {
+	var result ASTNode
+	for _, expression := range expressions {
+		if result == nil {
+			result = expression
+		} else {
+			result = NewBinaryOpNode(AND, result, expression)
+		}
+	}
+	return result
+}
+
+func matchCondition(row map[string]interface{}, condition *BinaryOpNode) (truth, error) {
+	value, err := operandValue(row, condition.Left)
+	if err != nil {
+		return truthFalse, err
+	}
+
+	if condition.Operator == BETWEEN {
+		bounds, ok := condition.Right.(*BinaryOpNode)
+		if !ok || bounds.Operator != AND {
+			return truthFalse, fmt.Errorf("malformed BETWEEN condition %v", condition)
+		}
+		low, err := operandValue(row, bounds.Left)
+		if err != nil {
+			return truthFalse, err
+		}
+		high, err := operandValue(row, bounds.Right)
+		if err != nil {
+			return truthFalse, err
+		}
+		if value == nil || low == nil || high == nil {
+			return truthUnknown, nil
+		}
+		lowCmp, ok1 := compareValues(value, low)
+		highCmp, ok2 := compareValues(value, high)
+		return toTruth(ok1 && ok2 && lowCmp >= 0 && highCmp <= 0), nil
+	}
+
+	if list, ok := condition.Right.(*valueList); ok {
+		return list.contains(value), nil
+	}
+
+	right, err := operandValue(row, condition.Right)
+	if err != nil {
+		return truthFalse, err
+	}
+	if value == nil || right == nil {
+		return truthUnknown, nil
+	}
+	cmp, ok := compareValues(value, right)
+	if !ok {
+		// 类型不一致时只有 != 成立
+		return toTruth(condition.Operator == NOT_EQUALS), nil
+	}
+	switch condition.Operator {
+	case EQUALS:
+		return toTruth(cmp == 0), nil
+	case NOT_EQUALS:
+		return toTruth(cmp != 0), nil
+	case LESS_THAN:
+		return toTruth(cmp < 0), nil
+	case LESS_EQUALS:
+		return toTruth(cmp <= 0), nil
+	case GREATER_THAN:
+		return toTruth(cmp > 0), nil
+	case GREATER_EQUALS:
+		return toTruth(cmp >= 0), nil
+	default:
+		return truthFalse, fmt.Errorf("unsupported operator %v in condition", condition.Operator)
+	}
+}
+
+// operandValue 取出比较运算一侧的值，列从行中读取，字面量直接返回，其它表达式不能作为操作数
+func operandValue(row map[string]interface{}, node ASTNode) (interface{}, error) {
+	switch n := node.(type) {
+	case *ColumnNode:
+		return columnValue(row, n), nil
+	case *LiteralNode:
+		return n.Value, nil
+	default:
+		return nil, fmt.Errorf("unsupported operand %v in condition", node)
+	}
+}
+
+// columnValue 读取列的值，连接后的行以 table.column 为键，单表的行只有列名，聚合结果以函数调用为键
+func columnValue(row map[string]interface{}, column *ColumnNode) interface{} {
+	if column.ColumnType == FUNCTION_CALL {
+		return row[column.String()]
+	}
+	if column.ColumnType == TABLE_NAME_PREFIXED {
+		if value, ok := row[qualifiedName(column.TableName, column.ColumnName)]; ok {
+			return value
+		}
+	}
+	return row[column.ColumnName]
+}
+
+func qualifiedName(tableName string, columnName string) string {
+	return tableName + "." + columnName
+}
+
+// referencedColumns 收集表达式中引用的所有列
+func referencedColumns(expression ASTNode) []*ColumnNode {
+	switch n := expression.(type) {
+	case *ColumnNode:
+		return []*ColumnNode{n}
+	case *BinaryOpNode:
+		return append(referencedColumns(n.Left), referencedColumns(n.Right)...)
+	case *UnaryOpNode:
+		return referencedColumns(n.Operand)
+	default:
+		return nil
+	}
+}
+
+// compareValues 比较两个同类型的值，类型不同或不可比较时返回 false
+func compareValues(a, b interface{}) (int, bool) {
+	// 聚合结果可能是 uint64 或 float64，与 uint32 的字面量比较时统一转成 float64
+	if x, ok := numericValue(a); ok {
+		y, ok := numericValue(b)
+		if !ok {
+			return 0, false
+		}
+		return threeWay(x < y, x > y), true
+	}
+	x, ok := a.(string)
+	if !ok {
+		return 0, false
+	}
+	y, ok := b.(string)
+	if !ok {
+		return 0, false
+	}
+	return threeWay(x < y, x > y), true
+}
+
+// compareKeys 比较两个同类型的索引键，用于排序
+func compareKeys(a, b interface{}) int {
+	c, _ := compareValues(a, b)
+	return c
+}
+
+func threeWay(less bool, greater bool) int {
+	if less {
+		return -1
+	} else if greater {
+		return 1
+	}
+	return 0
+}
+
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// isRangeOperator 判断条件是否可以转换为索引上的区间扫描
+func isRangeOperator(operator TokenType) bool {
+	switch operator {
+	case LESS_THAN, LESS_EQUALS, GREATER_THAN, GREATER_EQUALS, BETWEEN:
+		return true
+	default:
+		return false
+	}
+}
+
+// getEqualKey 返回 dataType 类型的列上 = 条件的索引键，字面量的类型与列不同时不能用于查找
+func getEqualKey(clause []*BinaryOpNode, columnName string, dataType DataType) (interface{}, bool) {
+	for _, condition := range clause {
+		left, ok := condition.Left.(*ColumnNode)
+		if !ok || left.ColumnName != columnName || condition.Operator != EQUALS {
+			continue
+		}
+		if literal, ok := condition.Right.(*LiteralNode); ok && isKeyValue(literal.Value, dataType) {
+			return literal.Value, true
+		}
+	}
+	return nil, false
+}
+
+// getKeyRange 把 dataType 类型的列上所有的区间条件合并成一个闭区间 [lo, hi]，lo 和 hi 的类型与列相同
+// 没有可用的区间条件时 found 为 false，区间为空时 lo > hi
+func getKeyRange(clause []*BinaryOpNode, columnName string, dataType DataType) (lo interface{}, hi interface{}, found bool) {
+	if isStringType(dataType) {
+		return getStringRange(clause, columnName)
+	}
+	return getIntRange(clause, columnName)
+}
+
+// getIntRange 合并 INT 列上的区间条件，开区间的边界换成相邻的整数
+func getIntRange(clause []*BinaryOpNode, columnName string) (lo uint32, hi uint32, found bool) {
+	lo, hi = 0, math.MaxUint32
+	for _, condition := range clause {
+		left, ok := condition.Left.(*ColumnNode)
+		if !ok || left.ColumnName != columnName || !isRangeOperator(condition.Operator) {
+			continue
+		}
+
+		if condition.Operator == BETWEEN {
+			bounds, ok := condition.Right.(*BinaryOpNode)
+			if !ok {
+				continue
+			}
+			low, lowOk := literalUint32(bounds.Left)
+			high, highOk := literalUint32(bounds.Right)
+			if !lowOk || !highOk {
+				continue
+			}
+			lo, hi = max(lo, low), min(hi, high)
+			found = true
+			continue
+		}
+
+		value, ok := literalUint32(condition.Right)
+		if !ok {
+			continue
+		}
+		found = true
+		switch condition.Operator {
+		case LESS_THAN:
+			if value == 0 {
+				return 1, 0, true
+			}
+			hi = min(hi, value-1)
+		case LESS_EQUALS:
+			hi = min(hi, value)
+		case GREATER_THAN:
+			if value == math.MaxUint32 {
+				return 1, 0, true
+			}
+			lo = max(lo, value+1)
+		case GREATER_EQUALS:
+			lo = max(lo, value)
+		}
+	}
+	return lo, hi, found
+}
+
+// getStringRange 合并字符串列上的区间条件，没有上界时 hi 是 MAX_STRING_KEY
+// 字符串没有相邻的值，> 和 < 按 >= 和 <= 扫描，等于边界的行由扫描之上的过滤去掉
+func getStringRange(clause []*BinaryOpNode, columnName string) (lo string, hi string, found bool) {
+	lo, hi = "", MAX_STRING_KEY
+	for _, condition := range clause {
+		left, ok := condition.Left.(*ColumnNode)
+		if !ok || left.ColumnName != columnName || !isRangeOperator(condition.Operator) {
+			continue
+		}
+
+		if condition.Operator == BETWEEN {
+			bounds, ok := condition.Right.(*BinaryOpNode)
+			if !ok {
+				continue
+			}
+			low, lowOk := literalString(bounds.Left)
+			high, highOk := literalString(bounds.Right)
+			if !lowOk || !highOk {
+				continue
+			}
+			lo, hi = max(lo, low), min(hi, high)
+			found = true
+			continue
+		}
+
+		value, ok := literalString(condition.Right)
+		if !ok {
+			continue
+		}
+		found = true
+		switch condition.Operator {
+		case LESS_THAN, LESS_EQUALS:
+			hi = min(hi, value)
+		case GREATER_THAN, GREATER_EQUALS:
+			lo = max(lo, value)
+		}
+	}
+	return lo, hi, found
+}
+
+// getInKeys 返回 dataType 类型的列上 IN 条件的索引键列表
+func getInKeys(clause []*BinaryOpNode, columnName string, dataType DataType) ([]interface{}, bool) {
+	for _, condition := range clause {
+		left, ok := condition.Left.(*ColumnNode)
+		if !ok || left.ColumnName != columnName || condition.Operator != IN {
+			continue
+		}
+		list, ok := condition.Right.(*valueList)
+		if !ok {
+			continue
+		}
+		if keys, ok := list.indexKeys(dataType); ok {
+			return keys, true
+		}
+	}
+	return nil, false
+}
+
+func literalUint32(node ASTNode) (uint32, bool) {
+	literal, ok := node.(*LiteralNode)
+	if !ok {
+		return 0, false
+	}
+	value, ok := literal.Value.(uint32)
+	return value, ok
+}
+
+func literalString(node ASTNode) (string, bool) {
+	literal, ok := node.(*LiteralNode)
+	if !ok {
+		return "", false
+	}
+	value, ok := literal.Value.(string)
+	return value, ok
+}
@@ -2,10 +2,10 @@ package database
 
 import (
 	"fmt"
+	"godb/disktree"
 	. "godb/entity"
 	"godb/logger"
 	. "godb/sqlparser"
-	"log"
 )
 
 // @Title        database.go
@@ -18,49 +18,123 @@ type DataBase struct {
 	sqlTableExecutor *SqlQueryExecutor
 }
 
-func NewDataBase(dataDirectory string) *DataBase {
-	manager := NewSqlTableManager(dataDirectory)
+// NewDataBase 打开数据目录下的数据库，目录不存在时创建，读取表定义或打开索引失败时返回错误
+func NewDataBase(dataDirectory string) (*DataBase, error) {
+	manager, err := NewSqlTableManager(dataDirectory)
+	if err != nil {
+		return nil, err
+	}
 	executor := NewSqlQueryExecutor(manager)
 	return &DataBase{
 		sqlTableManager:  manager,
 		sqlTableExecutor: executor,
-	}
+	}, nil
 }
 
-func (b *DataBase) Execute(sql string) (ExecuteResult, error) {
+// Execute 执行一条 SQL，任何错误都通过 error 返回，不会导致进程退出
+// 语法错误为 *SyntaxError，表不存在为 *UnknownTableError，主键重复为 *DuplicateKeyError，
+// 违反 UNIQUE 约束为 *UniqueConstraintError，磁盘读写失败为 *disktree.IOError
+func (b *DataBase) Execute(sql string) (result ExecuteResult, err error) {
+	// 读路径上的页面读取失败以 *disktree.IOError panic 的形式抛出，在这里转换为错误
+	defer func() {
+		if r := recover(); r != nil {
+			ioErr, ok := r.(*disktree.IOError)
+			if !ok {
+				panic(r)
+			}
+			result, err = ForError(ioErr.Error()), ioErr
+		}
+	}()
+
 	logger.Debug("start execute sql: %v \n", sql)
 	ASTNode, err := Parse(sql)
 	if err != nil {
-		log.Fatal(err)
+		return ForError(err.Error()), err
 	}
 	logger.Debug("finish parse sql to ASTNode")
 	switch Node := ASTNode.(type) {
 	case *SelectNode:
 		logger.Info("start execute select sql: %s \n", sql)
 		sqlTableDefinitions := make([]*SqlTableDefinition, 0)
-		result := b.sqlTableExecutor.processSelect(Node, sqlTableDefinitions)
-		return ForSelect(result, sqlTableDefinitions, &ASTNode), nil
+		resultSet, err := b.sqlTableExecutor.processSelect(Node, sqlTableDefinitions)
+		if err != nil {
+			return ForError(err.Error()), err
+		}
+		return ForSelect(resultSet, sqlTableDefinitions, &ASTNode), nil
 	case *InsertNode:
 		logger.Info("start execute insert sql: %s \n", sql)
 		sqlTableDefinitions := make([]*SqlTableDefinition, 0)
-		affectedrows := b.sqlTableExecutor.processInsert(Node, sqlTableDefinitions)
+		affectedrows, err := b.sqlTableExecutor.processInsert(Node, sqlTableDefinitions)
+		if err != nil {
+			return ForError(err.Error()), err
+		}
 		return ForInsert(affectedrows, sqlTableDefinitions), nil
 	case *UpdateNode:
-		logger.Info("start execute insert sql: %s \n", sql)
+		logger.Info("start execute update sql: %s \n", sql)
 		sqlTableDefinitions := make([]*SqlTableDefinition, 0)
-		result := b.sqlTableExecutor.processUpdate(Node, sqlTableDefinitions)
-		return ForUpdate(result, sqlTableDefinitions), nil
+		affectedRows, err := b.sqlTableExecutor.processUpdate(Node, sqlTableDefinitions)
+		if err != nil {
+			return ForError(err.Error()), err
+		}
+		return ForUpdate(affectedRows, sqlTableDefinitions), nil
+	case *DeleteNode:
+		logger.Info("start execute delete sql: %s \n", sql)
+		sqlTableDefinitions := make([]*SqlTableDefinition, 0)
+		affectedRows, err := b.sqlTableExecutor.processDelete(Node, sqlTableDefinitions)
+		if err != nil {
+			return ForError(err.Error()), err
+		}
+		return ForDelete(affectedRows, sqlTableDefinitions), nil
 	case *CreateTableNode:
 		logger.Info("start execute create sql: %s \n", sql)
 		sqlTableDefinitions := make([]*SqlTableDefinition, 0)
-		b.sqlTableExecutor.prcessCreateTable(Node, sqlTableDefinitions)
+		if _, err := b.sqlTableExecutor.prcessCreateTable(Node, sqlTableDefinitions); err != nil {
+			return ForError(err.Error()), err
+		}
 		return ForCreate(sqlTableDefinitions), nil
+	case *CreateIndexNode:
+		logger.Info("start execute create index sql: %s \n", sql)
+		indexed, err := b.sqlTableExecutor.processCreateIndex(Node)
+		if err != nil {
+			return ForError(err.Error()), err
+		}
+		return ForCreateIndex(indexed), nil
+	case *DropIndexNode:
+		logger.Info("start execute drop index sql: %s \n", sql)
+		if err := b.sqlTableExecutor.processDropIndex(Node); err != nil {
+			return ForError(err.Error()), err
+		}
+		return ForDropIndex(), nil
+	case *AnalyzeNode:
+		logger.Info("start execute analyze sql: %s \n", sql)
+		resultSet, err := b.sqlTableExecutor.processAnalyze(Node)
+		if err != nil {
+			return ForError(err.Error()), err
+		}
+		return ForAnalyze(resultSet), nil
+	case *ExplainNode:
+		logger.Info("start execute explain sql: %s \n", sql)
+		resultSet, err := b.sqlTableExecutor.processExplain(Node)
+		if err != nil {
+			return ForError(err.Error()), err
+		}
+		return ForExplain(resultSet), nil
 	default:
 		err := fmt.Errorf("Unknown node type: %T", ASTNode)
 		return ForError(err.Error()), err
 	}
 }
 
+// SetSortMemoryBudget 设置 ORDER BY 排序可使用的内存（字节），超出后排序结果写入数据目录下的临时文件
+func (b *DataBase) SetSortMemoryBudget(bytes int) {
+	b.sqlTableExecutor.SortMemoryBudget = bytes
+}
+
+// SetAggregateMemoryBudget 设置 GROUP BY 哈希聚合可使用的内存（字节），超出后新分组的输入写入数据目录下的分区文件
+func (b *DataBase) SetAggregateMemoryBudget(bytes int) {
+	b.sqlTableExecutor.AggregateMemoryBudget = bytes
+}
+
 func (b *DataBase) Close() {
 	b.sqlTableManager.Close()
 }
@@ -5,7 +5,14 @@ package database
 // @Create       david 2025-01-09 14:17
 // @Update       david 2025-01-09 14:17
 import (
+	"errors"
+	"fmt"
+	. "godb/entity"
 	"godb/logger"
+	"godb/sqlparser"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -14,7 +21,10 @@ func TestDatabase(t *testing.T) {
 	// 设置日志级别
 	logger.SetLevel(logger.INFO)
 	dir := "data"
-	base := NewDataBase(dir)
+	if err := resetDataDirectory(dir); err != nil {
+		t.Fatalf("Failed to reset data directory: %v", err)
+	}
+	base := openDataBase(t, dir)
 
 	logger.Info(":::start to test database......")
 	// 创建表
@@ -94,19 +104,19 @@ func TestDatabase(t *testing.T) {
 	}
 	logger.Info("Update verification result: %v", result)
 
-	//// 删除测试
-	//_, err = base.Execute("DELETE FROM users WHERE id = 5")
-	//if err != nil {
-	//	t.Fatalf("Failed to delete record: %v", err)
-	//}
-	//
-	//// 验证删除结果
-	//result, err = base.Execute("SELECT id, name FROM users WHERE id = 5")
-	//if err != nil {
-	//	t.Fatalf("Failed to verify deletion: %v", err)
-	//}
-	//logger.Info("Delete verification result: %v", result)
-	//
+	// 删除测试
+	_, err = base.Execute("DELETE FROM users WHERE id = 5")
+	if err != nil {
+		t.Fatalf("Failed to delete record: %v", err)
+	}
+
+	// 验证删除结果
+	result, err = base.Execute("SELECT id, name FROM users WHERE id = 5")
+	if err != nil {
+		t.Fatalf("Failed to verify deletion: %v", err)
+	}
+	logger.Info("Delete verification result: %v", result)
+
 	//// 聚合查询测试
 	//queries := []string{
 	//	"SELECT COUNT(*) FROM users",
@@ -124,3 +134,2228 @@ func TestDatabase(t *testing.T) {
 	//	logger.Info("Aggregate query result (%s): %v", query, result)
 	//}
 }
+
+func TestDatabaseDelete(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+
+	_, err := base.Execute("CREATE TABLE users (id INT PRIMARY KEY, name CHAR, age INT INDEX)")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	base.Execute("INSERT INTO users VALUES (1, 'Alice', 25)")
+	base.Execute("INSERT INTO users VALUES (2, 'Bob', 30)")
+	base.Execute("INSERT INTO users VALUES (3, 'Charlie', 35)")
+
+	result, err := base.Execute("DELETE FROM users WHERE id = 2")
+	if err != nil {
+		t.Fatalf("Failed to delete by primary key: %v", err)
+	}
+	if result.affectedRows != 1 {
+		t.Errorf("expected 1 affected row, got %d", result.affectedRows)
+	}
+
+	result, _ = base.Execute("SELECT id, name FROM users WHERE id = 2")
+	if result.resultSet.Len() != 0 {
+		t.Errorf("expected deleted row to be gone, got %v", result.resultSet)
+	}
+	result, _ = base.Execute("SELECT id, name FROM users WHERE age = 30")
+	if result.resultSet.Len() != 0 {
+		t.Errorf("expected secondary index entry to be gone, got %v", result.resultSet)
+	}
+
+	// 通过二级索引删除，附加条件不满足时不删除
+	result, err = base.Execute("DELETE FROM users WHERE age = 35 AND name = 'Alice'")
+	if err != nil {
+		t.Fatalf("Failed to delete by secondary index: %v", err)
+	}
+	if result.affectedRows != 0 {
+		t.Errorf("expected 0 affected rows, got %d", result.affectedRows)
+	}
+	result, err = base.Execute("DELETE FROM users WHERE age = 35")
+	if err != nil {
+		t.Fatalf("Failed to delete by secondary index: %v", err)
+	}
+	if result.affectedRows != 1 {
+		t.Errorf("expected 1 affected row, got %d", result.affectedRows)
+	}
+
+	result, _ = base.Execute("SELECT id, name FROM users WHERE id = 1")
+	if result.resultSet.Value(0, "name") != "Alice" {
+		t.Errorf("expected remaining row to be untouched, got %v", result.resultSet)
+	}
+
+	// 没有 WHERE 条件时删除所有行
+	base.Execute("INSERT INTO users VALUES (4, 'Dave', 40)")
+	result, err = base.Execute("DELETE FROM users")
+	if err != nil {
+		t.Fatalf("Failed to delete all rows: %v", err)
+	}
+	if result.affectedRows != 2 {
+		t.Errorf("expected 2 affected rows, got %d", result.affectedRows)
+	}
+	result, _ = base.Execute("SELECT id FROM users")
+	if result.resultSet.Len() != 0 {
+		t.Errorf("expected empty table, got %v", result.resultSet)
+	}
+	result, _ = base.Execute("SELECT id FROM users WHERE age = 40")
+	if result.resultSet.Len() != 0 {
+		t.Errorf("expected secondary index to be empty, got %v", result.resultSet)
+	}
+}
+
+func TestDatabaseRangeSelect(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+
+	_, err := base.Execute("CREATE TABLE users (id INT PRIMARY KEY, name CHAR, age INT INDEX, score INT)")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	base.Execute("INSERT INTO users VALUES (1, 'Alice', 25, 90)")
+	base.Execute("INSERT INTO users VALUES (2, 'Bob', 30, 85)")
+	base.Execute("INSERT INTO users VALUES (3, 'Charlie', 35, 70)")
+
+	tests := []struct {
+		sql  string
+		name string
+	}{
+		// 主键区间
+		{"SELECT id, name FROM users WHERE id > 2", "Charlie"},
+		{"SELECT id, name FROM users WHERE id BETWEEN 2 AND 2", "Bob"},
+		{"SELECT id, name FROM users WHERE id >= 1 AND id < 2", "Alice"},
+		// 二级索引区间
+		{"SELECT id, name FROM users WHERE age >= 26 AND age <= 30", "Bob"},
+		{"SELECT id, name FROM users WHERE age < 30", "Alice"},
+		// 区间命中后再过滤其他条件
+		{"SELECT id, name FROM users WHERE age > 20 AND name != 'Alice' AND score < 80", "Charlie"},
+		// 没有索引条件时全表扫描
+		{"SELECT id, name FROM users WHERE score <= 85 AND score <> 70", "Bob"},
+	}
+	for _, tt := range tests {
+		result, err := base.Execute(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		if result.resultSet.Len() != 1 || result.resultSet.Value(0, "name") != tt.name {
+			t.Errorf("%s: expected %s, got %v", tt.sql, tt.name, result.resultSet)
+		}
+	}
+
+	result, _ := base.Execute("SELECT id, name FROM users WHERE id < 0")
+	if result.resultSet.Len() != 0 {
+		t.Errorf("expected empty result, got %v", result.resultSet)
+	}
+}
+
+func TestDatabaseBooleanWhere(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+
+	_, err := base.Execute("CREATE TABLE users (id INT PRIMARY KEY, name CHAR, age INT INDEX)")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	base.Execute("INSERT INTO users VALUES (1, 'Alice', 25)")
+	base.Execute("INSERT INTO users VALUES (2, 'Bob', 30)")
+	base.Execute("INSERT INTO users VALUES (3, 'Charlie', 35)")
+
+	tests := []struct {
+		sql  string
+		name string
+	}{
+		{"SELECT id, name FROM users WHERE id > 1 AND (name = 'Alice' OR age = 35)", "Charlie"},
+		{"SELECT id, name FROM users WHERE NOT age >= 30", "Alice"},
+		{"SELECT id, name FROM users WHERE age < 35 AND NOT (id = 1 OR name = 'Charlie')", "Bob"},
+		{"SELECT id, name FROM users WHERE id = 2 OR id = 9", "Bob"},
+	}
+	for _, tt := range tests {
+		result, err := base.Execute(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		if result.resultSet.Len() != 1 || result.resultSet.Value(0, "name") != tt.name {
+			t.Errorf("%s: expected %s, got %v", tt.sql, tt.name, result.resultSet)
+		}
+	}
+
+	result, err := base.Execute("DELETE FROM users WHERE age = 25 OR name = 'Charlie'")
+	if err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if result.affectedRows != 2 {
+		t.Errorf("expected 2 affected rows, got %d", result.affectedRows)
+	}
+
+	// 无法计算的条件返回错误，而不是让所有行都满足
+	age := NewColumnNode("", "age", PLAIN_STRING)
+	rows := []map[string]interface{}{{"id": uint32(1), "age": uint32(25)}, {"id": uint32(2), "age": uint32(30)}}
+	unsupported := []ASTNode{
+		NewUnaryOpNode(AND, NewBinaryOpNode(EQUALS, age, NewLiteralNode(uint32(25)))),
+		NewBinaryOpNode(EQUALS, age, NewSelectNode("users", nil, nil, nil, nil)),
+		NewBinaryOpNode(BETWEEN, age, NewLiteralNode(uint32(25))),
+		NewBinaryOpNode(IN, age, NewLiteralNode(uint32(25))),
+		NewLiteralNode(uint32(1)),
+	}
+	for _, predicate := range unsupported {
+		matched, err := drain(newFilterOperator(newValuesOperator(rows), predicate))
+		if err == nil || len(matched) != 0 {
+			t.Errorf("%v: expected an error and no rows, got %v, %v", predicate, matched, err)
+		}
+	}
+}
+
+func TestDatabaseErrors(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+
+	_, err := base.Execute("CREATE TABLE users (id INT PRIMARY KEY, name CHAR, age INT INDEX)")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	base.Execute("INSERT INTO users VALUES (1, 'Alice', 25)")
+
+	var syntaxError *sqlparser.SyntaxError
+	if _, err := base.Execute("SELEC id FROM users"); !errors.As(err, &syntaxError) {
+		t.Errorf("expected syntax error, got %v", err)
+	}
+	if _, err := base.Execute("INSERT INTO users VALUES (2, 'Bob', 30"); !errors.As(err, &syntaxError) {
+		t.Errorf("expected syntax error, got %v", err)
+	}
+
+	var unknownTable *UnknownTableError
+	if _, err := base.Execute("SELECT id FROM orders WHERE id = 1"); !errors.As(err, &unknownTable) {
+		t.Errorf("expected unknown table error, got %v", err)
+	}
+	if _, err := base.Execute("INSERT INTO orders VALUES (1)"); !errors.As(err, &unknownTable) {
+		t.Errorf("expected unknown table error, got %v", err)
+	}
+
+	var duplicateKey *DuplicateKeyError
+	if _, err := base.Execute("INSERT INTO users VALUES (1, 'Bob', 30)"); !errors.As(err, &duplicateKey) {
+		t.Errorf("expected duplicate key error, got %v", err)
+	} else if duplicateKey.Key != uint32(1) || duplicateKey.ColumnName != "id" {
+		t.Errorf("unexpected duplicate key error: %v", duplicateKey)
+	}
+
+	if _, err := base.Execute("INSERT INTO users VALUES (2, 'Bob')"); err == nil {
+		t.Errorf("expected error for value count mismatch")
+	}
+	if _, err := base.Execute("INSERT INTO users VALUES ('x', 'Bob', 30)"); err == nil {
+		t.Errorf("expected error for value type mismatch")
+	}
+	if _, err := base.Execute("CREATE TABLE users (id INT PRIMARY KEY)"); err == nil {
+		t.Errorf("expected error for existing table")
+	}
+
+	// WHERE 中不存在的列是错误，而不是没有匹配的行
+	for _, sql := range []string{
+		"SELECT id FROM users WHERE missing = 1",
+		"UPDATE users SET age = 26 WHERE missing = 1 OR id = 1",
+		"DELETE FROM users WHERE missing = 1 OR id = 1",
+	} {
+		if _, err := base.Execute(sql); err == nil || !strings.Contains(err.Error(), "unknown column missing") {
+			t.Errorf("%s: expected unknown column error, got %v", sql, err)
+		}
+	}
+
+	// 出错之后数据库仍可继续使用
+	result, err := base.Execute("SELECT id, name FROM users WHERE id = 1")
+	if err != nil {
+		t.Fatalf("Failed to select after errors: %v", err)
+	}
+	if result.resultSet.Value(0, "name") != "Alice" {
+		t.Errorf("expected Alice, got %v", result.resultSet)
+	}
+
+	// 打开数据目录失败时返回错误，不会导致进程退出
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDataBase(dir); err == nil {
+		t.Errorf("expected error for broken table definition")
+	}
+	if _, err := NewDataBase(filepath.Join(dir, "broken.json", "data")); err == nil {
+		t.Errorf("expected error for data directory that can't be created")
+	}
+}
+
+// openDataBase 打开 dir 下的数据库，失败时结束测试
+func openDataBase(t *testing.T, dir string) *DataBase {
+	t.Helper()
+	base, err := NewDataBase(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	return base
+}
+
+func TestDatabaseMultiRowSelect(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+
+	_, err := base.Execute("CREATE TABLE users (id INT PRIMARY KEY, name CHAR, age INT INDEX)")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	base.Execute("INSERT INTO users VALUES (1, 'Alice', 25)")
+	base.Execute("INSERT INTO users VALUES (2, 'Bob', 30)")
+	base.Execute("INSERT INTO users VALUES (3, 'Charlie', 25)")
+
+	// 列的顺序与 SELECT 列表一致
+	result, err := base.Execute("SELECT name, id FROM users WHERE id >= 2")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	resultSet := result.resultSet
+	if !slices.Equal(resultSet.Columns, []string{"name", "id"}) {
+		t.Errorf("unexpected columns: %v", resultSet.Columns)
+	}
+	if resultSet.Len() != 2 {
+		t.Fatalf("expected 2 rows, got %v", resultSet)
+	}
+	if resultSet.Value(0, "name") != "Bob" || resultSet.Value(1, "id") != uint32(3) {
+		t.Errorf("unexpected rows: %v", resultSet)
+	}
+
+	// SELECT * 按表定义的列顺序输出所有行
+	result, err = base.Execute("SELECT * FROM users WHERE id >= 1")
+	if err != nil {
+		t.Fatalf("Failed to select: %v", err)
+	}
+	resultSet = result.resultSet
+	if !slices.Equal(resultSet.Columns, []string{"id", "name", "age"}) {
+		t.Errorf("unexpected columns: %v", resultSet.Columns)
+	}
+	if resultSet.Len() != 3 || resultSet.Value(2, "name") != "Charlie" {
+		t.Errorf("unexpected rows: %v", resultSet)
+	}
+
+	if _, err := base.Execute("SELECT email FROM users WHERE id = 1"); err == nil {
+		t.Errorf("expected error for unknown column")
+	}
+}
+
+func TestResultSetString(t *testing.T) {
+	resultSet := NewResultSet([]string{"id", "name"})
+	resultSet.AddRow(map[string]interface{}{"id": uint32(1), "name": "Alice"})
+	resultSet.AddRow(map[string]interface{}{"id": uint32(12), "name": "Bob"})
+
+	expected := "+----+-------+\n" +
+		"| id | name  |\n" +
+		"+----+-------+\n" +
+		"| 1  | Alice |\n" +
+		"| 12 | Bob   |\n" +
+		"+----+-------+\n"
+	if resultSet.String() != expected {
+		t.Errorf("unexpected table:\n%s", resultSet.String())
+	}
+
+	result := ForSelect(resultSet, nil, nil)
+	if !strings.HasSuffix(result.String(), "2 row(s) in set\n") {
+		t.Errorf("unexpected select result:\n%s", result.String())
+	}
+	if ForSelect(NewResultSet([]string{"id"}), nil, nil).String() != "Empty set" {
+		t.Errorf("expected empty set")
+	}
+}
+
+func TestDatabaseFullTableScan(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+
+	_, err := base.Execute("CREATE TABLE users (id INT PRIMARY KEY, name CHAR, age INT INDEX)")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	// 空表
+	result, err := base.Execute("SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("Failed to scan empty table: %v", err)
+	}
+	if result.resultSet.Len() != 0 {
+		t.Errorf("expected empty result, got %v", result.resultSet)
+	}
+
+	for i, name := range []string{"Alice", "Bob", "Charlie", "David", "Eve"} {
+		base.Execute(fmt.Sprintf("INSERT INTO users VALUES (%d, '%s', %d)", i+1, name, 20+i))
+	}
+
+	// 没有 WHERE 时按主键顺序返回所有行
+	result, err = base.Execute("SELECT * FROM users")
+	if err != nil {
+		t.Fatalf("Failed to select all: %v", err)
+	}
+	if result.resultSet.Len() != 5 || result.resultSet.Value(4, "name") != "Eve" {
+		t.Errorf("unexpected rows: %v", result.resultSet)
+	}
+
+	tests := []struct {
+		sql   string
+		names []interface{}
+	}{
+		// 非索引的 CHAR 列
+		{"SELECT name FROM users WHERE name = 'Charlie'", []interface{}{"Charlie"}},
+		{"SELECT name FROM users WHERE name > 'Bob' AND name < 'Eve'", []interface{}{"Charlie", "David"}},
+		{"SELECT name FROM users WHERE name = 'Alice' OR age = 24", []interface{}{"Alice", "Eve"}},
+		{"SELECT name FROM users WHERE NOT name = 'Bob'", []interface{}{"Alice", "Charlie", "David", "Eve"}},
+		{"SELECT name FROM users WHERE name = 'Nobody'", []interface{}{}},
+	}
+	for _, tt := range tests {
+		result, err := base.Execute(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		names := make([]interface{}, 0)
+		for i := 0; i < result.resultSet.Len(); i++ {
+			names = append(names, result.resultSet.Value(i, "name"))
+		}
+		if !slices.Equal(names, tt.names) {
+			t.Errorf("%s: expected %v, got %v", tt.sql, tt.names, names)
+		}
+	}
+}
+
+func TestDatabaseOrderBy(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	base := openDataBase(t, dir)
+
+	_, err := base.Execute("CREATE TABLE users (id INT PRIMARY KEY, name CHAR, age INT INDEX)")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	base.Execute("INSERT INTO users VALUES (1, 'Charlie', 30)")
+	base.Execute("INSERT INTO users VALUES (2, 'Alice', 20)")
+	base.Execute("INSERT INTO users VALUES (3, 'Eve', 50)")
+	base.Execute("INSERT INTO users VALUES (4, 'Bob', 40)")
+	base.Execute("INSERT INTO users VALUES (5, 'David', 10)")
+
+	tests := []struct {
+		sql string
+		ids []interface{}
+	}{
+		// 主键顺序直接满足
+		{"SELECT id FROM users ORDER BY id", []interface{}{uint32(1), uint32(2), uint32(3), uint32(4), uint32(5)}},
+		{"SELECT id FROM users WHERE id >= 2 ORDER BY id DESC, name", []interface{}{uint32(5), uint32(4), uint32(3), uint32(2)}},
+		// 二级索引区间扫描的顺序直接满足
+		{"SELECT id FROM users WHERE age BETWEEN 15 AND 45 ORDER BY age DESC", []interface{}{uint32(4), uint32(1), uint32(2)}},
+		// 需要排序
+		{"SELECT id FROM users ORDER BY name", []interface{}{uint32(2), uint32(4), uint32(1), uint32(5), uint32(3)}},
+		{"SELECT id FROM users WHERE id < 5 ORDER BY age DESC", []interface{}{uint32(3), uint32(4), uint32(1), uint32(2)}},
+	}
+	check := func() {
+		for _, tt := range tests {
+			result, err := base.Execute(tt.sql)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.sql, err)
+			}
+			ids := make([]interface{}, 0)
+			for i := 0; i < result.resultSet.Len(); i++ {
+				ids = append(ids, result.resultSet.Value(i, "id"))
+			}
+			if !slices.Equal(ids, tt.ids) {
+				t.Errorf("%s: expected %v, got %v", tt.sql, tt.ids, ids)
+			}
+		}
+	}
+	check()
+
+	// 降序直接反向扫描索引，投影下面就是索引扫描，没有缓存行的算子
+	for _, sql := range []string{
+		"SELECT id FROM users WHERE age BETWEEN 15 AND 45 ORDER BY age DESC",
+		"SELECT id FROM users WHERE id >= 2 ORDER BY id DESC, name",
+	} {
+		node, err := sqlparser.Parse(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		plan, _, err := base.sqlTableExecutor.buildPlan(node.(*SelectNode))
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		var scan operator = plan.(*projectOperator).child
+		if filter, ok := scan.(*filterOperator); ok {
+			scan = filter.child
+		}
+		if scanner, ok := scan.(*indexScanOperator); !ok || !scanner.scan.descending {
+			t.Errorf("%s: expected a descending index scan, got %T", sql, scan)
+		}
+	}
+
+	// 内存预算很小时每一行都会写入临时文件，结果不变，临时文件在查询结束后删除
+	base.SetSortMemoryBudget(1)
+	check()
+	tmpFiles, _ := filepath.Glob(filepath.Join(dir, "sort-*.tmp"))
+	if len(tmpFiles) != 0 {
+		t.Errorf("expected sort runs to be removed, got %v", tmpFiles)
+	}
+
+	if _, err := base.Execute("SELECT id FROM users ORDER BY email"); err == nil {
+		t.Errorf("expected error for unknown order by column")
+	}
+}
+
+func TestDatabaseLimit(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+
+	_, err := base.Execute("CREATE TABLE users (id INT PRIMARY KEY, name CHAR, age INT INDEX)")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i := 1; i <= 20; i++ {
+		base.Execute(fmt.Sprintf("INSERT INTO users VALUES (%d, 'user%02d', %d)", i, 21-i, 100+i))
+	}
+
+	tests := []struct {
+		sql string
+		ids []interface{}
+	}{
+		{"SELECT id FROM users LIMIT 3", []interface{}{uint32(1), uint32(2), uint32(3)}},
+		{"SELECT id FROM users LIMIT 2 OFFSET 5", []interface{}{uint32(6), uint32(7)}},
+		{"SELECT id FROM users WHERE id > 15 LIMIT 10", []interface{}{uint32(16), uint32(17), uint32(18), uint32(19), uint32(20)}},
+		{"SELECT id FROM users WHERE age >= 110 LIMIT 2 OFFSET 1", []interface{}{uint32(11), uint32(12)}},
+		{"SELECT id FROM users ORDER BY id DESC LIMIT 2", []interface{}{uint32(20), uint32(19)}},
+		{"SELECT id FROM users ORDER BY name LIMIT 2 OFFSET 1", []interface{}{uint32(19), uint32(18)}},
+		{"SELECT id FROM users LIMIT 0", []interface{}{}},
+		{"SELECT id FROM users LIMIT 5 OFFSET 30", []interface{}{}},
+	}
+	for _, tt := range tests {
+		result, err := base.Execute(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		ids := make([]interface{}, 0)
+		for i := 0; i < result.resultSet.Len(); i++ {
+			ids = append(ids, result.resultSet.Value(i, "id"))
+		}
+		if !slices.Equal(ids, tt.ids) {
+			t.Errorf("%s: expected %v, got %v", tt.sql, tt.ids, ids)
+		}
+	}
+
+	// LIMIT 取够行数后扫描不再继续读取
+	executor := base.sqlTableExecutor
+	definition := executor.SqlTableManager.getTableDefinition("users")
+	scanner := newTableScanOperator(executor.SqlTableManager.tablePrimaryIndex["users"], definition)
+	limit := newLimitOperator(scanner, NewLimitNode(4, 1))
+	rows, err := drain(limit)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if len(rows) != 4 || rows[0]["id"] != uint32(2) {
+		t.Errorf("expected 4 rows starting at id 2, got %v", rows)
+	}
+	if scanner.scanned != 5 {
+		t.Errorf("expected scan to stop after 5 rows, got %d", scanner.scanned)
+	}
+
+	// 执行之后 EXPLAIN 仍显示配置的 OFFSET，再次打开时重新跳过同样的行数
+	if detail := limit.explain().detail; detail != "LIMIT 4 OFFSET 1" {
+		t.Errorf("expected LIMIT 4 OFFSET 1 after execution, got %s", detail)
+	}
+	rows, err = drain(limit)
+	if err != nil || len(rows) != 4 || rows[0]["id"] != uint32(2) {
+		t.Errorf("expected 4 rows starting at id 2 after reopening, got %v, %v", rows, err)
+	}
+
+	// ORDER BY id DESC LIMIT 反向扫描主键索引，同样取够行数后停止
+	node, err := sqlparser.Parse("SELECT id FROM users ORDER BY id DESC LIMIT 2 OFFSET 1")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	plan, _, err := executor.buildPlan(node.(*SelectNode))
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	scanner, ok := plan.(*projectOperator).child.(*limitOperator).child.(*tableScanOperator)
+	if !ok || !scanner.descending {
+		t.Fatalf("expected a descending table scan under the limit")
+	}
+	rows, err = drain(plan)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["id"] != uint32(19) || rows[1]["id"] != uint32(18) {
+		t.Errorf("expected ids 19 and 18, got %v", rows)
+	}
+	if scanner.scanned != 3 {
+		t.Errorf("expected descending scan to stop after 3 rows, got %d", scanner.scanned)
+	}
+}
+
+func TestDatabaseJoin(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+
+	creates := []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name CHAR, dept_id INT)",
+		"CREATE TABLE depts (id INT PRIMARY KEY, title CHAR, floor INT INDEX)",
+		"CREATE TABLE orders (order_id INT PRIMARY KEY, user_id INT INDEX, amount INT)",
+		"CREATE TABLE buildings (code INT PRIMARY KEY, level INT, city CHAR)",
+	}
+	inserts := []string{
+		"INSERT INTO users VALUES (1, 'Alice', 10)",
+		"INSERT INTO users VALUES (2, 'Bob', 20)",
+		"INSERT INTO users VALUES (3, 'Charlie', 10)",
+		"INSERT INTO users VALUES (4, 'David', 99)",
+		"INSERT INTO depts VALUES (10, 'Sales', 1)",
+		"INSERT INTO depts VALUES (20, 'Dev', 2)",
+		"INSERT INTO orders VALUES (100, 1, 50)",
+		"INSERT INTO orders VALUES (101, 3, 70)",
+		"INSERT INTO orders VALUES (102, 2, 20)",
+		"INSERT INTO buildings VALUES (7, 1, 'Paris')",
+		"INSERT INTO buildings VALUES (8, 2, 'Tokyo')",
+	}
+	for _, sql := range append(creates, inserts...) {
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql     string
+		columns []string
+		rows    [][]interface{}
+	}{
+		// 内表主键上的索引嵌套循环
+		{
+			"SELECT users.name, depts.title FROM users JOIN depts ON users.dept_id = depts.id",
+			[]string{"users.name", "depts.title"},
+			[][]interface{}{{"Alice", "Sales"}, {"Bob", "Dev"}, {"Charlie", "Sales"}},
+		},
+		// 内表二级索引上的索引嵌套循环，条件两侧顺序颠倒，不带前缀的唯一列名
+		{
+			"SELECT name, amount FROM users JOIN orders ON orders.user_id = users.id WHERE amount > 30",
+			[]string{"name", "amount"},
+			[][]interface{}{{"Alice", uint32(50)}, {"Charlie", uint32(70)}},
+		},
+		// 非索引列上的块嵌套循环，多表连接
+		{
+			"SELECT users.name, buildings.city FROM users JOIN depts ON users.dept_id = depts.id JOIN buildings ON depts.floor = buildings.level WHERE users.id <= 2",
+			[]string{"users.name", "buildings.city"},
+			[][]interface{}{{"Alice", "Paris"}, {"Bob", "Tokyo"}},
+		},
+		// 排序和 LIMIT
+		{
+			"SELECT users.name, orders.amount FROM orders JOIN users ON orders.user_id = users.id ORDER BY orders.amount DESC LIMIT 2",
+			[]string{"users.name", "orders.amount"},
+			[][]interface{}{{"Charlie", uint32(70)}, {"Alice", uint32(50)}},
+		},
+		// SELECT * 展开为 table.column
+		{
+			"SELECT * FROM depts JOIN buildings ON depts.floor = buildings.level WHERE depts.id = 20",
+			[]string{"depts.id", "depts.title", "depts.floor", "buildings.code", "buildings.level", "buildings.city"},
+			[][]interface{}{{uint32(20), "Dev", uint32(2), uint32(8), uint32(2), "Tokyo"}},
+		},
+	}
+	for _, tt := range tests {
+		result, err := base.Execute(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		if !slices.Equal(result.resultSet.Columns, tt.columns) {
+			t.Errorf("%s: expected columns %v, got %v", tt.sql, tt.columns, result.resultSet.Columns)
+		}
+		if len(result.resultSet.Rows) != len(tt.rows) {
+			t.Errorf("%s: expected %v, got\n%v", tt.sql, tt.rows, result.resultSet)
+			continue
+		}
+		for i, row := range tt.rows {
+			if !slices.Equal(result.resultSet.Rows[i], row) {
+				t.Errorf("%s: row %d expected %v, got %v", tt.sql, i, row, result.resultSet.Rows[i])
+			}
+		}
+	}
+
+	errorCases := []string{
+		"SELECT id FROM users JOIN depts ON users.dept_id = depts.id",
+		"SELECT users.name FROM users JOIN teams ON users.dept_id = teams.id",
+		"SELECT users.email FROM users JOIN depts ON users.dept_id = depts.id",
+		"SELECT users.name FROM users JOIN users ON users.id = users.id",
+	}
+	for _, sql := range errorCases {
+		if _, err := base.Execute(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+}
+
+func TestDatabaseOuterJoin(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+
+	statements := []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name CHAR, dept_id INT)",
+		"CREATE TABLE depts (id INT PRIMARY KEY, title CHAR, floor INT)",
+		"CREATE TABLE colors (code INT PRIMARY KEY, color CHAR)",
+		"INSERT INTO users VALUES (1, 'Alice', 10)",
+		"INSERT INTO users VALUES (2, 'Bob', 99)",
+		"INSERT INTO users VALUES (3, 'Charlie', 20)",
+		"INSERT INTO depts VALUES (10, 'Sales', 1)",
+		"INSERT INTO depts VALUES (20, 'Dev', 2)",
+		"INSERT INTO depts VALUES (30, 'Ops', 3)",
+		"INSERT INTO colors VALUES (1, 'red')",
+		"INSERT INTO colors VALUES (2, 'blue')",
+	}
+	for _, sql := range statements {
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql  string
+		rows [][]interface{}
+	}{
+		// 没有匹配的外侧行补 NULL
+		{
+			"SELECT users.name, depts.title FROM users LEFT JOIN depts ON users.dept_id = depts.id",
+			[][]interface{}{{"Alice", "Sales"}, {"Bob", nil}, {"Charlie", "Dev"}},
+		},
+		// ON 中的附加条件只影响匹配，不过滤外侧行；块嵌套循环
+		{
+			"SELECT users.name, depts.title FROM users LEFT OUTER JOIN depts ON users.dept_id = depts.id AND depts.floor > 1",
+			[][]interface{}{{"Alice", nil}, {"Bob", nil}, {"Charlie", "Dev"}},
+		},
+		// WHERE 中 NOT 条件作用在 NULL 上结果为 unknown，补 NULL 的行被过滤
+		{
+			"SELECT users.name, depts.title FROM users LEFT JOIN depts ON users.dept_id = depts.id WHERE NOT depts.title = 'Sales'",
+			[][]interface{}{{"Charlie", "Dev"}},
+		},
+		// 内表没有匹配的行补 NULL 后输出
+		{
+			"SELECT users.name, depts.title FROM users RIGHT JOIN depts ON users.dept_id = depts.id",
+			[][]interface{}{{"Alice", "Sales"}, {"Charlie", "Dev"}, {nil, "Ops"}},
+		},
+		{
+			"SELECT users.name, depts.title FROM users RIGHT OUTER JOIN depts ON users.dept_id = depts.id WHERE depts.floor >= 2",
+			[][]interface{}{{"Charlie", "Dev"}, {nil, "Ops"}},
+		},
+		// 笛卡尔积
+		{
+			"SELECT depts.title, colors.color FROM depts CROSS JOIN colors WHERE depts.id <= 20",
+			[][]interface{}{{"Sales", "red"}, {"Sales", "blue"}, {"Dev", "red"}, {"Dev", "blue"}},
+		},
+		// 补 NULL 的行参与排序，NULL 排在最前
+		{
+			"SELECT users.name, depts.title FROM users LEFT JOIN depts ON users.dept_id = depts.id ORDER BY depts.title",
+			[][]interface{}{{"Bob", nil}, {"Charlie", "Dev"}, {"Alice", "Sales"}},
+		},
+	}
+	for _, tt := range tests {
+		result, err := base.Execute(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		if len(result.resultSet.Rows) != len(tt.rows) {
+			t.Errorf("%s: expected %v, got\n%v", tt.sql, tt.rows, result.resultSet)
+			continue
+		}
+		for i, row := range tt.rows {
+			if !slices.Equal(result.resultSet.Rows[i], row) {
+				t.Errorf("%s: row %d expected %v, got %v", tt.sql, i, row, result.resultSet.Rows[i])
+			}
+		}
+	}
+
+	result, _ := base.Execute("SELECT users.name, depts.title FROM users LEFT JOIN depts ON users.dept_id = depts.id")
+	if !strings.Contains(result.String(), "| Bob        | NULL        |") {
+		t.Errorf("expected NULL in output:\n%s", result.String())
+	}
+}
+
+func TestDatabaseAggregate(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+
+	creates := []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name CHAR, age INT INDEX)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)",
+		"CREATE TABLE empty (id INT PRIMARY KEY, age INT)",
+	}
+	for _, sql := range creates {
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	for i := 1; i <= 10; i++ {
+		base.Execute(fmt.Sprintf("INSERT INTO users VALUES (%d, 'user%02d', %d)", i*3, i, 20+i))
+	}
+	inserts := []string{
+		"INSERT INTO orders VALUES (1, 3, 100)",
+		"INSERT INTO orders VALUES (2, 3, 50)",
+		"INSERT INTO orders VALUES (3, 6, 25)",
+	}
+	for _, sql := range inserts {
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql    string
+		values map[string]interface{}
+	}{
+		{"SELECT COUNT(*), MIN(id), MAX(id) FROM users", map[string]interface{}{
+			"COUNT(*)": uint32(10), "MIN(id)": uint32(3), "MAX(id)": uint32(30)}},
+		{"SELECT COUNT(id), SUM(age), AVG(age) FROM users", map[string]interface{}{
+			"COUNT(id)": uint32(10), "SUM(age)": uint64(255), "AVG(age)": 25.5}},
+		{"SELECT MIN(name), MAX(name), MIN(age) FROM users WHERE age > 25", map[string]interface{}{
+			"MIN(name)": "user06", "MAX(name)": "user10", "MIN(age)": uint32(26)}},
+		{"SELECT COUNT(*) FROM users WHERE id BETWEEN 4 AND 12", map[string]interface{}{
+			"COUNT(*)": uint32(3)}},
+		{"SELECT COUNT(*), SUM(orders.amount) FROM users JOIN orders ON users.id = orders.user_id", map[string]interface{}{
+			"COUNT(*)": uint32(3), "SUM(orders.amount)": uint64(175)}},
+		{"SELECT COUNT(*), MAX(id), SUM(age), AVG(age) FROM empty", map[string]interface{}{
+			"COUNT(*)": uint32(0), "MAX(id)": nil, "SUM(age)": nil, "AVG(age)": nil}},
+		{"SELECT COUNT(*) FROM users WHERE age > 100", map[string]interface{}{
+			"COUNT(*)": uint32(0)}},
+	}
+	for _, tt := range tests {
+		result, err := base.Execute(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		if result.resultSet.Len() != 1 {
+			t.Fatalf("%s: expected 1 row, got %d", tt.sql, result.resultSet.Len())
+		}
+		for column, expected := range tt.values {
+			if got := result.resultSet.Value(0, column); got != expected {
+				t.Errorf("%s: expected %s = %v, got %v (%T)", tt.sql, column, expected, got, got)
+			}
+		}
+	}
+
+	// 快速路径的结果与逐行聚合一致
+	executor := base.sqlTableExecutor
+	node := &SelectNode{
+		TableName: "users",
+		Columns: []*ColumnNode{
+			NewFunctionColumnNode("COUNT", NewColumnNode("*", "", WILDCARDN)),
+			NewFunctionColumnNode("MAX", NewColumnNode("", "id", PLAIN_STRING)),
+		},
+	}
+	plan, _, err := executor.buildPlan(node)
+	if err != nil {
+		t.Fatalf("Failed to build plan: %v", err)
+	}
+	if _, ok := plan.(*projectOperator).child.(*indexAggregateOperator); !ok {
+		t.Fatalf("expected aggregate from index, got %T", plan.(*projectOperator).child)
+	}
+	rows, err := drain(plan)
+	if err != nil {
+		t.Fatalf("Failed to aggregate from index: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["COUNT(*)"] != uint32(10) || rows[0]["MAX(id)"] != uint32(30) {
+		t.Errorf("unexpected index aggregate %v", rows)
+	}
+	node.Columns = append(node.Columns, NewFunctionColumnNode("MAX", NewColumnNode("", "age", PLAIN_STRING)))
+	if plan, _, err = executor.buildPlan(node); err != nil {
+		t.Fatalf("Failed to build plan: %v", err)
+	}
+	if _, ok := plan.(*projectOperator).child.(*aggregateOperator); !ok {
+		t.Errorf("MAX on non primary key column should not use the index fast path, got %T", plan.(*projectOperator).child)
+	}
+
+	errorTests := []string{
+		"SELECT name, COUNT(*) FROM users",
+		"SELECT SUM(name) FROM users",
+		"SELECT COUNT(salary) FROM users",
+		"SELECT COUNT(*) FROM users ORDER BY age",
+	}
+	for _, sql := range errorTests {
+		if _, err := base.Execute(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+}
+
+func TestDatabaseGroupBy(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	base := openDataBase(t, dir)
+
+	creates := []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name CHAR, dept CHAR, age INT)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)",
+		"CREATE TABLE empty (id INT PRIMARY KEY, dept CHAR)",
+	}
+	for _, sql := range creates {
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	inserts := []string{
+		"INSERT INTO users VALUES (1, 'alice', 'dev', 30)",
+		"INSERT INTO users VALUES (2, 'bob', 'dev', 40)",
+		"INSERT INTO users VALUES (3, 'carol', 'ops', 25)",
+		"INSERT INTO users VALUES (4, 'dave', 'dev', 35)",
+		"INSERT INTO users VALUES (5, 'erin', 'sales', 50)",
+		"INSERT INTO users VALUES (6, 'frank', 'ops', 45)",
+		"INSERT INTO orders VALUES (1, 1, 100)",
+		"INSERT INTO orders VALUES (2, 1, 20)",
+		"INSERT INTO orders VALUES (3, 3, 70)",
+		"INSERT INTO orders VALUES (4, 5, 10)",
+	}
+	for _, sql := range inserts {
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql  string
+		rows [][]interface{}
+	}{
+		{"SELECT dept, COUNT(*), SUM(age) FROM users GROUP BY dept ORDER BY dept", [][]interface{}{
+			{"dev", uint32(3), uint64(105)},
+			{"ops", uint32(2), uint64(70)},
+			{"sales", uint32(1), uint64(50)},
+		}},
+		{"SELECT dept, MAX(age) FROM users GROUP BY dept HAVING COUNT(*) >= 2 ORDER BY dept", [][]interface{}{
+			{"dev", uint32(40)},
+			{"ops", uint32(45)},
+		}},
+		{"SELECT dept FROM users GROUP BY dept HAVING AVG(age) > 35 ORDER BY dept DESC", [][]interface{}{
+			{"sales"},
+		}},
+		{"SELECT dept, COUNT(*) FROM users WHERE age < 45 GROUP BY dept ORDER BY COUNT(*) DESC LIMIT 1", [][]interface{}{
+			{"dev", uint32(3)},
+		}},
+		{"SELECT users.name, SUM(orders.amount) FROM users JOIN orders ON users.id = orders.user_id GROUP BY users.name ORDER BY name", [][]interface{}{
+			{"alice", uint64(120)},
+			{"carol", uint64(70)},
+			{"erin", uint64(10)},
+		}},
+		{"SELECT dept, COUNT(orders.id) FROM users LEFT JOIN orders ON users.id = orders.user_id GROUP BY users.dept ORDER BY dept", [][]interface{}{
+			{"dev", uint32(2)},
+			{"ops", uint32(1)},
+			{"sales", uint32(1)},
+		}},
+		{"SELECT orders.user_id, COUNT(*) FROM users LEFT JOIN orders ON users.id = orders.user_id GROUP BY orders.user_id ORDER BY orders.user_id", [][]interface{}{
+			{nil, uint32(3)},
+			{uint32(1), uint32(2)},
+			{uint32(3), uint32(1)},
+			{uint32(5), uint32(1)},
+		}},
+		{"SELECT dept, COUNT(*) FROM empty GROUP BY dept", [][]interface{}{}},
+	}
+	for _, tt := range tests {
+		result, err := base.Execute(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		if fmt.Sprint(result.resultSet.Rows) != fmt.Sprint(tt.rows) {
+			t.Errorf("%s: expected %v, got %v", tt.sql, tt.rows, result.resultSet.Rows)
+		}
+	}
+
+	// 哈希表超出内存预算时新分组写入分区文件，结果与全部在内存中聚合相同
+	for i := 1; i <= 200; i++ {
+		base.Execute(fmt.Sprintf("INSERT INTO orders VALUES (%d, %d, %d)", 100+i, i%50, i))
+	}
+	sql := "SELECT user_id, COUNT(*), SUM(amount) FROM orders WHERE id > 100 GROUP BY user_id ORDER BY user_id"
+	inMemory, err := base.Execute(sql)
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	base.SetAggregateMemoryBudget(1)
+	spilled, err := base.Execute(sql)
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	if inMemory.resultSet.Len() != 50 || fmt.Sprint(spilled.resultSet.Rows) != fmt.Sprint(inMemory.resultSet.Rows) {
+		t.Errorf("spilled aggregation differs: %v vs %v", spilled.resultSet.Rows, inMemory.resultSet.Rows)
+	}
+	if partitions, _ := filepath.Glob(filepath.Join(dir, "aggregate-*.tmp")); len(partitions) > 0 {
+		t.Errorf("aggregate partitions not removed: %v", partitions)
+	}
+
+	errorTests := []string{
+		"SELECT name, COUNT(*) FROM users GROUP BY dept",
+		"SELECT * FROM users GROUP BY dept",
+		"SELECT dept FROM users GROUP BY dept HAVING age > 30",
+		"SELECT dept FROM users GROUP BY dept ORDER BY name",
+		"SELECT dept FROM users GROUP BY salary",
+		"SELECT dept FROM users WHERE COUNT(*) > 1 GROUP BY dept",
+	}
+	for _, sql := range errorTests {
+		if _, err := base.Execute(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+}
+
+func TestDatabaseInSubquery(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+
+	creates := []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name CHAR, age INT INDEX)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)",
+	}
+	for _, sql := range creates {
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	inserts := []string{
+		"INSERT INTO users VALUES (1, 'alice', 30)",
+		"INSERT INTO users VALUES (2, 'bob', 40)",
+		"INSERT INTO users VALUES (3, 'carol', 25)",
+		"INSERT INTO users VALUES (4, 'dave', 35)",
+		"INSERT INTO orders VALUES (1, 3, 100)",
+		"INSERT INTO orders VALUES (2, 1, 20)",
+		"INSERT INTO orders VALUES (3, 3, 70)",
+		"INSERT INTO orders VALUES (4, 9, 80)",
+	}
+	for _, sql := range inserts {
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+
+	tests := []struct {
+		sql   string
+		names []interface{}
+	}{
+		{"SELECT name FROM users WHERE id IN (SELECT user_id FROM orders)", []interface{}{"alice", "carol"}},
+		{"SELECT name FROM users WHERE id IN (SELECT user_id FROM orders WHERE amount > 50) AND age < 30", []interface{}{"carol"}},
+		{"SELECT name FROM users WHERE age IN (SELECT amount FROM orders WHERE amount < 50) OR id = 2", []interface{}{"bob"}},
+		{"SELECT name FROM users WHERE age IN (SELECT MAX(age) FROM users)", []interface{}{"bob"}},
+		{"SELECT name FROM users WHERE NOT id IN (SELECT user_id FROM orders) ORDER BY name DESC", []interface{}{"dave", "bob"}},
+		{"SELECT name FROM users WHERE id IN (SELECT user_id FROM orders WHERE id IN (SELECT id FROM users WHERE age > 28))", []interface{}{"alice", "carol"}},
+		{"SELECT name FROM users WHERE id IN (SELECT user_id FROM orders WHERE amount > 1000)", []interface{}{}},
+		{"SELECT users.name FROM users JOIN orders ON users.id = orders.user_id WHERE orders.id IN (SELECT id FROM orders WHERE amount >= 70)", []interface{}{"carol", "carol"}},
+	}
+	for _, tt := range tests {
+		result, err := base.Execute(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		names := make([]interface{}, 0)
+		for i := 0; i < result.resultSet.Len(); i++ {
+			names = append(names, result.resultSet.Rows[i][0])
+		}
+		if !slices.Equal(names, tt.names) {
+			t.Errorf("%s: expected %v, got %v", tt.sql, tt.names, names)
+		}
+	}
+
+	// 子查询的结果驱动主键和二级索引的逐键查找
+	executor := base.sqlTableExecutor
+	definition := executor.SqlTableManager.getTableDefinition("users")
+	for sql, column := range map[string]string{
+		"SELECT name FROM users WHERE id IN (SELECT user_id FROM orders)": "id",
+		"SELECT name FROM users WHERE age IN (SELECT amount FROM orders)": "age",
+	} {
+		parsed, err := sqlparser.Parse(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		node, err := executor.resolveSubqueries(parsed.(*SelectNode))
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		scan, err := executor.chooseIndexScan(node.WhereClause, definition)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		if scan.column() != column || scan.keys == nil {
+			t.Errorf("%s: expected key lookup on %s, got %+v", sql, column, scan)
+		}
+	}
+
+	result, err := base.Execute("DELETE FROM users WHERE id IN (SELECT user_id FROM orders WHERE amount > 50)")
+	if err != nil {
+		t.Fatalf("Failed to delete with subquery: %v", err)
+	}
+	if result.affectedRows != 1 {
+		t.Errorf("expected 1 affected row, got %d", result.affectedRows)
+	}
+
+	errorTests := []string{
+		"SELECT name FROM users WHERE id IN (SELECT id, user_id FROM orders)",
+		"SELECT name FROM users WHERE id IN (SELECT user_id FROM orders WHERE orders.amount > users.age)",
+		"SELECT name FROM users WHERE id = (SELECT user_id FROM orders)",
+		"SELECT name FROM users WHERE id IN (SELECT user_id FROM missing)",
+	}
+	for _, sql := range errorTests {
+		if _, err := base.Execute(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+}
+
+func TestDatabaseInList(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+
+	_, err := base.Execute("CREATE TABLE users (id INT PRIMARY KEY, name CHAR, age INT INDEX)")
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i := 1; i <= 10; i++ {
+		base.Execute(fmt.Sprintf("INSERT INTO users VALUES (%d, 'user%02d', %d)", i, i, 20+i))
+	}
+
+	tests := []struct {
+		sql string
+		ids []interface{}
+	}{
+		{"SELECT id FROM users WHERE id IN (9, 1, 5)", []interface{}{uint32(9), uint32(1), uint32(5)}},
+		{"SELECT id FROM users WHERE id IN (5, 1, 5, 9, 1)", []interface{}{uint32(5), uint32(1), uint32(9)}},
+		{"SELECT id FROM users WHERE id IN (9, 1, 5) ORDER BY id", []interface{}{uint32(1), uint32(5), uint32(9)}},
+		{"SELECT id FROM users WHERE id IN (9, 1, 5) ORDER BY id DESC", []interface{}{uint32(9), uint32(5), uint32(1)}},
+		{"SELECT id FROM users WHERE id IN (9, 1, 5) LIMIT 2", []interface{}{uint32(9), uint32(1)}},
+		{"SELECT id FROM users WHERE id IN (1, 99)", []interface{}{uint32(1)}},
+		{"SELECT id FROM users WHERE age IN (29, 21, 29)", []interface{}{uint32(9), uint32(1)}},
+		{"SELECT id FROM users WHERE age IN (29, 21, 25) ORDER BY age", []interface{}{uint32(1), uint32(5), uint32(9)}},
+		{"SELECT id FROM users WHERE id IN (9, 1, 5) ORDER BY name", []interface{}{uint32(1), uint32(5), uint32(9)}},
+		{"SELECT id FROM users WHERE age IN (21, 29, 25) ORDER BY name DESC", []interface{}{uint32(9), uint32(5), uint32(1)}},
+		{"SELECT id FROM users WHERE name IN ('user07', 'user03')", []interface{}{uint32(3), uint32(7)}},
+		{"SELECT id FROM users WHERE id IN (3, 'x')", []interface{}{uint32(3)}},
+		{"SELECT id FROM users WHERE NOT id IN (1, 2, 3, 4, 5, 6, 7, 8)", []interface{}{uint32(9), uint32(10)}},
+		{"SELECT id FROM users WHERE id IN (2, 4, 6) AND age IN (24, 26, 28)", []interface{}{uint32(4), uint32(6)}},
+	}
+	for _, tt := range tests {
+		result, err := base.Execute(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		ids := make([]interface{}, 0)
+		for i := 0; i < result.resultSet.Len(); i++ {
+			ids = append(ids, result.resultSet.Value(i, "id"))
+		}
+		if !slices.Equal(ids, tt.ids) {
+			t.Errorf("%s: expected %v, got %v", tt.sql, tt.ids, ids)
+		}
+	}
+
+	result, err := base.Execute("DELETE FROM users WHERE id IN (2, 4, 2)")
+	if err != nil {
+		t.Fatalf("Failed to delete with in list: %v", err)
+	}
+	if result.affectedRows != 2 {
+		t.Errorf("expected 2 affected rows, got %d", result.affectedRows)
+	}
+}
+
+func TestDatabaseOperators(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+
+	creates := []string{
+		"CREATE TABLE items (id INT PRIMARY KEY, name CHAR, kind INT)",
+		"CREATE TABLE kinds (code INT PRIMARY KEY, num INT, label CHAR)",
+	}
+	for _, sql := range creates {
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	// 超过一个连接块的外表行
+	count := JOIN_BLOCK_SIZE + 44
+	for i := 1; i <= count; i++ {
+		sql := fmt.Sprintf("INSERT INTO items VALUES (%d, 'item%03d', %d)", i, i, i%3)
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	for num, label := range []string{"zero", "one"} {
+		base.Execute(fmt.Sprintf("INSERT INTO kinds VALUES (%d, %d, '%s')", 10+num, num, label))
+	}
+
+	// 算子树的结构
+	plans := []struct {
+		sql       string
+		operators []string
+	}{
+		{"SELECT name FROM items WHERE id > 5 ORDER BY name LIMIT 2",
+			[]string{"*database.projectOperator", "*database.limitOperator", "*database.sortOperator", "*database.filterOperator", "*database.indexScanOperator"}},
+		{"SELECT name FROM items ORDER BY id DESC",
+			[]string{"*database.projectOperator", "*database.tableScanOperator"}},
+		{"SELECT kind, COUNT(*) FROM items GROUP BY kind HAVING COUNT(*) > 1",
+			[]string{"*database.projectOperator", "*database.filterOperator", "*database.aggregateOperator", "*database.tableScanOperator"}},
+		{"SELECT items.id FROM items JOIN kinds ON items.kind = kinds.num WHERE kinds.label = 'one'",
+			[]string{"*database.projectOperator", "*database.joinOperator", "*database.qualifyOperator", "*database.tableScanOperator"}},
+	}
+	for _, tt := range plans {
+		node, err := sqlparser.Parse(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		plan, _, err := base.sqlTableExecutor.buildPlan(node.(*SelectNode))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.sql, err)
+		}
+		operators := make([]string, 0)
+		for plan != nil {
+			operators = append(operators, fmt.Sprintf("%T", plan))
+			switch op := plan.(type) {
+			case *projectOperator:
+				plan = op.child
+			case *limitOperator:
+				plan = op.child
+			case *sortOperator:
+				plan = op.child
+			case *filterOperator:
+				plan = op.child
+			case *aggregateOperator:
+				plan = op.child
+			case *joinOperator:
+				plan = op.outer
+			case *qualifyOperator:
+				plan = op.child
+			default:
+				plan = nil
+			}
+		}
+		if !slices.Equal(operators, tt.operators) {
+			t.Errorf("%s: expected %v, got %v", tt.sql, tt.operators, operators)
+		}
+	}
+
+	// 块嵌套循环跨越多个块时结果仍按外表顺序输出，LIMIT 在第二个块中截断
+	result, err := base.Execute("SELECT items.id, kinds.label FROM items JOIN kinds ON items.kind = kinds.num LIMIT 3 OFFSET 180")
+	if err != nil {
+		t.Fatalf("Failed to join: %v", err)
+	}
+	ids := make([]interface{}, 0)
+	for i := 0; i < result.resultSet.Len(); i++ {
+		ids = append(ids, result.resultSet.Value(i, "items.id"))
+	}
+	// kind 为 2 的行没有匹配，每三行中保留两行，第 180 个匹配来自第二个块中的 271
+	expected := []interface{}{uint32(271), uint32(273), uint32(274)}
+	if !slices.Equal(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+
+	result, err = base.Execute("SELECT COUNT(*), COUNT(kinds.label) FROM items LEFT JOIN kinds ON items.kind = kinds.num")
+	if err != nil {
+		t.Fatalf("Failed to left join: %v", err)
+	}
+	if got := result.resultSet.Value(0, "COUNT(*)"); got != uint32(count) {
+		t.Errorf("expected %d rows, got %v", count, got)
+	}
+	if got := result.resultSet.Value(0, "COUNT(kinds.label)"); got != uint32(count-count/3) {
+		t.Errorf("expected %d matched rows, got %v", count-count/3, got)
+	}
+}
+
+func TestDatabaseAnalyze(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	base := openDataBase(t, dir)
+
+	creates := []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, age INT INDEX, team INT)",
+		"CREATE TABLE teams (code INT PRIMARY KEY, title CHAR)",
+	}
+	for _, sql := range creates {
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	for i := 1; i <= 100; i++ {
+		base.Execute(fmt.Sprintf("INSERT INTO users VALUES (%d, %d, %d)", i, 1000+i, i%3))
+	}
+	for code, title := range []string{"red", "green", "blue"} {
+		base.Execute(fmt.Sprintf("INSERT INTO teams VALUES (%d, '%s')", code, title))
+	}
+
+	chosen := func(sql string) *indexScan {
+		node, err := sqlparser.Parse(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		resolved, err := base.sqlTableExecutor.resolveSubqueries(node.(*SelectNode))
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		definition := base.sqlTableManager.getTableDefinition("users")
+		scan, err := base.sqlTableExecutor.chooseIndexScan(resolved.WhereClause, definition)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		return scan
+	}
+	inQuery := "SELECT id FROM users WHERE id IN (1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20) AND age BETWEEN 1010 AND 1011"
+	wideQuery := "SELECT id FROM users WHERE age > 1000"
+
+	// 没有统计信息时按规则选择
+	if scan := chosen(inQuery); scan.column() != "id" || scan.keys == nil {
+		t.Errorf("expected primary key lookup before analyze, got %+v", scan)
+	}
+	if scan := chosen(wideQuery); scan.column() != "age" || scan.full {
+		t.Errorf("expected secondary range scan before analyze, got %+v", scan)
+	}
+
+	result, err := base.Execute("ANALYZE TABLE users")
+	if err != nil {
+		t.Fatalf("Failed to analyze: %v", err)
+	}
+	if result.resultSet.Len() != 2 {
+		t.Fatalf("expected statistics of 2 indexes, got %d", result.resultSet.Len())
+	}
+	for i, expected := range []map[string]interface{}{
+		{"column": "id", "rows": uint32(100), "distinct": uint32(100), "min": uint32(1), "max": uint32(100)},
+		{"column": "age", "rows": uint32(100), "distinct": uint32(100), "min": uint32(1001), "max": uint32(1100)},
+	} {
+		for column, value := range expected {
+			if got := result.resultSet.Value(i, column); got != value {
+				t.Errorf("row %d: expected %s = %v, got %v", i, column, value, got)
+			}
+		}
+	}
+	if _, err := base.Execute("ANALYZE teams"); err != nil {
+		t.Fatalf("Failed to analyze: %v", err)
+	}
+
+	// 有统计信息后选择代价最小的路径
+	checkCostBased := func() {
+		t.Helper()
+		if scan := chosen(inQuery); scan.column() != "age" || scan.keys != nil || scan.rows != 2 {
+			t.Errorf("expected secondary range scan of 2 rows, got %+v", scan)
+		}
+		if scan := chosen(wideQuery); !scan.full {
+			t.Errorf("expected full scan for a range covering the table, got %+v", scan)
+		}
+	}
+	checkCostBased()
+	result, err = base.Execute(inQuery)
+	if err != nil {
+		t.Fatalf("%s: %v", inQuery, err)
+	}
+	if result.resultSet.Len() != 2 || result.resultSet.Value(0, "id") != uint32(10) {
+		t.Errorf("unexpected result of %s: %v", inQuery, result.resultSet)
+	}
+
+	// 插入后只在内存中调整行数
+	base.Execute("INSERT INTO users VALUES (101, 1101, 1)")
+	if stats := base.sqlTableManager.getTableStatistics("users"); stats.RowCount != 101 {
+		t.Errorf("expected row count 101 after insert, got %d", stats.RowCount)
+	}
+
+	// 连接时先读行数少的表
+	joinQuery := "SELECT users.id, teams.title FROM users JOIN teams ON users.team = teams.code WHERE users.id < 3 ORDER BY users.id"
+	node, err := sqlparser.Parse(joinQuery)
+	if err != nil {
+		t.Fatalf("%s: %v", joinQuery, err)
+	}
+	scope, err := base.sqlTableExecutor.buildJoinScope(node.(*SelectNode))
+	if err != nil {
+		t.Fatalf("%s: %v", joinQuery, err)
+	}
+	ordered, _ := base.sqlTableExecutor.orderJoins(scope, node.(*SelectNode), scope.pushdownConjuncts(node.(*SelectNode)))
+	if ordered.TableName != "users" || ordered.Join[0].TableName != "teams" {
+		t.Errorf("expected users filtered to 2 rows to be read first, got %s then %s", ordered.TableName, ordered.Join[0].TableName)
+	}
+	node, _ = sqlparser.Parse("SELECT users.id FROM users JOIN teams ON users.team = teams.code")
+	ordered, _ = base.sqlTableExecutor.orderJoins(scope, node.(*SelectNode), scope.pushdownConjuncts(node.(*SelectNode)))
+	if ordered.TableName != "teams" || ordered.Join[0].TableName != "users" {
+		t.Errorf("expected teams to be read first, got %s then %s", ordered.TableName, ordered.Join[0].TableName)
+	}
+	result, err = base.Execute(joinQuery)
+	if err != nil {
+		t.Fatalf("%s: %v", joinQuery, err)
+	}
+	titles := make([]interface{}, 0)
+	for i := 0; i < result.resultSet.Len(); i++ {
+		titles = append(titles, result.resultSet.Value(i, "teams.title"))
+	}
+	if expected := []interface{}{"green", "blue"}; !slices.Equal(titles, expected) {
+		t.Errorf("expected %v, got %v", expected, titles)
+	}
+
+	// 统计信息保存在表定义旁边，重新打开数据库后仍然使用
+	base.Close()
+	if _, err := os.Stat(filepath.Join(dir, "users"+STATISTICS_SUFFIX)); err != nil {
+		t.Fatalf("expected statistics file: %v", err)
+	}
+	base = openDataBase(t, dir)
+	defer base.Close()
+	checkCostBased()
+
+	if _, err := base.Execute("ANALYZE missing"); err == nil {
+		t.Errorf("expected error analyzing unknown table")
+	}
+}
+
+func TestDatabaseExplain(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+	defer base.Close()
+
+	creates := []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, age INT INDEX, team INT)",
+		"CREATE TABLE teams (code INT PRIMARY KEY, title CHAR)",
+	}
+	for _, sql := range creates {
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	for i := 1; i <= 50; i++ {
+		base.Execute(fmt.Sprintf("INSERT INTO users VALUES (%d, %d, %d)", i, 20+i, i%3))
+	}
+	for code, title := range []string{"red", "green", "blue"} {
+		base.Execute(fmt.Sprintf("INSERT INTO teams VALUES (%d, '%s')", code, title))
+	}
+
+	explain := func(sql string) *ResultSet {
+		t.Helper()
+		result, err := base.Execute(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		if result.resultType != Res_EXPLAIN {
+			t.Fatalf("%s: expected explain result, got %v", sql, result.resultType)
+		}
+		return result.resultSet
+	}
+	operators := func(plan *ResultSet) []interface{} {
+		names := make([]interface{}, plan.Len())
+		for i := range names {
+			names[i] = plan.Value(i, "operator")
+		}
+		return names
+	}
+
+	plan := explain("EXPLAIN SELECT id FROM users WHERE age = 30 AND team = 1")
+	if expected := []interface{}{"Project", "-> Filter", "  -> IndexScan"}; !slices.Equal(operators(plan), expected) {
+		t.Fatalf("expected %v, got %v\n%v", expected, operators(plan), plan)
+	}
+	if detail := plan.Value(2, "detail"); detail != "secondary index users.age.idx: age = 30" {
+		t.Errorf("unexpected index scan detail %v", detail)
+	}
+	if detail := plan.Value(1, "detail").(string); !strings.Contains(detail, "team") {
+		t.Errorf("expected the filter to show the pushed down predicate, got %v", detail)
+	}
+	if rows := plan.Value(2, "rows"); rows != nil {
+		t.Errorf("expected unknown rows before analyze, got %v", rows)
+	}
+
+	plan = explain("EXPLAIN SELECT * FROM users WHERE id BETWEEN 5 AND 9 ORDER BY id DESC LIMIT 2")
+	if expected := []interface{}{"Project", "-> Limit", "  -> Filter", "    -> IndexScan"}; !slices.Equal(operators(plan), expected) {
+		t.Fatalf("expected %v, got %v\n%v", expected, operators(plan), plan)
+	}
+	if detail := plan.Value(3, "detail"); detail != "primary index users.db: id BETWEEN 5 AND 9, descending" {
+		t.Errorf("unexpected index scan detail %v", detail)
+	}
+
+	// ANALYZE 之后显示估算的行数
+	if _, err := base.Execute("ANALYZE users"); err != nil {
+		t.Fatalf("Failed to analyze: %v", err)
+	}
+	plan = explain("EXPLAIN SELECT id FROM users WHERE id BETWEEN 5 AND 9 LIMIT 2")
+	if rows := plan.Value(plan.Len()-1, "rows"); rows != uint32(5) {
+		t.Errorf("expected 5 estimated rows for the range, got %v\n%v", rows, plan)
+	}
+	if rows := plan.Value(1, "rows"); rows != uint32(2) {
+		t.Errorf("expected the limit to cap the estimate at 2, got %v\n%v", rows, plan)
+	}
+	plan = explain("EXPLAIN SELECT id FROM users WHERE age > 0")
+	if last := plan.Value(plan.Len()-1, "operator"); last != "  -> TableScan" || plan.Value(plan.Len()-1, "rows") != uint32(50) {
+		t.Errorf("expected a full scan of 50 rows, got\n%v", plan)
+	}
+
+	plan = explain("EXPLAIN SELECT users.id, teams.title FROM users JOIN teams ON users.team = teams.code")
+	if expected := []interface{}{"Project", "-> IndexNestedLoopJoin", "  -> TableScan", "  -> IndexScan"}; !slices.Equal(operators(plan), expected) {
+		t.Fatalf("expected %v, got %v\n%v", expected, operators(plan), plan)
+	}
+	if detail := plan.Value(3, "detail"); detail != "primary index teams.db: code = users.team" {
+		t.Errorf("unexpected inner scan detail %v", detail)
+	}
+	// 只涉及内表的条件下推到内表的扫描，连接之后不再过滤一遍
+	plan = explain("EXPLAIN SELECT users.id, teams.title FROM users JOIN teams ON users.team = teams.code WHERE teams.title = 'red'")
+	if expected := []interface{}{"Project", "-> IndexNestedLoopJoin", "  -> TableScan", "  -> Filter", "    -> IndexScan"}; !slices.Equal(operators(plan), expected) {
+		t.Fatalf("expected %v, got %v\n%v", expected, operators(plan), plan)
+	}
+
+	plan = explain("EXPLAIN SELECT COUNT(*) FROM users")
+	if expected := []interface{}{"Project", "-> IndexAggregate"}; !slices.Equal(operators(plan), expected) {
+		t.Errorf("expected %v, got %v", expected, operators(plan))
+	}
+	plan = explain("EXPLAIN SELECT team, COUNT(*) FROM users GROUP BY team")
+	if operators(plan)[1] != "-> HashAggregate" {
+		t.Errorf("expected hash aggregate, got %v", operators(plan))
+	}
+
+	// EXPLAIN 不执行查询，也不能用于其它语句
+	if _, err := base.Execute("EXPLAIN SELECT * FROM missing"); err == nil {
+		t.Errorf("expected error explaining unknown table")
+	}
+	if _, err := base.Execute("EXPLAIN DELETE FROM users WHERE id = 1"); err == nil {
+		t.Errorf("expected error explaining delete")
+	}
+	result, _ := base.Execute("SELECT COUNT(*) FROM users")
+	if count := result.resultSet.Value(0, "COUNT(*)"); count != uint32(50) {
+		t.Errorf("expected 50 rows after explain, got %v", count)
+	}
+}
+
+func TestDatabaseUpdate(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+	defer base.Close()
+
+	if _, err := base.Execute("CREATE TABLE users (id INT PRIMARY KEY, age INT INDEX, name CHAR)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i := 1; i <= 10; i++ {
+		base.Execute(fmt.Sprintf("INSERT INTO users VALUES (%d, %d, 'user%d')", i, 20+i, i))
+	}
+	update := func(sql string, expected uint32) {
+		t.Helper()
+		result, err := base.Execute(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		if result.affectedRows != expected {
+			t.Errorf("%s: expected %d affected rows, got %d", sql, expected, result.affectedRows)
+		}
+	}
+	ids := func(sql string) []interface{} {
+		t.Helper()
+		result, err := base.Execute(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		values := make([]interface{}, result.resultSet.Len())
+		for i := range values {
+			values[i] = result.resultSet.Value(i, "id")
+		}
+		return values
+	}
+
+	// 任意 WHERE 条件，更新所有满足条件的行
+	update("UPDATE users SET name = 'senior' WHERE age >= 25 AND name != 'user8'", 5)
+	if got, expected := ids("SELECT id FROM users WHERE name = 'senior'"), []interface{}{uint32(5), uint32(6), uint32(7), uint32(9), uint32(10)}; !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	update("UPDATE users SET age = 1 WHERE id = 999", 0)
+
+	// 二级索引随更新维护
+	update("UPDATE users SET age = 100 WHERE id = 3", 1)
+	if got := ids("SELECT id FROM users WHERE age = 100"); !slices.Equal(got, []interface{}{uint32(3)}) {
+		t.Errorf("expected id 3 through the new index key, got %v", got)
+	}
+	if got := ids("SELECT id FROM users WHERE age = 23"); len(got) != 0 {
+		t.Errorf("expected the old index key to be removed, got %v", got)
+	}
+
+	// 修改主键时二级索引指向新的主键
+	update("UPDATE users SET id = 50 WHERE age = 100", 1)
+	if got := ids("SELECT id FROM users WHERE age = 100"); !slices.Equal(got, []interface{}{uint32(50)}) {
+		t.Errorf("expected the index to point at id 50, got %v", got)
+	}
+	if got := ids("SELECT id FROM users WHERE id = 3"); len(got) != 0 {
+		t.Errorf("expected id 3 to be gone, got %v", got)
+	}
+
+	// 主键重复时不修改任何一行
+	for _, sql := range []string{
+		"UPDATE users SET id = 1 WHERE id = 2",
+		"UPDATE users SET id = 60 WHERE id < 5",
+	} {
+		var duplicate *DuplicateKeyError
+		if _, err := base.Execute(sql); !errors.As(err, &duplicate) {
+			t.Errorf("%s: expected duplicate key error, got %v", sql, err)
+		}
+	}
+	if got := ids("SELECT id FROM users WHERE id < 5"); !slices.Equal(got, []interface{}{uint32(1), uint32(2), uint32(4)}) {
+		t.Errorf("expected ids 1, 2, 4 to be unchanged, got %v", got)
+	}
+
+	for _, sql := range []string{
+		"UPDATE users SET missing = 1 WHERE id = 1",
+		"UPDATE users SET age = 'old' WHERE id = 1",
+		"UPDATE users SET age = 1, age = 2 WHERE id = 1",
+	} {
+		if _, err := base.Execute(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+
+	// 没有 WHERE 时更新整张表
+	result, err := base.Execute("UPDATE users SET name = 'all'")
+	if err != nil {
+		t.Fatalf("Failed to update all rows: %v", err)
+	}
+	if result.String() != "Query OK, 10 row(s) affected" {
+		t.Errorf("unexpected update result %q", result.String())
+	}
+}
+
+func TestDatabaseDuplicateIndexKeys(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	base := openDataBase(t, t.TempDir())
+	defer base.Close()
+
+	if _, err := base.Execute("CREATE TABLE users (id INT PRIMARY KEY, age INT INDEX)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i := 1; i <= 30; i++ {
+		if _, err := base.Execute(fmt.Sprintf("INSERT INTO users VALUES (%d, %d)", i, 20+i%3)); err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+	}
+	ids := func(sql string) []uint32 {
+		t.Helper()
+		result, err := base.Execute(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		values := make([]uint32, result.resultSet.Len())
+		for i := range values {
+			values[i] = result.resultSet.Value(i, "id").(uint32)
+		}
+		slices.Sort(values)
+		return values
+	}
+	expected := func(from uint32, except ...uint32) []uint32 {
+		values := make([]uint32, 0)
+		for id := from; id <= 30; id += 3 {
+			if !slices.Contains(except, id) {
+				values = append(values, id)
+			}
+		}
+		return values
+	}
+
+	// 相同索引键的行都能通过二级索引找到
+	if got := ids("SELECT id FROM users WHERE age = 21"); !slices.Equal(got, expected(1)) {
+		t.Errorf("expected %v, got %v", expected(1), got)
+	}
+	if got := ids("SELECT id FROM users WHERE age = 22"); !slices.Equal(got, expected(2)) {
+		t.Errorf("expected %v, got %v", expected(2), got)
+	}
+
+	// 删除和更新只影响对应主键的条目
+	base.Execute("DELETE FROM users WHERE id = 4")
+	base.Execute("UPDATE users SET age = 22 WHERE id = 7")
+	if got := ids("SELECT id FROM users WHERE age = 21"); !slices.Equal(got, expected(1, 4, 7)) {
+		t.Errorf("expected %v, got %v", expected(1, 4, 7), got)
+	}
+	want := append(expected(2), 7)
+	slices.Sort(want)
+	if got := ids("SELECT id FROM users WHERE age = 22"); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := ids("SELECT id FROM users WHERE age >= 20"); len(got) != 29 {
+		t.Errorf("expected 29 rows through the index, got %d", len(got))
+	}
+
+	result, err := base.Execute("ANALYZE users")
+	if err != nil {
+		t.Fatalf("Failed to analyze: %v", err)
+	}
+	if distinct := result.resultSet.Value(1, "distinct"); distinct != uint32(3) {
+		t.Errorf("expected 3 distinct ages, got %v", distinct)
+	}
+}
+
+func TestDatabaseCreateIndex(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	base := openDataBase(t, dir)
+
+	if _, err := base.Execute("CREATE TABLE users (id INT PRIMARY KEY, age INT, email INT, team INT, name CHAR, score INT INDEX)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i := 1; i <= 20; i++ {
+		base.Execute(fmt.Sprintf("INSERT INTO users VALUES (%d, %d, %d, %d, 'user%d', %d)", i, 20+i%4, 1000+i, i%2, i, i))
+	}
+	accessPath := func(sql string) string {
+		t.Helper()
+		result, err := base.Execute("EXPLAIN " + sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		plan := result.resultSet
+		return fmt.Sprintf("%v", plan.Value(plan.Len()-1, "detail"))
+	}
+	count := func(sql string) int {
+		t.Helper()
+		result, err := base.Execute(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		return result.resultSet.Len()
+	}
+	ageQuery := "SELECT id FROM users WHERE age = 21"
+	if path := accessPath(ageQuery); strings.Contains(path, "age") {
+		t.Errorf("expected a full scan before creating the index, got %s", path)
+	}
+
+	// 在已有数据上建立索引
+	result, err := base.Execute("CREATE INDEX idx_age ON users (age)")
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if result.affectedRows != 20 {
+		t.Errorf("expected 20 rows indexed, got %d", result.affectedRows)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "users.age.idx")); err != nil {
+		t.Errorf("expected index file: %v", err)
+	}
+	if path := accessPath(ageQuery); path != "secondary index users.age.idx: age = 21" {
+		t.Errorf("expected the new index to be used, got %s", path)
+	}
+	if n := count(ageQuery); n != 5 {
+		t.Errorf("expected 5 rows with age 21, got %d", n)
+	}
+	base.Execute("INSERT INTO users VALUES (21, 21, 1021, 1, 'user21', 21)")
+	if n := count(ageQuery); n != 6 {
+		t.Errorf("expected the new row to be indexed, got %d rows", n)
+	}
+
+	for _, sql := range []string{
+		"CREATE INDEX idx_age2 ON users (age)",
+		"CREATE INDEX idx_age ON users (team)",
+		"CREATE INDEX score ON users (team)",
+		"CREATE INDEX idx_id ON users (id)",
+		"CREATE INDEX idx_missing ON users (missing)",
+		"CREATE INDEX idx_age ON missing (age)",
+	} {
+		if _, err := base.Execute(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+
+	// 唯一索引：已有重复数据时建立失败，建立后拒绝重复的键
+	var violation *UniqueConstraintError
+	if _, err := base.Execute("CREATE UNIQUE INDEX idx_team ON users (team)"); !errors.As(err, &violation) {
+		t.Errorf("expected a unique constraint error building a unique index, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "users.team.idx")); !os.IsNotExist(err) {
+		t.Errorf("expected the failed index file to be removed, got %v", err)
+	}
+	if _, err := base.Execute("CREATE UNIQUE INDEX idx_email ON users (email)"); err != nil {
+		t.Fatalf("Failed to create unique index: %v", err)
+	}
+	for _, sql := range []string{
+		"INSERT INTO users VALUES (30, 20, 1005, 0, 'dup', 30)",
+		"UPDATE users SET email = 1005 WHERE id = 6",
+		"UPDATE users SET email = 2000 WHERE id < 3",
+	} {
+		if _, err := base.Execute(sql); !errors.As(err, &violation) {
+			t.Errorf("%s: expected a unique constraint error, got %v", sql, err)
+		}
+	}
+	if _, err := base.Execute("UPDATE users SET email = 1005, age = 20 WHERE id = 5"); err != nil {
+		t.Errorf("expected updating a row to its own unique key to succeed: %v", err)
+	}
+
+	// 索引写入表定义，重新打开后仍然存在
+	base.Close()
+	base = openDataBase(t, dir)
+	defer base.Close()
+	if path := accessPath(ageQuery); path != "secondary index users.age.idx: age = 21" {
+		t.Errorf("expected the index after reopen, got %s", path)
+	}
+	if _, err := base.Execute("INSERT INTO users VALUES (31, 21, 1007, 0, 'user31', 31)"); err != nil {
+		t.Fatalf("Failed to insert after reopen: %v", err)
+	}
+	if _, err := base.Execute("INSERT INTO users VALUES (32, 20, 1007, 0, 'dup', 32)"); !errors.As(err, &violation) {
+		t.Errorf("expected the unique index to be enforced after reopen, got %v", err)
+	}
+
+	// 删除索引后回到全表扫描
+	if _, err := base.Execute("DROP INDEX idx_age ON users"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "users.age.idx")); !os.IsNotExist(err) {
+		t.Errorf("expected the index file to be removed, got %v", err)
+	}
+	if path := accessPath(ageQuery); strings.Contains(path, "age.idx") {
+		t.Errorf("expected a full scan after dropping the index, got %s", path)
+	}
+	if n := count(ageQuery); n != 1 {
+		t.Errorf("expected 1 row with age 21 after drop, got %d", n)
+	}
+	if _, err := base.Execute("DROP INDEX idx_age ON users"); err == nil {
+		t.Errorf("expected error dropping a missing index")
+	}
+	// 建表时声明的索引以列名作为索引名
+	if _, err := base.Execute("DROP INDEX score ON users"); err != nil {
+		t.Errorf("Failed to drop inline index: %v", err)
+	}
+	if base.sqlTableManager.getTableDefinition("users").GetColumn("score").IndexType != None {
+		t.Errorf("expected score to no longer be indexed")
+	}
+}
+
+func TestDatabaseUniqueConstraint(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	base := openDataBase(t, dir)
+
+	if _, err := base.Execute("CREATE TABLE accounts (id INT PRIMARY KEY, email INT UNIQUE, age INT)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "accounts.email.idx")); err != nil {
+		t.Errorf("expected a unique index file for email: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		if _, err := base.Execute(fmt.Sprintf("INSERT INTO accounts VALUES (%d, %d, 20)", i, 100+i)); err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+	}
+	count := func(sql string) int {
+		t.Helper()
+		result, err := base.Execute(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		return result.resultSet.Len()
+	}
+
+	// 违反约束的语句返回指明列和值的错误，且不写入任何数据
+	var violation *UniqueConstraintError
+	_, err := base.Execute("INSERT INTO accounts VALUES (6, 103, 20)")
+	if !errors.As(err, &violation) {
+		t.Fatalf("expected a unique constraint error, got %v", err)
+	}
+	if violation.ColumnName != "email" || violation.Value != uint32(103) {
+		t.Errorf("expected the error to name email = 103, got %s = %v", violation.ColumnName, violation.Value)
+	}
+	if err.Error() != "unique constraint violated: value 103 already exists in accounts.email" {
+		t.Errorf("unexpected error message: %v", err)
+	}
+	if n := count("SELECT * FROM accounts"); n != 5 {
+		t.Errorf("expected 5 rows after the rejected insert, got %d", n)
+	}
+	for _, sql := range []string{
+		"UPDATE accounts SET email = 101 WHERE id = 2",
+		"UPDATE accounts SET email = 200 WHERE age = 20",
+	} {
+		if _, err := base.Execute(sql); !errors.As(err, &violation) {
+			t.Errorf("%s: expected a unique constraint error, got %v", sql, err)
+		}
+	}
+	if n := count("SELECT * FROM accounts WHERE email = 101"); n != 1 {
+		t.Errorf("expected email 101 to belong to one row, got %d", n)
+	}
+
+	// 修改或删除行之后原来的值可以再次使用
+	if _, err := base.Execute("UPDATE accounts SET email = 102, age = 21 WHERE id = 2"); err != nil {
+		t.Errorf("expected updating a row to its own value to succeed: %v", err)
+	}
+	if _, err := base.Execute("UPDATE accounts SET email = 200 WHERE id = 1"); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if _, err := base.Execute("DELETE FROM accounts WHERE id = 3"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	for _, sql := range []string{
+		"INSERT INTO accounts VALUES (6, 101, 20)",
+		"INSERT INTO accounts VALUES (7, 103, 20)",
+	} {
+		if _, err := base.Execute(sql); err != nil {
+			t.Errorf("%s: expected a freed value to be reusable: %v", sql, err)
+		}
+	}
+
+	// 约束写入表定义，重新打开后仍然生效
+	base.Close()
+	base = openDataBase(t, dir)
+	defer base.Close()
+	if !base.sqlTableManager.getTableDefinition("accounts").GetColumn("email").Unique {
+		t.Errorf("expected email to stay unique after reopen")
+	}
+	if _, err := base.Execute("INSERT INTO accounts VALUES (1, 100, 20)"); err != nil {
+		t.Fatalf("Failed to insert after reopen: %v", err)
+	}
+	if _, err := base.Execute("INSERT INTO accounts VALUES (2, 100, 20)"); !errors.As(err, &violation) {
+		t.Errorf("expected the constraint to be enforced after reopen, got %v", err)
+	}
+
+	// 删除列上的索引同时去掉约束
+	if _, err := base.Execute("DROP INDEX email ON accounts"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	if _, err := base.Execute("INSERT INTO accounts VALUES (2, 100, 20)"); err != nil {
+		t.Errorf("expected duplicates to be allowed after dropping the index: %v", err)
+	}
+}
+
+func TestDatabaseCompositeKeys(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	base := openDataBase(t, dir)
+	defer base.Close()
+
+	if _, err := base.Execute("CREATE TABLE scores (team INT, player INT PRIMARY KEY, points INT, PRIMARY KEY (team, player))"); err == nil {
+		t.Errorf("expected error declaring two primary keys")
+	}
+	if _, err := base.Execute("CREATE TABLE scores (team INT, player INT, points INT, PRIMARY KEY (team, missing))"); err == nil {
+		t.Errorf("expected error declaring a primary key on an unknown column")
+	}
+	if _, err := base.Execute("CREATE TABLE scores (team INT, player INT, round INT, points INT, PRIMARY KEY (team, player))"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for team := 1; team <= 3; team++ {
+		for player := 1; player <= 5; player++ {
+			sql := fmt.Sprintf("INSERT INTO scores VALUES (%d, %d, %d, %d)", team, player, player%2, team*10+player)
+			if _, err := base.Execute(sql); err != nil {
+				t.Fatalf("%s: %v", sql, err)
+			}
+		}
+	}
+
+	// 组合主键只要求整个键不重复
+	var duplicate *DuplicateKeyError
+	if _, err := base.Execute("INSERT INTO scores VALUES (2, 3, 0, 0)"); !errors.As(err, &duplicate) {
+		t.Fatalf("expected a duplicate key error, got %v", err)
+	} else if duplicate.ColumnName != "team,player" || duplicate.Key != "(2, 3)" {
+		t.Errorf("expected the error to name (team, player) = (2, 3), got %s = %v", duplicate.ColumnName, duplicate.Key)
+	}
+	if _, err := base.Execute("UPDATE scores SET player = 4 WHERE team = 1 AND player = 5"); !errors.As(err, &duplicate) {
+		t.Errorf("expected a duplicate key error updating into an existing key, got %v", err)
+	}
+
+	explain := func(sql string) *ResultSet {
+		t.Helper()
+		result, err := base.Execute(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		return result.resultSet
+	}
+	points := func(sql string) []interface{} {
+		t.Helper()
+		result, err := base.Execute(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		values := make([]interface{}, result.resultSet.Len())
+		for i := range values {
+			values[i] = result.resultSet.Value(i, "points")
+		}
+		return values
+	}
+
+	// 最左前缀上的等值和范围条件都走主键索引，索引顺序满足 ORDER BY
+	scanTests := []struct {
+		sql    string
+		detail string
+		points []interface{}
+	}{
+		{"SELECT points FROM scores WHERE team = 2 AND player = 3", "primary index scores.db: team = 2 AND player = 3", []interface{}{uint32(23)}},
+		{"SELECT points FROM scores WHERE team = 3 AND player BETWEEN 2 AND 4", "primary index scores.db: team = 3 AND player BETWEEN 2 AND 4", []interface{}{uint32(32), uint32(33), uint32(34)}},
+		{"SELECT points FROM scores WHERE team = 1 ORDER BY player DESC LIMIT 2", "primary index scores.db: team = 1, descending", []interface{}{uint32(15), uint32(14)}},
+		{"SELECT points FROM scores WHERE team >= 3 AND player = 1", "primary index scores.db: team >= 3", []interface{}{uint32(31)}},
+	}
+	for _, tt := range scanTests {
+		plan := explain("EXPLAIN " + tt.sql)
+		last := plan.Len() - 1
+		if plan.Value(last, "detail") != tt.detail {
+			t.Errorf("%s: expected %q, got\n%v", tt.sql, tt.detail, plan)
+		}
+		for i := 0; i < plan.Len(); i++ {
+			if strings.HasSuffix(plan.Value(i, "operator").(string), "Sort") {
+				t.Errorf("%s: expected the index order to satisfy ORDER BY, got\n%v", tt.sql, plan)
+			}
+		}
+		if got := points(tt.sql); !slices.Equal(got, tt.points) {
+			t.Errorf("%s: expected %v, got %v", tt.sql, tt.points, got)
+		}
+	}
+
+	// 多列二级索引，前缀之后的列只能作为过滤条件
+	result, err := base.Execute("CREATE INDEX round_points ON scores (round, points)")
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if result.affectedRows != 15 {
+		t.Errorf("expected 15 rows indexed, got %d", result.affectedRows)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "scores.round,points.idx")); err != nil {
+		t.Errorf("expected an index file for (round, points): %v", err)
+	}
+	if _, err := base.Execute("CREATE INDEX again ON scores (round, points)"); err == nil {
+		t.Errorf("expected error creating the same index twice")
+	}
+	if _, err := base.Execute("CREATE INDEX primary_again ON scores (team, player)"); err == nil {
+		t.Errorf("expected error indexing the primary key columns")
+	}
+	plan := explain("EXPLAIN SELECT points FROM scores WHERE round = 1 AND points BETWEEN 20 AND 29 ORDER BY points")
+	if detail := plan.Value(plan.Len()-1, "detail"); detail != "secondary index scores.round,points.idx: round = 1 AND points BETWEEN 20 AND 29" {
+		t.Errorf("unexpected index scan detail %v\n%v", detail, plan)
+	}
+	if got := points("SELECT points FROM scores WHERE round = 1 AND points BETWEEN 20 AND 29 ORDER BY points"); !slices.Equal(got, []interface{}{uint32(21), uint32(23), uint32(25)}) {
+		t.Errorf("expected [21 23 25], got %v", got)
+	}
+
+	// 更新和删除同时维护主键和多列索引
+	if _, err := base.Execute("UPDATE scores SET points = 26 WHERE team = 2 AND player = 1"); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if _, err := base.Execute("DELETE FROM scores WHERE team = 2 AND player = 3"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if got := points("SELECT points FROM scores WHERE round = 1 AND points BETWEEN 20 AND 29"); !slices.Equal(got, []interface{}{uint32(25), uint32(26)}) {
+		t.Errorf("expected [25 26] after update and delete, got %v", got)
+	}
+
+	// ANALYZE 按索引输出多列索引的统计
+	result, err = base.Execute("ANALYZE scores")
+	if err != nil {
+		t.Fatalf("Failed to analyze: %v", err)
+	}
+	found := false
+	for i := 0; i < result.resultSet.Len(); i++ {
+		if result.resultSet.Value(i, "column") == "round,points" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected statistics for the (round, points) index, got\n%v", result.resultSet)
+	}
+
+	// 多列唯一索引只要求列的组合不重复
+	if _, err := base.Execute("CREATE UNIQUE INDEX team_points ON scores (team, points)"); err != nil {
+		t.Fatalf("Failed to create unique index: %v", err)
+	}
+	var violation *UniqueConstraintError
+	if _, err := base.Execute("INSERT INTO scores VALUES (1, 9, 0, 12)"); !errors.As(err, &violation) {
+		t.Errorf("expected a unique constraint error, got %v", err)
+	}
+	if _, err := base.Execute("INSERT INTO scores VALUES (2, 9, 0, 12)"); err != nil {
+		t.Errorf("expected a different combination to be allowed: %v", err)
+	}
+
+	if _, err := base.Execute("DROP INDEX round_points ON scores"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "scores.round,points.idx")); !os.IsNotExist(err) {
+		t.Errorf("expected the index file to be removed, got %v", err)
+	}
+	if got := points("SELECT points FROM scores WHERE round = 1 AND points BETWEEN 20 AND 29"); !slices.Equal(got, []interface{}{uint32(26), uint32(25)}) {
+		t.Errorf("expected [26 25] in primary key order after dropping the index, got %v", got)
+	}
+}
+
+func TestDatabaseCharKeys(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	base := openDataBase(t, dir)
+	defer base.Close()
+
+	creates := []string{
+		"CREATE TABLE users (name CHAR PRIMARY KEY, email CHAR UNIQUE, city CHAR INDEX, age INT)",
+		"CREATE TABLE visits (id INT PRIMARY KEY, user CHAR, city CHAR)",
+	}
+	for _, sql := range creates {
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	users := []string{
+		"('carol', 'carol@x', 'paris', 31)",
+		"('alice', 'alice@x', 'rome', 25)",
+		"('dave', 'dave@x', 'paris', 40)",
+		"('bob', 'bob@x', 'oslo', 25)",
+		"('erin', 'erin@x', 'rome', 22)",
+	}
+	for _, values := range users {
+		if _, err := base.Execute("INSERT INTO users VALUES " + values); err != nil {
+			t.Fatalf("Failed to insert %s: %v", values, err)
+		}
+	}
+	for i, visit := range []string{"'bob', 'oslo'", "'alice', 'paris'", "'bob', 'rome'"} {
+		base.Execute(fmt.Sprintf("INSERT INTO visits VALUES (%d, %s)", i+1, visit))
+	}
+
+	// 字符串主键和唯一索引拒绝重复的值
+	var duplicate *DuplicateKeyError
+	if _, err := base.Execute("INSERT INTO users VALUES ('bob', 'other@x', 'oslo', 30)"); !errors.As(err, &duplicate) || duplicate.Key != "bob" {
+		t.Errorf("expected a duplicate key error for bob, got %v", err)
+	}
+	var violation *UniqueConstraintError
+	if _, err := base.Execute("UPDATE users SET email = 'bob@x' WHERE name = 'carol'"); !errors.As(err, &violation) {
+		t.Errorf("expected a unique constraint error, got %v", err)
+	}
+
+	explain := func(sql string) *ResultSet {
+		t.Helper()
+		result, err := base.Execute(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		return result.resultSet
+	}
+	names := func(sql string) []interface{} {
+		t.Helper()
+		result, err := base.Execute(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		values := make([]interface{}, result.resultSet.Len())
+		for i := range values {
+			values[i] = result.resultSet.Value(i, "name")
+		}
+		return values
+	}
+
+	// 字符串列上的等值、IN 和区间条件都使用索引，开区间的边界由过滤去掉
+	scanTests := []struct {
+		sql    string
+		detail string
+		names  []interface{}
+	}{
+		{"SELECT name FROM users WHERE name = 'dave'", "primary index users.db: name = 'dave'", []interface{}{"dave"}},
+		{"SELECT name FROM users WHERE city = 'rome'", "secondary index users.city.idx: city = 'rome'", []interface{}{"alice", "erin"}},
+		{"SELECT name FROM users WHERE email IN ('erin@x', 'bob@x', 'nobody@x')", "secondary index users.email.idx: email IN ('erin@x', 'bob@x', 'nobody@x')", []interface{}{"erin", "bob"}},
+		{"SELECT name FROM users WHERE name > 'bob' AND name < 'dave'", "primary index users.db: name BETWEEN 'bob' AND 'dave'", []interface{}{"carol"}},
+		{"SELECT name FROM users WHERE name BETWEEN 'a' AND 'c'", "primary index users.db: name BETWEEN 'a' AND 'c'", []interface{}{"alice", "bob"}},
+		{"SELECT name FROM users WHERE name > 'carol'", "primary index users.db: name >= 'carol'", []interface{}{"dave", "erin"}},
+		{"SELECT name FROM users WHERE name > 'x'", "primary index users.db: name >= 'x'", []interface{}{}},
+		{"SELECT name FROM users WHERE name <= 'bob'", "primary index users.db: name <= 'bob'", []interface{}{"alice", "bob"}},
+		{"SELECT name FROM users WHERE city > 'p'", "secondary index users.city.idx: city >= 'p'", []interface{}{"carol", "dave", "alice", "erin"}},
+		{"SELECT name FROM users ORDER BY name", "users.db: all rows of users", []interface{}{"alice", "bob", "carol", "dave", "erin"}},
+	}
+	for _, tt := range scanTests {
+		plan := explain("EXPLAIN " + tt.sql)
+		if detail := plan.Value(plan.Len()-1, "detail").(string); !strings.HasSuffix(detail, tt.detail) {
+			t.Errorf("%s: expected %q, got\n%v", tt.sql, tt.detail, plan)
+		}
+		for i := 0; i < plan.Len(); i++ {
+			if strings.HasSuffix(plan.Value(i, "operator").(string), "Sort") {
+				t.Errorf("%s: expected no sort, got\n%v", tt.sql, plan)
+			}
+		}
+		if got := names(tt.sql); !slices.Equal(got, tt.names) {
+			t.Errorf("%s: expected %v, got %v", tt.sql, tt.names, got)
+		}
+	}
+	if _, err := base.Execute("SELECT name FROM users WHERE name = 25"); err != nil {
+		t.Errorf("expected a literal of another type not to be used as a key: %v", err)
+	}
+
+	// 字符串列可以组成多列索引，也可以作为索引连接的键
+	if _, err := base.Execute("CREATE INDEX age_city ON users (age, city)"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	plan := explain("EXPLAIN SELECT name FROM users WHERE age = 25 AND city = 'oslo'")
+	if detail := plan.Value(plan.Len()-1, "detail"); detail != "secondary index users.age,city.idx: age = 25 AND city = 'oslo'" {
+		t.Errorf("unexpected index scan detail %v", detail)
+	}
+	if got := names("SELECT name FROM users WHERE age = 25 AND city = 'oslo'"); !slices.Equal(got, []interface{}{"bob"}) {
+		t.Errorf("expected [bob], got %v", got)
+	}
+	plan = explain("EXPLAIN SELECT visits.id, users.age FROM visits JOIN users ON visits.user = users.name")
+	if detail := plan.Value(plan.Len()-1, "detail"); detail != "primary index users.db: name = visits.user" {
+		t.Errorf("expected an index join on the primary key, got\n%v", plan)
+	}
+	result, err := base.Execute("SELECT visits.id, users.age FROM visits JOIN users ON visits.user = users.name")
+	if err != nil || result.resultSet.Len() != 3 {
+		t.Errorf("expected 3 joined rows, got %v, %v", result, err)
+	}
+
+	// 修改和删除字符串主键同时维护所有索引
+	if _, err := base.Execute("UPDATE users SET name = 'zoe', city = 'oslo' WHERE name = 'alice'"); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if _, err := base.Execute("DELETE FROM users WHERE name = 'erin'"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if got := names("SELECT name FROM users WHERE city = 'oslo'"); !slices.Equal(got, []interface{}{"bob", "zoe"}) {
+		t.Errorf("expected [bob zoe], got %v", got)
+	}
+	if got := names("SELECT name FROM users WHERE city = 'rome'"); len(got) != 0 {
+		t.Errorf("expected no rows in rome, got %v", got)
+	}
+	result, err = base.Execute("SELECT MIN(name), MAX(name) FROM users")
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+	if min, max := result.resultSet.Value(0, "MIN(name)"), result.resultSet.Value(0, "MAX(name)"); min != "bob" || max != "zoe" {
+		t.Errorf("expected MIN bob and MAX zoe from the primary index, got %v and %v", min, max)
+	}
+
+	// 统计信息中字符串列没有取值范围
+	result, err = base.Execute("ANALYZE users")
+	if err != nil {
+		t.Fatalf("Failed to analyze: %v", err)
+	}
+	for i := 0; i < result.resultSet.Len(); i++ {
+		if result.resultSet.Value(i, "column") == "city" {
+			if distinct := result.resultSet.Value(i, "distinct"); distinct != uint32(2) {
+				t.Errorf("expected 2 distinct cities, got %v", distinct)
+			}
+			if min := result.resultSet.Value(i, "min"); min != nil {
+				t.Errorf("expected no range for a CHAR column, got %v", min)
+			}
+		}
+	}
+	if got := names("SELECT name FROM users WHERE name = 'carol'"); !slices.Equal(got, []interface{}{"carol"}) {
+		t.Errorf("expected [carol] after analyze, got %v", got)
+	}
+
+	// 编码后超过 MAX_KEY_SIZE 的索引键被拒绝
+	if _, err := base.Execute("CREATE TABLE wide (a CHAR, b CHAR, c CHAR, d CHAR, e CHAR, PRIMARY KEY (a, b, c, d, e))"); err == nil {
+		t.Errorf("expected error declaring a primary key longer than %d bytes", MAX_KEY_SIZE)
+	}
+
+	// VARCHAR 列与 CHAR 列一样存储，可以作为主键、二级索引和多列索引的列
+	creates = []string{
+		"CREATE TABLE tags (name VARCHAR PRIMARY KEY, label VARCHAR INDEX, uses INT)",
+		"CREATE INDEX label_uses ON tags (label, uses)",
+	}
+	for _, sql := range creates {
+		if _, err := base.Execute(sql); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	for _, values := range []string{"('go', 'lang', 3)", "('sql', 'lang', 5)", "('btree', 'index', 2)"} {
+		if _, err := base.Execute("INSERT INTO tags VALUES " + values); err != nil {
+			t.Fatalf("Failed to insert %s: %v", values, err)
+		}
+	}
+	if _, err := base.Execute("INSERT INTO tags VALUES ('go', 'other', 1)"); !errors.As(err, &duplicate) || duplicate.Key != "go" {
+		t.Errorf("expected a duplicate key error for go, got %v", err)
+	}
+	if _, err := base.Execute("INSERT INTO tags VALUES (1, 'lang', 1)"); err == nil {
+		t.Errorf("expected error inserting an INT into a VARCHAR column")
+	}
+	plan = explain("EXPLAIN SELECT uses FROM tags WHERE name = 'sql'")
+	if detail := plan.Value(plan.Len()-1, "detail"); detail != "primary index tags.db: name = 'sql'" {
+		t.Errorf("expected a primary key lookup on a VARCHAR column, got\n%v", plan)
+	}
+	plan = explain("EXPLAIN SELECT name FROM tags WHERE label = 'lang' AND uses = 5")
+	if detail := plan.Value(plan.Len()-1, "detail"); detail != "secondary index tags.label,uses.idx: label = 'lang' AND uses = 5" {
+		t.Errorf("expected a composite index lookup on a VARCHAR column, got\n%v", plan)
+	}
+	if got := names("SELECT name FROM tags WHERE label = 'lang' ORDER BY name DESC"); !slices.Equal(got, []interface{}{"sql", "go"}) {
+		t.Errorf("expected [sql go], got %v", got)
+	}
+
+	// 索引键只保存字符串的前 CHAR_LENGTH 字节，更长的值不能写入索引列，否则前缀相同的值会被当成同一个键
+	prefix := strings.Repeat("k", CHAR_LENGTH)
+	if _, err := base.Execute("INSERT INTO tags VALUES ('" + prefix + "', 'lang', 7)"); err != nil {
+		t.Fatalf("Failed to insert a key of %d bytes: %v", CHAR_LENGTH, err)
+	}
+	for _, sql := range []string{
+		"INSERT INTO tags VALUES ('" + prefix + "x', 'lang', 8)",
+		"INSERT INTO tags VALUES ('rust', '" + prefix + "x', 8)",
+		"UPDATE tags SET name = '" + prefix + "x' WHERE name = 'go'",
+		"UPDATE tags SET label = '" + prefix + "x' WHERE name = 'go'",
+	} {
+		if _, err := base.Execute(sql); err == nil || errors.As(err, &duplicate) {
+			t.Errorf("%s: expected a key length error, got %v", sql, err)
+		}
+	}
+	if got := names("SELECT name FROM tags WHERE name = '" + prefix + "'"); !slices.Equal(got, []interface{}{prefix}) {
+		t.Errorf("expected [%s], got %v", prefix, got)
+	}
+	if got := names("SELECT name FROM tags WHERE label = 'lang'"); !slices.Equal(got, []interface{}{"go", prefix, "sql"}) {
+		t.Errorf("expected the long values not to be written, got %v", got)
+	}
+}
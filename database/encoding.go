@@ -3,9 +3,10 @@ package database
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	. "godb/entity"
 	"godb/logger"
-	"log"
+	"strings"
 )
 
 // @Title        encoding.go
@@ -13,23 +14,26 @@ import (
 // @Create       david 2025-01-15 10:23
 // @Update       david 2025-01-15 10:23
 
-func serializeRow(record map[string]interface{}, definition *SqlTableDefinition) *bytes.Buffer {
+func serializeRow(record map[string]interface{}, definition *SqlTableDefinition) (*bytes.Buffer, error) {
 	buf := new(bytes.Buffer)
 
+	if err := checkValueTypes(record, definition); err != nil {
+		return nil, err
+	}
 	for _, column := range definition.Columns {
 		switch column.DataType {
 		case TypeInt:
 			// 写入整数，固定4字节
 			ser_Int(record, column, buf)
-		case TypeChar:
-			// 写入字符串，固定长度(CHAR_SIZE + CHAR_LENGTH)
+		case TypeChar, TypeVarchar:
+			// 写入字符串，固定长度(CHAR_SIZE + CHAR_LENGTH)，VARCHAR 与 CHAR 的存储相同
 			ser_Char(record, column, buf)
 		default:
-			log.Fatal("SerializeRow Unknown column type:", column.DataType)
+			return nil, fmt.Errorf("serializeRow unknown column type: %v", column.DataType)
 		}
 	}
 
-	return buf
+	return buf, nil
 }
 
 func ser_Char(record map[string]interface{}, column *ColumnDefinition, buf *bytes.Buffer) {
@@ -59,11 +63,14 @@ func ser_Int(record map[string]interface{}, column *ColumnDefinition, buf *bytes
 	buf.Write(data)
 }
 
-func deserializeRow(definition *SqlTableDefinition, bytes []byte) map[string]interface{} {
+func deserializeRow(definition *SqlTableDefinition, bytes []byte) (map[string]interface{}, error) {
 	// check row size
-	rowSize := getRowSize(definition)
+	rowSize, err := getRowSize(definition)
+	if err != nil {
+		return nil, err
+	}
 	if rowSize < len(bytes) {
-		log.Fatalf("Row size mismatch, row size: %d, expected row size: %d", len(bytes), rowSize)
+		return nil, fmt.Errorf("row size mismatch, row size: %d, expected row size: %d", len(bytes), rowSize)
 	}
 
 	// from bytes to typed data
@@ -77,15 +84,15 @@ func deserializeRow(definition *SqlTableDefinition, bytes []byte) map[string]int
 			// 将4个字节转换为uint32
 			curPosition = deser_Int(curPosition, bytes, result, column)
 
-		case TypeChar:
+		case TypeChar, TypeVarchar:
 			// 处理字符串类型，去除空字节
 			curPosition = deser_Char(curPosition, bytes, result, column)
 
 		default:
-			log.Fatal("DeserializeRow Unknown column type:", column.DataType)
+			return nil, fmt.Errorf("deserializeRow unknown column type: %v", column.DataType)
 		}
 	}
-	return result
+	return result, nil
 }
 
 func deser_Int(curPosition int, bytes []byte, result map[string]interface{}, column *ColumnDefinition) int {
@@ -131,3 +138,80 @@ func SerializeInt(value uint32) []byte {
 func DeserializeInt(bytes []byte) uint32 {
 	return binary.BigEndian.Uint32(bytes)
 }
+
+// encodeKey 把行中 columns 列的值依次编码成索引键，键的字节序与列值的顺序一致，多列的键按列依次比较
+func encodeKey(row map[string]interface{}, columns []string) ([]byte, error) {
+	key := make([]byte, 0, INT_SIZE*len(columns))
+	for _, column := range columns {
+		value, err := encodeKeyValue(row[column])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key value %v for column %s, expected INT, CHAR or VARCHAR", row[column], column)
+		}
+		key = append(key, value...)
+	}
+	return key, nil
+}
+
+// encodeKeyValue 把一列的值编码成定长的索引键
+// 整数按大端序编码；字符串与行中存储的一样截断到 CHAR_LENGTH 字节，再用 0 补齐到 CHAR_LENGTH 字节
+func encodeKeyValue(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case uint32:
+		return SerializeInt(v), nil
+	case string:
+		key := make([]byte, CHAR_LENGTH)
+		copy(key, v)
+		return key, nil
+	default:
+		return nil, fmt.Errorf("invalid key value %v", value)
+	}
+}
+
+// decodeKeyValue 从索引键的开头解码出一列的值，是 encodeKeyValue 的逆过程
+func decodeKeyValue(key []byte, dataType DataType) interface{} {
+	if isStringType(dataType) {
+		return string(bytes.TrimRight(key[:CHAR_LENGTH], "\x00"))
+	}
+	return DeserializeInt(key[:INT_SIZE])
+}
+
+// keyWidth 一列的值编码成索引键后的字节数，只有 INT、CHAR 和 VARCHAR 列可以作为索引键
+func keyWidth(dataType DataType) (int, bool) {
+	switch dataType {
+	case TypeInt:
+		return INT_SIZE, true
+	case TypeChar, TypeVarchar:
+		return CHAR_LENGTH, true
+	default:
+		return 0, false
+	}
+}
+
+// isKeyValue 判断值能否作为 dataType 列的索引键查找
+func isKeyValue(value interface{}, dataType DataType) bool {
+	switch value.(type) {
+	case uint32:
+		return dataType == TypeInt
+	case string:
+		return isStringType(dataType)
+	default:
+		return false
+	}
+}
+
+// isStringType 判断列的值是否是字符串，CHAR 和 VARCHAR 列的存储和索引键都相同
+func isStringType(dataType DataType) bool {
+	return dataType == TypeChar || dataType == TypeVarchar
+}
+
+// keyValue 返回行中 columns 列的值，用于错误信息，多列时格式为 (v1, v2)
+func keyValue(row map[string]interface{}, columns []string) interface{} {
+	if len(columns) == 1 {
+		return row[columns[0]]
+	}
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		values[i] = formatValue(row[column])
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
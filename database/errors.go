@@ -0,0 +1,39 @@
+package database
+
+import "fmt"
+
+// @Title        errors.go
+// @Description  typed errors returned from DataBase.Execute
+
+// 语法错误为 *sqlparser.SyntaxError，磁盘读写错误为 *disktree.IOError 或 *fs.PathError
+
+// UnknownTableError 表不存在
+type UnknownTableError struct {
+	TableName string
+}
+
+func (e *UnknownTableError) Error() string {
+	return fmt.Sprintf("table %s not exist", e.TableName)
+}
+
+// DuplicateKeyError 插入或更新时键已存在
+type DuplicateKeyError struct {
+	TableName  string
+	ColumnName string
+	Key        interface{}
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key %v for %s.%s", e.Key, e.TableName, e.ColumnName)
+}
+
+// UniqueConstraintError 插入或更新的值违反了列上的 UNIQUE 约束或唯一索引
+type UniqueConstraintError struct {
+	TableName  string
+	ColumnName string
+	Value      interface{}
+}
+
+func (e *UniqueConstraintError) Error() string {
+	return fmt.Sprintf("unique constraint violated: value %v already exists in %s.%s", e.Value, e.TableName, e.ColumnName)
+}
@@ -18,12 +18,18 @@ const (
 	Res_INSERT
 	Res_CREATE
 	Res_UPDATE
+	Res_DELETE
+	Res_ANALYZE
+	Res_EXPLAIN
+	Res_CREATE_INDEX
+	Res_DROP_INDEX
 	Res_ERROR
 )
 
 type ExecuteResult struct {
 	resultType       ResultType
 	rows             map[string]interface{}
+	resultSet        *ResultSet
 	affectedRows     uint32
 	tableDefinitions []*SqlTableDefinition
 	slqParsed        *ASTNode
@@ -39,21 +45,47 @@ func NewExecuteResult(resultType ResultType, rowsData map[string]interface{}, af
 	}
 }
 
-func ForSelect(rowsData map[string]interface{}, tableDefinitions []*SqlTableDefinition, sqlParsed *ASTNode) ExecuteResult {
-	return NewExecuteResult(Res_SELECT, rowsData, 0, tableDefinitions, sqlParsed)
+func ForSelect(resultSet *ResultSet, tableDefinitions []*SqlTableDefinition, sqlParsed *ASTNode) ExecuteResult {
+	result := NewExecuteResult(Res_SELECT, nil, 0, tableDefinitions, sqlParsed)
+	result.resultSet = resultSet
+	return result
 }
 
 func ForInsert(affected uint32, tableDefinitions []*SqlTableDefinition) ExecuteResult {
 	return NewExecuteResult(Res_INSERT, nil, affected, tableDefinitions, nil)
 }
 
-func ForUpdate(rowsData map[string]interface{}, tableDefinitions []*SqlTableDefinition) ExecuteResult {
-	return NewExecuteResult(Res_UPDATE, rowsData, 1, tableDefinitions, nil)
+func ForUpdate(affected uint32, tableDefinitions []*SqlTableDefinition) ExecuteResult {
+	return NewExecuteResult(Res_UPDATE, nil, affected, tableDefinitions, nil)
+}
+
+func ForDelete(affected uint32, tableDefinitions []*SqlTableDefinition) ExecuteResult {
+	return NewExecuteResult(Res_DELETE, nil, affected, tableDefinitions, nil)
 }
 
 func ForCreate(tableDefinitions []*SqlTableDefinition) ExecuteResult {
 	return NewExecuteResult(Res_CREATE, nil, 0, tableDefinitions, nil)
 }
+func ForAnalyze(resultSet *ResultSet) ExecuteResult {
+	result := NewExecuteResult(Res_ANALYZE, nil, 0, nil, nil)
+	result.resultSet = resultSet
+	return result
+}
+
+func ForExplain(resultSet *ResultSet) ExecuteResult {
+	result := NewExecuteResult(Res_EXPLAIN, nil, 0, nil, nil)
+	result.resultSet = resultSet
+	return result
+}
+
+func ForCreateIndex(indexed uint32) ExecuteResult {
+	return NewExecuteResult(Res_CREATE_INDEX, nil, indexed, nil, nil)
+}
+
+func ForDropIndex() ExecuteResult {
+	return NewExecuteResult(Res_DROP_INDEX, nil, 0, nil, nil)
+}
+
 func ForError(errorMessage string) ExecuteResult {
 	rows := map[string]interface{}{"error": errorMessage}
 	return NewExecuteResult(Res_ERROR, rows, 0, nil, nil)
@@ -67,6 +99,16 @@ func (r ExecuteResult) String() string {
 		return r.formatInsertResult()
 	case Res_CREATE:
 		return r.formatCreateResult()
+	case Res_UPDATE:
+		return r.formatUpdateResult()
+	case Res_DELETE:
+		return r.formatDeleteResult()
+	case Res_CREATE_INDEX:
+		return fmt.Sprintf("Index created, %d row(s) indexed", r.affectedRows)
+	case Res_DROP_INDEX:
+		return "Index dropped"
+	case Res_ANALYZE, Res_EXPLAIN:
+		return r.resultSet.String()
 	case Res_ERROR:
 		return r.formatErrorResult()
 	default:
@@ -76,18 +118,13 @@ func (r ExecuteResult) String() string {
 
 // 格式化 SELECT 结果
 func (r ExecuteResult) formatSelectResult() string {
-	if r.rows == nil || len(r.rows) == 0 {
+	if r.resultSet.Len() == 0 {
 		return "Empty set"
 	}
 
 	var result strings.Builder
-	result.WriteString(fmt.Sprintf("%d row(s) in set\n", len(r.rows)))
-
-	// 如果需要显示具体数据，可以遍历 r.rows
-	for key, value := range r.rows {
-		result.WriteString(fmt.Sprintf("%v: %v\n", key, value))
-	}
-
+	result.WriteString(r.resultSet.String())
+	result.WriteString(fmt.Sprintf("%d row(s) in set\n", r.resultSet.Len()))
 	return result.String()
 }
 
@@ -96,6 +133,16 @@ func (r ExecuteResult) formatInsertResult() string {
 	return fmt.Sprintf("Query OK, %d row(s) affected", r.affectedRows)
 }
 
+// 格式化 UPDATE 结果
+func (r ExecuteResult) formatUpdateResult() string {
+	return fmt.Sprintf("Query OK, %d row(s) affected", r.affectedRows)
+}
+
+// 格式化 DELETE 结果
+func (r ExecuteResult) formatDeleteResult() string {
+	return fmt.Sprintf("Query OK, %d row(s) affected", r.affectedRows)
+}
+
 // 格式化 CREATE 结果
 func (r ExecuteResult) formatCreateResult() string {
 	if len(r.tableDefinitions) == 0 {
@@ -115,8 +162,14 @@ func (r ExecuteResult) formatCreateResult() string {
 		if col.IndexType == Primary {
 			sb.WriteString(" PRIMARY KEY")
 		}
+		if col.Unique {
+			sb.WriteString(" UNIQUE")
+		}
 		sb.WriteString("\n")
 	}
+	if len(tableDef.PrimaryKey) > 0 {
+		sb.WriteString(fmt.Sprintf("Primary key: (%s)\n", strings.Join(tableDef.PrimaryKey, ", ")))
+	}
 
 	return sb.String()
 }
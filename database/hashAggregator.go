@@ -0,0 +1,277 @@
+package database
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	. "godb/entity"
+	"godb/logger"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+)
+
+// @Title        hashAggregator.go
+// @Description  GROUP BY hash aggregation, spills new groups to partition files when over the memory budget
+
+// DEFAULT_AGGREGATE_MEMORY_BUDGET 分组聚合的哈希表默认可使用的内存（字节）
+const DEFAULT_AGGREGATE_MEMORY_BUDGET = 4 << 20
+
+const (
+	// AGGREGATE_PARTITIONS 哈希表超出内存预算后，新分组的输入按哈希值写入的分区文件数
+	AGGREGATE_PARTITIONS = 8
+	// AGGREGATE_MAX_DEPTH 分区再次超出预算时最多递归溢出的层数，之后整个分区在内存中聚合
+	AGGREGATE_MAX_DEPTH = 3
+	// aggregatorSize 估算一个聚合函数状态占用的字节数
+	aggregatorSize = 32
+)
+
+// aggregateGroup 一个分组的分组列值和每个聚合函数的状态
+type aggregateGroup struct {
+	values      []interface{}
+	aggregators []aggregator
+}
+
+// hashAggregator 哈希聚合：每条输入前 groupCount 个值是分组列，后面依次是每个聚合函数的参数
+// 哈希表超出内存预算后，已有分组继续在内存中累加，新分组的输入写入分区文件，
+// 同一分组的输入总是落在同一个分区，最后逐个分区递归聚合
+type hashAggregator struct {
+	functions  []*ColumnNode
+	groupCount int
+	directory  string
+	budget     int
+	depth      int
+	groups     map[string]*aggregateGroup
+	// 分组第一次出现的顺序，结果按这个顺序输出
+	order      []*aggregateGroup
+	size       int
+	partitions []*aggregatePartition
+}
+
+// aggregatePartition 溢出到磁盘的一个分区
+type aggregatePartition struct {
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *gob.Encoder
+}
+
+func newHashAggregator(functions []*ColumnNode, groupCount int, directory string, budget int, depth int) *hashAggregator {
+	return &hashAggregator{
+		functions:  functions,
+		groupCount: groupCount,
+		directory:  directory,
+		budget:     budget,
+		depth:      depth,
+		groups:     make(map[string]*aggregateGroup),
+		order:      make([]*aggregateGroup, 0),
+	}
+}
+
+// Len 返回内存中的分组数
+func (a *hashAggregator) Len() int {
+	return len(a.order)
+}
+
+// Add 把一条输入累加到所属的分组
+func (a *hashAggregator) Add(input []interface{}) error {
+	key := groupKey(input[:a.groupCount])
+	group, ok := a.groups[key]
+	if !ok {
+		if a.size > a.budget && a.depth < AGGREGATE_MAX_DEPTH {
+			return a.spill(key, input)
+		}
+		group = a.newGroup(key, input[:a.groupCount])
+	}
+	for i, aggregator := range group.aggregators {
+		if err := aggregator.add(input[a.groupCount+i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *hashAggregator) newGroup(key string, values []interface{}) *aggregateGroup {
+	group := &aggregateGroup{
+		values:      values,
+		aggregators: make([]aggregator, len(a.functions)),
+	}
+	for i, function := range a.functions {
+		group.aggregators[i] = newAggregator(function)
+	}
+	a.groups[key] = group
+	a.order = append(a.order, group)
+	a.size += len(key) + 16 + aggregatorSize*len(a.functions)
+	return group
+}
+
+// spill 把新分组的输入写入分区文件，分区号由分组键和递归层数决定
+func (a *hashAggregator) spill(key string, input []interface{}) error {
+	if a.partitions == nil {
+		a.partitions = make([]*aggregatePartition, AGGREGATE_PARTITIONS)
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte{byte(a.depth)})
+	hash.Write([]byte(key))
+	index := hash.Sum32() % AGGREGATE_PARTITIONS
+
+	partition := a.partitions[index]
+	if partition == nil {
+		file, err := os.CreateTemp(a.directory, "aggregate-*.tmp")
+		if err != nil {
+			return err
+		}
+		logger.Debug("spill aggregate partition %d at depth %d to %s", index, a.depth, file.Name())
+		writer := bufio.NewWriter(file)
+		partition = &aggregatePartition{file: file, writer: writer, encoder: gob.NewEncoder(writer)}
+		a.partitions[index] = partition
+	}
+	return partition.encoder.Encode(input)
+}
+
+// Groups 返回按顺序遍历所有分组的迭代器：先是内存中的分组，再逐个读回分区聚合出的分组
+func (a *hashAggregator) Groups() *groupIterator {
+	return &groupIterator{aggregator: a}
+}
+
+// loadPartition 读回一个分区，交给下一层的哈希聚合
+func (a *hashAggregator) loadPartition(partition *aggregatePartition) (*hashAggregator, error) {
+	if err := partition.writer.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := partition.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	child := newHashAggregator(a.functions, a.groupCount, a.directory, a.budget, a.depth+1)
+	decoder := gob.NewDecoder(bufio.NewReader(partition.file))
+	for {
+		var input []interface{}
+		if err := decoder.Decode(&input); err != nil {
+			if errors.Is(err, io.EOF) {
+				return child, nil
+			}
+			child.Close()
+			return nil, err
+		}
+		if err := child.Add(input); err != nil {
+			child.Close()
+			return nil, err
+		}
+	}
+}
+
+// Close 关闭并删除所有分区文件
+func (a *hashAggregator) Close() {
+	for _, partition := range a.partitions {
+		if partition == nil {
+			continue
+		}
+		partition.file.Close()
+		if err := os.Remove(partition.file.Name()); err != nil {
+			logger.Warn("failed to remove aggregate partition %s: %v", partition.file.Name(), err)
+		}
+	}
+	a.partitions = nil
+}
+
+// groupKey 把分组列的值编码成哈希表的键，不同类型和 NULL 的编码互不相同
+func groupKey(values []interface{}) string {
+	var sb strings.Builder
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			sb.WriteByte('N')
+		case uint32:
+			sb.WriteByte('I')
+			binary.Write(&sb, binary.BigEndian, v)
+		case string:
+			sb.WriteByte('S')
+			binary.Write(&sb, binary.BigEndian, uint32(len(v)))
+			sb.WriteString(v)
+		default:
+			sb.WriteString(fmt.Sprintf("?%T:%v;", v, v))
+		}
+	}
+	return sb.String()
+}
+
+// groupIterator 逐个输出分组的分组列值和聚合结果，同一时间只有一个分区在内存中聚合
+type groupIterator struct {
+	aggregator *hashAggregator
+	index      int
+	partition  int
+	// 当前分区的下一层聚合和它的迭代器
+	child       *hashAggregator
+	childGroups *groupIterator
+	values      []interface{}
+	results     []interface{}
+	err         error
+}
+
+func (it *groupIterator) Next() bool {
+	a := it.aggregator
+	if it.index < len(a.order) {
+		group := a.order[it.index]
+		it.index++
+		it.values = group.values
+		it.results = make([]interface{}, len(group.aggregators))
+		for i, aggregator := range group.aggregators {
+			it.results[i] = aggregator.result()
+		}
+		return true
+	}
+	for it.err == nil {
+		if it.childGroups != nil {
+			if it.childGroups.Next() {
+				it.values, it.results = it.childGroups.values, it.childGroups.results
+				return true
+			}
+			it.err = it.childGroups.Err()
+			it.closeChild()
+			continue
+		}
+		for it.partition < len(a.partitions) && a.partitions[it.partition] == nil {
+			it.partition++
+		}
+		if it.partition >= len(a.partitions) {
+			return false
+		}
+		it.child, it.err = a.loadPartition(a.partitions[it.partition])
+		it.partition++
+		if it.err == nil {
+			it.childGroups = it.child.Groups()
+		}
+	}
+	return false
+}
+
+// Values 返回当前分组的分组列值
+func (it *groupIterator) Values() []interface{} {
+	return it.values
+}
+
+// Results 返回当前分组每个聚合函数的结果
+func (it *groupIterator) Results() []interface{} {
+	return it.results
+}
+
+func (it *groupIterator) Err() error {
+	return it.err
+}
+
+// Close 释放还没有读完的分区聚合
+func (it *groupIterator) Close() {
+	it.closeChild()
+}
+
+func (it *groupIterator) closeChild() {
+	if it.childGroups != nil {
+		it.childGroups.Close()
+	}
+	if it.child != nil {
+		it.child.Close()
+	}
+	it.child, it.childGroups = nil, nil
+}
@@ -0,0 +1,560 @@
+package database
+
+import (
+	"fmt"
+	. "godb/entity"
+	"godb/logger"
+	"path/filepath"
+	"slices"
+)
+
+// @Title        join.go
+// @Description  join operator with index nested loop and block nested loop
+
+// JOIN_BLOCK_SIZE 块嵌套循环连接中一次缓存的外表行数，每个块只扫描一遍内表
+const JOIN_BLOCK_SIZE = 256
+
+// joinScope 参与连接的所有表，负责把列解析到所属的表
+// 连接后的行以 table.column 为键，列名在所有表中唯一时同时保留不带前缀的键
+type joinScope struct {
+	tables  []*SqlTableDefinition
+	columns map[string][]string
+}
+
+func newJoinScope() *joinScope {
+	return &joinScope{
+		tables:  make([]*SqlTableDefinition, 0),
+		columns: make(map[string][]string),
+	}
+}
+
+func (s *joinScope) addTable(definition *SqlTableDefinition) error {
+	if s.getTable(definition.TableName) != nil {
+		return fmt.Errorf("table %s appears more than once in join", definition.TableName)
+	}
+	s.tables = append(s.tables, definition)
+	for _, column := range definition.Columns {
+		s.columns[column.Name] = append(s.columns[column.Name], definition.TableName)
+	}
+	return nil
+}
+
+func (s *joinScope) getTable(tableName string) *SqlTableDefinition {
+	for _, table := range s.tables {
+		if table.TableName == tableName {
+			return table
+		}
+	}
+	return nil
+}
+
+// resolve 返回列所属的表名，列不存在或不带前缀的列名出现在多张表中时返回错误
+func (s *joinScope) resolve(column *ColumnNode) (string, error) {
+	if column.ColumnType == FUNCTION_CALL {
+		return "", fmt.Errorf("aggregate function %s is not allowed here", column)
+	}
+	if column.ColumnType == TABLE_NAME_PREFIXED {
+		table := s.getTable(column.TableName)
+		if table == nil {
+			return "", &UnknownTableError{TableName: column.TableName}
+		}
+		if table.GetColumn(column.ColumnName) == nil {
+			return "", fmt.Errorf("unknown column %s in table %s", column.ColumnName, column.TableName)
+		}
+		return column.TableName, nil
+	}
+	tables := s.columns[column.ColumnName]
+	switch len(tables) {
+	case 0:
+		return "", fmt.Errorf("unknown column %s", column.ColumnName)
+	case 1:
+		return tables[0], nil
+	default:
+		return "", fmt.Errorf("column %s is ambiguous", column.ColumnName)
+	}
+}
+
+// resolveAll 检查表达式中引用的列都能解析
+func (s *joinScope) resolveAll(expression ASTNode) error {
+	for _, column := range referencedColumns(expression) {
+		if _, err := s.resolve(column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveTableColumns 检查单表的条件中引用的列都在 definition 表中
+func resolveTableColumns(definition *SqlTableDefinition, expression ASTNode) error {
+	scope := newJoinScope()
+	scope.addTable(definition)
+	return scope.resolveAll(expression)
+}
+
+// selectColumns 返回结果集的列名，SELECT * 展开为所有表的 table.column
+func (s *joinScope) selectColumns(columns []*ColumnNode) ([]string, error) {
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if column.ColumnType == WILDCARDN {
+			for _, table := range s.tables {
+				for _, col := range table.Columns {
+					names = append(names, qualifiedName(table.TableName, col.Name))
+				}
+			}
+			continue
+		}
+		if _, err := s.resolve(column); err != nil {
+			return nil, err
+		}
+		names = append(names, column.String())
+	}
+	return names, nil
+}
+
+// merge 把 tableName 表的一行并入已经连接好的行，返回新的行
+func (s *joinScope) merge(joined map[string]interface{}, tableName string, row map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(joined)+2*len(row))
+	for key, value := range joined {
+		result[key] = value
+	}
+	for column, value := range row {
+		result[qualifiedName(tableName, column)] = value
+		if len(s.columns[column]) == 1 {
+			result[column] = value
+		}
+	}
+	return result
+}
+
+// nullRow 返回表的全 NULL 行，用于外连接中没有匹配的一侧
+func (s *joinScope) nullRow(tableName string) map[string]interface{} {
+	row := make(map[string]interface{})
+	for _, column := range s.getTable(tableName).Columns {
+		row[column.Name] = nil
+	}
+	return row
+}
+
+// tableConjuncts 取出 where 中只涉及 tableName 一张表的 AND 条件，用于在扫描该表时提前过滤
+func (s *joinScope) tableConjuncts(where ASTNode, tableName string) ASTNode {
+	conjuncts := make([]ASTNode, 0)
+	for _, conjunct := range splitConjuncts(where) {
+		columns := referencedColumns(conjunct)
+		if len(columns) == 0 {
+			continue
+		}
+		onlyThisTable := true
+		for _, column := range columns {
+			if table, err := s.resolve(column); err != nil || table != tableName {
+				onlyThisTable = false
+				break
+			}
+		}
+		if onlyThisTable {
+			conjuncts = append(conjuncts, conjunct)
+		}
+	}
+	return andAll(conjuncts)
+}
+
+// buildJoinScope 收集 FROM 和所有 JOIN 的表，并检查 WHERE 和 ON 中的列都能解析
+func (e *SqlQueryExecutor) buildJoinScope(node *SelectNode) (*joinScope, error) {
+	scope := newJoinScope()
+	tableNames := []string{node.TableName}
+	for _, join := range node.Join {
+		tableNames = append(tableNames, join.TableName)
+	}
+	for _, tableName := range tableNames {
+		definition := e.SqlTableManager.getTableDefinition(tableName)
+		if definition == nil {
+			return nil, &UnknownTableError{TableName: tableName}
+		}
+		if err := scope.addTable(definition); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := scope.resolveAll(node.WhereClause); err != nil {
+		return nil, err
+	}
+	for _, join := range node.Join {
+		if err := scope.resolveAll(join.Condition); err != nil {
+			return nil, err
+		}
+	}
+	return scope, nil
+}
+
+// pushdownConjuncts 返回每张表扫描时可以提前计算的 WHERE 条件
+// 外连接中会被补 NULL 的表不能提前过滤，否则本该被 WHERE 过滤掉的行会变成补 NULL 的行
+func (s *joinScope) pushdownConjuncts(node *SelectNode) map[string]ASTNode {
+	nullable := make(map[string]bool)
+	for i, join := range node.Join {
+		switch join.Kind {
+		case LeftJoin:
+			nullable[join.TableName] = true
+		case RightJoin:
+			for _, table := range s.tables[:i+1] {
+				nullable[table.TableName] = true
+			}
+		}
+	}
+	pushdown := make(map[string]ASTNode, len(s.tables))
+	for _, table := range s.tables {
+		if !nullable[table.TableName] {
+			pushdown[table.TableName] = s.tableConjuncts(node.WhereClause, table.TableName)
+		}
+	}
+	return pushdown
+}
+
+// residualConjuncts 去掉 where 中已经下推到各表扫描的 AND 条件，返回连接之后还需要计算的条件
+func residualConjuncts(where ASTNode, pushdown map[string]ASTNode) ASTNode {
+	pushed := make(map[ASTNode]bool)
+	for _, conjuncts := range pushdown {
+		for _, conjunct := range splitAnd(conjuncts) {
+			pushed[conjunct] = true
+		}
+	}
+	residual := make([]ASTNode, 0)
+	for _, conjunct := range splitAnd(where) {
+		if !pushed[conjunct] {
+			residual = append(residual, conjunct)
+		}
+	}
+	return andAll(residual)
+}
+
+// indexJoinColumn 在 ON 条件中查找 内表索引的第一列 = 外侧列 的等值条件，返回使用的索引，主键优先
+func (s *joinScope) indexJoinColumn(join *JoinNode, definition *SqlTableDefinition) (index *tableIndex, outerColumn *ColumnNode, found bool) {
+	indexes, err := tableIndexes(definition)
+	if err != nil {
+		return nil, nil, false
+	}
+	for _, conjunct := range splitConjuncts(join.Condition) {
+		if conjunct.Operator != EQUALS {
+			continue
+		}
+		left, leftOk := conjunct.Left.(*ColumnNode)
+		right, rightOk := conjunct.Right.(*ColumnNode)
+		if !leftOk || !rightOk {
+			continue
+		}
+		leftTable, _ := s.resolve(left)
+		rightTable, _ := s.resolve(right)
+		inner, outer := left, right
+		if rightTable == definition.TableName && leftTable != definition.TableName {
+			inner, outer = right, left
+		} else if leftTable != definition.TableName || rightTable == definition.TableName {
+			continue
+		}
+
+		i := slices.IndexFunc(indexes, func(index *tableIndex) bool {
+			return index.columns[0] == inner.ColumnName
+		})
+		if i == 0 {
+			return indexes[0], outer, true
+		}
+		if i > 0 && !found {
+			index, outerColumn, found = indexes[i], outer, true
+		}
+	}
+	return index, outerColumn, found
+}
+
+// qualifyOperator 把单表的行转换成连接后的行，列名加上表名前缀
+type qualifyOperator struct {
+	rowState
+	child     operator
+	scope     *joinScope
+	tableName string
+}
+
+func newQualifyOperator(child operator, scope *joinScope, tableName string) *qualifyOperator {
+	return &qualifyOperator{child: child, scope: scope, tableName: tableName}
+}
+
+func (o *qualifyOperator) Open() error {
+	return o.child.Open()
+}
+
+func (o *qualifyOperator) Next() bool {
+	if !o.child.Next() {
+		o.err = o.child.Err()
+		return false
+	}
+	o.row = o.scope.merge(nil, o.tableName, o.child.Row())
+	return true
+}
+
+func (o *qualifyOperator) Close() {
+	o.child.Close()
+}
+
+// explain 加表名前缀不改变行，EXPLAIN 中直接显示子算子
+func (o *qualifyOperator) explain() *planNode {
+	return o.child.explain()
+}
+
+// joinOperator 把外侧算子输出的已连接行与内表连接，结果按外侧行的顺序输出
+// ON 中有 内表索引列 = 外侧列 的等值条件时，对每一行外侧行在内表索引上查找（索引嵌套循环）；
+// 否则每次读入 JOIN_BLOCK_SIZE 行外侧行，扫描一遍内表与整块比较（块嵌套循环）
+// RIGHT JOIN 在外侧读完之后，再扫描一遍内表输出没有匹配过的行
+type joinOperator struct {
+	rowState
+	executor   *SqlQueryExecutor
+	outer      operator
+	scope      *joinScope
+	join       *JoinNode
+	definition *SqlTableDefinition
+	// 内表主键的列，RIGHT JOIN 按编码后的主键记录匹配过的内表行
+	priKeyColumns []string
+	innerWhere    ASTNode
+	// 索引嵌套循环使用的内表索引和与索引第一列相等的外侧列，innerIndex 为 nil 时使用块嵌套循环
+	innerIndex  *tableIndex
+	outerColumn *ColumnNode
+	// 当前块还没有输出的连接结果
+	pending      []map[string]interface{}
+	matchedInner map[string]bool
+	outerDone    bool
+	// RIGHT JOIN 中输出没有匹配的内表行的扫描，以及外侧所有表补 NULL 的行
+	unmatched operator
+	padded    map[string]interface{}
+}
+
+func (e *SqlQueryExecutor) newJoinOperator(outer operator, scope *joinScope, join *JoinNode, definition *SqlTableDefinition, innerWhere ASTNode) *joinOperator {
+	o := &joinOperator{
+		executor:      e,
+		outer:         outer,
+		scope:         scope,
+		join:          join,
+		definition:    definition,
+		priKeyColumns: definition.PrimaryKeyColumns(),
+		innerWhere:    innerWhere,
+	}
+	if innerIndex, outerColumn, found := scope.indexJoinColumn(join, definition); found {
+		o.innerIndex, o.outerColumn = innerIndex, outerColumn
+	}
+	return o
+}
+
+func (o *joinOperator) Open() error {
+	if o.innerIndex != nil {
+		logger.Debug("index nested loop %v %s on %s", o.join.Kind, o.definition.TableName, o.innerIndex.name)
+	} else {
+		logger.Debug("block nested loop %v %s", o.join.Kind, o.definition.TableName)
+	}
+	o.pending = nil
+	o.matchedInner = make(map[string]bool)
+	o.outerDone = false
+	return o.outer.Open()
+}
+
+func (o *joinOperator) Next() bool {
+	for len(o.pending) == 0 && o.err == nil {
+		if o.outerDone {
+			return o.nextUnmatched()
+		}
+		block := o.readBlock()
+		if o.err != nil {
+			return false
+		}
+		if len(block) == 0 {
+			o.outerDone = true
+			if o.join.Kind != RightJoin {
+				return false
+			}
+			o.err = o.openUnmatched()
+			continue
+		}
+		o.pending, o.err = o.joinBlock(block)
+	}
+	if o.err != nil {
+		return false
+	}
+	o.row = o.pending[0]
+	o.pending = o.pending[1:]
+	return true
+}
+
+// readBlock 从外侧读入下一块，索引嵌套循环每次只读一行
+func (o *joinOperator) readBlock() []map[string]interface{} {
+	size := JOIN_BLOCK_SIZE
+	if o.innerIndex != nil {
+		size = 1
+	}
+	block := make([]map[string]interface{}, 0, size)
+	for len(block) < size && o.outer.Next() {
+		block = append(block, o.outer.Row())
+	}
+	o.err = o.outer.Err()
+	return block
+}
+
+// joinBlock 连接一块外侧行，LEFT JOIN 中没有匹配的外侧行输出补 NULL 的行
+func (o *joinOperator) joinBlock(block []map[string]interface{}) ([]map[string]interface{}, error) {
+	matches := make([][]map[string]interface{}, len(block))
+	if o.innerIndex != nil {
+		for i, outer := range block {
+			key := columnValue(outer, o.outerColumn)
+			if !isKeyValue(key, o.innerIndex.types[0]) {
+				continue
+			}
+			scan := &indexScan{index: o.innerIndex, primaryKey: o.priKeyColumns, lo: key, hi: key}
+			err := o.scanInner(scan, func(inner map[string]interface{}) error {
+				joined, ok, err := o.match(outer, inner)
+				if ok {
+					matches[i] = append(matches[i], joined)
+				}
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		scan, err := o.executor.chooseIndexScan(o.innerWhere, o.definition)
+		if err != nil {
+			return nil, err
+		}
+		err = o.scanInner(scan, func(inner map[string]interface{}) error {
+			for i, outer := range block {
+				joined, ok, err := o.match(outer, inner)
+				if err != nil {
+					return err
+				}
+				if ok {
+					matches[i] = append(matches[i], joined)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]map[string]interface{}, 0, len(block))
+	for i, outer := range block {
+		if len(matches[i]) == 0 && o.join.Kind == LeftJoin {
+			result = append(result, o.scope.merge(outer, o.definition.TableName, o.scope.nullRow(o.definition.TableName)))
+			continue
+		}
+		result = append(result, matches[i]...)
+	}
+	return result, nil
+}
+
+// scanInner 按访问路径扫描内表，对每一行满足内表条件的行调用 visit，visit 返回错误时停止扫描
+func (o *joinOperator) scanInner(scan *indexScan, visit func(inner map[string]interface{}) error) error {
+	inner, err := o.executor.newScanOperator(o.definition, scan, o.innerWhere)
+	if err != nil {
+		return err
+	}
+	if err := inner.Open(); err != nil {
+		inner.Close()
+		return err
+	}
+	defer inner.Close()
+	for inner.Next() {
+		if err := visit(inner.Row()); err != nil {
+			return err
+		}
+	}
+	return inner.Err()
+}
+
+// match 判断外侧行与内表行是否满足连接条件，满足时返回连接后的行
+func (o *joinOperator) match(outer map[string]interface{}, inner map[string]interface{}) (map[string]interface{}, bool, error) {
+	joined := o.scope.merge(outer, o.definition.TableName, inner)
+	if matched, err := matchRow(joined, o.join.Condition); !matched || err != nil {
+		return nil, false, err
+	}
+	if o.join.Kind == RightJoin {
+		o.matchedInner[o.innerKey(inner)] = true
+	}
+	return joined, true, nil
+}
+
+// innerKey 内表行编码后的主键，用于记录匹配过的内表行
+func (o *joinOperator) innerKey(inner map[string]interface{}) string {
+	key, _ := encodeKey(inner, o.priKeyColumns)
+	return string(key)
+}
+
+// openUnmatched 开始扫描内表，查找 RIGHT JOIN 中没有匹配到任何外侧行的行
+func (o *joinOperator) openUnmatched() error {
+	scan, err := o.executor.chooseIndexScan(o.innerWhere, o.definition)
+	if err != nil {
+		return err
+	}
+	if o.unmatched, err = o.executor.newScanOperator(o.definition, scan, o.innerWhere); err != nil {
+		return err
+	}
+	o.padded = nil
+	for _, table := range o.scope.tables {
+		if table.TableName == o.definition.TableName {
+			break
+		}
+		o.padded = o.scope.merge(o.padded, table.TableName, o.scope.nullRow(table.TableName))
+	}
+	return o.unmatched.Open()
+}
+
+// nextUnmatched 输出下一行没有匹配的内表行，外侧所有表补 NULL
+func (o *joinOperator) nextUnmatched() bool {
+	if o.unmatched == nil {
+		return false
+	}
+	for o.unmatched.Next() {
+		inner := o.unmatched.Row()
+		if !o.matchedInner[o.innerKey(inner)] {
+			o.row = o.scope.merge(o.padded, o.definition.TableName, inner)
+			return true
+		}
+	}
+	o.err = o.unmatched.Err()
+	return false
+}
+
+func (o *joinOperator) Close() {
+	if o.unmatched != nil {
+		o.unmatched.Close()
+		o.unmatched = nil
+	}
+	o.outer.Close()
+}
+
+// explain 外侧计划在前，内表的访问方式在后
+// 索引嵌套循环的查找键来自外侧行，内表显示为以外侧列为键的索引查找
+func (o *joinOperator) explain() *planNode {
+	var inner *planNode
+	name := "BlockNestedLoopJoin"
+	if o.innerIndex != nil {
+		name = "IndexNestedLoopJoin"
+		manager := o.executor.SqlTableManager
+		kind, file := "primary", manager.primaryIndexFile(o.definition.TableName)
+		if o.innerIndex.secondary {
+			kind, file = "secondary", manager.secondaryIndexFile(o.definition.TableName, o.innerIndex.name)
+		}
+		inner = newPlanNode("IndexScan", fmt.Sprintf("%s index %s: %s = %v", kind, filepath.Base(file), o.innerIndex.columns[0], o.outerColumn))
+		if stats := manager.getTableStatistics(o.definition.TableName); stats != nil {
+			inner.rows = stats.rowsPerPrefix(o.innerIndex, 1)
+		}
+		if o.innerWhere != nil {
+			inner = newPlanNode("Filter", fmt.Sprintf("%v", o.innerWhere), inner)
+		}
+	} else {
+		scan, err := o.executor.chooseIndexScan(o.innerWhere, o.definition)
+		if err == nil {
+			var scanner operator
+			if scanner, err = o.executor.newScanOperator(o.definition, scan, o.innerWhere); err == nil {
+				inner = scanner.explain()
+			}
+		}
+		if err != nil {
+			inner = newPlanNode("Scan", fmt.Sprintf("%s: %v", o.definition.TableName, err))
+		}
+	}
+	return newPlanNode(name, o.join.String(), o.outer.explain(), inner)
+}
@@ -0,0 +1,467 @@
+package database
+
+import (
+	"fmt"
+	"godb/disktree"
+	. "godb/entity"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// @Title        operator.go
+// @Description  pull-based (Volcano) operators for select: scans, filter, project, sort, limit
+
+// operator 火山模型的算子：Open 之后反复调用 Next 拉取下一行，结束或出错时 Next 返回 false，
+// 出错时 Err 返回错误，Close 释放算子及其子算子的资源
+// explain 返回算子在 EXPLAIN 中的描述，不需要先 Open
+type operator interface {
+	Open() error
+	Next() bool
+	Row() map[string]interface{}
+	Err() error
+	Close()
+	explain() *planNode
+}
+
+// planNode EXPLAIN 输出的执行计划中的一个算子
+type planNode struct {
+	name   string
+	detail string
+	// 估算的输出行数，没有统计信息时为 -1
+	rows     float64
+	children []*planNode
+}
+
+func newPlanNode(name string, detail string, children ...*planNode) *planNode {
+	return &planNode{name: name, detail: detail, rows: -1, children: children}
+}
+
+// rowState 算子当前的行和错误
+type rowState struct {
+	row map[string]interface{}
+	err error
+}
+
+func (s *rowState) Row() map[string]interface{} {
+	return s.row
+}
+
+func (s *rowState) Err() error {
+	return s.err
+}
+
+// drain 打开算子并读出所有行
+func drain(op operator) ([]map[string]interface{}, error) {
+	if err := op.Open(); err != nil {
+		op.Close()
+		return nil, err
+	}
+	defer op.Close()
+	rows := make([]map[string]interface{}, 0)
+	for op.Next() {
+		rows = append(rows, op.Row())
+	}
+	return rows, op.Err()
+}
+
+// tableScanOperator 沿主键索引的叶子链表读取整张表
+type tableScanOperator struct {
+	rowState
+	tree       *disktree.BPTree
+	definition *SqlTableDefinition
+	// 按主键降序读取
+	descending bool
+	it         *disktree.TreeIterator
+	// 已经读出的行数
+	scanned int
+	// 主键索引文件和估算的行数，只用于 EXPLAIN
+	file          string
+	estimatedRows float64
+}
+
+func newTableScanOperator(tree *disktree.BPTree, definition *SqlTableDefinition) *tableScanOperator {
+	return &tableScanOperator{tree: tree, definition: definition, estimatedRows: -1}
+}
+
+func (o *tableScanOperator) Open() error {
+	if o.descending {
+		o.it = o.tree.ReverseRange(nil, nil)
+	} else {
+		o.it = o.tree.Iterator()
+	}
+	return nil
+}
+
+func (o *tableScanOperator) Next() bool {
+	if o.err != nil || !o.it.Next() {
+		if o.err == nil {
+			o.err = o.it.Err()
+		}
+		return false
+	}
+	o.row, o.err = deserializeRow(o.definition, o.it.Value())
+	if o.err != nil {
+		return false
+	}
+	o.scanned++
+	return true
+}
+
+func (o *tableScanOperator) Close() {}
+
+func (o *tableScanOperator) explain() *planNode {
+	detail := fmt.Sprintf("%s: all rows of %s", filepath.Base(o.file), o.definition.TableName)
+	if o.descending {
+		detail += ", descending"
+	}
+	node := newPlanNode("TableScan", detail)
+	node.rows = o.estimatedRows
+	return node
+}
+
+// indexScanOperator 在主键或二级索引上读取前缀之后一列的 [lo, hi] 区间，或者按 IN 的键逐个查找
+// 二级索引的值是主键，再回主键索引读取整行
+type indexScanOperator struct {
+	rowState
+	primaryTree *disktree.BPTree
+	// 二级索引，为 nil 时直接扫描主键索引
+	indexTree  *disktree.BPTree
+	definition *SqlTableDefinition
+	scan       *indexScan
+	// 依次读取的索引键区间，IN 的每个键是一个区间
+	ranges  [][2][]byte
+	current int
+	it      *disktree.TreeIterator
+	scanned int
+	// 扫描的索引文件，只用于 EXPLAIN
+	file string
+}
+
+func newIndexScanOperator(primaryTree *disktree.BPTree, indexTree *disktree.BPTree, definition *SqlTableDefinition, scan *indexScan, file string) *indexScanOperator {
+	return &indexScanOperator{
+		primaryTree: primaryTree,
+		indexTree:   indexTree,
+		definition:  definition,
+		scan:        scan,
+		file:        file,
+	}
+}
+
+func (o *indexScanOperator) Open() error {
+	o.ranges = make([][2][]byte, 0, max(len(o.scan.keys), 1))
+	if o.scan.keys != nil {
+		for _, key := range o.scan.keys {
+			keyRange, err := o.scan.keyRange(key, key)
+			if err != nil {
+				return err
+			}
+			o.ranges = append(o.ranges, keyRange)
+		}
+	} else if !o.scan.empty() {
+		keyRange, err := o.scan.keyRange(o.scan.lo, o.scan.hi)
+		if err != nil {
+			return err
+		}
+		o.ranges = append(o.ranges, keyRange)
+	}
+	if o.scan.descending {
+		slices.Reverse(o.ranges)
+	}
+	o.current = 0
+	o.it = nil
+	return nil
+}
+
+func (o *indexScanOperator) Next() bool {
+	tree := o.primaryTree
+	if o.indexTree != nil {
+		tree = o.indexTree
+	}
+	for o.err == nil {
+		if o.it == nil {
+			if o.current >= len(o.ranges) {
+				return false
+			}
+			if o.scan.descending {
+				o.it = tree.ReverseRange(o.ranges[o.current][0], o.ranges[o.current][1])
+			} else {
+				o.it = tree.Range(o.ranges[o.current][0], o.ranges[o.current][1])
+			}
+			o.current++
+		}
+		if !o.it.Next() {
+			o.err = o.it.Err()
+			o.it = nil
+			continue
+		}
+
+		value := o.it.Value()
+		if o.indexTree != nil {
+			record, found, err := o.primaryTree.Search(value)
+			if err != nil {
+				o.err = err
+				return false
+			}
+			if !found {
+				continue
+			}
+			value = record.([]byte)
+		}
+		o.row, o.err = deserializeRow(o.definition, value)
+		if o.err == nil {
+			o.scanned++
+			return true
+		}
+	}
+	return false
+}
+
+func (o *indexScanOperator) Close() {}
+
+func (o *indexScanOperator) explain() *planNode {
+	kind := "primary"
+	if o.indexTree != nil {
+		kind = "secondary"
+	}
+	detail := fmt.Sprintf("%s index %s: %s", kind, filepath.Base(o.file), o.scan)
+	if o.scan.descending {
+		detail += ", descending"
+	}
+	node := newPlanNode("IndexScan", detail)
+	node.rows = o.scan.rows
+	return node
+}
+
+// filterOperator 只输出满足条件的行
+type filterOperator struct {
+	rowState
+	child     operator
+	predicate ASTNode
+}
+
+func newFilterOperator(child operator, predicate ASTNode) *filterOperator {
+	return &filterOperator{child: child, predicate: predicate}
+}
+
+func (o *filterOperator) Open() error {
+	return o.child.Open()
+}
+
+func (o *filterOperator) Next() bool {
+	for o.child.Next() {
+		matched, err := matchRow(o.child.Row(), o.predicate)
+		if err != nil {
+			o.err = err
+			return false
+		}
+		if matched {
+			o.row = o.child.Row()
+			return true
+		}
+	}
+	o.err = o.child.Err()
+	return false
+}
+
+func (o *filterOperator) Close() {
+	o.child.Close()
+}
+
+func (o *filterOperator) explain() *planNode {
+	// 访问路径已经按谓词中的索引条件估算过行数，这里沿用子算子的估算
+	child := o.child.explain()
+	node := newPlanNode("Filter", fmt.Sprintf("%v", o.predicate), child)
+	node.rows = child.rows
+	return node
+}
+
+// projectOperator 只保留结果集需要的列
+type projectOperator struct {
+	rowState
+	child   operator
+	columns []string
+}
+
+func newProjectOperator(child operator, columns []string) *projectOperator {
+	return &projectOperator{child: child, columns: columns}
+}
+
+func (o *projectOperator) Open() error {
+	return o.child.Open()
+}
+
+func (o *projectOperator) Next() bool {
+	if !o.child.Next() {
+		o.err = o.child.Err()
+		return false
+	}
+	row := o.child.Row()
+	o.row = make(map[string]interface{}, len(o.columns))
+	for _, column := range o.columns {
+		o.row[column] = row[column]
+	}
+	return true
+}
+
+func (o *projectOperator) Close() {
+	o.child.Close()
+}
+
+func (o *projectOperator) explain() *planNode {
+	child := o.child.explain()
+	node := newPlanNode("Project", strings.Join(o.columns, ", "), child)
+	node.rows = child.rows
+	return node
+}
+
+// sortOperator 在 Open 时读完子算子并排序，超出内存预算的部分写入数据目录下的临时文件
+type sortOperator struct {
+	rowState
+	child     operator
+	orderBy   []*OrderByNode
+	directory string
+	budget    int
+	sorter    *rowSorter
+	sorted    *sortedRows
+}
+
+func newSortOperator(child operator, orderBy []*OrderByNode, directory string, budget int) *sortOperator {
+	return &sortOperator{child: child, orderBy: orderBy, directory: directory, budget: budget}
+}
+
+func (o *sortOperator) Open() error {
+	if err := o.child.Open(); err != nil {
+		return err
+	}
+	o.sorter = newRowSorter(o.orderBy, o.directory, o.budget)
+	for o.child.Next() {
+		if err := o.sorter.Add(o.child.Row()); err != nil {
+			return err
+		}
+	}
+	if err := o.child.Err(); err != nil {
+		return err
+	}
+	sorted, err := o.sorter.Sort()
+	if err != nil {
+		return err
+	}
+	o.sorted = sorted
+	return nil
+}
+
+func (o *sortOperator) Next() bool {
+	if !o.sorted.Next() {
+		o.err = o.sorted.Err()
+		return false
+	}
+	o.row = o.sorted.Row()
+	return true
+}
+
+func (o *sortOperator) Close() {
+	if o.sorted != nil {
+		o.sorted.Close()
+	}
+	if o.sorter != nil {
+		o.sorter.Close()
+	}
+	o.child.Close()
+}
+
+func (o *sortOperator) explain() *planNode {
+	keys := make([]string, len(o.orderBy))
+	for i, order := range o.orderBy {
+		keys[i] = order.String()
+	}
+	child := o.child.explain()
+	node := newPlanNode("Sort", strings.Join(keys, ", "), child)
+	node.rows = child.rows
+	return node
+}
+
+// limitOperator 跳过 offset 行后最多输出 count 行，取够之后不再从子算子拉取
+type limitOperator struct {
+	rowState
+	child  operator
+	offset int
+	count  int
+	// 已经跳过和输出的行数，每次 Open 时重新计数
+	skipped int
+	emitted int
+}
+
+func newLimitOperator(child operator, limit *LimitNode) *limitOperator {
+	return &limitOperator{child: child, offset: int(limit.Offset), count: int(limit.Count)}
+}
+
+func (o *limitOperator) Open() error {
+	o.skipped, o.emitted = 0, 0
+	return o.child.Open()
+}
+
+func (o *limitOperator) Next() bool {
+	if o.emitted >= o.count {
+		return false
+	}
+	for ; o.skipped < o.offset; o.skipped++ {
+		if !o.child.Next() {
+			o.err = o.child.Err()
+			return false
+		}
+	}
+	if !o.child.Next() {
+		o.err = o.child.Err()
+		return false
+	}
+	o.row = o.child.Row()
+	o.emitted++
+	return true
+}
+
+func (o *limitOperator) Close() {
+	o.child.Close()
+}
+
+func (o *limitOperator) explain() *planNode {
+	child := o.child.explain()
+	node := newPlanNode("Limit", NewLimitNode(uint32(o.count), uint32(o.offset)).String(), child)
+	if child.rows >= 0 {
+		node.rows = max(min(child.rows-float64(o.offset), float64(o.count)), 0)
+	}
+	return node
+}
+
+// valuesOperator 输出事先算好的行
+type valuesOperator struct {
+	rowState
+	rows  []map[string]interface{}
+	index int
+}
+
+func newValuesOperator(rows []map[string]interface{}) *valuesOperator {
+	return &valuesOperator{rows: rows}
+}
+
+func (o *valuesOperator) Open() error {
+	o.index = 0
+	return nil
+}
+
+func (o *valuesOperator) Next() bool {
+	if o.index >= len(o.rows) {
+		return false
+	}
+	o.row = o.rows[o.index]
+	o.index++
+	return true
+}
+
+func (o *valuesOperator) Close() {}
+
+func (o *valuesOperator) explain() *planNode {
+	node := newPlanNode("Values", fmt.Sprintf("%d rows", len(o.rows)))
+	node.rows = float64(len(o.rows))
+	return node
+}
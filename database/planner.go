@@ -0,0 +1,318 @@
+package database
+
+import (
+	"fmt"
+	"godb/disktree"
+	. "godb/entity"
+	"godb/logger"
+	"math"
+)
+
+// @Title        planner.go
+// @Description  build the operator tree of a select statement
+
+// buildPlan 根据 SELECT 语句构建算子树，返回根算子和结果集的列名
+// 子查询需要事先用 resolveSubqueries 物化
+func (e *SqlQueryExecutor) buildPlan(node *SelectNode) (operator, []string, error) {
+	if hasAggregate(node.Columns) || len(node.GroupBy) > 0 || node.Having != nil {
+		return e.buildAggregatePlan(node)
+	}
+	if len(node.Join) > 0 {
+		return e.buildJoinPlan(node)
+	}
+	return e.buildTablePlan(node)
+}
+
+// buildTablePlan 单表查询：扫描 -> 过滤 -> 排序 -> LIMIT -> 投影，索引顺序满足 ORDER BY 时不排序
+func (e *SqlQueryExecutor) buildTablePlan(node *SelectNode) (operator, []string, error) {
+	definition := e.SqlTableManager.getTableDefinition(node.TableName)
+	if definition == nil {
+		return nil, nil, &UnknownTableError{TableName: node.TableName}
+	}
+	columns, err := selectColumns(node, definition)
+	if err != nil {
+		return nil, nil, err
+	}
+	// WHERE 中的列只能来自这张表，子查询引用外层查询的列时在这里报错
+	if err := resolveTableColumns(definition, node.WhereClause); err != nil {
+		return nil, nil, err
+	}
+	for _, order := range node.OrderByColumns {
+		if definition.GetColumn(order.Column.ColumnName) == nil {
+			return nil, nil, fmt.Errorf("unknown column %s in order by", order.Column.ColumnName)
+		}
+	}
+
+	scan, err := e.chooseIndexScan(node.WhereClause, definition)
+	if err != nil {
+		return nil, nil, err
+	}
+	sorted := true
+	if len(node.OrderByColumns) > 0 {
+		ordered, constant := scan.orderedBy()
+		satisfied, reverse := indexOrderSatisfies(node.OrderByColumns, ordered, constant)
+		logger.Debug("order by satisfied by index order %v: %v, reverse: %v", ordered, satisfied, reverse)
+		// 降序时反向扫描索引
+		sorted, scan.descending = satisfied, satisfied && reverse
+	}
+	plan, err := e.newScanOperator(definition, scan, node.WhereClause)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !sorted {
+		plan = e.newSortOperator(plan, node.OrderByColumns)
+	}
+	return e.finishPlan(plan, node, columns), columns, nil
+}
+
+// buildJoinPlan 连接查询：扫描 FROM 表，依次与每个 JOIN 的表连接，再计算完整的 WHERE
+func (e *SqlQueryExecutor) buildJoinPlan(node *SelectNode) (operator, []string, error) {
+	scope, err := e.buildJoinScope(node)
+	if err != nil {
+		return nil, nil, err
+	}
+	columns, err := scope.selectColumns(node.Columns)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, order := range node.OrderByColumns {
+		if _, err := scope.resolve(order.Column); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	plan, err := e.buildJoinInput(scope, node)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(node.OrderByColumns) > 0 {
+		plan = e.newSortOperator(plan, node.OrderByColumns)
+	}
+	return e.finishPlan(plan, node, columns), columns, nil
+}
+
+// buildJoinInput 返回连接并经过 WHERE 过滤后的行，只涉及一张表的条件在扫描该表时提前计算，连接之后不再重复计算
+func (e *SqlQueryExecutor) buildJoinInput(scope *joinScope, node *SelectNode) (operator, error) {
+	pushdown := scope.pushdownConjuncts(node)
+	node, where := e.orderJoins(scope, node, pushdown)
+	definition := scope.getTable(node.TableName)
+	scan, err := e.chooseIndexScan(pushdown[definition.TableName], definition)
+	if err != nil {
+		return nil, err
+	}
+	outer, err := e.newScanOperator(definition, scan, pushdown[definition.TableName])
+	if err != nil {
+		return nil, err
+	}
+	var plan operator = newQualifyOperator(outer, scope, definition.TableName)
+	for _, join := range node.Join {
+		inner := scope.getTable(join.TableName)
+		plan = e.newJoinOperator(plan, scope, join, inner, pushdown[inner.TableName])
+	}
+	if where = residualConjuncts(where, pushdown); where != nil {
+		plan = newFilterOperator(plan, where)
+	}
+	return plan, nil
+}
+
+// orderJoins 所有连接都是内连接或 CROSS JOIN 且每张表都有统计信息时，按估算代价贪心地重排连接顺序：
+// 先读估算行数最少的表，之后每一步加入连接代价最小的表
+// 内连接的 ON 条件与 WHERE 等价，重排后每个条件挂在它引用的表都已连接的那一步，连接之后再和没有下推的 WHERE 条件一起过滤一遍
+// 返回重排后的查询和连接之后的过滤条件，不能重排时原样返回
+func (e *SqlQueryExecutor) orderJoins(scope *joinScope, node *SelectNode, pushdown map[string]ASTNode) (*SelectNode, ASTNode) {
+	for _, join := range node.Join {
+		if join.Kind != InnerJoin && join.Kind != CrossJoin {
+			return node, node.WhereClause
+		}
+	}
+	scans := make(map[string]*indexScan, len(scope.tables))
+	for _, table := range scope.tables {
+		if e.SqlTableManager.getTableStatistics(table.TableName) == nil {
+			return node, node.WhereClause
+		}
+		scan, err := e.chooseIndexScan(pushdown[table.TableName], table)
+		if err != nil {
+			return node, node.WhereClause
+		}
+		scans[table.TableName] = scan
+	}
+	conditions := make([]ASTNode, 0)
+	for _, join := range node.Join {
+		conditions = append(conditions, splitAnd(join.Condition)...)
+	}
+
+	first := scope.tables[0]
+	for _, table := range scope.tables[1:] {
+		if scans[table.TableName].rows < scans[first.TableName].rows {
+			first = table
+		}
+	}
+	ordered := *node
+	ordered.TableName = first.TableName
+	ordered.Join = make([]*JoinNode, 0, len(node.Join))
+	joined := map[string]bool{first.TableName: true}
+	used := make([]bool, len(conditions))
+	rows := scans[first.TableName].rows
+	for len(joined) < len(scope.tables) {
+		var best *JoinNode
+		var bestUsed []int
+		bestCost, bestRows := 0.0, 0.0
+		for _, table := range scope.tables {
+			if joined[table.TableName] {
+				continue
+			}
+			join, usable := scope.joinStep(conditions, used, joined, table.TableName)
+			cost, joinRows := e.joinCost(scope, join, table, rows, scans[table.TableName])
+			if best == nil || cost < bestCost {
+				best, bestUsed, bestCost, bestRows = join, usable, cost, joinRows
+			}
+		}
+		for _, i := range bestUsed {
+			used[i] = true
+		}
+		joined[best.TableName] = true
+		rows = bestRows
+		ordered.Join = append(ordered.Join, best)
+	}
+
+	tables := []string{ordered.TableName}
+	for _, join := range ordered.Join {
+		tables = append(tables, join.TableName)
+	}
+	logger.Debug("join order %v, estimated rows %.1f", tables, rows)
+	return &ordered, andAll(append(splitAnd(node.WhereClause), conditions...))
+}
+
+// joinStep 把 tableName 加入已连接的表时的连接，ON 条件是还没有用过、引用的表都已经连接的条件
+func (s *joinScope) joinStep(conditions []ASTNode, used []bool, joined map[string]bool, tableName string) (*JoinNode, []int) {
+	usable := make([]int, 0)
+	expressions := make([]ASTNode, 0)
+	for i, condition := range conditions {
+		if used[i] {
+			continue
+		}
+		available := true
+		for _, column := range referencedColumns(condition) {
+			table, err := s.resolve(column)
+			if err != nil || (table != tableName && !joined[table]) {
+				available = false
+				break
+			}
+		}
+		if available {
+			usable = append(usable, i)
+			expressions = append(expressions, condition)
+		}
+	}
+	if len(expressions) == 0 {
+		return NewJoinNode(CrossJoin, tableName, nil), usable
+	}
+	return NewJoinNode(InnerJoin, tableName, andAll(expressions)), usable
+}
+
+// joinCost 估算外侧 outerRows 行与内表连接的代价和输出行数
+// 索引嵌套循环每一行外侧行做一次索引查找；块嵌套循环每 JOIN_BLOCK_SIZE 行外侧行扫描一遍内表
+func (e *SqlQueryExecutor) joinCost(scope *joinScope, join *JoinNode, definition *SqlTableDefinition, outerRows float64, inner *indexScan) (cost float64, rows float64) {
+	stats := e.SqlTableManager.getTableStatistics(definition.TableName)
+	if index, _, found := scope.indexJoinColumn(join, definition); found {
+		perKey := stats.rowsPerPrefix(index, 1)
+		rowCost := SEQUENTIAL_ROW_COST
+		if index.secondary {
+			rowCost += LOOKUP_ROW_COST
+		}
+		return outerRows * (INDEX_SEEK_COST + perKey*rowCost), outerRows * perKey
+	}
+	blocks := max(math.Ceil(outerRows/JOIN_BLOCK_SIZE), 1)
+	rows = outerRows * inner.rows
+	if join.Condition != nil {
+		rows *= DEFAULT_KEY_SELECTIVITY
+	}
+	return blocks * inner.cost, rows
+}
+
+// buildAggregatePlan 聚合查询：输入行 -> 哈希聚合 -> HAVING -> 排序 -> LIMIT -> 投影
+// 可以只靠主键索引回答时不读取任何一行
+func (e *SqlQueryExecutor) buildAggregatePlan(node *SelectNode) (operator, []string, error) {
+	scope, err := e.buildJoinScope(node)
+	if err != nil {
+		return nil, nil, err
+	}
+	query, err := newAggregateQuery(scope, node)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var plan operator
+	definition := scope.tables[0]
+	if canAggregateFromIndex(node, definition) {
+		tree := e.SqlTableManager.tablePrimaryIndex[definition.TableName]
+		return e.finishPlan(newIndexAggregateOperator(tree, definition, node.Columns), node, query.columns), query.columns, nil
+	}
+	if len(node.Join) > 0 {
+		plan, err = e.buildJoinInput(scope, node)
+	} else {
+		var scan *indexScan
+		if scan, err = e.chooseIndexScan(node.WhereClause, definition); err == nil {
+			plan, err = e.newScanOperator(definition, scan, node.WhereClause)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan = newAggregateOperator(plan, query, e.SqlTableManager.dataDirectory, e.AggregateMemoryBudget)
+	if node.Having != nil {
+		plan = newFilterOperator(plan, node.Having)
+	}
+	if len(node.OrderByColumns) > 0 {
+		plan = e.newSortOperator(plan, node.OrderByColumns)
+	}
+	return e.finishPlan(plan, node, query.columns), query.columns, nil
+}
+
+// finishPlan 在算子树顶部加上 LIMIT 和投影
+func (e *SqlQueryExecutor) finishPlan(plan operator, node *SelectNode, columns []string) operator {
+	if node.Limit != nil {
+		plan = newLimitOperator(plan, node.Limit)
+	}
+	return newProjectOperator(plan, columns)
+}
+
+func (e *SqlQueryExecutor) newSortOperator(child operator, orderBy []*OrderByNode) operator {
+	return newSortOperator(child, orderBy, e.SqlTableManager.dataDirectory, e.SortMemoryBudget)
+}
+
+// newAccessOperator 按访问路径创建读取表的算子
+func (e *SqlQueryExecutor) newAccessOperator(definition *SqlTableDefinition, scan *indexScan) (operator, error) {
+	primaryTree := e.SqlTableManager.tablePrimaryIndex[definition.TableName]
+	if primaryTree == nil {
+		return nil, &UnknownTableError{TableName: definition.TableName}
+	}
+	if scan.full {
+		logger.Debug("full table scan on %s", definition.TableName)
+		scanner := newTableScanOperator(primaryTree, definition)
+		scanner.file, scanner.estimatedRows = e.SqlTableManager.primaryIndexFile(definition.TableName), scan.rows
+		scanner.descending = scan.descending
+		return scanner, nil
+	}
+	logger.Debug("index %s %s: %v", scan.index.name, scan.kind(), scan)
+	var indexTree *disktree.BPTree
+	file := e.SqlTableManager.primaryIndexFile(definition.TableName)
+	if scan.index.secondary {
+		indexTree = e.SqlTableManager.getSecondaryIndex(definition.TableName, scan.index.name)
+		file = e.SqlTableManager.secondaryIndexFile(definition.TableName, scan.index.name)
+	}
+	return newIndexScanOperator(primaryTree, indexTree, definition, scan, file), nil
+}
+
+// newScanOperator 按访问路径读取表，只输出满足 where 条件的行
+func (e *SqlQueryExecutor) newScanOperator(definition *SqlTableDefinition, scan *indexScan, where ASTNode) (operator, error) {
+	access, err := e.newAccessOperator(definition, scan)
+	if err != nil {
+		return nil, err
+	}
+	if where == nil {
+		return access, nil
+	}
+	return newFilterOperator(access, where), nil
+}
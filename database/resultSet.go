@@ -0,0 +1,115 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// @Title        resultSet.go
+// @Description  ordered columns and rows returned by select
+
+// ResultSet 查询结果，Columns 的顺序就是 SELECT 列表的顺序，每一行的值与 Columns 一一对应
+type ResultSet struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+func NewResultSet(columns []string) *ResultSet {
+	return &ResultSet{
+		Columns: columns,
+		Rows:    make([][]interface{}, 0),
+	}
+}
+
+// AddRow 按 Columns 的顺序从行中取值追加一行
+func (r *ResultSet) AddRow(row map[string]interface{}) {
+	values := make([]interface{}, len(r.Columns))
+	for i, column := range r.Columns {
+		values[i] = row[column]
+	}
+	r.Rows = append(r.Rows, values)
+}
+
+func (r *ResultSet) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.Rows)
+}
+
+// ColumnIndex 返回列在结果中的位置，不存在时返回 -1
+func (r *ResultSet) ColumnIndex(column string) int {
+	for i, name := range r.Columns {
+		if name == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// Value 返回第 i 行某一列的值
+func (r *ResultSet) Value(i int, column string) interface{} {
+	index := r.ColumnIndex(column)
+	if index < 0 || i < 0 || i >= r.Len() {
+		return nil
+	}
+	return r.Rows[i][index]
+}
+
+// String 以表格形式输出结果
+// +----+-------+
+// | id | name  |
+// +----+-------+
+// | 1  | Alice |
+// +----+-------+
+func (r *ResultSet) String() string {
+	widths := make([]int, len(r.Columns))
+	for i, column := range r.Columns {
+		widths[i] = len(column)
+	}
+	cells := make([][]string, len(r.Rows))
+	for i, row := range r.Rows {
+		cells[i] = make([]string, len(row))
+		for j, value := range row {
+			cells[i][j] = formatValue(value)
+			widths[j] = max(widths[j], len(cells[i][j]))
+		}
+	}
+
+	var sb strings.Builder
+	separator := tableSeparator(widths)
+	sb.WriteString(separator)
+	writeTableLine(&sb, r.Columns, widths)
+	sb.WriteString(separator)
+	for _, row := range cells {
+		writeTableLine(&sb, row, widths)
+	}
+	sb.WriteString(separator)
+	return sb.String()
+}
+
+func formatValue(value interface{}) string {
+	if value == nil {
+		return "NULL"
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func tableSeparator(widths []int) string {
+	var sb strings.Builder
+	sb.WriteString("+")
+	for _, width := range widths {
+		sb.WriteString(strings.Repeat("-", width+2))
+		sb.WriteString("+")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+func writeTableLine(sb *strings.Builder, values []string, widths []int) {
+	sb.WriteString("|")
+	for i, value := range values {
+		sb.WriteString(fmt.Sprintf(" %-*s |", widths[i], value))
+	}
+	sb.WriteString("\n")
+}
@@ -0,0 +1,282 @@
+package database
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	. "godb/entity"
+	"godb/logger"
+	"io"
+	"os"
+	"slices"
+)
+
+// @Title        sorter.go
+// @Description  ORDER BY sort, spills sorted runs to temp files when over the memory budget
+
+// DEFAULT_SORT_MEMORY_BUDGET 排序默认可使用的内存（字节）
+const DEFAULT_SORT_MEMORY_BUDGET = 4 << 20
+
+// rowSorter 外部排序：缓冲区超过内存预算时排序后写成一个有序段文件，最后多路归并所有段
+type rowSorter struct {
+	orderBy    []*OrderByNode
+	directory  string
+	budget     int
+	buffer     []map[string]interface{}
+	bufferSize int
+	runs       []string
+}
+
+func newRowSorter(orderBy []*OrderByNode, directory string, budget int) *rowSorter {
+	return &rowSorter{
+		orderBy:   orderBy,
+		directory: directory,
+		budget:    budget,
+		buffer:    make([]map[string]interface{}, 0),
+	}
+}
+
+// Add 加入一行，超出内存预算时把缓冲区写入临时文件
+func (s *rowSorter) Add(row map[string]interface{}) error {
+	s.buffer = append(s.buffer, row)
+	s.bufferSize += estimateRowSize(row)
+	if s.bufferSize > s.budget {
+		return s.spill()
+	}
+	return nil
+}
+
+// Sort 结束输入，返回按 orderBy 有序的行迭代器
+func (s *rowSorter) Sort() (*sortedRows, error) {
+	s.sortBuffer()
+	if len(s.runs) == 0 {
+		return &sortedRows{rows: s.buffer}, nil
+	}
+	if len(s.buffer) > 0 {
+		if err := s.spill(); err != nil {
+			return nil, err
+		}
+	}
+	return s.merge()
+}
+
+// Close 删除排序过程中产生的临时文件
+func (s *rowSorter) Close() {
+	for _, run := range s.runs {
+		if err := os.Remove(run); err != nil {
+			logger.Warn("failed to remove sort run %s: %v", run, err)
+		}
+	}
+	s.runs = nil
+}
+
+func (s *rowSorter) sortBuffer() {
+	slices.SortStableFunc(s.buffer, func(a, b map[string]interface{}) int {
+		return compareRows(a, b, s.orderBy)
+	})
+}
+
+// spill 把排好序的缓冲区写入数据目录下的临时文件
+func (s *rowSorter) spill() error {
+	s.sortBuffer()
+	file, err := os.CreateTemp(s.directory, "sort-*.tmp")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, file.Name())
+	logger.Debug("spill %d rows to %s", len(s.buffer), file.Name())
+
+	writer := bufio.NewWriter(file)
+	encoder := gob.NewEncoder(writer)
+	for _, row := range s.buffer {
+		if err := encoder.Encode(row); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	s.buffer = make([]map[string]interface{}, 0)
+	s.bufferSize = 0
+	return nil
+}
+
+// merge 打开所有有序段，用小顶堆做多路归并
+func (s *rowSorter) merge() (*sortedRows, error) {
+	merger := &runMerger{orderBy: s.orderBy}
+	for _, run := range s.runs {
+		file, err := os.Open(run)
+		if err != nil {
+			merger.close()
+			return nil, err
+		}
+		cursor := &runCursor{file: file, decoder: gob.NewDecoder(bufio.NewReader(file))}
+		ok, err := cursor.advance()
+		if err != nil {
+			file.Close()
+			merger.close()
+			return nil, err
+		}
+		if ok {
+			merger.cursors = append(merger.cursors, cursor)
+		} else {
+			file.Close()
+		}
+	}
+	heap.Init(merger)
+	return &sortedRows{merger: merger}, nil
+}
+
+// sortedRows 排序结果的迭代器，数据全部在内存中时直接遍历切片，否则从归并堆中读取
+type sortedRows struct {
+	rows   []map[string]interface{}
+	index  int
+	merger *runMerger
+	row    map[string]interface{}
+	err    error
+}
+
+// Next 前进到下一行，结束或出错时返回 false
+func (r *sortedRows) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if r.merger == nil {
+		if r.index >= len(r.rows) {
+			return false
+		}
+		r.row = r.rows[r.index]
+		r.index++
+		return true
+	}
+
+	if r.merger.Len() == 0 {
+		return false
+	}
+	cursor := r.merger.cursors[0]
+	r.row = cursor.row
+	ok, err := cursor.advance()
+	if err != nil {
+		r.err = err
+		return false
+	}
+	if ok {
+		heap.Fix(r.merger, 0)
+	} else {
+		cursor.file.Close()
+		heap.Pop(r.merger)
+	}
+	return true
+}
+
+func (r *sortedRows) Row() map[string]interface{} {
+	return r.row
+}
+
+func (r *sortedRows) Err() error {
+	return r.err
+}
+
+// Close 关闭还未读完的段文件
+func (r *sortedRows) Close() {
+	if r.merger != nil {
+		r.merger.close()
+	}
+}
+
+// runCursor 一个有序段文件的读取位置
+type runCursor struct {
+	file    *os.File
+	decoder *gob.Decoder
+	row     map[string]interface{}
+}
+
+func (c *runCursor) advance() (bool, error) {
+	row := make(map[string]interface{})
+	if err := c.decoder.Decode(&row); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	c.row = row
+	return true, nil
+}
+
+// runMerger 按每个段当前行排序的小顶堆，实现 heap.Interface
+type runMerger struct {
+	orderBy []*OrderByNode
+	cursors []*runCursor
+}
+
+func (m *runMerger) Len() int { return len(m.cursors) }
+
+func (m *runMerger) Less(i, j int) bool {
+	return compareRows(m.cursors[i].row, m.cursors[j].row, m.orderBy) < 0
+}
+
+func (m *runMerger) Swap(i, j int) { m.cursors[i], m.cursors[j] = m.cursors[j], m.cursors[i] }
+
+func (m *runMerger) Push(x interface{}) { m.cursors = append(m.cursors, x.(*runCursor)) }
+
+func (m *runMerger) Pop() interface{} {
+	last := m.cursors[len(m.cursors)-1]
+	m.cursors = m.cursors[:len(m.cursors)-1]
+	return last
+}
+
+func (m *runMerger) close() {
+	for _, cursor := range m.cursors {
+		cursor.file.Close()
+	}
+	m.cursors = nil
+}
+
+// compareRows 按 ORDER BY 的列依次比较两行，NULL 排在最前
+func compareRows(a, b map[string]interface{}, orderBy []*OrderByNode) int {
+	for _, order := range orderBy {
+		cmp := compareNullable(columnValue(a, order.Column), columnValue(b, order.Column))
+		if order.Desc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+func compareNullable(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	cmp, _ := compareValues(a, b)
+	return cmp
+}
+
+// estimateRowSize 估算一行在内存中占用的字节数
+func estimateRowSize(row map[string]interface{}) int {
+	size := 0
+	for column, value := range row {
+		size += len(column) + 16
+		switch v := value.(type) {
+		case string:
+			size += len(v)
+		default:
+			size += INT_SIZE
+		}
+	}
+	return size
+}
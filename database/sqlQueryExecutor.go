@@ -1,13 +1,14 @@
 package database
 
 import (
+	"bytes"
 	"fmt"
 	"godb/disktree"
 	. "godb/entity"
 	"godb/logger"
-	"log"
+	"math"
 	"slices"
-	"strconv"
+	"strings"
 )
 
 // @Title        sqlQueryExecutor.go
@@ -17,246 +18,928 @@ import (
 
 type SqlQueryExecutor struct {
 	SqlTableManager *SqlTableManager
+	// ORDER BY 排序可使用的内存（字节），超出后写临时文件
+	SortMemoryBudget int
+	// GROUP BY 哈希聚合可使用的内存（字节），超出后新分组写入分区文件
+	AggregateMemoryBudget int
 }
 
 func NewSqlQueryExecutor(manager *SqlTableManager) *SqlQueryExecutor {
 	return &SqlQueryExecutor{
-		SqlTableManager: manager,
+		SqlTableManager:       manager,
+		SortMemoryBudget:      DEFAULT_SORT_MEMORY_BUDGET,
+		AggregateMemoryBudget: DEFAULT_AGGREGATE_MEMORY_BUDGET,
 	}
 }
 
-func (e *SqlQueryExecutor) processSelect(node *SelectNode, tableDefinitions []*SqlTableDefinition) map[string]interface{} {
+// processSelect 构建查询的算子树，逐行拉取结果放入结果集
+func (e *SqlQueryExecutor) processSelect(node *SelectNode, tableDefinitions []*SqlTableDefinition) (*ResultSet, error) {
 	logger.Debug("start process select sql")
-	result := make(map[string]interface{}, 0)
+	node, err := e.resolveSubqueries(node)
+	if err != nil {
+		return nil, err
+	}
+	plan, columns, err := e.buildPlan(node)
+	if err != nil {
+		return nil, err
+	}
+	if err := plan.Open(); err != nil {
+		plan.Close()
+		return nil, err
+	}
+	defer plan.Close()
+
+	resultSet := NewResultSet(columns)
+	for plan.Next() {
+		resultSet.AddRow(plan.Row())
+	}
+	if err := plan.Err(); err != nil {
+		return nil, err
+	}
+	return resultSet, nil
+}
+
+// processExplain 构建 SELECT 的执行计划但不执行，每个算子输出一行
+// 非相关子查询决定了访问路径，仍然需要先物化
+func (e *SqlQueryExecutor) processExplain(node *ExplainNode) (*ResultSet, error) {
+	logger.Debug("start process explain sql")
+	query, err := e.resolveSubqueries(node.Statement)
+	if err != nil {
+		return nil, err
+	}
+	plan, _, err := e.buildPlan(query)
+	if err != nil {
+		return nil, err
+	}
+	resultSet := NewResultSet([]string{"operator", "detail", "rows"})
+	addPlanRows(resultSet, plan.explain(), 0)
+	return resultSet, nil
+}
+
+// addPlanRows 深度优先输出计划树，子算子按层级缩进；估算行数未知时为 NULL
+func addPlanRows(resultSet *ResultSet, node *planNode, depth int) {
+	name := node.name
+	if depth > 0 {
+		name = strings.Repeat("  ", depth-1) + "-> " + name
+	}
+	var rows interface{}
+	if node.rows >= 0 {
+		rows = uint32(math.Round(node.rows))
+	}
+	resultSet.AddRow(map[string]interface{}{"operator": name, "detail": node.detail, "rows": rows})
+	for _, child := range node.children {
+		addPlanRows(resultSet, child, depth+1)
+	}
+}
+
+// indexOrderSatisfies 判断索引扫描输出的顺序能否直接满足 ORDER BY
+// 跳过取值固定的列后，ORDER BY 的列要依次与索引的顺序相同且方向一致；索引的顺序用完时每一行已经唯一确定，
+// 之后的列不影响顺序；全部降序时反向扫描索引
+func indexOrderSatisfies(orderBy []*OrderByNode, ordered []string, constant []string) (satisfied bool, reverse bool) {
+	if ordered == nil {
+		return false, false
+	}
+	matched := 0
+	for _, order := range orderBy {
+		if matched == len(ordered) {
+			break
+		}
+		column := order.Column.ColumnName
+		if slices.Contains(constant, column) {
+			continue
+		}
+		if column != ordered[matched] || (matched > 0 && order.Desc != reverse) {
+			return false, false
+		}
+		reverse = order.Desc
+		matched++
+	}
+	return true, reverse
+}
+
+// processUpdate 更新所有满足 WHERE 条件的行，没有 WHERE 时更新整张表，返回实际更新的行数
+// 满足条件的行先全部读出再逐行修改，避免修改索引时影响正在进行的扫描
+func (e *SqlQueryExecutor) processUpdate(node *UpdateNode, tableDefinitions []*SqlTableDefinition) (uint32, error) {
+	logger.Debug("start process update sql")
 	tableDefinition := e.SqlTableManager.getTableDefinition(node.TableName)
+	if tableDefinition == nil {
+		return 0, &UnknownTableError{TableName: node.TableName}
+	}
 	primaryTree := e.SqlTableManager.tablePrimaryIndex[node.TableName]
-	indexUsed := false
+	priKeyColumns, err := getPrimaryKeyColumns(tableDefinition)
+	if err != nil {
+		return 0, err
+	}
 
-	if node.WhereClause == nil || len(node.WhereClause) == 0 {
-		log.Fatal("Where clause is empty")
+	assignments, err := formatUpdateValues(node, tableDefinition)
+	if err != nil {
+		return 0, err
+	}
+	where, err := e.materializeSubqueries(node.WhereClause)
+	if err != nil {
+		return 0, err
 	}
-	//priKey := statmentPrimaryKey(node, tableDefinition)
-	// primary key "="
-	condition, err := getPrimeryKeyCondition(node.WhereClause, tableDefinition, EQUALS)
-	if err == nil {
-		priKey := condition.Right.(*LiteralNode).Value.(uint32)
-		rows := GetPrimaryTreeRows(primaryTree, priKey, tableDefinition)
-		result = trimRows(node, rows, result)
-		indexUsed = true
+	rows, err := e.getRowsByIndex(node.TableName, where, tableDefinition)
+	if err != nil {
+		return 0, err
 	}
 
-	// secondary key "="
-	if !indexUsed {
-		condition, err := getSecondaryKeyCondition(node.WhereClause, tableDefinition, EQUALS)
-		left := condition.Left.(*ColumnNode)
-		secondaryTree := e.SqlTableManager.getSecondaryIndex(node.TableName, left.ColumnName)
-		if err == nil {
-			secondaryIndex := condition.Right.(*LiteralNode).Value.(uint32)
-			// TODO
-			rows := GetSecondaryTreeRowsFromPri(secondaryTree, secondaryIndex, primaryTree, tableDefinition)
-			result = trimRows(node, rows, result)
+	// 先算出每一行更新后的值，在写入任何一行之前检查主键和 UNIQUE 约束
+	updatedRows := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		updated := make(map[string]interface{}, len(row))
+		for column, value := range row {
+			updated[column] = value
 		}
-		indexUsed = true
+		for column, value := range assignments {
+			updated[column] = value
+		}
+		updatedRows[i] = updated
+	}
+	if err := e.checkUpdateKeys(tableDefinition, assignments, rows, updatedRows); err != nil {
+		return 0, err
 	}
 
-	// primary key "in"
-	if !indexUsed {
-		condition, err := getPrimeryKeyCondition(node.WhereClause, tableDefinition, IN)
-		if err == nil {
-			priKey := condition.Right.(*LiteralNode).Value.(uint32)
-			rows := GetPrimaryTreeRows(primaryTree, priKey, tableDefinition)
-			result = trimRows(node, rows, result)
+	indexes := e.SqlTableManager.getTableIndexes(node.TableName)
+	affectedRows := uint32(0)
+	for i, row := range rows {
+		updated := updatedRows[i]
+		oldKey, err := encodeKey(row, priKeyColumns)
+		if err != nil {
+			return affectedRows, err
+		}
+		newKey, err := encodeKey(updated, priKeyColumns)
+		if err != nil {
+			return affectedRows, err
+		}
+		logger.Debug("row update: %v -> %v", row, updated)
+
+		// 写回主索引，主键改变时先删除旧的记录
+		bufRecord, err := serializeRow(updated, tableDefinition)
+		if err != nil {
+			return affectedRows, err
+		}
+		if !bytes.Equal(newKey, oldKey) {
+			if err := primaryTree.Delete(oldKey); err != nil {
+				return affectedRows, err
+			}
 		}
-		indexUsed = true
+		if err := primaryTree.Insert(newKey, bufRecord.Bytes()); err != nil {
+			return affectedRows, err
+		}
+
+		// 索引列或主键改变时，删除指向旧主键的条目再插入新条目
+		for name, indexTree := range indexes {
+			columns := splitColumnsName(name)
+			oldIndexKey, err := encodeKey(row, columns)
+			if err != nil {
+				return affectedRows, err
+			}
+			newIndexKey, err := encodeKey(updated, columns)
+			if err != nil {
+				return affectedRows, err
+			}
+			if bytes.Equal(oldIndexKey, newIndexKey) && bytes.Equal(oldKey, newKey) {
+				continue
+			}
+			if err := deleteFromSecondaryIndex(indexTree, oldIndexKey, oldKey); err != nil {
+				return affectedRows, err
+			}
+			if err := indexTree.InsertEntry(newIndexKey, newKey); err != nil {
+				return affectedRows, err
+			}
+		}
+		affectedRows++
 	}
 
-	// secondary key "="
-	if !indexUsed {
-		condition, err := getSecondaryKeyCondition(node.WhereClause, tableDefinition, IN)
-		left := condition.Left.(*ColumnNode)
-		secondaryTree := e.SqlTableManager.getSecondaryIndex(node.TableName, left.ColumnName)
-		if err == nil {
-			priKey := condition.Right.(*LiteralNode).Value.(uint32)
-			rows := GetSecondaryTreeRows(secondaryTree, priKey, tableDefinition)
-			result = trimRows(node, rows, result)
+	if err := e.SqlTableManager.Flush(); err != nil {
+		return affectedRows, err
+	}
+	return affectedRows, nil
+}
+
+// checkUpdateKeys 检查更新后的行是否违反主键或 UNIQUE 约束，只检查 SET 修改了其中某一列的键
+// 更新后的行之间不能重复，也不能与其它行已有的键重复；已有的键属于另一行正在更新的行时同样视为重复
+func (e *SqlQueryExecutor) checkUpdateKeys(definition *SqlTableDefinition, assignments map[string]interface{}, rows []map[string]interface{}, updatedRows []map[string]interface{}) error {
+	priKeyColumns, err := getPrimaryKeyColumns(definition)
+	if err != nil {
+		return err
+	}
+	assigned := func(columns []string) bool {
+		return slices.ContainsFunc(columns, func(column string) bool {
+			_, ok := assignments[column]
+			return ok
+		})
+	}
+
+	if assigned(priKeyColumns) {
+		primaryTree := e.SqlTableManager.tablePrimaryIndex[definition.TableName]
+		seen := make(map[string]bool, len(rows))
+		for i, updated := range updatedRows {
+			oldKey, err := encodeKey(rows[i], priKeyColumns)
+			if err != nil {
+				return err
+			}
+			newKey, err := encodeKey(updated, priKeyColumns)
+			if err != nil {
+				return err
+			}
+			duplicate := seen[string(newKey)]
+			if !duplicate && !bytes.Equal(newKey, oldKey) {
+				if _, duplicate, err = primaryTree.Search(newKey); err != nil {
+					return err
+				}
+			}
+			if duplicate {
+				return &DuplicateKeyError{TableName: definition.TableName, ColumnName: columnsName(priKeyColumns), Key: keyValue(updated, priKeyColumns)}
+			}
+			seen[string(newKey)] = true
 		}
-		indexUsed = true
 	}
 
-	return result
+	for _, columns := range definition.UniqueKeys() {
+		if !assigned(columns) {
+			continue
+		}
+		indexTree := e.SqlTableManager.getSecondaryIndex(definition.TableName, columnsName(columns))
+		seen := make(map[string]bool, len(rows))
+		for i, updated := range updatedRows {
+			priKey, err := encodeKey(rows[i], priKeyColumns)
+			if err != nil {
+				return err
+			}
+			indexKey, err := encodeKey(updated, columns)
+			if err != nil {
+				return err
+			}
+			used := seen[string(indexKey)]
+			if !used {
+				if used, err = usedByOtherRow(indexTree, indexKey, priKey); err != nil {
+					return err
+				}
+			}
+			if used {
+				return &UniqueConstraintError{TableName: definition.TableName, ColumnName: columnsName(columns), Value: keyValue(updated, columns)}
+			}
+			seen[string(indexKey)] = true
+		}
+	}
+	return nil
 }
 
-func (e *SqlQueryExecutor) processUpdate(node *UpdateNode, tableDefinitions []*SqlTableDefinition) map[string]interface{} {
-	logger.Debug("start process update sql")
-	result := make(map[string]interface{}, 0)
+func (e *SqlQueryExecutor) processDelete(node *DeleteNode, tableDefinitions []*SqlTableDefinition) (uint32, error) {
+	logger.Debug("start process delete sql")
 	tableDefinition := e.SqlTableManager.getTableDefinition(node.TableName)
+	if tableDefinition == nil {
+		return 0, &UnknownTableError{TableName: node.TableName}
+	}
 	primaryTree := e.SqlTableManager.tablePrimaryIndex[node.TableName]
 
-	if node.WhereClause == nil || len(node.WhereClause) == 0 {
-		log.Fatal("Where clause is empty")
+	// 没有 WHERE 条件时和 UPDATE 一样作用于表中的所有行
+	priKeyColumns, err := getPrimaryKeyColumns(tableDefinition)
+	if err != nil {
+		return 0, err
 	}
-	condition, err := getPrimeryKeyCondition(node.WhereClause, tableDefinition, EQUALS)
+	where, err := e.materializeSubqueries(node.WhereClause)
 	if err != nil {
-		log.Fatal("Only support update by primary key")
+		return 0, err
 	}
-	priKey := condition.Right.(*LiteralNode).Value.(uint32)
-	rows := GetPrimaryTreeRows(primaryTree, priKey, tableDefinition)
-	if len(rows) == 0 {
-		log.Fatal("No row found to update")
+
+	rows, err := e.getRowsByIndex(node.TableName, where, tableDefinition)
+	if err != nil {
+		return 0, err
 	}
-	row := rows[0]
 
-	// 记录更新前的二级索引值
-	oldSecondaryValues := make(map[string]interface{})
-	for _, colDef := range tableDefinition.Columns {
-		if colDef.IndexType == Secondary {
-			oldSecondaryValues[colDef.Name] = row[colDef.Name]
+	indexes := e.SqlTableManager.getTableIndexes(node.TableName)
+	affectedRows := uint32(0)
+	for _, row := range rows {
+		priKey, err := encodeKey(row, priKeyColumns)
+		if err != nil {
+			return affectedRows, err
 		}
+		if err := primaryTree.Delete(priKey); err != nil {
+			return affectedRows, err
+		}
+
+		for name, indexTree := range indexes {
+			indexKey, err := encodeKey(row, splitColumnsName(name))
+			if err != nil {
+				return affectedRows, err
+			}
+			if err := deleteFromSecondaryIndex(indexTree, indexKey, priKey); err != nil {
+				return affectedRows, err
+			}
+		}
+		affectedRows++
+		e.SqlTableManager.adjustRowCount(node.TableName, -1)
 	}
 
-	// 应用更新
-	for i, col := range node.Columns {
-		row[col] = node.Values[i]
+	if err := e.SqlTableManager.Flush(); err != nil {
+		return affectedRows, err
+	}
+	return affectedRows, nil
+}
+
+// tableIndex 表上的一个索引，索引键依次由 columns 中的列组成
+type tableIndex struct {
+	// 索引列名，见 columnsName
+	name    string
+	columns []string
+	// 各列的类型，决定列值在键中的编码
+	types     []DataType
+	secondary bool
+}
+
+func newTableIndex(definition *SqlTableDefinition, columns []string, secondary bool) *tableIndex {
+	types := make([]DataType, len(columns))
+	for i, name := range columns {
+		if column := definition.GetColumn(name); column != nil {
+			types[i] = column.DataType
+		}
 	}
-	logger.Info(" row update: %v", row)
+	return &tableIndex{name: columnsName(columns), columns: columns, types: types, secondary: secondary}
+}
 
-	// 写回主索引
-	bufRecord := serializeRow(row, tableDefinition)
-	err = primaryTree.Insert(priKey, bufRecord.Bytes())
+// tableIndexes 返回表上的所有索引：先是主键索引，再是单列二级索引，最后是多列二级索引
+func tableIndexes(definition *SqlTableDefinition) ([]*tableIndex, error) {
+	priKeyColumns, err := getPrimaryKeyColumns(definition)
 	if err != nil {
-		log.Fatal("Failed to update primary index")
+		return nil, err
+	}
+	indexes := []*tableIndex{newTableIndex(definition, priKeyColumns, false)}
+	for _, columns := range definition.SecondaryIndexes() {
+		indexes = append(indexes, newTableIndex(definition, columns, true))
 	}
+	return indexes, nil
+}
 
-	// 处理二级索引（先删除旧索引，再插入新索引）
-	indexes := e.SqlTableManager.getTableIndexes(node.TableName)
-	for i, col := range node.Columns {
-		for _, colDef := range tableDefinition.Columns {
-			if colDef.Name == col && colDef.IndexType == Secondary {
-				indexTree := indexes[col]
-				// 先删除旧索引
-				if oldVal, ok := oldSecondaryValues[col]; ok {
-					if oldKey, ok2 := oldVal.(uint32); ok2 {
-						indexTree.Delete(oldKey)
-					}
-				}
-				// 再插入新索引
-				newIndexKey := node.Values[i].(uint32)
-				indexTree.Insert(newIndexKey, e.SqlTableManager.serializeInt(priKey))
+// indexScan 描述一次索引访问：索引的前 len(prefix) 列等于 prefix，下一列在 [lo, hi] 中，之后的列不限
+// 索引是主键索引时直接扫描，否则先扫描二级索引再回表；full 表示没有可用条件的全表扫描
+// 列值的类型与列相同：INT 列是 uint32，CHAR 和 VARCHAR 列是 string；lo 等于 hi 时是等值查找
+type indexScan struct {
+	index *tableIndex
+	// 主键的列，二级索引中键相同的条目按主键排列
+	primaryKey []string
+	// 索引最左边若干列的等值条件
+	prefix []interface{}
+	lo, hi interface{}
+	full   bool
+	// IN 条件的索引键，不为 nil 时逐个键查找索引而不是扫描区间
+	keys []interface{}
+	// 按索引键降序读取，用于索引顺序满足 ORDER BY ... DESC 的情况
+	descending bool
+	// 根据统计信息估算的读取行数和代价，表没有统计信息时为 -1
+	rows, cost float64
+}
+
+// column lo、hi 和 keys 所限定的索引列，即前缀之后的第一列
+func (s *indexScan) column() string {
+	return s.index.columns[len(s.prefix)]
+}
+
+// keyRange 把前缀和 [lo, hi] 编码成索引上的键区间，前缀之后不限的列下界补 0x00、上界补 0xFF
+func (s *indexScan) keyRange(lo, hi interface{}) ([2][]byte, error) {
+	prefix := make([]byte, 0, MAX_KEY_SIZE)
+	for _, value := range s.prefix {
+		key, err := encodeKeyValue(value)
+		if err != nil {
+			return [2][]byte{}, err
+		}
+		prefix = append(prefix, key...)
+	}
+	lower, err := encodeKeyValue(lo)
+	if err != nil {
+		return [2][]byte{}, err
+	}
+	upper, err := encodeKeyValue(hi)
+	if err != nil {
+		return [2][]byte{}, err
+	}
+	rest := 0
+	for _, dataType := range s.index.types[len(s.prefix)+1:] {
+		width, _ := keyWidth(dataType)
+		rest += width
+	}
+	lower = append(append(slices.Clone(prefix), lower...), make([]byte, rest)...)
+	upper = append(append(prefix, upper...), bytes.Repeat([]byte{0xFF}, rest)...)
+	return [2][]byte{lower, upper}, nil
+}
+
+// empty 判断 [lo, hi] 是否为空区间
+func (s *indexScan) empty() bool {
+	c, ok := compareValues(s.lo, s.hi)
+	return ok && c > 0
+}
+
+// orderedBy 返回扫描结果依次按哪些列升序排列：前缀之后的索引列，二级索引再加上不在索引中的主键列
+// constant 是前缀中取值固定的列；IN 的键不是升序时结果按列表的顺序，ordered 为 nil
+func (s *indexScan) orderedBy() (ordered []string, constant []string) {
+	if s.keys != nil && !slices.IsSortedFunc(s.keys, compareKeys) {
+		return nil, nil
+	}
+	// 等值查找时扫描的列也是固定的
+	fixed := len(s.prefix)
+	if !s.full && s.keys == nil && s.lo == s.hi {
+		fixed++
+	}
+	ordered = slices.Clone(s.index.columns[fixed:])
+	if s.index.secondary {
+		for _, column := range s.primaryKey {
+			if !slices.Contains(s.index.columns, column) {
+				ordered = append(ordered, column)
 			}
 		}
 	}
+	return ordered, s.index.columns[:fixed]
+}
 
-	if err := e.SqlTableManager.Flush(); err != nil {
-		log.Fatal("Failed to flush changes to disk")
+// chooseIndexScan 根据 where 条件选择访问路径
+// 表有统计信息时选择估算代价最小的路径，代价相同时按规则的优先级；
+// 还没有 ANALYZE 过的表按规则选择：先等值条件，再 IN，再区间条件，主键优先于二级索引，都没有时全表扫描
+func (e *SqlQueryExecutor) chooseIndexScan(where ASTNode, definition *SqlTableDefinition) (*indexScan, error) {
+	candidates, err := candidateScans(where, definition)
+	if err != nil {
+		return nil, err
+	}
+	stats := e.SqlTableManager.getTableStatistics(definition.TableName)
+	if stats == nil {
+		return candidates[0], nil
 	}
 
-	// 返回更新后的行
-	for k, v := range row {
-		result[k] = v
+	var best *indexScan
+	for _, scan := range candidates {
+		scan.rows, scan.cost = stats.estimate(scan)
+		if best == nil || scan.cost < best.cost {
+			best = scan
+		}
 	}
-	return result
+	logger.Debug("choose %s scan on %s(%s) from %d candidates, rows %.1f, cost %.1f",
+		best.kind(), definition.TableName, best.index.name, len(candidates), best.rows, best.cost)
+	return best, nil
 }
 
-func (e *SqlQueryExecutor) processInsert(node *InsertNode, tableDefinitions []*SqlTableDefinition) uint32 {
+// String 描述扫描的索引条件，用于 EXPLAIN
+func (s *indexScan) String() string {
+	if s.full {
+		return "all rows"
+	}
+	conditions := make([]string, 0, len(s.prefix)+1)
+	for i, value := range s.prefix {
+		conditions = append(conditions, fmt.Sprintf("%s = %s", s.index.columns[i], formatKey(value)))
+	}
+	return strings.Join(append(conditions, s.columnCondition()), " AND ")
+}
+
+// columnCondition 描述前缀之后那一列上的条件
+func (s *indexScan) columnCondition() string {
+	column := s.column()
+	switch {
+	case s.keys != nil:
+		keys := make([]string, len(s.keys))
+		for i, key := range s.keys {
+			keys[i] = formatKey(key)
+		}
+		return fmt.Sprintf("%s IN (%s)", column, strings.Join(keys, ", "))
+	case s.lo == s.hi:
+		return fmt.Sprintf("%s = %s", column, formatKey(s.lo))
+	case s.empty():
+		return fmt.Sprintf("%s in empty range", column)
+	case s.hi == uint32(math.MaxUint32) || s.hi == MAX_STRING_KEY:
+		return fmt.Sprintf("%s >= %s", column, formatKey(s.lo))
+	case s.lo == uint32(0) || s.lo == "":
+		return fmt.Sprintf("%s <= %s", column, formatKey(s.hi))
+	default:
+		return fmt.Sprintf("%s BETWEEN %s AND %s", column, formatKey(s.lo), formatKey(s.hi))
+	}
+}
+
+// formatKey 格式化索引条件中的列值，字符串加上单引号
+func formatKey(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return "'" + s + "'"
+	}
+	return formatValue(value)
+}
+
+// kind 访问方式的名称，用于日志
+func (s *indexScan) kind() string {
+	switch {
+	case s.full:
+		return "full"
+	case s.keys != nil:
+		return "key lookup"
+	case s.lo == s.hi:
+		return "equality"
+	default:
+		return "range"
+	}
+}
+
+// candidateScans 列出 where 条件可以使用的所有访问路径，按规则的优先级排列，最后一个总是全表扫描
+// 多列索引按最左前缀匹配：从第一列开始连续的等值条件组成前缀，前缀之后的一列可以是 IN 或区间条件
+// 规则的优先级先按匹配的列数，列数多的优先，再按条件的种类：等值、IN、区间，最后按主键、单列索引、多列索引的顺序
+func candidateScans(where ASTNode, definition *SqlTableDefinition) ([]*indexScan, error) {
+	clause := splitConjuncts(where)
+	indexes, err := tableIndexes(definition)
+	if err != nil {
+		return nil, err
+	}
+	priKeyColumns := indexes[0].columns
+	// 等值、IN、区间三种条件的访问路径
+	groups := make([][]*indexScan, 3)
+	add := func(group int, scan *indexScan) {
+		scan.primaryKey = priKeyColumns
+		scan.rows, scan.cost = -1, -1
+		groups[group] = append(groups[group], scan)
+	}
+
+	for _, index := range indexes {
+		equal := make([]interface{}, 0, len(index.columns))
+		for len(equal) < len(index.columns) {
+			key, found := getEqualKey(clause, index.columns[len(equal)], index.types[len(equal)])
+			if !found {
+				break
+			}
+			equal = append(equal, key)
+		}
+
+		// "="
+		if n := len(equal); n > 0 {
+			add(0, &indexScan{index: index, prefix: equal[:n-1], lo: equal[n-1], hi: equal[n-1]})
+		}
+
+		// 等值前缀之后的一列，所有列都有等值条件时是最后一列
+		prefix := equal[:min(len(equal), len(index.columns)-1)]
+		column, dataType := index.columns[len(prefix)], index.types[len(prefix)]
+		// IN
+		if keys, found := getInKeys(clause, column, dataType); found {
+			add(1, &indexScan{index: index, prefix: prefix, keys: keys})
+		}
+		// 区间
+		if lo, hi, found := getKeyRange(clause, column, dataType); found {
+			add(2, &indexScan{index: index, prefix: prefix, lo: lo, hi: hi})
+		}
+	}
+
+	candidates := slices.Concat(groups...)
+	slices.SortStableFunc(candidates, func(a, b *indexScan) int {
+		return len(b.prefix) - len(a.prefix)
+	})
+
+	// 没有可用的索引条件，全表扫描
+	full := &indexScan{index: indexes[0], primaryKey: priKeyColumns, lo: uint32(0), hi: uint32(math.MaxUint32), full: true}
+	full.rows, full.cost = -1, -1
+	return append(candidates, full), nil
+}
+
+// getRowsByIndex 通过主键或二级索引取出满足 where 条件的行，where 引用了表中没有的列时返回错误
+func (e *SqlQueryExecutor) getRowsByIndex(tableName string, where ASTNode, definition *SqlTableDefinition) ([]map[string]interface{}, error) {
+	if err := resolveTableColumns(definition, where); err != nil {
+		return nil, err
+	}
+	scan, err := e.chooseIndexScan(where, definition)
+	if err != nil {
+		return nil, err
+	}
+	scanner, err := e.newScanOperator(definition, scan, where)
+	if err != nil {
+		return nil, err
+	}
+	return drain(scanner)
+}
+
+func (e *SqlQueryExecutor) processInsert(node *InsertNode, tableDefinitions []*SqlTableDefinition) (uint32, error) {
 	logger.Debug("start process insert sql")
 	tableDef := e.SqlTableManager.getTableDefinition(node.TableName)
+	if tableDef == nil {
+		return 0, &UnknownTableError{TableName: node.TableName}
+	}
 	tree := e.SqlTableManager.tablePrimaryIndex[node.TableName]
 
 	// 格式化并验证值
-	values := formatInsertValues(node, tableDef)
+	values, err := formatInsertValues(node, tableDef)
+	if err != nil {
+		return 0, err
+	}
 
 	// 获取并验证主键
-	key := checkPrimaryKeyExisting(values, tableDef, tree)
+	key, err := checkPrimaryKeyExisting(values, tableDef, tree)
+	if err != nil {
+		return 0, err
+	}
+	if err := e.checkUniqueIndexes(tableDef, values, key); err != nil {
+		return 0, err
+	}
 
 	// 序列化并插入记录
-	bufRecord := serializeRow(values, tableDef)
-	tree.Insert(key, bufRecord.Bytes())
+	bufRecord, err := serializeRow(values, tableDef)
+	if err != nil {
+		return 0, err
+	}
+	if err := tree.Insert(key, bufRecord.Bytes()); err != nil {
+		return 0, err
+	}
 
 	// secondary indexes
-	e.insertIntoSecondaryIndex(node, tableDef, key)
+	if err := e.insertIntoSecondaryIndex(node.TableName, values, key); err != nil {
+		return 0, err
+	}
 
-	return 1
+	e.SqlTableManager.adjustRowCount(node.TableName, 1)
+	return 1, nil
 }
 func (e *SqlQueryExecutor) prcessCreateTable(node *CreateTableNode, tableDefinitions []*SqlTableDefinition) (*SqlTableDefinition, error) {
 	logger.Debug("start process create table sql")
+	if e.SqlTableManager.getTableDefinition(node.TableName) != nil {
+		return nil, fmt.Errorf("table %s already exists", node.TableName)
+	}
 	// create table definition
 	definition := NewSqlTableDefinition(node.TableName, node.Columns)
+	definition.PrimaryKey = node.PrimaryKey
+	if err := checkPrimaryKey(definition); err != nil {
+		return nil, err
+	}
 	for _, column := range definition.Columns {
 		if column.IndexType != None {
-			if column.DataType != TypeInt {
-				return nil, fmt.Errorf("index can only be created on numeric columns")
+			if err := checkIndexColumns(definition, []string{column.Name}); err != nil {
+				return nil, err
 			}
 		}
 	}
-	e.SqlTableManager.addAndPersistTableDefinition(definition)
-	e.SqlTableManager.addPrimaryIndex(definition)
-	e.SqlTableManager.addSecondaryIndex(definition)
+	if err := e.SqlTableManager.addAndPersistTableDefinition(definition); err != nil {
+		return nil, err
+	}
+	if err := e.SqlTableManager.addPrimaryIndex(definition); err != nil {
+		return nil, err
+	}
+	if err := e.SqlTableManager.addSecondaryIndex(definition); err != nil {
+		return nil, err
+	}
 
 	// return table definition
 	return definition, nil
 }
 
-func trimRows(node *SelectNode, rows []map[string]interface{}, result map[string]interface{}) map[string]interface{} {
-	columns := node.Columns
-	for _, row := range rows {
-		// 处理 SELECT * 的情况
-		if len(columns) == 1 && columns[0].ColumnName == "*" {
-			result = row
-			break // 因为只需要一行数据，所以可以直接break
-		}
-		// 处理指定列
-		for _, column := range columns {
-			if value, exits := row[column.ColumnName]; exits {
-				result[column.ColumnName] = value
+// processCreateIndex 为已有表的一列或多列建立二级索引并写入表定义，返回建立索引的行数
+func (e *SqlQueryExecutor) processCreateIndex(node *CreateIndexNode) (uint32, error) {
+	logger.Debug("start process create index sql")
+	definition := e.SqlTableManager.getTableDefinition(node.TableName)
+	if definition == nil {
+		return 0, &UnknownTableError{TableName: node.TableName}
+	}
+	if err := checkIndexColumns(definition, node.Columns); err != nil {
+		return 0, err
+	}
+	name := columnsName(node.Columns)
+	if len(node.Columns) == 1 {
+		switch definition.GetColumn(name).IndexType {
+		case Primary:
+			return 0, fmt.Errorf("column %s is the primary key and is already indexed", name)
+		case Secondary:
+			return 0, fmt.Errorf("column %s already has an index", name)
+		}
+	}
+	if slices.Equal(node.Columns, definition.PrimaryKeyColumns()) {
+		return 0, fmt.Errorf("columns (%s) are the primary key and are already indexed", name)
+	}
+	if e.SqlTableManager.getSecondaryIndex(node.TableName, name) != nil {
+		return 0, fmt.Errorf("columns (%s) already have an index", name)
+	}
+	if _, err := indexColumns(definition, node.IndexName); err == nil {
+		return 0, fmt.Errorf("index %s already exists on table %s", node.IndexName, node.TableName)
+	}
+
+	count, err := e.SqlTableManager.buildSecondaryIndex(definition, node.Columns, node.Unique)
+	if err != nil {
+		return 0, err
+	}
+	// 单列索引同时记录在列定义中
+	setIndexType := func(indexType IndexType) {
+		if len(node.Columns) == 1 {
+			definition.GetColumn(name).IndexType = indexType
+		}
+	}
+	setIndexType(Secondary)
+	definition.Indexes = append(definition.Indexes, &IndexDefinition{Name: node.IndexName, Columns: node.Columns, Unique: node.Unique})
+	if err := e.SqlTableManager.addAndPersistTableDefinition(definition); err != nil {
+		// 表定义没有写入时撤销索引
+		setIndexType(None)
+		definition.Indexes = definition.Indexes[:len(definition.Indexes)-1]
+		e.SqlTableManager.dropSecondaryIndex(node.TableName, name)
+		return 0, err
+	}
+	if err := e.SqlTableManager.refreshIndexStatistics(node.TableName, name, e.SqlTableManager.getSecondaryIndex(node.TableName, name)); err != nil {
+		logger.Warn("failed to update statistics of %s: %v", node.TableName, err)
+	}
+	return count, nil
+}
+
+// processDropIndex 删除二级索引的文件并从表定义中移除
+func (e *SqlQueryExecutor) processDropIndex(node *DropIndexNode) error {
+	logger.Debug("start process drop index sql")
+	definition := e.SqlTableManager.getTableDefinition(node.TableName)
+	if definition == nil {
+		return &UnknownTableError{TableName: node.TableName}
+	}
+	columns, err := indexColumns(definition, node.IndexName)
+	if err != nil {
+		return err
+	}
+
+	// 删除单列索引同时去掉列上的 UNIQUE 约束
+	if len(columns) == 1 {
+		definition.GetColumn(columns[0]).IndexType = None
+		definition.GetColumn(columns[0]).Unique = false
+	}
+	definition.Indexes = slices.DeleteFunc(definition.Indexes, func(index *IndexDefinition) bool {
+		return index.Name == node.IndexName
+	})
+	if err := e.SqlTableManager.addAndPersistTableDefinition(definition); err != nil {
+		return err
+	}
+	name := columnsName(columns)
+	if err := e.SqlTableManager.dropSecondaryIndex(node.TableName, name); err != nil {
+		return err
+	}
+	if err := e.SqlTableManager.refreshIndexStatistics(node.TableName, name, nil); err != nil {
+		logger.Warn("failed to update statistics of %s: %v", node.TableName, err)
+	}
+	return nil
+}
+
+// indexColumns 返回索引名对应的列，建表时用 INDEX 声明的索引以列名作为索引名
+func indexColumns(definition *SqlTableDefinition, indexName string) ([]string, error) {
+	if index := definition.GetIndex(indexName); index != nil {
+		return index.Columns, nil
+	}
+	column := definition.GetColumn(indexName)
+	if column != nil && column.IndexType == Secondary && !slices.ContainsFunc(definition.Indexes, func(index *IndexDefinition) bool {
+		return slices.Equal(index.Columns, []string{column.Name})
+	}) {
+		return []string{column.Name}, nil
+	}
+	return nil, fmt.Errorf("index %s does not exist on table %s", indexName, definition.TableName)
+}
+
+// checkPrimaryKey 检查表只声明了一个主键，主键的列都可以作为索引的列
+func checkPrimaryKey(definition *SqlTableDefinition) error {
+	if len(definition.PrimaryKey) > 0 && slices.ContainsFunc(definition.Columns, func(column *ColumnDefinition) bool {
+		return column.IndexType == Primary
+	}) {
+		return fmt.Errorf("primary key declared more than once in table %s", definition.TableName)
+	}
+	columns, err := getPrimaryKeyColumns(definition)
+	if err != nil {
+		return err
+	}
+	return checkIndexColumns(definition, columns)
+}
+
+// checkIndexColumns 检查索引的列都存在、不重复且是 INT、CHAR 或 VARCHAR 列，列数不超过 MAX_INDEX_COLUMNS，
+// 编码后的键不超过 MAX_KEY_SIZE 字节
+func checkIndexColumns(definition *SqlTableDefinition, columns []string) error {
+	if len(columns) > MAX_INDEX_COLUMNS {
+		return fmt.Errorf("an index can have at most %d columns", MAX_INDEX_COLUMNS)
+	}
+	for i, name := range columns {
+		column := definition.GetColumn(name)
+		switch {
+		case column == nil:
+			return fmt.Errorf("unknown column %s in table %s", name, definition.TableName)
+		case slices.Contains(columns[:i], name):
+			return fmt.Errorf("column %s appears more than once in index", name)
+		}
+		if _, ok := keyWidth(column.DataType); !ok {
+			return fmt.Errorf("index can only be created on INT, CHAR or VARCHAR columns, %s is %v", name, column.DataType)
+		}
+	}
+	if length := keyLength(definition, columns); length > MAX_KEY_SIZE {
+		return fmt.Errorf("index key of %d bytes is longer than %d bytes", length, MAX_KEY_SIZE)
+	}
+	return nil
+}
+
+// checkUniqueIndexes 检查 UNIQUE 约束的唯一索引中是否已有其它行使用了 values 中的键，priKey 是正在写入的行的主键
+func (e *SqlQueryExecutor) checkUniqueIndexes(definition *SqlTableDefinition, values map[string]interface{}, priKey []byte) error {
+	for _, columns := range definition.UniqueKeys() {
+		indexKey, err := encodeKey(values, columns)
+		if err != nil {
+			return err
+		}
+		indexTree := e.SqlTableManager.getSecondaryIndex(definition.TableName, columnsName(columns))
+		used, err := usedByOtherRow(indexTree, indexKey, priKey)
+		if err != nil {
+			return err
+		}
+		if used {
+			return &UniqueConstraintError{TableName: definition.TableName, ColumnName: columnsName(columns), Value: keyValue(values, columns)}
+		}
+	}
+	return nil
+}
+
+// usedByOtherRow 判断二级索引中 indexKey 是否有指向主键 priKey 以外的行的条目
+func usedByOtherRow(indexTree *disktree.BPTree, indexKey []byte, priKey []byte) (bool, error) {
+	existing, _, err := indexTree.SearchAll(indexKey)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(existing, func(value []byte) bool {
+		return !bytes.Equal(value, priKey)
+	}), nil
+}
+
+// selectColumns 返回 SELECT 列表对应的列名，SELECT * 按表定义中列的顺序展开
+func selectColumns(node *SelectNode, definition *SqlTableDefinition) ([]string, error) {
+	columns := make([]string, 0, len(node.Columns))
+	for _, column := range node.Columns {
+		if column.ColumnType == WILDCARDN {
+			for _, col := range definition.Columns {
+				columns = append(columns, col.Name)
 			}
+			continue
 		}
+		if definition.GetColumn(column.ColumnName) == nil {
+			return nil, fmt.Errorf("unknown column %s in table %s", column.ColumnName, definition.TableName)
+		}
+		columns = append(columns, column.ColumnName)
 	}
-	return result
+	return columns, nil
 }
 
-func checkPrimaryKeyExisting(values map[string]interface{}, tableDef *SqlTableDefinition, tree *disktree.BPTree) uint32 {
-	key := getPrimaryKey(values, tableDef)
+func checkPrimaryKeyExisting(values map[string]interface{}, tableDef *SqlTableDefinition, tree *disktree.BPTree) ([]byte, error) {
+	key, err := getPrimaryKey(values, tableDef)
+	if err != nil {
+		return nil, err
+	}
 
 	// 检查主键是否存在
-	if _, exists := tree.Search(key); exists {
-		log.Fatal("duplicate primary key found")
+	_, exists, err := tree.Search(key)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		priKeyColumns := tableDef.PrimaryKeyColumns()
+		return nil, &DuplicateKeyError{TableName: tableDef.TableName, ColumnName: columnsName(priKeyColumns), Key: keyValue(values, priKeyColumns)}
 	}
 
-	return key
+	return key, nil
+}
+
+func (e *SqlQueryExecutor) insertIntoSecondaryIndex(tableName string, values map[string]interface{}, key []byte) error {
+	inedxes := e.SqlTableManager.getTableIndexes(tableName)
+
+	// put index key into every index tree
+	for name, indexTree := range inedxes {
+		indexKey, err := encodeKey(values, splitColumnsName(name))
+		if err != nil {
+			return err
+		}
+		if err := indexTree.InsertEntry(indexKey, key); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (e *SqlQueryExecutor) insertIntoSecondaryIndex(node *InsertNode, tableDef *SqlTableDefinition, key uint32) {
-	inedxes := e.SqlTableManager.getTableIndexes(node.TableName)
+// deleteFromSecondaryIndex 二级索引中以 (索引键, 主键) 存放条目，只删除指向当前主键的条目
+func deleteFromSecondaryIndex(indexTree *disktree.BPTree, indexKey []byte, priKey []byte) error {
+	_, err := indexTree.DeleteEntry(indexKey, priKey)
+	return err
+}
 
-	// column is secondary, put index key into index tree
-	for i, column := range tableDef.Columns {
-		if column.IndexType == Secondary {
-			indexTree := inedxes[column.Name]
-			//LiteralNode := node.Values[i].(LiteralNode)
-			//indexKey := LiteralNode.Value.(uint32)
-			indexKey := node.Values[i].(uint32)
-			indexTree.Insert(indexKey, e.SqlTableManager.serializeInt(key))
+// formatUpdateValues 检查 SET 中的列存在、不重复且值的类型与列定义一致
+func formatUpdateValues(node *UpdateNode, tableDef *SqlTableDefinition) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(node.Columns))
+	for i, colName := range node.Columns {
+		if tableDef.GetColumn(colName) == nil {
+			return nil, fmt.Errorf("unknown column %s in table %s", colName, tableDef.TableName)
 		}
+		if _, exists := values[colName]; exists {
+			return nil, fmt.Errorf("column %s assigned more than once", colName)
+		}
+		values[colName] = node.Values[i]
 	}
+	return values, checkValueTypes(values, tableDef)
 }
 
-func formatInsertValues(node *InsertNode, tableDef *SqlTableDefinition) map[string]interface{} {
+func formatInsertValues(node *InsertNode, tableDef *SqlTableDefinition) (map[string]interface{}, error) {
 	values := make(map[string]interface{})
 
 	if len(node.Columns) == 0 {
 		if len(node.Values) != len(tableDef.Columns) {
-			panic(fmt.Sprintf("value count (%d) doesn't match column count (%d)",
-				len(node.Values), len(tableDef.Columns)))
+			return nil, fmt.Errorf("value count (%d) doesn't match column count (%d)",
+				len(node.Values), len(tableDef.Columns))
 		}
 		for i, col := range tableDef.Columns {
 			values[col.Name] = node.Values[i]
 		}
-		return values
+		return values, checkValueTypes(values, tableDef)
 	}
 
 	if len(node.Values) != len(node.Columns) {
-		panic(fmt.Sprintf("value count (%d) doesn't match column count (%d)",
-			len(node.Values), len(node.Columns)))
+		return nil, fmt.Errorf("value count (%d) doesn't match column count (%d)",
+			len(node.Values), len(node.Columns))
 	}
 
 	for i, colName := range node.Columns {
@@ -265,159 +948,82 @@ func formatInsertValues(node *InsertNode, tableDef *SqlTableDefinition) map[stri
 
 	for _, col := range tableDef.Columns {
 		if _, exists := values[col.Name]; !exists {
-			panic(fmt.Sprintf("missing value for column %s", col.Name))
+			return nil, fmt.Errorf("missing value for column %s", col.Name)
 		}
 	}
 
-	return values
+	return values, checkValueTypes(values, tableDef)
 }
 
-func getPrimaryKey(values map[string]interface{}, tableDef *SqlTableDefinition) uint32 {
+// checkValueTypes 检查每一列的值与列定义的类型一致
+// 索引键只保存字符串的前 CHAR_LENGTH 字节，索引列上更长的字符串会与前缀相同的值冲突，因此拒绝写入
+func checkValueTypes(values map[string]interface{}, tableDef *SqlTableDefinition) error {
 	for _, col := range tableDef.Columns {
-		if !(col.IndexType == Primary) {
-			continue
-		}
-
-		val, exists := values[col.Name]
+		value, exists := values[col.Name]
 		if !exists {
-			panic(fmt.Sprintf("missing value for primary key column %s", col.Name))
+			continue
 		}
-
 		switch col.DataType {
 		case TypeInt:
-			if intVal, ok := val.(uint32); ok {
-				return intVal
+			if _, ok := value.(uint32); !ok {
+				return fmt.Errorf("invalid value %v for column %s, expected INT", value, col.Name)
 			}
-			panic(fmt.Sprintf("invalid type for primary key column %s, expected uint32", col.Name))
-
-		case TypeChar:
-			strVal, ok := val.(string)
+		case TypeChar, TypeVarchar:
+			str, ok := value.(string)
 			if !ok {
-				panic(fmt.Sprintf("invalid type for primary key column %s, expected string", col.Name))
+				return fmt.Errorf("invalid value %v for column %s, expected %v", value, col.Name, col.DataType)
 			}
-			key, err := strconv.ParseUint(strVal, 10, 32)
-			if err != nil {
-				panic(fmt.Sprintf("invalid primary key value: %s (must be a positive integer <= %d)",
-					strVal, uint32(^uint32(0))))
+			if len(str) > CHAR_LENGTH && isKeyColumn(tableDef, col.Name) {
+				return fmt.Errorf("value '%s' for index column %s is longer than %d bytes", str, col.Name, CHAR_LENGTH)
 			}
-			return uint32(key)
-
-		default:
-			panic(fmt.Sprintf("unsupported primary key type for column %s", col.Name))
 		}
 	}
-
-	panic("no primary key column found in table definition")
+	return nil
 }
 
-func getPrimeryKeyCondition(clause []*BinaryOpNode, definition *SqlTableDefinition, operation TokenType) (*BinaryOpNode, error) {
-	priKeyName, err := getPriName(definition)
-	if err != nil {
-		log.Fatal(err)
-	}
-	for _, node := range clause {
-		if left, ok := node.Left.(*ColumnNode); ok {
-			if left.ColumnName == priKeyName && node.Operator == operation {
-				return node, nil
-			}
-		}
+// isKeyColumn 判断列是否属于主键或某个二级索引
+func isKeyColumn(definition *SqlTableDefinition, column string) bool {
+	if slices.Contains(definition.PrimaryKeyColumns(), column) {
+		return true
 	}
-	return nil, fmt.Errorf("No primary key column found")
+	return slices.ContainsFunc(definition.SecondaryIndexes(), func(columns []string) bool {
+		return slices.Contains(columns, column)
+	})
 }
 
-func getSecondaryKeyCondition(clause []*BinaryOpNode, definition *SqlTableDefinition, operation TokenType) (*BinaryOpNode, error) {
-	secondaryIndexes, err := getSecondaryIndex(definition)
+// getPrimaryKey 返回编码后的主键
+func getPrimaryKey(values map[string]interface{}, tableDef *SqlTableDefinition) ([]byte, error) {
+	columns, err := getPrimaryKeyColumns(tableDef)
 	if err != nil {
-		log.Fatal(err)
-	}
-	for _, node := range clause {
-		if left, ok := node.Left.(*ColumnNode); ok {
-			if slices.Contains(secondaryIndexes, left.ColumnName) && node.Operator == operation {
-				return node, nil
-			}
-		}
-	}
-	return nil, fmt.Errorf("No primary key column found")
-}
-
-func GetPrimaryTreeRows(tree *disktree.BPTree, priKey uint32, definition *SqlTableDefinition) []map[string]interface{} {
-	all, _ := tree.SearchAll(priKey)
-
-	if all != nil {
-		rows := make([]map[string]interface{}, 0)
-		for _, bytes := range all {
-			// deserialize
-			rows = append(rows, deserializeRow(definition, bytes))
-		}
-		logger.Debug("rows: %v \n", rows)
-		return rows
+		return nil, err
 	}
-	log.Fatal("can't found data")
-	return nil
-}
-
-func GetSecondaryTreeRows(tree *disktree.BPTree, indexKey uint32, definition *SqlTableDefinition) []map[string]interface{} {
-	all, _ := tree.SearchAll(indexKey)
-	if all != nil {
-		rows := make([]map[string]interface{}, 0)
-		for _, bytes := range all {
-			// deserialize
-			rows = append(rows, deserializeRow(definition, bytes))
+	for _, column := range columns {
+		if _, exists := values[column]; !exists {
+			return nil, fmt.Errorf("missing value for primary key column %s", column)
 		}
-		logger.Debug("rows: %v \n", rows)
-		return rows
-	}
-	log.Fatal("can't found data")
-	return nil
-}
-
-func GetSecondaryTreeRowsFromPri(tree *disktree.BPTree, indexKey uint32, priTree *disktree.BPTree, definition *SqlTableDefinition) []map[string]interface{} {
-	allPri, _ := tree.SearchAll(indexKey)
-	priKeys := make([]uint32, 0)
-	rows := make([]map[string]interface{}, 0)
-	if allPri != nil {
-		for _, bytes := range allPri {
-			priKeys = append(priKeys, DeserializeInt(bytes))
-		}
-	}
-	for _, pri := range priKeys {
-		rows = append(rows, GetPrimaryTreeRows(priTree, pri, definition)...)
 	}
-	return rows
+	return encodeKey(values, columns)
 }
 
-func getRowSize(definition *SqlTableDefinition) int {
+func getRowSize(definition *SqlTableDefinition) (int, error) {
 	size := 0
 	for _, column := range definition.Columns {
 		if column.DataType == TypeInt {
 			size += INT_SIZE
-		} else if column.DataType == TypeChar {
+		} else if isStringType(column.DataType) {
 			size += CHAR_SIZE + CHAR_LENGTH
 		} else {
-			log.Fatal("getRowSize Unknown column type:", column.DataType)
+			return 0, fmt.Errorf("unknown column type: %v", column.DataType)
 		}
 	}
-	return size
+	return size, nil
 }
 
-func getPriName(definition *SqlTableDefinition) (string, error) {
-	for _, column := range definition.Columns {
-		if column.IndexType == Primary {
-			return column.Name, nil // 返回列名而不是数据类型
-		}
+// getPrimaryKeyColumns 返回主键依次包含的列
+func getPrimaryKeyColumns(definition *SqlTableDefinition) ([]string, error) {
+	columns := definition.PrimaryKeyColumns()
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("primary key not exist in table definition")
 	}
-	return "", fmt.Errorf("primary key not exist in table definition")
-}
-
-func getSecondaryIndex(definition *SqlTableDefinition) ([]string, error) {
-	indexes := []string{}
-	for _, column := range definition.Columns {
-		if column.IndexType == Secondary {
-			indexes = append(indexes, column.Name)
-		}
-	}
-	if len(indexes) == 0 {
-		return nil, fmt.Errorf("no primary key column found in table definition")
-	}
-	return indexes, nil
+	return columns, nil
 }
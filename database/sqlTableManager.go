@@ -7,7 +7,6 @@ import (
 	"godb/disktree"
 	. "godb/entity"
 	"godb/logger"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,10 +18,13 @@ import (
 // @Update       david 2025-01-15 14:26
 
 type SqlTableManager struct {
-	dataDirectory        string
-	tableDefinitions     map[string]*SqlTableDefinition
-	tablePrimaryIndex    map[string]*disktree.BPTree
+	dataDirectory     string
+	tableDefinitions  map[string]*SqlTableDefinition
+	tablePrimaryIndex map[string]*disktree.BPTree
+	// 每张表的二级索引，以 columnsName 得到的索引列名为键
 	tableSecondaryIndexs map[string]map[string]*disktree.BPTree
+	// ANALYZE 收集的统计信息，没有 ANALYZE 过的表不在其中
+	tableStatistics map[string]*tableStatistics
 }
 
 const (
@@ -32,36 +34,53 @@ const (
 	CHAR_LENGTH = 16
 	CHAR_SIZE   = 4
 	CACHE_SIZE  = 10
+	// MAX_INDEX_COLUMNS 一个索引最多包含的列数，保证索引键能放进 B+ 树的页面
+	MAX_INDEX_COLUMNS = 16
+	// MAX_KEY_SIZE 编码后索引键最多的字节数，二级索引的一个条目包含索引键和主键，都不超过这个长度时才能放进页面
+	MAX_KEY_SIZE = 64
+	// MAX_STRING_KEY 编码后最大的字符串索引键，用作字符串区间没有上界时的 hi
+	MAX_STRING_KEY = "\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff"
 )
 
-// 构造函数
-func NewSqlTableManager(dataDirectory string) *SqlTableManager {
+// 构造函数，读取数据目录下已有的表定义并打开它们的索引，失败时返回错误
+func NewSqlTableManager(dataDirectory string) (*SqlTableManager, error) {
 	stm := &SqlTableManager{
 		dataDirectory:        dataDirectory,
 		tableDefinitions:     make(map[string]*SqlTableDefinition),
 		tablePrimaryIndex:    make(map[string]*disktree.BPTree),
 		tableSecondaryIndexs: make(map[string]map[string]*disktree.BPTree),
+		tableStatistics:      make(map[string]*tableStatistics),
 	}
 
 	// 读取表定义和初始化B+树
-	stm.tableDefinitions = stm.readTableDefinition()
+	var err error
+	if stm.tableDefinitions, err = stm.readTableDefinition(); err != nil {
+		return nil, err
+	}
 	//fmt.Printf("tableDefinitions: %v\n", db.tableDefinitions)
 	// 每次都需要初始化吗？
-	stm.tablePrimaryIndex = stm.readTableTree()
+	if stm.tablePrimaryIndex, err = stm.readTableTree(); err != nil {
+		return nil, err
+	}
 
-	stm.tableSecondaryIndexs = stm.readSecondaryIndexs()
-	return stm
+	if stm.tableSecondaryIndexs, err = stm.readSecondaryIndexs(); err != nil {
+		// 关闭已经打开的主索引
+		stm.Close()
+		return nil, err
+	}
+	stm.tableStatistics = stm.readTableStatistics()
+	return stm, nil
 }
 
 func (b *SqlTableManager) getTableDefinition(tableName string) *SqlTableDefinition {
 	return b.tableDefinitions[tableName]
 }
 
-func (b *SqlTableManager) readTableDefinition() map[string]*SqlTableDefinition {
+func (b *SqlTableManager) readTableDefinition() (map[string]*SqlTableDefinition, error) {
 	if _, err := os.Stat(b.dataDirectory); os.IsNotExist(err) {
 		err := os.MkdirAll(b.dataDirectory, 0755)
 		if err != nil {
-			log.Fatal(err)
+			return nil, fmt.Errorf("failed to create directory: %w", err)
 		}
 	}
 
@@ -69,7 +88,7 @@ func (b *SqlTableManager) readTableDefinition() map[string]*SqlTableDefinition {
 
 	dir, err := os.ReadDir(b.dataDirectory)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
 	}
 	for _, file := range dir {
 		if info, _ := file.Info(); info.Mode().IsRegular() && strings.HasSuffix(file.Name(), ".json") {
@@ -77,58 +96,45 @@ func (b *SqlTableManager) readTableDefinition() map[string]*SqlTableDefinition {
 			content, err := os.ReadFile(filePath)
 			//fmt.Printf("content: %s \n", content)
 			if err != nil {
-				log.Fatal(err)
+				return nil, fmt.Errorf("failed to read table definition: %w", err)
 			}
 			var table SqlTableDefinition
 			err = json.Unmarshal(content, &table)
 			if err != nil {
-				logger.Debug("Error: %v", err)
+				return nil, fmt.Errorf("failed to unmarshal table definition %s: %w", filePath, err)
 			}
 			//fmt.Printf("json : %v \n", table)
 			tableDefinitions[table.TableName] = &table
 		}
 	}
-	return tableDefinitions
+	return tableDefinitions, nil
 }
 
-func (b *SqlTableManager) readTableTree() map[string]*disktree.BPTree {
+func (b *SqlTableManager) readTableTree() (map[string]*disktree.BPTree, error) {
 	tableTrees := make(map[string]*disktree.BPTree)
 	for tableName := range b.tableDefinitions {
 		//fmt.Printf("tableName: %s \n", tableName)
-		size := b.getRowSize(tableName)
-		fileName := b.dataDirectory + "/" + tableName + ".db"
-
-		redolog, err := disktree.NewRedoLog(fileName + ".log")
-		if err != nil {
-			log.Fatal(err)
+		size, err := b.getRowSize(tableName)
+		if err == nil {
+			tableTrees[tableName], err = openTree(b.primaryIndexFile(tableName), size)
 		}
-
-		diskPager, err := disktree.NewDiskPager(fileName, PAGE_SIZE, CACHE_SIZE, redolog)
-
 		if err != nil {
-			log.Fatal("Failed to allocate new page")
+			for _, tree := range tableTrees {
+				tree.DiskPager.Close()
+			}
+			return nil, err
 		}
-		tree := disktree.NewBPTree(ORDER_SIZE, size, diskPager, redolog)
-		tableTrees[tableName] = tree
 	}
-	return tableTrees
+	return tableTrees, nil
 }
 
-func (b *SqlTableManager) getRowSize(name string) uint32 {
+func (b *SqlTableManager) getRowSize(name string) (uint32, error) {
 	tableDefinition := b.tableDefinitions[name]
-	rowSize := uint32(0)
-	for _, column := range tableDefinition.Columns {
-		//fmt.Printf("column name: %v \n", column.Name)
-		//fmt.Printf("column type: %v \n", column.DataType)
-		if column.DataType == TypeInt {
-			rowSize += INT_SIZE
-		} else if column.DataType == TypeChar {
-			rowSize += CHAR_SIZE + CHAR_LENGTH
-		} else {
-			log.Fatal("Unknown column type:", column.DataType)
-		}
+	if tableDefinition == nil {
+		return 0, &UnknownTableError{TableName: name}
 	}
-	return rowSize
+	rowSize, err := getRowSize(tableDefinition)
+	return uint32(rowSize), err
 }
 
 func resetDataDirectory(dataDirectory string) error {
@@ -167,29 +173,34 @@ func (b *SqlTableManager) Close() {
 	for _, tree := range b.tablePrimaryIndex {
 		tree.DiskPager.Close()
 	}
+	for _, indexes := range b.tableSecondaryIndexs {
+		for _, tree := range indexes {
+			tree.DiskPager.Close()
+		}
+	}
 }
 
-func (b *SqlTableManager) readSecondaryIndexs() map[string]map[string]*disktree.BPTree {
+func (b *SqlTableManager) readSecondaryIndexs() (map[string]map[string]*disktree.BPTree, error) {
 	tableSecondaryIndexs := make(map[string]map[string]*disktree.BPTree)
 	for tableName, tableDefinition := range b.tableDefinitions {
 		indexs := make(map[string]*disktree.BPTree)
-		for _, column := range tableDefinition.Columns {
-			if column.IndexType == Secondary {
-				indexFileName := b.dataDirectory + "/" + tableName + "." + column.Name + ".idx"
-				redolog, err := disktree.NewRedoLog(indexFileName + ".log")
-
-				if err != nil {
-					log.Fatal("Failed to allocate new page")
+		tableSecondaryIndexs[tableName] = indexs
+		for _, columns := range tableDefinition.SecondaryIndexes() {
+			name := columnsName(columns)
+			indexTree, err := openTree(b.secondaryIndexFile(tableName, name), primaryKeyLength(tableDefinition))
+			if err != nil {
+				// 关闭已经打开的索引
+				for _, indexes := range tableSecondaryIndexs {
+					for _, tree := range indexes {
+						tree.DiskPager.Close()
+					}
 				}
-				indexPager, _ := disktree.NewDiskPager(indexFileName, PAGE_SIZE, CACHE_SIZE, redolog)
-
-				indexTree := disktree.NewBPTree(ORDER_SIZE, INT_SIZE+INT_SIZE, indexPager, redolog)
-				indexs[column.Name] = indexTree
+				return nil, err
 			}
+			indexs[name] = indexTree
 		}
-		tableSecondaryIndexs[tableName] = indexs
 	}
-	return tableSecondaryIndexs
+	return tableSecondaryIndexs, nil
 }
 
 func (b *SqlTableManager) getTableIndexes(name string) map[string]*disktree.BPTree {
@@ -207,74 +218,211 @@ func (b *SqlTableManager) serializeInt(key uint32) []byte {
 	return res
 }
 
-func (b *SqlTableManager) addAndPersistTableDefinition(definition *SqlTableDefinition) {
-
-	b.tableDefinitions[definition.TableName] = definition
+func (b *SqlTableManager) addAndPersistTableDefinition(definition *SqlTableDefinition) error {
 
 	// create table directory
 	if _, err := os.Stat(b.dataDirectory); os.IsNotExist(err) {
 		err := os.MkdirAll(b.dataDirectory, 0755)
 		if err != nil {
-			logger.Error("failed to create directory: %v\n", err)
+			return fmt.Errorf("failed to create directory: %w", err)
 		}
 	}
 
 	// ser(json) table definition
 	jsonTableDef, err := json.Marshal(definition)
 	if err != nil {
-		logger.Error("failed to marshal definition: %v\n", err)
+		return fmt.Errorf("failed to marshal definition: %w", err)
 	}
 
 	// json file
 	jsonfilename := filepath.Join(b.dataDirectory, definition.TableName+".json")
 	err = os.WriteFile(jsonfilename, jsonTableDef, 0644)
 	if err != nil {
-		logger.Error("failed to create json table: %v\n", err)
+		return fmt.Errorf("failed to create json table: %w", err)
 	}
+
+	b.tableDefinitions[definition.TableName] = definition
+	return nil
 }
 
-func (b *SqlTableManager) addPrimaryIndex(definition *SqlTableDefinition) {
+func (b *SqlTableManager) addPrimaryIndex(definition *SqlTableDefinition) error {
 	// init tree
-	size := b.getRowSize(definition.TableName)
-	fileName := filepath.Join(b.dataDirectory, definition.TableName+".db")
-	redolog, err := disktree.NewRedoLog(fileName + ".log")
+	size, err := b.getRowSize(definition.TableName)
 	if err != nil {
-		log.Fatal("Failed to allocate new page")
+		return err
 	}
-
-	diskPager, err := disktree.NewDiskPager(fileName, PAGE_SIZE, CACHE_SIZE, redolog)
-
+	tree, err := openTree(b.primaryIndexFile(definition.TableName), size)
 	if err != nil {
-		log.Fatal("Failed to allocate new page")
+		return err
 	}
-	tree := disktree.NewBPTree(ORDER_SIZE, size, diskPager, redolog)
 	b.tablePrimaryIndex[definition.TableName] = tree
+	return nil
 }
 
-func (b *SqlTableManager) addSecondaryIndex(definition *SqlTableDefinition) {
+func (b *SqlTableManager) addSecondaryIndex(definition *SqlTableDefinition) error {
 	indexes := make(map[string]*disktree.BPTree)
-	for _, column := range definition.Columns {
-		if column.IndexType == Secondary {
-			indexFileName := b.dataDirectory + "/" + definition.TableName + "." + column.Name + ".idx"
-			redolog, err := disktree.NewRedoLog(indexFileName + ".log")
-			if err != nil {
-				log.Fatal("Failed to allocate new page")
+	for _, columns := range definition.SecondaryIndexes() {
+		name := columnsName(columns)
+		indexTree, err := openTree(b.secondaryIndexFile(definition.TableName, name), primaryKeyLength(definition))
+		if err != nil {
+			return err
+		}
+		indexes[name] = indexTree
+	}
+	b.tableSecondaryIndexs[definition.TableName] = indexes
+	return nil
+}
+
+// openTree 打开数据文件和对应的 redo log 并创建 B+ 树
+func openTree(fileName string, valueLength uint32) (tree *disktree.BPTree, err error) {
+	redolog, err := disktree.NewRedoLog(fileName + ".log")
+	if err != nil {
+		return nil, err
+	}
+	diskPager, err := disktree.NewDiskPager(fileName, PAGE_SIZE, CACHE_SIZE, redolog)
+	if err != nil {
+		return nil, err
+	}
+
+	// 初始化根节点失败时 NewBPTree 会抛出 *disktree.IOError
+	defer func() {
+		if r := recover(); r != nil {
+			ioErr, ok := r.(*disktree.IOError)
+			if !ok {
+				panic(r)
 			}
+			err = ioErr
+		}
+	}()
+	return disktree.NewBPTree(ORDER_SIZE, valueLength, diskPager, redolog), nil
+}
+
+// primaryIndexFile 主键索引（表数据）文件的路径
+func (b *SqlTableManager) primaryIndexFile(tableName string) string {
+	return filepath.Join(b.dataDirectory, tableName+".db")
+}
+
+// secondaryIndexFile 二级索引文件的路径，name 是索引列名，例如 users.age.idx、users.team,age.idx
+func (b *SqlTableManager) secondaryIndexFile(tableName string, name string) string {
+	return filepath.Join(b.dataDirectory, tableName+"."+name+".idx")
+}
+
+// columnsName 索引列名，多列索引的列名用逗号连接；二级索引的文件、B+ 树和统计信息都以它为名
+func columnsName(columns []string) string {
+	return strings.Join(columns, ",")
+}
+
+// splitColumnsName 把 columnsName 得到的索引列名拆回各列
+func splitColumnsName(name string) []string {
+	return strings.Split(name, ",")
+}
 
-			indexPager, err := disktree.NewDiskPager(indexFileName, PAGE_SIZE, CACHE_SIZE, redolog)
+// primaryKeyLength 编码后主键的字节数，也是二级索引中值的长度
+func primaryKeyLength(definition *SqlTableDefinition) uint32 {
+	return uint32(keyLength(definition, definition.PrimaryKeyColumns()))
+}
+
+// keyLength 编码后 columns 列组成的索引键的字节数
+func keyLength(definition *SqlTableDefinition, columns []string) int {
+	length := 0
+	for _, name := range columns {
+		if column := definition.GetColumn(name); column != nil {
+			width, _ := keyWidth(column.DataType)
+			length += width
+		}
+	}
+	return length
+}
+
+// buildSecondaryIndex 扫描主键索引，为已有表的一列或多列建立二级索引，返回建立索引的行数
+// 唯一索引遇到重复的键时删除已经写入的文件并返回 *UniqueConstraintError
+func (b *SqlTableManager) buildSecondaryIndex(definition *SqlTableDefinition, columns []string, unique bool) (count uint32, err error) {
+	primaryTree := b.tablePrimaryIndex[definition.TableName]
+	if primaryTree == nil {
+		return 0, &UnknownTableError{TableName: definition.TableName}
+	}
+	name := columnsName(columns)
+	fileName := b.secondaryIndexFile(definition.TableName, name)
+	// 之前失败的 CREATE INDEX 可能留下了文件
+	removeTreeFiles(fileName)
+	indexTree, err := openTree(fileName, primaryKeyLength(definition))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			closeTree(indexTree)
+			removeTreeFiles(fileName)
+		}
+	}()
+
+	it := primaryTree.Iterator()
+	for it.Next() {
+		row, err := deserializeRow(definition, it.Value())
+		if err != nil {
+			return count, err
+		}
+		indexKey, err := encodeKey(row, columns)
+		if err != nil {
+			return count, err
+		}
+		if unique {
+			existing, _, err := indexTree.SearchAll(indexKey)
 			if err != nil {
-				log.Fatal("Failed to allocate new page")
+				return count, err
+			}
+			if len(existing) > 0 {
+				return count, &UniqueConstraintError{TableName: definition.TableName, ColumnName: name, Value: keyValue(row, columns)}
 			}
+		}
+		if err := indexTree.InsertEntry(indexKey, it.Key()); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := it.Err(); err != nil {
+		return count, err
+	}
+	if err := indexTree.Flush(); err != nil {
+		return count, err
+	}
 
-			indexTree := disktree.NewBPTree(ORDER_SIZE, INT_SIZE, indexPager, redolog)
-			indexes[column.Name] = indexTree
+	if b.tableSecondaryIndexs[definition.TableName] == nil {
+		b.tableSecondaryIndexs[definition.TableName] = make(map[string]*disktree.BPTree)
+	}
+	b.tableSecondaryIndexs[definition.TableName][name] = indexTree
+	logger.Debug("built index on %s(%s) with %d rows", definition.TableName, name, count)
+	return count, nil
+}
+
+// dropSecondaryIndex 关闭并删除一个二级索引的文件，name 是索引列名
+func (b *SqlTableManager) dropSecondaryIndex(tableName string, name string) error {
+	if indexTree := b.tableSecondaryIndexs[tableName][name]; indexTree != nil {
+		closeTree(indexTree)
+		delete(b.tableSecondaryIndexs[tableName], name)
+	}
+	return removeTreeFiles(b.secondaryIndexFile(tableName, name))
+}
+
+// closeTree 先关闭数据文件再关闭 redo log
+func closeTree(tree *disktree.BPTree) {
+	tree.DiskPager.Close()
+	tree.RedoLog.Close()
+}
+
+// removeTreeFiles 删除 B+ 树的数据文件和对应的 redo log，文件不存在时忽略
+func removeTreeFiles(fileName string) error {
+	for _, file := range []string{fileName, fileName + ".log"} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
 		}
 	}
-	b.tableSecondaryIndexs[definition.TableName] = indexes
+	return nil
 }
 
-func (b *SqlTableManager) getSecondaryIndex(tableName string, columnName string) *disktree.BPTree {
-	return b.tableSecondaryIndexs[tableName][columnName]
+// getSecondaryIndex 按索引列名查找二级索引，单列索引的索引列名就是列名
+func (b *SqlTableManager) getSecondaryIndex(tableName string, name string) *disktree.BPTree {
+	return b.tableSecondaryIndexs[tableName][name]
 }
 
 func (b *SqlTableManager) Flush() error {
@@ -0,0 +1,314 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"godb/disktree"
+	. "godb/entity"
+	"godb/logger"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// @Title        statistics.go
+// @Description  table statistics collected by ANALYZE and the cost model of access paths
+
+const (
+	// STATISTICS_SUFFIX 统计信息文件的后缀，与表定义的 .json 放在同一个目录
+	STATISTICS_SUFFIX = ".stats"
+
+	// SEQUENTIAL_ROW_COST 沿叶子链表读取一行的代价
+	SEQUENTIAL_ROW_COST = 1.0
+	// LOOKUP_ROW_COST 通过二级索引回主键索引读取一行的额外代价
+	LOOKUP_ROW_COST = 4.0
+	// INDEX_SEEK_COST 从根节点下降到叶子节点的代价
+	INDEX_SEEK_COST = 3.0
+	// DEFAULT_KEY_SELECTIVITY 没有统计信息的索引列，一个键平均匹配的行数占总行数的比例
+	DEFAULT_KEY_SELECTIVITY = 0.1
+	// DEFAULT_RANGE_SELECTIVITY 没有统计信息的索引列，区间条件匹配的行数占总行数的比例
+	DEFAULT_RANGE_SELECTIVITY = 1.0 / 3
+)
+
+// tableStatistics 表的统计信息，由 ANALYZE 计算并保存在数据目录下的 <table>.stats 中
+// 之后的插入和删除只在内存中调整行数，下一次 ANALYZE 时重新计算
+type tableStatistics struct {
+	RowCount uint32 `json:"rowCount"`
+	// 主键和二级索引的统计信息，以索引列名为键，见 columnsName
+	Indexes map[string]*indexStatistics `json:"indexes"`
+}
+
+// indexStatistics 一个索引的不同键数和第一列的取值范围，第一列不是 INT 时没有取值范围
+type indexStatistics struct {
+	Distinct uint32 `json:"distinct"`
+	MinKey   uint32 `json:"minKey"`
+	MaxKey   uint32 `json:"maxKey"`
+	// 多列索引中最左 1、2、... 列组成的前缀各有多少个不同的值，不包含所有列，单列索引为空
+	PrefixDistinct []uint32 `json:"prefixDistinct,omitempty"`
+}
+
+// analyzeIndex 沿叶子链表读一遍索引，统计条目数、不同键数和第一列的范围
+func analyzeIndex(tree *disktree.BPTree, tableIndex *tableIndex) (entries uint32, index *indexStatistics, err error) {
+	index = &indexStatistics{}
+	// 各个前缀编码后的字节数
+	prefixLengths := make([]int, len(tableIndex.types)-1)
+	length := 0
+	for i := range prefixLengths {
+		width, _ := keyWidth(tableIndex.types[i])
+		length += width
+		prefixLengths[i] = length
+	}
+	if len(prefixLengths) > 0 {
+		index.PrefixDistinct = make([]uint32, len(prefixLengths))
+	}
+	numeric := tableIndex.types[0] == TypeInt
+
+	var previous []byte
+	it := tree.Iterator()
+	for it.Next() {
+		key := it.Key()
+		var first uint32
+		if numeric {
+			first = DeserializeInt(key[:INT_SIZE])
+		}
+		if entries == 0 {
+			index.MinKey = first
+		}
+		if entries == 0 || !bytes.Equal(key, previous) {
+			index.Distinct++
+		}
+		for i, length := range prefixLengths {
+			if entries == 0 || !bytes.Equal(key[:length], previous[:length]) {
+				index.PrefixDistinct[i]++
+			}
+		}
+		index.MaxKey = first
+		previous = key
+		entries++
+	}
+	return entries, index, it.Err()
+}
+
+// rowsPerPrefix 估算索引最左 columns 列取一组确定的值时匹配的行数，columns 为 0 时是整张表
+func (s *tableStatistics) rowsPerPrefix(index *tableIndex, columns int) float64 {
+	if columns == 0 {
+		return float64(s.RowCount)
+	}
+	stats := s.Indexes[index.name]
+	if stats == nil {
+		return float64(s.RowCount) * DEFAULT_KEY_SELECTIVITY
+	}
+	distinct := stats.Distinct
+	if columns < len(index.columns) && columns <= len(stats.PrefixDistinct) {
+		distinct = stats.PrefixDistinct[columns-1]
+	}
+	if distinct == 0 {
+		return 0
+	}
+	return float64(s.RowCount) / float64(distinct)
+}
+
+// rangeFraction 估算扫描的区间 [lo, hi] 在前缀匹配的行中所占的比例
+// 区间在索引的第一列上时假设键在 [MinKey, MaxKey] 上均匀分布，其余的列没有统计取值范围
+func (s *tableStatistics) rangeFraction(scan *indexScan) float64 {
+	if scan.empty() {
+		return 0
+	}
+	lo, loOk := scan.lo.(uint32)
+	hi, hiOk := scan.hi.(uint32)
+	index := s.Indexes[scan.index.name]
+	if index == nil || len(scan.prefix) > 0 || !loOk || !hiOk {
+		return DEFAULT_RANGE_SELECTIVITY
+	}
+	lo, hi = max(lo, index.MinKey), min(hi, index.MaxKey)
+	if index.Distinct == 0 || lo > hi {
+		return 0
+	}
+	return (float64(hi-lo) + 1) / (float64(index.MaxKey-index.MinKey) + 1)
+}
+
+// estimate 估算访问路径读取的行数和代价
+// 每次索引下降计 INDEX_SEEK_COST，每读一行计 SEQUENTIAL_ROW_COST，二级索引回表的每一行再计 LOOKUP_ROW_COST
+func (s *tableStatistics) estimate(scan *indexScan) (rows float64, cost float64) {
+	total := float64(s.RowCount)
+	if scan.full {
+		return total, total * SEQUENTIAL_ROW_COST
+	}
+
+	seeks := 1.0
+	switch {
+	case scan.keys != nil:
+		seeks = float64(len(scan.keys))
+		rows = seeks * s.rowsPerPrefix(scan.index, len(scan.prefix)+1)
+	case scan.lo == scan.hi:
+		rows = s.rowsPerPrefix(scan.index, len(scan.prefix)+1)
+	default:
+		rows = s.rowsPerPrefix(scan.index, len(scan.prefix)) * s.rangeFraction(scan)
+	}
+	rows = min(rows, total)
+
+	rowCost := SEQUENTIAL_ROW_COST
+	if scan.index.secondary {
+		rowCost += LOOKUP_ROW_COST
+	}
+	return rows, seeks*INDEX_SEEK_COST + rows*rowCost
+}
+
+// analyzeTable 重新计算表的统计信息并持久化
+func (b *SqlTableManager) analyzeTable(definition *SqlTableDefinition) (*tableStatistics, error) {
+	tree := b.tablePrimaryIndex[definition.TableName]
+	if tree == nil {
+		return nil, &UnknownTableError{TableName: definition.TableName}
+	}
+	indexes, err := tableIndexes(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &tableStatistics{Indexes: make(map[string]*indexStatistics)}
+	primary := indexes[0]
+	if stats.RowCount, stats.Indexes[primary.name], err = analyzeIndex(tree, primary); err != nil {
+		return nil, err
+	}
+	for _, index := range indexes[1:] {
+		indexTree := b.getSecondaryIndex(definition.TableName, index.name)
+		if _, stats.Indexes[index.name], err = analyzeIndex(indexTree, index); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.persistTableStatistics(definition.TableName, stats); err != nil {
+		return nil, err
+	}
+	b.tableStatistics[definition.TableName] = stats
+	logger.Debug("analyze %s: %v", definition.TableName, stats)
+	return stats, nil
+}
+
+// refreshIndexStatistics 创建或删除索引后更新已有的统计信息，name 是索引列名，indexTree 为 nil 表示索引已删除
+// 表还没有 ANALYZE 过时不做任何事
+func (b *SqlTableManager) refreshIndexStatistics(tableName string, name string, indexTree *disktree.BPTree) error {
+	stats := b.tableStatistics[tableName]
+	if stats == nil {
+		return nil
+	}
+	definition := b.getTableDefinition(tableName)
+	if indexTree == nil || definition == nil {
+		delete(stats.Indexes, name)
+	} else {
+		_, index, err := analyzeIndex(indexTree, newTableIndex(definition, splitColumnsName(name), true))
+		if err != nil {
+			return err
+		}
+		stats.Indexes[name] = index
+	}
+	return b.persistTableStatistics(tableName, stats)
+}
+
+// getTableStatistics 返回表的统计信息，表还没有 ANALYZE 过时返回 nil
+func (b *SqlTableManager) getTableStatistics(tableName string) *tableStatistics {
+	return b.tableStatistics[tableName]
+}
+
+// adjustRowCount 插入或删除后调整内存中的行数，表没有统计信息时不做任何事
+func (b *SqlTableManager) adjustRowCount(tableName string, delta int) {
+	stats := b.tableStatistics[tableName]
+	if stats == nil {
+		return
+	}
+	stats.RowCount = uint32(min(max(int64(stats.RowCount)+int64(delta), 0), math.MaxUint32))
+}
+
+func (b *SqlTableManager) persistTableStatistics(tableName string, stats *tableStatistics) error {
+	content, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to marshal statistics: %w", err)
+	}
+	fileName := filepath.Join(b.dataDirectory, tableName+STATISTICS_SUFFIX)
+	if err := os.WriteFile(fileName, content, 0644); err != nil {
+		return fmt.Errorf("failed to write statistics: %w", err)
+	}
+	return nil
+}
+
+// readTableStatistics 读取数据目录下已有表的统计信息，文件损坏时忽略，等待下一次 ANALYZE
+func (b *SqlTableManager) readTableStatistics() map[string]*tableStatistics {
+	statistics := make(map[string]*tableStatistics)
+	for tableName := range b.tableDefinitions {
+		fileName := filepath.Join(b.dataDirectory, tableName+STATISTICS_SUFFIX)
+		content, err := os.ReadFile(fileName)
+		if err != nil {
+			continue
+		}
+		var stats tableStatistics
+		if err := json.Unmarshal(content, &stats); err != nil {
+			logger.Warn("ignore broken statistics %s: %v", fileName, err)
+			continue
+		}
+		if stats.Indexes == nil {
+			stats.Indexes = make(map[string]*indexStatistics)
+		}
+		statistics[tableName] = &stats
+	}
+	return statistics
+}
+
+// processAnalyze 重新计算表的统计信息，结果集中每个索引一行：先按列的顺序列出单列索引，再列出多列索引
+// 多列索引的 column 是用逗号连接的索引列名，min 和 max 是第一列的范围，第一列不是 INT 时为 NULL
+func (e *SqlQueryExecutor) processAnalyze(node *AnalyzeNode) (*ResultSet, error) {
+	logger.Debug("start process analyze sql")
+	definition := e.SqlTableManager.getTableDefinition(node.TableName)
+	if definition == nil {
+		return nil, &UnknownTableError{TableName: node.TableName}
+	}
+	stats, err := e.SqlTableManager.analyzeTable(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(stats.Indexes))
+	for _, column := range definition.Columns {
+		names = append(names, column.Name)
+	}
+	indexes, err := tableIndexes(definition)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		if len(index.columns) > 1 {
+			names = append(names, index.name)
+		}
+	}
+
+	resultSet := NewResultSet([]string{"table", "column", "rows", "distinct", "min", "max"})
+	for _, name := range names {
+		index := stats.Indexes[name]
+		if index == nil {
+			continue
+		}
+		var minKey, maxKey interface{}
+		if definition.GetColumn(splitColumnsName(name)[0]).DataType == TypeInt {
+			minKey, maxKey = index.MinKey, index.MaxKey
+		}
+		resultSet.AddRow(map[string]interface{}{
+			"table":    definition.TableName,
+			"column":   name,
+			"rows":     stats.RowCount,
+			"distinct": index.Distinct,
+			"min":      minKey,
+			"max":      maxKey,
+		})
+	}
+	return resultSet, nil
+}
+
+// String 用于调试日志
+func (s *tableStatistics) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("rows=%d", s.RowCount))
+	for column, index := range s.Indexes {
+		sb.WriteString(fmt.Sprintf(" %s(distinct=%d, [%d, %d])", column, index.Distinct, index.MinKey, index.MaxKey))
+	}
+	return sb.String()
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"fmt"
+	. "godb/entity"
+	"godb/logger"
+	"slices"
+	"strings"
+)
+
+// @Title        subquery.go
+// @Description  materialize IN literal lists and uncorrelated IN (SELECT ...) subqueries before execution
+
+// valueList IN 右侧物化后的值列表，替换条件中的字面量列表和子查询
+type valueList struct {
+	values []interface{}
+	set    map[interface{}]bool
+	// 列表中是否有 NULL，找不到时 IN 的结果是 UNKNOWN 而不是 FALSE
+	hasNull bool
+	// 字面量列表按书写顺序查找索引，没有 ORDER BY 时结果总是按列表的顺序返回，有 ORDER BY 时按 ORDER BY 排序
+	// 子查询的结果没有顺序，按键升序查找
+	preserveOrder bool
+}
+
+func newValueList(values []interface{}, preserveOrder bool) *valueList {
+	list := &valueList{
+		values:        values,
+		set:           make(map[interface{}]bool, len(values)),
+		preserveOrder: preserveOrder,
+	}
+	for _, value := range values {
+		if value == nil {
+			list.hasNull = true
+			continue
+		}
+		list.set[setKey(value)] = true
+	}
+	return list
+}
+
+// setKey 数值统一转成 float64，uint32 的列可以和 SUM 等聚合结果比较
+func setKey(value interface{}) interface{} {
+	if number, ok := numericValue(value); ok {
+		return number
+	}
+	return value
+}
+
+// contains 按三值逻辑判断 value 是否在列表中
+func (l *valueList) contains(value interface{}) truth {
+	if value == nil {
+		return truthUnknown
+	}
+	if l.set[setKey(value)] {
+		return truthTrue
+	}
+	if l.hasNull {
+		return truthUnknown
+	}
+	return truthFalse
+}
+
+// indexKeys 列表中的值都能作为 dataType 类型的列的索引键时返回去重后的键，用于逐个键查找索引
+// preserveOrder 时键保持在列表中第一次出现的顺序，否则按升序排列
+func (l *valueList) indexKeys(dataType DataType) ([]interface{}, bool) {
+	keys := make([]interface{}, 0, len(l.values))
+	seen := make(map[interface{}]bool, len(l.values))
+	for _, value := range l.values {
+		if value == nil {
+			continue
+		}
+		if !isKeyValue(value, dataType) {
+			return nil, false
+		}
+		if !seen[value] {
+			seen[value] = true
+			keys = append(keys, value)
+		}
+	}
+	if !l.preserveOrder {
+		slices.SortFunc(keys, compareKeys)
+	}
+	return keys, true
+}
+
+func (l *valueList) String() string {
+	values := make([]string, len(l.values))
+	for i, value := range l.values {
+		values[i] = formatValue(value)
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
+
+// resolveSubqueries 返回把 WHERE、HAVING 和 JOIN 条件中的子查询替换为结果列表后的查询，不修改原来的语法树
+func (e *SqlQueryExecutor) resolveSubqueries(node *SelectNode) (*SelectNode, error) {
+	resolved := *node
+	var err error
+	if resolved.WhereClause, err = e.materializeSubqueries(node.WhereClause); err != nil {
+		return nil, err
+	}
+	if resolved.Having, err = e.materializeSubqueries(node.Having); err != nil {
+		return nil, err
+	}
+	resolved.Join = make([]*JoinNode, len(node.Join))
+	for i, join := range node.Join {
+		condition, err := e.materializeSubqueries(join.Condition)
+		if err != nil {
+			return nil, err
+		}
+		resolved.Join[i] = NewJoinNode(join.Kind, join.TableName, condition)
+	}
+	return &resolved, nil
+}
+
+// materializeSubqueries 执行表达式中的每个 IN (SELECT ...) 子查询一次，用结果列表替换子查询，
+// IN (v1, v2, ...) 的字面量列表也替换为同样的结果列表，保留书写的顺序，见 valueList.preserveOrder
+// 子查询不引用外层查询的列，引用时在子查询自己的作用域中解析失败
+func (e *SqlQueryExecutor) materializeSubqueries(expression ASTNode) (ASTNode, error) {
+	switch n := expression.(type) {
+	case *BinaryOpNode:
+		if literals, ok := n.Right.(*ListNode); ok && n.Operator == IN {
+			values := make([]interface{}, len(literals.Values))
+			for i, literal := range literals.Values {
+				values[i] = literal.Value
+			}
+			return NewBinaryOpNode(IN, n.Left, newValueList(values, true)), nil
+		}
+		if subquery, ok := n.Right.(*SelectNode); ok && n.Operator == IN {
+			list, err := e.evaluateSubquery(subquery)
+			if err != nil {
+				return nil, err
+			}
+			return NewBinaryOpNode(IN, n.Left, list), nil
+		}
+		left, err := e.materializeSubqueries(n.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.materializeSubqueries(n.Right)
+		if err != nil {
+			return nil, err
+		}
+		if left == n.Left && right == n.Right {
+			return n, nil
+		}
+		return NewBinaryOpNode(n.Operator, left, right), nil
+	case *UnaryOpNode:
+		operand, err := e.materializeSubqueries(n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		if operand == n.Operand {
+			return n, nil
+		}
+		return NewUnaryOpNode(n.Operator, operand), nil
+	case *SelectNode:
+		return nil, fmt.Errorf("subquery is only supported on the right side of IN: %s", n)
+	default:
+		return expression, nil
+	}
+}
+
+// evaluateSubquery 执行子查询并取出唯一一列的所有值
+func (e *SqlQueryExecutor) evaluateSubquery(subquery *SelectNode) (*valueList, error) {
+	resultSet, err := e.processSelect(subquery, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(resultSet.Columns) != 1 {
+		return nil, fmt.Errorf("subquery must return exactly one column, got %d", len(resultSet.Columns))
+	}
+	values := make([]interface{}, 0, resultSet.Len())
+	for _, row := range resultSet.Rows {
+		values = append(values, row[0])
+	}
+	logger.Debug("subquery %s returned %d values", subquery, len(values))
+	return newValueList(values, false), nil
+}
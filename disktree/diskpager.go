@@ -2,6 +2,7 @@ package disktree
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"godb/logger"
 	"os"
@@ -18,6 +19,9 @@ type DiskPager struct {
 	pageSize  int
 	info      os.FileInfo
 
+	// 空闲页链表头，0 表示没有可复用的页面（第 0 页是元数据页，不会被回收）
+	freeListHead atomic.Uint32
+
 	// 缓存相关
 	cacheSize int
 	cache     sync.Map
@@ -37,6 +41,8 @@ type DiskPager struct {
 
 const (
 	FLASHiNTERVAL = 1000
+	// 空闲页标志，与叶子节点(1)、内部节点(0)的 isLeaf 字节区分
+	FREE_PAGE_FLAG byte = 2
 )
 
 func NewDiskPager(filename string, pageSize int, cacheSize int, redolog *RedoLog) (*DiskPager, error) {
@@ -123,7 +129,7 @@ func (dp *DiskPager) ReadPage(pageNum int) ([]byte, error) {
 	defer dp.mu.RUnlock()
 
 	if uint32(pageNum) > dp.totalPage.Load() {
-		return nil, fmt.Errorf("page number %d out of range (total pages: %d)", pageNum, dp.totalPage)
+		return nil, fmt.Errorf("page number %d out of range (total pages: %d)", pageNum, dp.totalPage.Load())
 	}
 
 	// check cache first
@@ -134,6 +140,12 @@ func (dp *DiskPager) ReadPage(pageNum int) ([]byte, error) {
 		return cachePage.([]byte), nil
 	}
 
+	// 被淘汰出缓存但还没有刷盘的页，文件中的内容是旧的
+	if dirtyPage, ok := dp.dirtyPage.Load(pageNum); ok {
+		dp.addToCache(pageNum, dirtyPage.([]byte))
+		return dirtyPage.([]byte), nil
+	}
+
 	pageData := make([]byte, dp.pageSize)
 
 	if int64((pageNum+1)*dp.pageSize) > dp.info.Size() {
@@ -159,9 +171,11 @@ func (dp *DiskPager) addToCache(pageNum int, data []byte) {
 	for count >= dp.cacheSize {
 		// remove the least used page
 		lastUsed, b := dp.lru.removeLast()
-		if b {
-			dp.cache.Delete(lastUsed)
+		if !b {
+			break
 		}
+		dp.cache.Delete(lastUsed)
+		count--
 	}
 	dp.cache.Store(pageNum, data)
 	// updatelru
@@ -185,8 +199,14 @@ func (dp *DiskPager) updateFileInfo() error {
 	return nil
 }
 
-// AllocateNewPage 分配新页面并返回页号
+// AllocateNewPage 分配新页面并返回页号，优先复用空闲链表中的页面
 func (dp *DiskPager) AllocateNewPage() (int, error) {
+	if pageNum, ok, err := dp.popFreePage(); err != nil {
+		return 0, err
+	} else if ok {
+		return pageNum, nil
+	}
+
 	dp.mu.Lock()
 	defer dp.mu.Unlock()
 
@@ -208,6 +228,41 @@ func (dp *DiskPager) AllocateNewPage() (int, error) {
 	return int(newPageNum), nil
 }
 
+// FreePage 回收页面，将其挂到空闲链表头部
+// free page format:
+// flag (1 byte) | logSequenceNumber (4 bytes) | nextFreePageNumber (4 bytes)
+func (dp *DiskPager) FreePage(pageNum int, logSequenceNumber int32) error {
+	if pageNum == 0 {
+		return fmt.Errorf("metadata page can't be freed")
+	}
+	data := make([]byte, dp.pageSize)
+	data[0] = FREE_PAGE_FLAG
+	binary.BigEndian.PutUint32(data[1:5], uint32(max(logSequenceNumber, 0)))
+	binary.BigEndian.PutUint32(data[5:9], dp.freeListHead.Load())
+	if err := dp.WritePage(pageNum, data, logSequenceNumber); err != nil {
+		return fmt.Errorf("failed to free page %d: %w", pageNum, err)
+	}
+	dp.freeListHead.Store(uint32(pageNum))
+	return nil
+}
+
+// popFreePage 从空闲链表头部取出一个页面
+func (dp *DiskPager) popFreePage() (int, bool, error) {
+	head := dp.freeListHead.Load()
+	if head == 0 {
+		return 0, false, nil
+	}
+	data, err := dp.ReadPage(int(head))
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read free page %d: %w", head, err)
+	}
+	if data[0] != FREE_PAGE_FLAG {
+		return 0, false, fmt.Errorf("page %d in free list is not a free page", head)
+	}
+	dp.freeListHead.Store(binary.BigEndian.Uint32(data[5:9]))
+	return int(head), true, nil
+}
+
 // Close 关闭文件
 func (dp *DiskPager) Close() error {
 	// 检查 redoLog 状态
@@ -257,6 +312,10 @@ func (dp *DiskPager) GetFileName() string {
 	return dp.fileName
 }
 
+func (dp *DiskPager) GetFreeListHead() uint32 {
+	return dp.freeListHead.Load()
+}
+
 // 主动 flush
 func (dp *DiskPager) Flush() error {
 	dp.mu.Lock()
@@ -149,6 +149,45 @@ func TestDiskPager(t *testing.T) {
 	})
 }
 
+// 被淘汰出缓存但还没有刷盘的页，读取时要返回最新写入的内容
+func TestDiskPagerEvictDirtyPage(t *testing.T) {
+	dir := t.TempDir()
+	pageSize := 64
+	cacheSize := 2
+
+	redoLog, err := NewRedoLog(dir + "/test.log")
+	if err != nil {
+		t.Fatalf("Failed to create RedoLog: %v", err)
+	}
+	defer redoLog.Close()
+	pager, err := NewDiskPager(dir+"/test.db", pageSize, cacheSize, redoLog)
+	if err != nil {
+		t.Fatalf("Failed to create DiskPager: %v", err)
+	}
+	defer pager.Close()
+
+	pages := make([][]byte, 5)
+	for i := range pages {
+		pageNum, err := pager.AllocateNewPage()
+		if err != nil {
+			t.Fatalf("Failed to allocate page: %v", err)
+		}
+		pages[i] = bytes.Repeat([]byte{byte(i + 1)}, pageSize)
+		if err := pager.WritePage(pageNum, pages[i], -1); err != nil {
+			t.Fatalf("Failed to write page %d: %v", pageNum, err)
+		}
+	}
+	for i, want := range pages {
+		data, err := pager.ReadPage(i)
+		if err != nil {
+			t.Fatalf("Failed to read page %d: %v", i, err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("page %d: expected %x..., got %x...", i, want[:4], data[:4])
+		}
+	}
+}
+
 func seeDetail(filename string, pageSize int) {
 	logger.Debug(":::Start to show detail of the file:")
 	// 读取 db 文件，看是否新建页面成功？
@@ -0,0 +1,35 @@
+package disktree
+
+import "fmt"
+
+// IOError 读写页面或日志失败时返回的错误
+type IOError struct {
+	Op         string
+	PageNumber uint32
+	Err        error
+}
+
+func (e *IOError) Error() string {
+	return fmt.Sprintf("disktree: %s (page %d): %v", e.Op, e.PageNumber, e.Err)
+}
+
+func (e *IOError) Unwrap() error {
+	return e.Err
+}
+
+// throwIOError 在节点的递归读写中抛出 IOError，
+// 由 BPTree 的公开方法通过 recoverIOError 转换为返回值，避免每一层都改签名
+func throwIOError(op string, pageNumber uint32, err error) {
+	panic(&IOError{Op: op, PageNumber: pageNumber, Err: err})
+}
+
+// recoverIOError 只捕获 throwIOError 抛出的错误，其余 panic 继续向上传递
+func recoverIOError(errp *error) {
+	if r := recover(); r != nil {
+		if ioErr, ok := r.(*IOError); ok {
+			*errp = ioErr
+			return
+		}
+		panic(r)
+	}
+}
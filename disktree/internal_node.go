@@ -5,37 +5,55 @@ import (
 	"encoding/binary"
 	"fmt"
 	"godb/logger"
-	"log"
 )
 
 // InternalNode 内部节点
 type DiskInternalNode struct {
 	Order               uint32
 	PageNumber          uint32
-	Keys                []uint32
+	Keys                [][]byte
 	ChildrenPageNumbers []uint32
 	DiskPager           *DiskPager
 	RedoLog             *RedoLog
+	// 键的比较函数
+	Compare Comparator
+	// 最后一次修改本页的日志序号，重做日志时跳过已经写入本页的修改
+	LogSequenceNumber int32
 }
 
 // NewInternalNode 创建新的内部节点
-func NewInternalNode(order uint32, pager *DiskPager, pageNum uint32, redolog *RedoLog) *DiskInternalNode {
+func NewInternalNode(order uint32, pager *DiskPager, pageNum uint32, redolog *RedoLog, compare Comparator) *DiskInternalNode {
 	node := &DiskInternalNode{
 		Order:               order,
 		PageNumber:          pageNum,
 		DiskPager:           pager,
 		RedoLog:             redolog,
-		Keys:                make([]uint32, 0, order-1),
+		Compare:             compare,
+		Keys:                make([][]byte, 0, order-1),
 		ChildrenPageNumbers: make([]uint32, 0, order),
 	}
 	return node
 }
 
 // Insert 实现内部节点的插入
-func (n *DiskInternalNode) Insert(key uint32, value []byte) *DiskInsertResult {
+func (n *DiskInternalNode) Insert(key []byte, value []byte) *DiskInsertResult {
+	return n.insertIntoChild(key, func(child DiskNode) *DiskInsertResult {
+		return child.Insert(key, value)
+	})
+}
+
+// InsertEntry 插入 (key, value) 条目，与 Insert 一样在键相等时进入右侧子树
+func (n *DiskInternalNode) InsertEntry(key []byte, value []byte) *DiskInsertResult {
+	return n.insertIntoChild(key, func(child DiskNode) *DiskInsertResult {
+		return child.InsertEntry(key, value)
+	})
+}
+
+// insertIntoChild 在 key 所在的子节点上执行插入，子节点分裂时把新的分隔键插入当前节点
+func (n *DiskInternalNode) insertIntoChild(key []byte, insert func(child DiskNode) *DiskInsertResult) *DiskInsertResult {
 	// 找到合适的子节点
 	insertIndex := 0
-	for insertIndex < len(n.Keys) && n.Keys[insertIndex] <= key {
+	for insertIndex < len(n.Keys) && n.Compare(n.Keys[insertIndex], key) <= 0 {
 		insertIndex++
 	}
 
@@ -43,13 +61,12 @@ func (n *DiskInternalNode) Insert(key uint32, value []byte) *DiskInsertResult {
 
 	// 递归插入到子节点
 	childPage := n.ChildrenPageNumbers[insertIndex]
-	child := ReadDisk(n.Order, n.DiskPager, childPage, n.RedoLog)
-	result := child.Insert(key, value)
+	child := ReadDisk(n.Order, n.DiskPager, childPage, n.RedoLog, n.Compare)
+	result := insert(child)
 
 	if result != nil {
-		// 子节点分裂，需要插入新的键和子节点指针
-		childPage := child.GetPageNumber()
-		n.insertIntoNode(result.Key, childPage)
+		// 子节点分裂，需要插入新的键和新的右侧子节点指针
+		n.insertIntoNode(result.Key, result.DiskNode.GetPageNumber())
 
 		// 内部节点最多可以有 order-1 个键
 		if uint32(len(n.Keys)) <= n.Order-1 {
@@ -62,14 +79,14 @@ func (n *DiskInternalNode) Insert(key uint32, value []byte) *DiskInsertResult {
 }
 
 // insertIntoNode 插入键和子节点到当前节点
-func (n *DiskInternalNode) insertIntoNode(key uint32, childPage uint32) {
+func (n *DiskInternalNode) insertIntoNode(key []byte, childPage uint32) {
 	insertIndex := 0
-	for insertIndex < len(n.Keys) && key >= n.Keys[insertIndex] {
+	for insertIndex < len(n.Keys) && n.Compare(key, n.Keys[insertIndex]) >= 0 {
 		insertIndex++
 	}
 
 	// 插入键
-	n.Keys = append(n.Keys[:insertIndex], append([]uint32{key}, n.Keys[insertIndex:]...)...)
+	n.Keys = append(n.Keys[:insertIndex], append([][]byte{key}, n.Keys[insertIndex:]...)...)
 
 	// 修改：正确处理子节点页码
 	if len(n.ChildrenPageNumbers) == 0 {
@@ -81,12 +98,12 @@ func (n *DiskInternalNode) insertIntoNode(key uint32, childPage uint32) {
 			append([]uint32{childPage}, n.ChildrenPageNumbers[insertIndex+1:]...)...)
 	}
 
-	logSequenceNumber, err := n.RedoLog.LogInsertInternalNormal(int32(n.PageNumber), int32(key), int(childPage))
+	logSequenceNumber, err := n.RedoLog.LogInsertInternalNormal(int32(n.PageNumber), key, int(childPage))
 	if err != nil {
 		logger.Error("failed to log internal node")
 	}
 	if err := n.WriteDisk(logSequenceNumber); err != nil {
-		log.Fatal(err)
+		throwIOError("write internal node", n.PageNumber, err)
 	}
 }
 
@@ -95,9 +112,9 @@ func (n *DiskInternalNode) splitInternalNode() *DiskInsertResult {
 	// 创建新的右侧节点
 	newNodePage, err := n.DiskPager.AllocateNewPage()
 	if err != nil {
-		log.Fatal("Failed to allocate new page")
+		throwIOError("allocate internal page", n.PageNumber, err)
 	}
-	newNode := NewInternalNode(n.Order, n.DiskPager, uint32(newNodePage), n.RedoLog)
+	newNode := NewInternalNode(n.Order, n.DiskPager, uint32(newNodePage), n.RedoLog, n.Compare)
 
 	// 计算中间位置
 	midIndex := len(n.Keys) / 2
@@ -123,10 +140,10 @@ func (n *DiskInternalNode) splitInternalNode() *DiskInsertResult {
 	logSequenceNumber, err := n.RedoLog.LogInsertInternalSplit(int32(n.PageNumber))
 	// 写回磁盘
 	if err := newNode.WriteDisk(logSequenceNumber); err != nil {
-		log.Fatalf("Failed to write new internal node to disk: %v", err)
+		throwIOError("write internal node", newNode.PageNumber, err)
 	}
 	if err := n.WriteDisk(logSequenceNumber); err != nil {
-		log.Fatalf("Failed to write internal node to disk: %v", err)
+		throwIOError("write internal node", n.PageNumber, err)
 	}
 
 	return &DiskInsertResult{
@@ -136,34 +153,34 @@ func (n *DiskInternalNode) splitInternalNode() *DiskInsertResult {
 }
 
 // Search 在内部节点中搜索
-func (n *DiskInternalNode) Search(key uint32) (interface{}, bool) {
+func (n *DiskInternalNode) Search(key []byte) (interface{}, bool) {
 	// 找到合适的子节点
 	index := 0
-	for index < len(n.Keys) && n.Keys[index] <= key {
+	for index < len(n.Keys) && n.Compare(n.Keys[index], key) <= 0 {
 		index++
 	}
 
 	// 加载对应的子节点
 	childPageNumber := n.ChildrenPageNumbers[index]
-	child := ReadDisk(n.Order, n.DiskPager, childPageNumber, n.RedoLog)
+	child := ReadDisk(n.Order, n.DiskPager, childPageNumber, n.RedoLog, n.Compare)
 
 	return child.Search(key)
 }
 
-func (n *DiskInternalNode) SearchAll(key uint32) ([][]byte, bool) {
-	// 找到合适的子节点
+// SearchAll 从可能包含 key 的最左侧子节点开始查找，重复键可能分布在分隔键两侧
+func (n *DiskInternalNode) SearchAll(key []byte) ([][]byte, bool) {
 	index := 0
-	for index < len(n.Keys) && n.Keys[index] <= key {
+	for index < len(n.Keys) && n.Compare(n.Keys[index], key) < 0 {
 		index++
 	}
 
 	result := make([][]byte, 0, n.Order)
 	for index < len(n.ChildrenPageNumbers) {
 		childPageNumber := n.ChildrenPageNumbers[index]
-		child := ReadDisk(n.Order, n.DiskPager, childPageNumber, n.RedoLog)
+		child := ReadDisk(n.Order, n.DiskPager, childPageNumber, n.RedoLog, n.Compare)
 		all, _ := child.SearchAll(key)
 		result = append(result, all...)
-		if index < len(n.Keys) && key < n.Keys[index] {
+		if index < len(n.Keys) && n.Compare(key, n.Keys[index]) < 0 {
 			break
 		}
 		index++
@@ -172,11 +189,11 @@ func (n *DiskInternalNode) SearchAll(key uint32) ([][]byte, bool) {
 }
 
 // GetKeys 获取节点的键列表
-func (n *DiskInternalNode) GetKeys() []uint32 {
+func (n *DiskInternalNode) GetKeys() [][]byte {
 	if len(n.Keys) == 0 {
 		return nil
 	}
-	Keys := make([]uint32, len(n.Keys))
+	Keys := make([][]byte, len(n.Keys))
 	for i, key := range n.Keys {
 		Keys[i] = key
 	}
@@ -190,13 +207,12 @@ func (n *DiskInternalNode) GetPageNumber() uint32 {
 // WriteDisk 将叶子节点写入磁盘
 // internal node format:
 // isLeaf (1 byte)
+// logSequenceNumber (4 bytes)
 // keyCount (4 bytes)
-// keys (4 * keyCount bytes)
-// childrenPageNumbers size (4 bytes)
-// childrenPageNumbers (4 * keyCount bytes)
+// keys ([keyLength (1 byte) | key (keyLength bytes)] * keyCount)
+// childrenPageNumbers (4 * (keyCount + 1) bytes)
 
-// isLeaf (1 byte) | keyCount (4 bytes) | [key (4 bytes)]*keyCount |childrenPageNumbers size (4 bytes) |childrenPageNumbers (4 * keyCount bytes)
-// 1 + 4 + 12 + 4 + 40 = 61
+// isLeaf (1 byte) | logSequenceNumber (4 bytes) | keyCount (4 bytes) | [keyLength (1 byte) | key (keyLength bytes)]*keyCount | childrenPageNumbers (4 * (keyCount + 1) bytes)
 // WriteDisk 将内部节点写入磁盘
 func (node *DiskInternalNode) WriteDisk(logSequenceNumber int32) error {
 	fmt.Printf("Writing internal node to page %d\n", node.PageNumber) // 添加日志
@@ -213,14 +229,22 @@ func (node *DiskInternalNode) WriteDisk(logSequenceNumber int32) error {
 		return err
 	}
 
+	// 写入 logSequenceNumber (4 bytes)，-1 表示这次写入没有对应的日志，保留原来的序号
+	if logSequenceNumber > 0 {
+		node.LogSequenceNumber = logSequenceNumber
+	}
+	if err := binary.Write(buffer, binary.BigEndian, node.LogSequenceNumber); err != nil {
+		return err
+	}
+
 	// 写入键的数量 (uint32)
 	if err := binary.Write(buffer, binary.BigEndian, uint32(len(node.Keys))); err != nil {
 		return err
 	}
 
-	// 写入键 (uint32)
+	// 写入键
 	for _, key := range node.Keys {
-		if err := binary.Write(buffer, binary.BigEndian, key); err != nil {
+		if err := writeKey(buffer, key); err != nil {
 			return err
 		}
 	}
@@ -234,6 +258,9 @@ func (node *DiskInternalNode) WriteDisk(logSequenceNumber int32) error {
 
 	// 确保数据长度等于页面大小
 	data := buffer.Bytes()
+	if len(data) > node.DiskPager.GetPageSize() {
+		return fmt.Errorf("internal node of %d bytes does not fit in a page of %d bytes", len(data), node.DiskPager.GetPageSize())
+	}
 	if len(data) < node.DiskPager.GetPageSize() {
 		padding := make([]byte, node.DiskPager.GetPageSize()-len(data))
 		data = append(data, padding...)
@@ -242,14 +269,178 @@ func (node *DiskInternalNode) WriteDisk(logSequenceNumber int32) error {
 	return node.DiskPager.WritePage(int(node.PageNumber), data, logSequenceNumber)
 }
 
-// Delete 删除指定 key 的数据
-func (n *DiskInternalNode) Delete(key uint32) error {
+// Delete 删除指定 key 的数据，子节点下溢时向兄弟节点借键或与兄弟节点合并
+func (n *DiskInternalNode) Delete(key []byte) error {
 	// 找到应该递归的子节点
 	childIndex := 0
-	for childIndex < len(n.Keys) && key >= n.Keys[childIndex] {
+	for childIndex < len(n.Keys) && n.Compare(key, n.Keys[childIndex]) >= 0 {
 		childIndex++
 	}
 	childPage := n.ChildrenPageNumbers[childIndex]
-	child := ReadDisk(n.Order, n.DiskPager, childPage, n.RedoLog)
-	return child.Delete(key)
+	child := ReadDisk(n.Order, n.DiskPager, childPage, n.RedoLog, n.Compare)
+	if err := child.Delete(key); err != nil {
+		return err
+	}
+	if !isUnderflow(child) {
+		return nil
+	}
+	return n.rebalance(childIndex)
+}
+
+// DeleteEntry 删除与 (key, value) 完全相同的条目
+// 相同的键可能分布在多个子树中，从可能包含 key 的最左侧子节点开始依次查找
+func (n *DiskInternalNode) DeleteEntry(key []byte, value []byte) (bool, error) {
+	childIndex := 0
+	for childIndex < len(n.Keys) && n.Compare(n.Keys[childIndex], key) < 0 {
+		childIndex++
+	}
+	for ; childIndex < len(n.ChildrenPageNumbers); childIndex++ {
+		child := ReadDisk(n.Order, n.DiskPager, n.ChildrenPageNumbers[childIndex], n.RedoLog, n.Compare)
+		found, err := child.DeleteEntry(key, value)
+		if err != nil {
+			return found, err
+		}
+		if found {
+			if !isUnderflow(child) {
+				return true, nil
+			}
+			return true, n.rebalance(childIndex)
+		}
+		// 右侧的子树只包含不小于分隔键的键
+		if childIndex < len(n.Keys) && n.Compare(n.Keys[childIndex], key) > 0 {
+			break
+		}
+	}
+	return false, nil
+}
+
+// rebalance 处理下溢的子节点：优先向左、右兄弟借键，都不够时合并
+func (n *DiskInternalNode) rebalance(childIndex int) error {
+	if childIndex > 0 {
+		left := ReadDisk(n.Order, n.DiskPager, n.ChildrenPageNumbers[childIndex-1], n.RedoLog, n.Compare)
+		if canLend(left) {
+			return n.borrowFromLeft(childIndex)
+		}
+	}
+	if childIndex < len(n.ChildrenPageNumbers)-1 {
+		right := ReadDisk(n.Order, n.DiskPager, n.ChildrenPageNumbers[childIndex+1], n.RedoLog, n.Compare)
+		if canLend(right) {
+			return n.borrowFromRight(childIndex)
+		}
+	}
+	if childIndex > 0 {
+		return n.merge(childIndex - 1)
+	}
+	return n.merge(childIndex)
+}
+
+// borrowFromLeft 将左兄弟的最后一个键移动到第 childIndex 个子节点
+func (n *DiskInternalNode) borrowFromLeft(childIndex int) error {
+	left := ReadDisk(n.Order, n.DiskPager, n.ChildrenPageNumbers[childIndex-1], n.RedoLog, n.Compare)
+	child := ReadDisk(n.Order, n.DiskPager, n.ChildrenPageNumbers[childIndex], n.RedoLog, n.Compare)
+
+	logSequenceNumber, err := n.RedoLog.LogDeleteRebalance(DELETE_BORROW_LEFT, int32(n.PageNumber), int32(childIndex))
+	if err != nil {
+		return err
+	}
+
+	switch c := child.(type) {
+	case *DiskLeafNode:
+		l := left.(*DiskLeafNode)
+		last := len(l.Keys) - 1
+		c.Keys = append([][]byte{l.Keys[last]}, c.Keys...)
+		c.Values = append([][]byte{l.Values[last]}, c.Values...)
+		l.Keys = l.Keys[:last]
+		l.Values = l.Values[:last]
+		n.Keys[childIndex-1] = c.Keys[0]
+	case *DiskInternalNode:
+		// 父节点的分隔键下移，左兄弟的最后一个键上移
+		l := left.(*DiskInternalNode)
+		last := len(l.Keys) - 1
+		c.Keys = append([][]byte{n.Keys[childIndex-1]}, c.Keys...)
+		c.ChildrenPageNumbers = append([]uint32{l.ChildrenPageNumbers[last+1]}, c.ChildrenPageNumbers...)
+		n.Keys[childIndex-1] = l.Keys[last]
+		l.Keys = l.Keys[:last]
+		l.ChildrenPageNumbers = l.ChildrenPageNumbers[:last+1]
+	}
+
+	if err := left.WriteDisk(logSequenceNumber); err != nil {
+		return err
+	}
+	if err := child.WriteDisk(logSequenceNumber); err != nil {
+		return err
+	}
+	return n.WriteDisk(logSequenceNumber)
+}
+
+// borrowFromRight 将右兄弟的第一个键移动到第 childIndex 个子节点
+func (n *DiskInternalNode) borrowFromRight(childIndex int) error {
+	child := ReadDisk(n.Order, n.DiskPager, n.ChildrenPageNumbers[childIndex], n.RedoLog, n.Compare)
+	right := ReadDisk(n.Order, n.DiskPager, n.ChildrenPageNumbers[childIndex+1], n.RedoLog, n.Compare)
+
+	logSequenceNumber, err := n.RedoLog.LogDeleteRebalance(DELETE_BORROW_RIGHT, int32(n.PageNumber), int32(childIndex))
+	if err != nil {
+		return err
+	}
+
+	switch c := child.(type) {
+	case *DiskLeafNode:
+		r := right.(*DiskLeafNode)
+		c.Keys = append(c.Keys, r.Keys[0])
+		c.Values = append(c.Values, r.Values[0])
+		r.Keys = r.Keys[1:]
+		r.Values = r.Values[1:]
+		n.Keys[childIndex] = r.Keys[0]
+	case *DiskInternalNode:
+		// 父节点的分隔键下移，右兄弟的第一个键上移
+		r := right.(*DiskInternalNode)
+		c.Keys = append(c.Keys, n.Keys[childIndex])
+		c.ChildrenPageNumbers = append(c.ChildrenPageNumbers, r.ChildrenPageNumbers[0])
+		n.Keys[childIndex] = r.Keys[0]
+		r.Keys = r.Keys[1:]
+		r.ChildrenPageNumbers = r.ChildrenPageNumbers[1:]
+	}
+
+	if err := child.WriteDisk(logSequenceNumber); err != nil {
+		return err
+	}
+	if err := right.WriteDisk(logSequenceNumber); err != nil {
+		return err
+	}
+	return n.WriteDisk(logSequenceNumber)
+}
+
+// merge 将第 leftIndex+1 个子节点合并进第 leftIndex 个子节点，并回收右侧页面
+func (n *DiskInternalNode) merge(leftIndex int) error {
+	left := ReadDisk(n.Order, n.DiskPager, n.ChildrenPageNumbers[leftIndex], n.RedoLog, n.Compare)
+	right := ReadDisk(n.Order, n.DiskPager, n.ChildrenPageNumbers[leftIndex+1], n.RedoLog, n.Compare)
+
+	logSequenceNumber, err := n.RedoLog.LogDeleteRebalance(DELETE_MERGE, int32(n.PageNumber), int32(leftIndex))
+	if err != nil {
+		return err
+	}
+
+	switch l := left.(type) {
+	case *DiskLeafNode:
+		r := right.(*DiskLeafNode)
+		l.Keys = append(l.Keys, r.Keys...)
+		l.Values = append(l.Values, r.Values...)
+		l.NextPageNumber = r.NextPageNumber
+	case *DiskInternalNode:
+		// 父节点的分隔键下移到合并后的节点中
+		r := right.(*DiskInternalNode)
+		l.Keys = append(append(l.Keys, n.Keys[leftIndex]), r.Keys...)
+		l.ChildrenPageNumbers = append(l.ChildrenPageNumbers, r.ChildrenPageNumbers...)
+	}
+
+	n.Keys = append(n.Keys[:leftIndex], n.Keys[leftIndex+1:]...)
+	n.ChildrenPageNumbers = append(n.ChildrenPageNumbers[:leftIndex+1], n.ChildrenPageNumbers[leftIndex+2:]...)
+
+	if err := left.WriteDisk(logSequenceNumber); err != nil {
+		return err
+	}
+	if err := n.DiskPager.FreePage(int(right.GetPageNumber()), logSequenceNumber); err != nil {
+		return err
+	}
+	return n.WriteDisk(logSequenceNumber)
 }
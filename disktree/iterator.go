@@ -0,0 +1,258 @@
+package disktree
+
+// TreeIterator 沿叶子节点的兄弟链表按键升序遍历 [lo, hi] 区间，或者从右向左按键降序遍历
+type TreeIterator struct {
+	tree  *BPTree
+	leaf  *DiskLeafNode
+	index int
+	lo    []byte
+	hi    []byte
+	key   []byte
+	value []byte
+	err   error
+	// 降序遍历时叶子只有右侧兄弟的页码，记下从根到当前叶子的路径，沿路径回退找到左侧的叶子
+	descending bool
+	path       []pathEntry
+}
+
+// pathEntry 降序遍历路径上的一个内部节点，index 是当前所在的子节点下标
+type pathEntry struct {
+	node  *DiskInternalNode
+	index int
+}
+
+// Range 返回遍历 [lo, hi] 区间（包含两端）的迭代器，lo 为 nil 时没有下界，hi 为 nil 时没有上界
+func (t *BPTree) Range(lo, hi []byte) *TreeIterator {
+	it := &TreeIterator{
+		tree:  t,
+		index: 0,
+		lo:    lo,
+		hi:    hi,
+	}
+	func() {
+		defer recoverIOError(&it.err)
+		it.leaf = t.findLeaf(lo)
+	}()
+	return it
+}
+
+// Iterator 返回按键升序遍历整棵树的迭代器
+func (t *BPTree) Iterator() *TreeIterator {
+	return t.Range(nil, nil)
+}
+
+// ReverseRange 返回按键降序遍历 [lo, hi] 区间（包含两端）的迭代器，lo、hi 为 nil 时表示没有下界、上界
+// 重复键按插入时的位置从右向左输出，与 Range 的顺序正好相反
+func (t *BPTree) ReverseRange(lo, hi []byte) *TreeIterator {
+	it := &TreeIterator{
+		tree:       t,
+		lo:         lo,
+		hi:         hi,
+		descending: true,
+	}
+	func() {
+		defer recoverIOError(&it.err)
+		node := ReadDisk(t.order, t.DiskPager, t.rootPageNumber, t.RedoLog, t.compare)
+		// 遇到与 hi 相等的分隔键时走右侧子树，等于 hi 的键可能分布在分隔键两侧，左侧的在回退时读到
+		it.descend(node, func(n *DiskInternalNode) int {
+			if hi == nil {
+				return len(n.Keys)
+			}
+			index := 0
+			for index < len(n.Keys) && t.compare(n.Keys[index], hi) <= 0 {
+				index++
+			}
+			return index
+		})
+	}()
+	return it
+}
+
+// descend 从 node 向下走到叶子，child 选择每个内部节点中进入的子节点，经过的内部节点记入路径
+func (it *TreeIterator) descend(node DiskNode, child func(n *DiskInternalNode) int) {
+	t := it.tree
+	for {
+		switch n := node.(type) {
+		case *DiskLeafNode:
+			it.leaf = n
+			it.index = len(n.Keys) - 1
+			return
+		case *DiskInternalNode:
+			index := child(n)
+			it.path = append(it.path, pathEntry{node: n, index: index})
+			node = ReadDisk(t.order, t.DiskPager, n.ChildrenPageNumbers[index], t.RedoLog, t.compare)
+		default:
+			it.leaf = nil
+			return
+		}
+	}
+}
+
+// previousLeaf 沿路径回退到还有左侧子节点的内部节点，再走到该子节点最右侧的叶子，没有左侧的叶子时 leaf 为 nil
+func (it *TreeIterator) previousLeaf() {
+	for len(it.path) > 0 {
+		top := &it.path[len(it.path)-1]
+		if top.index == 0 {
+			it.path = it.path[:len(it.path)-1]
+			continue
+		}
+		top.index--
+		t := it.tree
+		node := ReadDisk(t.order, t.DiskPager, top.node.ChildrenPageNumbers[top.index], t.RedoLog, t.compare)
+		it.descend(node, func(n *DiskInternalNode) int {
+			return len(n.ChildrenPageNumbers) - 1
+		})
+		return
+	}
+	it.leaf = nil
+}
+
+// findLeaf 找到可能包含 key 的最左侧叶子节点
+// 遇到与 key 相等的分隔键时走左侧子树，重复键可能分布在分隔键两侧
+func (t *BPTree) findLeaf(key []byte) *DiskLeafNode {
+	node := ReadDisk(t.order, t.DiskPager, t.rootPageNumber, t.RedoLog, t.compare)
+	for {
+		switch n := node.(type) {
+		case *DiskLeafNode:
+			return n
+		case *DiskInternalNode:
+			index := 0
+			for key != nil && index < len(n.Keys) && t.compare(n.Keys[index], key) < 0 {
+				index++
+			}
+			node = ReadDisk(t.order, t.DiskPager, n.ChildrenPageNumbers[index], t.RedoLog, t.compare)
+		default:
+			return nil
+		}
+	}
+}
+
+// Next 前进到下一个键值对，超出区间、遍历结束或读取失败时返回 false
+func (it *TreeIterator) Next() (ok bool) {
+	defer func() {
+		if it.err != nil {
+			it.leaf = nil
+			ok = false
+		}
+	}()
+	defer recoverIOError(&it.err)
+	if it.descending {
+		return it.previous()
+	}
+	for it.leaf != nil {
+		for it.index < len(it.leaf.Keys) {
+			key := it.leaf.Keys[it.index]
+			value := it.leaf.Values[it.index]
+			it.index++
+			if it.lo != nil && it.tree.compare(key, it.lo) < 0 {
+				continue
+			}
+			if it.hi != nil && it.tree.compare(key, it.hi) > 0 {
+				it.leaf = nil
+				return false
+			}
+			it.key = key
+			it.value = value
+			return true
+		}
+
+		// 当前叶子遍历完，沿链表读取下一个叶子
+		if it.leaf.NextPageNumber == 0 {
+			it.leaf = nil
+			return false
+		}
+		next := ReadDisk(it.tree.order, it.tree.DiskPager, it.leaf.NextPageNumber, it.tree.RedoLog, it.tree.compare)
+		it.leaf = next.(*DiskLeafNode)
+		it.index = 0
+	}
+	return false
+}
+
+// previous 降序遍历时后退到上一个键值对
+func (it *TreeIterator) previous() bool {
+	for it.leaf != nil {
+		for it.index >= 0 {
+			key := it.leaf.Keys[it.index]
+			value := it.leaf.Values[it.index]
+			it.index--
+			if it.hi != nil && it.tree.compare(key, it.hi) > 0 {
+				continue
+			}
+			if it.lo != nil && it.tree.compare(key, it.lo) < 0 {
+				it.leaf = nil
+				return false
+			}
+			it.key = key
+			it.value = value
+			return true
+		}
+
+		// 当前叶子遍历完，回退到左侧的叶子
+		it.previousLeaf()
+	}
+	return false
+}
+
+// Key 返回当前位置的键
+func (it *TreeIterator) Key() []byte {
+	return it.key
+}
+
+// Value 返回当前位置的值
+func (it *TreeIterator) Value() []byte {
+	return it.value
+}
+
+// Err 返回遍历过程中遇到的读取错误
+func (it *TreeIterator) Err() error {
+	return it.err
+}
+
+// Count 沿叶子链表统计键的数量，只读取页面不解析值
+func (t *BPTree) Count() (count uint32, err error) {
+	defer recoverIOError(&err)
+	leaf := t.findLeaf(nil)
+	for leaf != nil {
+		count += uint32(len(leaf.Keys))
+		if leaf.NextPageNumber == 0 {
+			break
+		}
+		leaf = ReadDisk(t.order, t.DiskPager, leaf.NextPageNumber, t.RedoLog, t.compare).(*DiskLeafNode)
+	}
+	return count, nil
+}
+
+// MinKey 返回树中最小的键，树为空时 found 为 false
+func (t *BPTree) MinKey() (key []byte, found bool, err error) {
+	defer recoverIOError(&err)
+	leaf := t.findLeaf(nil)
+	for leaf != nil {
+		if len(leaf.Keys) > 0 {
+			return leaf.Keys[0], true, nil
+		}
+		if leaf.NextPageNumber == 0 {
+			break
+		}
+		leaf = ReadDisk(t.order, t.DiskPager, leaf.NextPageNumber, t.RedoLog, t.compare).(*DiskLeafNode)
+	}
+	return nil, false, nil
+}
+
+// MaxKey 沿最右侧的子树找到最大的键，树为空时 found 为 false
+func (t *BPTree) MaxKey() (key []byte, found bool, err error) {
+	defer recoverIOError(&err)
+	node := ReadDisk(t.order, t.DiskPager, t.rootPageNumber, t.RedoLog, t.compare)
+	for {
+		switch n := node.(type) {
+		case *DiskLeafNode:
+			if len(n.Keys) == 0 {
+				return nil, false, nil
+			}
+			return n.Keys[len(n.Keys)-1], true, nil
+		case *DiskInternalNode:
+			node = ReadDisk(t.order, t.DiskPager, n.ChildrenPageNumbers[len(n.ChildrenPageNumbers)-1], t.RedoLog, t.compare)
+		default:
+			return nil, false, nil
+		}
+	}
+}
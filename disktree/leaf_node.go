@@ -3,8 +3,8 @@ package disktree
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"godb/logger"
-	"log"
 )
 
 // LeafNode 叶子节点
@@ -13,47 +13,80 @@ type DiskLeafNode struct {
 	PageNumber  uint32
 	DiskPager   *DiskPager
 	RedoLog     *RedoLog
-	Keys        []uint32
+	Keys        [][]byte
 	Values      [][]byte
 	ValueLength uint32
+	// 右侧兄弟叶子的页码，0 表示最后一个叶子（第 0 页是元数据页）
+	NextPageNumber uint32
+	// 最后一次修改本页的日志序号，重做日志时跳过已经写入本页的修改
+	LogSequenceNumber int32
+	// 键的比较函数
+	Compare Comparator
 }
 
 // NewLeafNode 创建新的叶子节点
-func NewLeafNode(order uint32, valueLength uint32, pager *DiskPager, pageNum uint32, redolog *RedoLog) *DiskLeafNode {
+func NewLeafNode(order uint32, valueLength uint32, pager *DiskPager, pageNum uint32, redolog *RedoLog, compare Comparator) *DiskLeafNode {
 	return &DiskLeafNode{
-		Keys:        make([]uint32, 0, order),
+		Keys:        make([][]byte, 0, order),
 		Values:      make([][]byte, 0, order),
 		ValueLength: valueLength,
 		Order:       order,
 		PageNumber:  pageNum,
 		DiskPager:   pager,
 		RedoLog:     redolog,
+		Compare:     compare,
 	}
 }
 
 // Insert 实现叶子节点的插入
-func (n *DiskLeafNode) Insert(key uint32, value []byte) *DiskInsertResult {
+func (n *DiskLeafNode) Insert(key []byte, value []byte) *DiskInsertResult {
 	insertIndex := 0
-	for insertIndex < len(n.Keys) && n.Keys[insertIndex] < key {
+	for insertIndex < len(n.Keys) && n.Compare(n.Keys[insertIndex], key) < 0 {
 		insertIndex++
 	}
 
 	// 如果键已存在，更新值
-	if insertIndex < len(n.Keys) && n.Keys[insertIndex] == key {
+	if insertIndex < len(n.Keys) && n.Compare(n.Keys[insertIndex], key) == 0 {
 		n.Values[insertIndex] = value
 		// 写入更新后的值到磁盘
-		logSequenceNumber, err := n.RedoLog.LogInsertLeafNormal(int32(n.PageNumber), int32(key), value)
+		logSequenceNumber, err := n.RedoLog.LogInsertLeafNormal(int32(n.PageNumber), key, value)
 		if err != nil {
 			logger.Error("failed to insert leaf node log")
 		}
 		if err := n.WriteDisk(logSequenceNumber); err != nil {
-			log.Fatalf("Failed to write leaf node: %v", err)
+			throwIOError("write leaf node", n.PageNumber, err)
 		}
 		return nil
 	}
 
-	// 插入新条目
-	n.Keys = append(n.Keys, 0)
+	logSequenceNumber, err := n.RedoLog.LogInsertLeafNormal(int32(n.PageNumber), key, value)
+	if err != nil {
+		logger.Error("failed to insert leaf node log")
+	}
+	return n.insertAt(insertIndex, key, value, logSequenceNumber)
+}
+
+// InsertEntry 插入 (key, value) 条目，键相同的条目按值排序全部保留，条目已存在时不做任何事
+func (n *DiskLeafNode) InsertEntry(key []byte, value []byte) *DiskInsertResult {
+	value = padValue(value, n.ValueLength)
+	insertIndex := 0
+	for insertIndex < len(n.Keys) && n.compareEntry(n.Keys[insertIndex], n.Values[insertIndex], key, value) < 0 {
+		insertIndex++
+	}
+	if insertIndex < len(n.Keys) && n.compareEntry(n.Keys[insertIndex], n.Values[insertIndex], key, value) == 0 {
+		return nil
+	}
+
+	logSequenceNumber, err := n.RedoLog.LogInsertLeafEntry(int32(n.PageNumber), key, value)
+	if err != nil {
+		logger.Error("failed to insert leaf entry log")
+	}
+	return n.insertAt(insertIndex, key, value, logSequenceNumber)
+}
+
+// insertAt 在 insertIndex 处插入新条目并写回磁盘，超过 order 个键时分裂
+func (n *DiskLeafNode) insertAt(insertIndex int, key []byte, value []byte, logSequenceNumber int32) *DiskInsertResult {
+	n.Keys = append(n.Keys, nil)
 	copy(n.Keys[insertIndex+1:], n.Keys[insertIndex:])
 	n.Keys[insertIndex] = key
 
@@ -61,22 +94,34 @@ func (n *DiskLeafNode) Insert(key uint32, value []byte) *DiskInsertResult {
 	copy(n.Values[insertIndex+1:], n.Values[insertIndex:])
 	n.Values[insertIndex] = value
 	logger.Debug("values : %x \n", n.Values)
-	logger.Debug("values : %x \n", n.Values)
 
-	logSequenceNumber, err := n.RedoLog.LogInsertLeafNormal(int32(n.PageNumber), int32(key), value)
-	if err != nil {
-		logger.Error("failed to insert leaf node log")
+	// 如果节点需要分裂，由分裂写回两个节点，超过 order 个键的节点不落盘
+	if uint32(len(n.Keys)) > n.Order {
+		return n.split()
 	}
+
 	if err := n.WriteDisk(logSequenceNumber); err != nil {
-		log.Fatalf("Failed to write leaf node: %v", err)
+		throwIOError("write leaf node", n.PageNumber, err)
 	}
+	return nil
+}
 
-	// 如果节点需要分裂
-	if uint32(len(n.Keys)) > n.Order {
-		return n.split()
+// padValue 把值用 0 补齐到固定长度，与写入磁盘后再读出的值一致，便于按值比较
+func padValue(value []byte, length uint32) []byte {
+	if uint32(len(value)) >= length {
+		return value
 	}
+	padded := make([]byte, length)
+	copy(padded, value)
+	return padded
+}
 
-	return nil
+// compareEntry 先按键、键相同时再按值的字节序比较两个条目
+func (n *DiskLeafNode) compareEntry(key1 []byte, value1 []byte, key2 []byte, value2 []byte) int {
+	if c := n.Compare(key1, key2); c != 0 {
+		return c
+	}
+	return bytes.Compare(value1, value2)
 }
 
 // split 分裂叶子节点
@@ -85,33 +130,34 @@ func (n *DiskLeafNode) split() *DiskInsertResult {
 
 	// 创建新的右侧节点
 	newNodePage, err := n.DiskPager.AllocateNewPage()
-	_, _ = n.DiskPager.AllocateNewPage()
 	logger.Debug("newNodePage: %v", newNodePage)
 
 	if err != nil {
-		log.Fatal("Failed to allocate new page")
+		throwIOError("allocate leaf page", n.PageNumber, err)
 	}
 	logger.Debug("when split the valueLength is %d", n.ValueLength)
-	newNode := NewLeafNode(n.Order, n.ValueLength, n.DiskPager, uint32(newNodePage), n.RedoLog)
+	newNode := NewLeafNode(n.Order, n.ValueLength, n.DiskPager, uint32(newNodePage), n.RedoLog, n.Compare)
 	newNode.Keys = append(newNode.Keys, n.Keys[midIndex:]...)
 	newNode.Values = append(newNode.Values, n.Values[midIndex:]...)
+	newNode.NextPageNumber = n.NextPageNumber
 
-	if err := newNode.WriteDisk(-1); err != nil {
-		//log.Fatalf("Failed to write new node: %v", err)
-		logger.Error("Failed to write new node %v", err)
+	// 新节点也记为分裂的日志序号，复用的回收页面不会再重放之前的修改
+	logSequenceNumber, err := n.RedoLog.LogInsertLeafSplit(int32(n.PageNumber))
+	if err != nil {
+		throwIOError("write redo log", n.PageNumber, err)
+	}
+	if err := newNode.WriteDisk(logSequenceNumber); err != nil {
+		throwIOError("write leaf node", newNode.PageNumber, err)
 	}
 
 	// 维护叶子节点链表
 	n.Keys = n.Keys[:midIndex]
 	n.Values = n.Values[:midIndex]
+	n.NextPageNumber = newNode.PageNumber
 	//logger.Debug("values :", n.Values)
 
-	logSequenceNumber, err := n.RedoLog.LogInsertLeafSplit(int32(n.PageNumber))
-	if err != nil {
-		log.Fatal("Failed to insert leaf node log")
-	}
 	if err := n.WriteDisk(logSequenceNumber); err != nil {
-		log.Fatalf("Failed to write node: %v", err)
+		throwIOError("write leaf node", n.PageNumber, err)
 	}
 	logger.Debug("return key is %v", newNode.Keys[0])
 
@@ -122,16 +168,16 @@ func (n *DiskLeafNode) split() *DiskInsertResult {
 }
 
 // Search 在叶子节点中搜索
-func (n *DiskLeafNode) Search(key uint32) (interface{}, bool) {
+func (n *DiskLeafNode) Search(key []byte) (interface{}, bool) {
 	// 使用二分查找提高搜索效率
 	left, right := 0, len(n.Keys)-1
 	for left <= right {
 		mid := left + (right-left)/2
-		if n.Keys[mid] == key {
-			logger.Debug("key is %v", n.Keys[mid])
+		if c := n.Compare(n.Keys[mid], key); c == 0 {
+			logger.Debug("key is %x", n.Keys[mid])
 			logger.Debug("value is %v", n.Values[mid])
 			return n.Values[mid], true // 返回对应的值
-		} else if n.Keys[mid] < key {
+		} else if c < 0 {
 			left = mid + 1
 		} else {
 			right = mid - 1
@@ -140,13 +186,13 @@ func (n *DiskLeafNode) Search(key uint32) (interface{}, bool) {
 	return nil, false // 未找到时返回
 }
 
-func (n *DiskLeafNode) SearchAll(key uint32) ([][]byte, bool) {
+func (n *DiskLeafNode) SearchAll(key []byte) ([][]byte, bool) {
 	result := make([][]byte, 0)
 
 	for i := 0; i < len(n.Keys); i++ {
-		if key == n.Keys[i] {
+		if c := n.Compare(key, n.Keys[i]); c == 0 {
 			result = append(result, n.Values[i])
-		} else if key < n.Keys[i] {
+		} else if c < 0 {
 			// 由于keys是有序的，当找到更大的key时可以停止搜索
 			break
 		}
@@ -155,8 +201,8 @@ func (n *DiskLeafNode) SearchAll(key uint32) ([][]byte, bool) {
 }
 
 // GetKeys 获取节点的键列表
-func (n *DiskLeafNode) GetKeys() []uint32 {
-	keys := make([]uint32, len(n.Keys))
+func (n *DiskLeafNode) GetKeys() [][]byte {
+	keys := make([][]byte, len(n.Keys))
 	for i, key := range n.Keys {
 		keys[i] = key
 	}
@@ -164,8 +210,7 @@ func (n *DiskLeafNode) GetKeys() []uint32 {
 }
 
 // WriteDisk 将叶子节点写入磁盘
-// isLeaf (1 byte) | keyCount (4 bytes) | [key (4 bytes)]*keyCount | valueLength (4 bytes) | valueData (valueLength bytes)] * keyCount | nextPageNumber (4 bytes)
-// 1 + 4 + 16 + 4 + 40 + 4 = 69
+// isLeaf (1 byte) | logSequenceNumber (4 bytes) | keyCount (4 bytes) | [keyLength (1 byte) | key (keyLength bytes)]*keyCount | valueLength (4 bytes) | valueData (valueLength bytes)] * keyCount | nextPageNumber (4 bytes)
 func (n *DiskLeafNode) WriteDisk(logSequenceNumber int32) error {
 	//fmt.Printf("Writing leaf node to page %d\n", n.PageNumber)
 	//fmt.Printf("Keys: %v\n", n.Keys)
@@ -177,22 +222,28 @@ func (n *DiskLeafNode) WriteDisk(logSequenceNumber int32) error {
 
 	// 写入 isLeaf 标志 (1 byte)
 	if err := buffer.WriteByte(1); err != nil {
-		log.Fatalf("Failed to write isLeaf flag: %v", err)
+		return err
+	}
+
+	// 写入 logSequenceNumber (4 bytes)，-1 表示这次写入没有对应的日志，保留原来的序号
+	if logSequenceNumber > 0 {
+		n.LogSequenceNumber = logSequenceNumber
+	}
+	if err := binary.Write(buffer, binary.BigEndian, n.LogSequenceNumber); err != nil {
+		return err
 	}
 
 	// 写入 keyCount (4 bytes)
 	keyCount := uint32(len(n.Keys))
 	//logger.Debug("keyCount:", keyCount)
 	if err := binary.Write(buffer, binary.BigEndian, keyCount); err != nil {
-		//log.Fatalf("Failed to write keyCount: %v", err)
-		logger.Error("Failed to write keyCount %v", err)
+		return err
 	}
 
 	// 写入键 (key)
 	for _, key := range n.Keys {
-		// 写入 key (4 bytes)
-		if err := binary.Write(buffer, binary.BigEndian, key); err != nil {
-			log.Fatalf("Failed to write key: %v", err)
+		if err := writeKey(buffer, key); err != nil {
+			return err
 		}
 	}
 	//logger.Debug("valueLength: ", n.ValueLength)
@@ -200,8 +251,7 @@ func (n *DiskLeafNode) WriteDisk(logSequenceNumber int32) error {
 	// 写入 valueLength (4 bytes)
 	valueLength := n.ValueLength
 	if err := binary.Write(buffer, binary.BigEndian, valueLength); err != nil {
-		//log.Fatalf("Failed to write ValueLength: %v", err)
-		logger.Error("Failed to write ValueLength: %v", err)
+		return err
 	}
 
 	// 写入值 (value)
@@ -210,32 +260,39 @@ func (n *DiskLeafNode) WriteDisk(logSequenceNumber int32) error {
 	for _, value := range n.Values {
 		logger.Debug("value: %v", string(value))
 		if n.ValueLength < uint32(len(value)) {
-			log.Fatalf("value length larger than fixed length: valueLength: %d value: %d", n.ValueLength, len(value))
+			return fmt.Errorf("value length larger than fixed length: valueLength: %d value: %d", n.ValueLength, len(value))
 		} else if n.ValueLength >= uint32(len(value)) {
 			// 将值写入缓冲区
 			if _, err := buffer.Write(value); err != nil {
-				log.Fatalf("Failed to write value: %v", err)
+				return err
 			}
 			// 用 0 填充剩余部分以使页面大小固定
 			paddingLength := n.ValueLength - uint32(len(value))
 			padding := make([]byte, paddingLength) // 创建填充字节切片
 			if _, err := buffer.Write(padding); err != nil {
-				log.Fatalf("Failed to write padding: %v", err)
+				return err
 			}
 		}
 	}
 
+	// 写入 nextPageNumber (4 bytes)
+	if err := binary.Write(buffer, binary.BigEndian, n.NextPageNumber); err != nil {
+		return err
+	}
+
 	// 将缓冲区内容写入磁盘
 	logger.Debug("buffer: %v \n", buffer.Bytes())
 	//logger.Debug("buffer:", string(buffer.Bytes()))
 	logger.Debug("buffer: %x \n", buffer.Bytes())
 	data := buffer.Bytes()
+	if len(data) > n.DiskPager.GetPageSize() {
+		return fmt.Errorf("leaf node of %d bytes does not fit in a page of %d bytes", len(data), n.DiskPager.GetPageSize())
+	}
 	if len(data) < n.DiskPager.GetPageSize() {
 		padding := make([]byte, n.DiskPager.GetPageSize()-len(data))
 		data = append(data, padding...)
 	}
-	n.DiskPager.WritePage(int(n.PageNumber), data, logSequenceNumber)
-	return nil
+	return n.DiskPager.WritePage(int(n.PageNumber), data, logSequenceNumber)
 }
 
 func (n *DiskLeafNode) GetPageNumber() uint32 {
@@ -243,13 +300,13 @@ func (n *DiskLeafNode) GetPageNumber() uint32 {
 }
 
 // Delete 删除指定 key 的数据
-func (n *DiskLeafNode) Delete(key uint32) error {
+func (n *DiskLeafNode) Delete(key []byte) error {
 	for i, k := range n.Keys {
-		if k == key {
+		if n.Compare(k, key) == 0 {
 			// 删除 key 和 value
 			n.Keys = append(n.Keys[:i], n.Keys[i+1:]...)
 			n.Values = append(n.Values[:i], n.Values[i+1:]...)
-			logSequenceNumber, err := n.RedoLog.LogInsertLeafNormal(int32(n.PageNumber), int32(key), nil)
+			logSequenceNumber, err := n.RedoLog.LogDeleteLeafNormal(int32(n.PageNumber), key)
 			if err != nil {
 				return err
 			}
@@ -261,3 +318,21 @@ func (n *DiskLeafNode) Delete(key uint32) error {
 	}
 	return nil // 没找到也算成功
 }
+
+// DeleteEntry 删除与 (key, value) 完全相同的条目，返回是否找到
+func (n *DiskLeafNode) DeleteEntry(key []byte, value []byte) (bool, error) {
+	value = padValue(value, n.ValueLength)
+	for i := range n.Keys {
+		if n.compareEntry(n.Keys[i], n.Values[i], key, value) != 0 {
+			continue
+		}
+		n.Keys = append(n.Keys[:i], n.Keys[i+1:]...)
+		n.Values = append(n.Values[:i], n.Values[i+1:]...)
+		logSequenceNumber, err := n.RedoLog.LogDeleteLeafEntry(int32(n.PageNumber), key, value)
+		if err != nil {
+			return true, err
+		}
+		return true, n.WriteDisk(logSequenceNumber)
+	}
+	return false, nil
+}
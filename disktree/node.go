@@ -1,17 +1,92 @@
 package disktree
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Comparator 比较两个键，a 小于、等于、大于 b 时分别返回负数、0、正数
+type Comparator func(a, b []byte) int
+
 // Node 接口定义所有节点必须实现的方法
+// 键是变长的字节串，节点用树的 Comparator 比较键，默认按字节序比较（bytes.Compare），
+// 此时调用方负责把键编码成保持顺序的字节串（例如大端序的整数）
 type DiskNode interface {
-	Insert(key uint32, value []byte) *DiskInsertResult
-	Search(key uint32) (interface{}, bool)
-	SearchAll(key uint32) ([][]byte, bool)
-	GetKeys() []uint32
+	Insert(key []byte, value []byte) *DiskInsertResult
+	Search(key []byte) (interface{}, bool)
+	SearchAll(key []byte) ([][]byte, bool)
+	GetKeys() [][]byte
 	GetPageNumber() uint32
 	WriteDisk(logSequenceNumber int32) error
-	Delete(key uint32) error
+	Delete(key []byte) error
+	// InsertEntry 和 DeleteEntry 用于允许重复键的树，条目由 (key, value) 共同确定
+	InsertEntry(key []byte, value []byte) *DiskInsertResult
+	DeleteEntry(key []byte, value []byte) (bool, error)
 }
 
 type DiskInsertResult struct {
-	Key      uint32
+	Key      []byte
 	DiskNode DiskNode
 }
+
+// minKeys 返回节点在不下溢的情况下至少需要的键数量
+// 叶子节点最多 order 个键，分裂后左半部分为 order/2 个
+// 内部节点最多 order-1 个键，分裂后左半部分为 (order-1)/2 个
+func minKeys(node DiskNode) int {
+	switch n := node.(type) {
+	case *DiskLeafNode:
+		return int(n.Order / 2)
+	case *DiskInternalNode:
+		return int((n.Order - 1) / 2)
+	default:
+		return 0
+	}
+}
+
+// isUnderflow 判断节点删除后是否需要借键或合并
+func isUnderflow(node DiskNode) bool {
+	return len(node.GetKeys()) < minKeys(node)
+}
+
+// canLend 判断兄弟节点是否有多余的键可以借出
+func canLend(node DiskNode) bool {
+	return len(node.GetKeys()) > minKeys(node)
+}
+
+// MAX_KEY_LENGTH 键的最大字节数，页面中键的长度只占一个字节
+const MAX_KEY_LENGTH = math.MaxUint8
+
+// writeKey 写入一个变长的键：keyLength (1 byte) | key (keyLength bytes)
+func writeKey(buffer *bytes.Buffer, key []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := buffer.WriteByte(byte(len(key))); err != nil {
+		return err
+	}
+	_, err := buffer.Write(key)
+	return err
+}
+
+// readKey 读取 writeKey 写入的键
+func readKey(reader io.Reader) ([]byte, error) {
+	var keyLength [1]byte
+	if _, err := io.ReadFull(reader, keyLength[:]); err != nil {
+		return nil, err
+	}
+	key := make([]byte, keyLength[0])
+	if _, err := io.ReadFull(reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// checkKey 在修改树之前检查键的长度，避免写到一半的节点无法写入页面
+func checkKey(key []byte) error {
+	if len(key) > MAX_KEY_LENGTH {
+		return fmt.Errorf("key of %d bytes is longer than %d bytes", len(key), MAX_KEY_LENGTH)
+	}
+	return nil
+}
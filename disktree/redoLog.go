@@ -22,7 +22,9 @@ type RedoLog struct {
 	logSequenceNumber         int32
 	executedLogSequenceMumber int32
 	recovering                bool
-	IsClosed                  bool
+	// 重做日志时正在重放的日志序号，重放产生的页面写入都记为这个序号
+	replayLogSequenceNumber int32
+	IsClosed                bool
 }
 
 const (
@@ -33,6 +35,13 @@ const (
 	INSERT_INTERNAL_SPLIT        int32 = 3
 	INSERT_LEAF_NORMAL           int32 = 4
 	INSERT_INTERNAL_NORMAL       int32 = 5
+	DELETE_LEAF_NORMAL           int32 = 6
+	DELETE_BORROW_LEFT           int32 = 7
+	DELETE_BORROW_RIGHT          int32 = 8
+	DELETE_MERGE                 int32 = 9
+	DELETE_ROOT_SHRINK           int32 = 10
+	INSERT_LEAF_ENTRY            int32 = 11
+	DELETE_LEAF_ENTRY            int32 = 12
 	LOG_SEQUENCE_NUMBER          int32 = 1
 	EXECUTED_LOG_SEQUENCE_NUMBER int32 = 0
 	LOG_METADATA_SIZE            int32 = 4
@@ -118,19 +127,20 @@ func (l *RedoLog) logHeader(buffer *bytes.Buffer, capacity int32) (int32, error)
  * logSequenceNumber (4 bytes)
  * nextPosition (4 bytes)
  * operation (4 bytes)
- * key (4 bytes)
+ * keyLength (4 bytes)
+ * key (keyLength bytes)
  * childPageNumber1 (4 bytes)
  * childPageNumber2 (4 bytes)
  */
-func (l *RedoLog) LogInsertRootNew(key int32, childPageNum1 int32, childPageNum2 int32) (int32, error) {
-	capacity := 4 * 6
+func (l *RedoLog) LogInsertRootNew(key []byte, childPageNum1 int32, childPageNum2 int32) (int32, error) {
+	capacity := 4*6 + len(key)
 	buffer := bytes.NewBuffer(make([]byte, 0, capacity))
 	nextPosition, err := l.logHeader(buffer, int32(capacity))
 	if err != nil {
 		return 0, err
 	}
 	binary.Write(buffer, binary.LittleEndian, INSERT_ROOT_NEW)
-	binary.Write(buffer, binary.LittleEndian, key)
+	writeLogBytes(buffer, key)
 	binary.Write(buffer, binary.LittleEndian, childPageNum1)
 	binary.Write(buffer, binary.LittleEndian, childPageNum2)
 	entry, err := l.writeLogEntry(buffer, int32(nextPosition))
@@ -141,14 +151,12 @@ func (l *RedoLog) LogInsertRootNew(key int32, childPageNum1 int32, childPageNum2
 }
 
 func (l *RedoLog) RecoverInsertRootNew(tree *BPTree) {
-	buffer := make([]byte, 4*3)
-	l.logFile.Read(buffer)
-	var key uint32
-	var childPageNum1 uint32
-	var childPageNum2 uint32
-	binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &key)
-	binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &childPageNum1)
-	binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &childPageNum2)
+	key := l.readLogBytes()
+	childPageNum1, childPageNum2 := l.readOperands()
+	// 根节点已经不是分裂前的节点，或者分裂前的根节点之后又被修改过，说明新的根已经写入
+	if tree.rootPageNumber != childPageNum1 || l.applied(tree.DiskPager, childPageNum1) {
+		return
+	}
 	tree.InsertRootNew(key, childPageNum1, childPageNum2)
 }
 
@@ -158,12 +166,13 @@ func (l *RedoLog) RecoverInsertRootNew(tree *BPTree) {
  * nextPosition (4 bytes)
  * operation (4 bytes)
  * pageNumber (4 bytes)
- * newKey (4 bytes)
+ * newKeyLength (4 bytes)
+ * newKey (newKeyLength bytes)
  * newValueLength (4 bytes)
  * newValue (variable length)
  */
-func (l *RedoLog) LogInsertLeafNormal(pageNumber int32, newKey int32, newValue []byte) (int32, error) {
-	capacity := 4*6 + len(newValue)
+func (l *RedoLog) LogInsertLeafNormal(pageNumber int32, newKey []byte, newValue []byte) (int32, error) {
+	capacity := 4*6 + len(newKey) + len(newValue)
 	buffer := bytes.NewBuffer(make([]byte, 0, capacity))
 	nextPosition, err := l.logHeader(buffer, int32(capacity))
 	if err != nil {
@@ -171,9 +180,8 @@ func (l *RedoLog) LogInsertLeafNormal(pageNumber int32, newKey int32, newValue [
 	}
 	binary.Write(buffer, binary.LittleEndian, INSERT_LEAF_NORMAL)
 	binary.Write(buffer, binary.LittleEndian, pageNumber)
-	binary.Write(buffer, binary.LittleEndian, newKey)
-	binary.Write(buffer, binary.LittleEndian, len(newValue))
-	binary.Write(buffer, binary.LittleEndian, newValue)
+	writeLogBytes(buffer, newKey)
+	writeLogBytes(buffer, newValue)
 	entry, err := l.writeLogEntry(buffer, int32(nextPosition))
 	if err != nil {
 		return 0, err
@@ -181,18 +189,15 @@ func (l *RedoLog) LogInsertLeafNormal(pageNumber int32, newKey int32, newValue [
 	return entry, nil
 }
 
-func (l *RedoLog) RecoverLogInsertLeafNormal(order uint32, pager *DiskPager) {
-	buffer := make([]byte, 4*3)
-	l.logFile.Read(buffer)
+func (l *RedoLog) RecoverLogInsertLeafNormal(order uint32, pager *DiskPager, compare Comparator) {
 	var pageNumber uint32
-	var newKey uint32
-	var newValueLen uint32
-	var newValue []byte
-	binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &pageNumber)
-	binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &newKey)
-	binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &newValueLen)
-	binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &newValue)
-	disk := ReadDisk(order, pager, pageNumber, l).(*DiskLeafNode)
+	binary.Read(l.logFile, binary.LittleEndian, &pageNumber)
+	newKey := l.readLogBytes()
+	newValue := l.readLogBytes()
+	if l.applied(pager, pageNumber) {
+		return
+	}
+	disk := ReadDisk(order, pager, pageNumber, l, compare).(*DiskLeafNode)
 	disk.Insert(newKey, newValue)
 }
 
@@ -202,11 +207,12 @@ func (l *RedoLog) RecoverLogInsertLeafNormal(order uint32, pager *DiskPager) {
  * nextPosition (4 bytes)
  * operation (4 bytes)
  * pageNumber (4 bytes)
- * newKey (4 bytes)
+ * newKeyLength (4 bytes)
+ * newKey (newKeyLength bytes)
  * newChildPageNumber (4 bytes)
  */
-func (l *RedoLog) LogInsertInternalNormal(pageNumber int32, newKey int32, newChildPageNumber int) (int32, error) {
-	capacity := 4 * 6
+func (l *RedoLog) LogInsertInternalNormal(pageNumber int32, newKey []byte, newChildPageNumber int) (int32, error) {
+	capacity := 4*6 + len(newKey)
 	buffer := bytes.NewBuffer(make([]byte, 0, capacity))
 	nextPosition, err := l.logHeader(buffer, int32(capacity))
 	if err != nil {
@@ -214,8 +220,8 @@ func (l *RedoLog) LogInsertInternalNormal(pageNumber int32, newKey int32, newChi
 	}
 	binary.Write(buffer, binary.LittleEndian, INSERT_INTERNAL_NORMAL)
 	binary.Write(buffer, binary.LittleEndian, pageNumber)
-	binary.Write(buffer, binary.LittleEndian, newKey)
-	binary.Write(buffer, binary.LittleEndian, newChildPageNumber)
+	writeLogBytes(buffer, newKey)
+	binary.Write(buffer, binary.LittleEndian, int32(newChildPageNumber))
 	entry, err := l.writeLogEntry(buffer, int32(nextPosition))
 	if err != nil {
 		return 0, err
@@ -223,16 +229,15 @@ func (l *RedoLog) LogInsertInternalNormal(pageNumber int32, newKey int32, newChi
 	return entry, nil
 }
 
-func (l *RedoLog) RecoverLogInsertInternalNormal(order uint32, pager *DiskPager) {
-	buffer := make([]byte, 4*3)
-	l.logFile.Read(buffer)
-	var pageNumber uint32
-	var newKey uint32
-	var newChildPageNumber uint32
-	binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &pageNumber)
-	binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &newKey)
-	binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &newChildPageNumber)
-	disk := ReadDisk(order, pager, pageNumber, l).(*DiskInternalNode)
+func (l *RedoLog) RecoverLogInsertInternalNormal(order uint32, pager *DiskPager, compare Comparator) {
+	var pageNumber, newChildPageNumber uint32
+	binary.Read(l.logFile, binary.LittleEndian, &pageNumber)
+	newKey := l.readLogBytes()
+	binary.Read(l.logFile, binary.LittleEndian, &newChildPageNumber)
+	if l.applied(pager, pageNumber) {
+		return
+	}
+	disk := ReadDisk(order, pager, pageNumber, l, compare).(*DiskInternalNode)
 	disk.insertIntoNode(newKey, newChildPageNumber)
 }
 
@@ -259,12 +264,17 @@ func (l *RedoLog) LogInsertLeafSplit(pageNumber int32) (int32, error) {
 	return entry, nil
 }
 
-func (l *RedoLog) RecoverLogInsertLeafSplit(order uint32, pager *DiskPager) {
-	buffer := make([]byte, 4*3)
-	l.logFile.Read(buffer)
+func (l *RedoLog) RecoverLogInsertLeafSplit(order uint32, pager *DiskPager, compare Comparator) {
 	var pageNumber uint32
-	binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &pageNumber)
-	disk := ReadDisk(order, pager, pageNumber, l).(*DiskLeafNode)
+	binary.Read(l.logFile, binary.LittleEndian, &pageNumber)
+	if l.applied(pager, pageNumber) {
+		return
+	}
+	disk := ReadDisk(order, pager, pageNumber, l, compare).(*DiskLeafNode)
+	// 重放插入时节点已经随插入一起分裂，不再超过 order 个键
+	if uint32(len(disk.Keys)) <= disk.Order {
+		return
+	}
 	disk.split()
 }
 
@@ -291,16 +301,212 @@ func (l *RedoLog) LogInsertInternalSplit(pageNumber int32) (int32, error) {
 	return entry, nil
 }
 
-func (l *RedoLog) RecoverLogInsertInternalSplit(order uint32, pager *DiskPager) {
-	buffer := make([]byte, 4*3)
-	l.logFile.Read(buffer)
+func (l *RedoLog) RecoverLogInsertInternalSplit(order uint32, pager *DiskPager, compare Comparator) {
 	var pageNumber uint32
-	binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &pageNumber)
-	disk := ReadDisk(order, pager, pageNumber, l).(*DiskInternalNode)
+	binary.Read(l.logFile, binary.LittleEndian, &pageNumber)
+	if l.applied(pager, pageNumber) {
+		return
+	}
+	disk := ReadDisk(order, pager, pageNumber, l, compare).(*DiskInternalNode)
+	if uint32(len(disk.Keys)) <= disk.Order-1 {
+		return
+	}
 	disk.splitInternalNode()
 }
 
+/*
+ * DELETE_LEAF_NORMAL log format:
+ * logSequenceNumber (4 bytes)
+ * nextPosition (4 bytes)
+ * operation (4 bytes)
+ * pageNumber (4 bytes)
+ * keyLength (4 bytes)
+ * key (keyLength bytes)
+ */
+func (l *RedoLog) LogDeleteLeafNormal(pageNumber int32, key []byte) (int32, error) {
+	capacity := 4*5 + len(key)
+	buffer := bytes.NewBuffer(make([]byte, 0, capacity))
+	nextPosition, err := l.logHeader(buffer, int32(capacity))
+	if err != nil {
+		return 0, err
+	}
+	binary.Write(buffer, binary.LittleEndian, DELETE_LEAF_NORMAL)
+	binary.Write(buffer, binary.LittleEndian, pageNumber)
+	writeLogBytes(buffer, key)
+	return l.writeLogEntry(buffer, nextPosition)
+}
+
+func (l *RedoLog) RecoverLogDeleteLeafNormal(order uint32, pager *DiskPager, compare Comparator) {
+	var pageNumber uint32
+	binary.Read(l.logFile, binary.LittleEndian, &pageNumber)
+	key := l.readLogBytes()
+	if l.applied(pager, pageNumber) {
+		return
+	}
+	disk := ReadDisk(order, pager, pageNumber, l, compare).(*DiskLeafNode)
+	disk.Delete(key)
+}
+
+/*
+ * DELETE_BORROW_LEFT / DELETE_BORROW_RIGHT / DELETE_MERGE log format:
+ * logSequenceNumber (4 bytes)
+ * nextPosition (4 bytes)
+ * operation (4 bytes)
+ * parentPageNumber (4 bytes)
+ * childIndex (4 bytes)
+ */
+func (l *RedoLog) LogDeleteRebalance(operation int32, parentPageNumber int32, childIndex int32) (int32, error) {
+	capacity := 4 * 5
+	buffer := bytes.NewBuffer(make([]byte, 0, capacity))
+	nextPosition, err := l.logHeader(buffer, int32(capacity))
+	if err != nil {
+		return 0, err
+	}
+	binary.Write(buffer, binary.LittleEndian, operation)
+	binary.Write(buffer, binary.LittleEndian, parentPageNumber)
+	binary.Write(buffer, binary.LittleEndian, childIndex)
+	return l.writeLogEntry(buffer, nextPosition)
+}
+
+func (l *RedoLog) RecoverLogDeleteRebalance(operation int32, order uint32, pager *DiskPager, compare Comparator) {
+	parentPageNumber, childIndex := l.readOperands()
+	// 借键与合并同时改写父节点，父节点的序号不小于本条日志时这一步已经完成
+	if l.applied(pager, parentPageNumber) {
+		return
+	}
+	parent := ReadDisk(order, pager, parentPageNumber, l, compare).(*DiskInternalNode)
+	switch operation {
+	case DELETE_BORROW_LEFT:
+		parent.borrowFromLeft(int(childIndex))
+	case DELETE_BORROW_RIGHT:
+		parent.borrowFromRight(int(childIndex))
+	case DELETE_MERGE:
+		parent.merge(int(childIndex))
+	}
+}
+
+/*
+ * DELETE_ROOT_SHRINK log format:
+ * logSequenceNumber (4 bytes)
+ * nextPosition (4 bytes)
+ * operation (4 bytes)
+ * oldRootPageNumber (4 bytes)
+ * newRootPageNumber (4 bytes)
+ */
+func (l *RedoLog) LogDeleteRootShrink(oldRootPageNumber int32, newRootPageNumber int32) (int32, error) {
+	capacity := 4 * 5
+	buffer := bytes.NewBuffer(make([]byte, 0, capacity))
+	nextPosition, err := l.logHeader(buffer, int32(capacity))
+	if err != nil {
+		return 0, err
+	}
+	binary.Write(buffer, binary.LittleEndian, DELETE_ROOT_SHRINK)
+	binary.Write(buffer, binary.LittleEndian, oldRootPageNumber)
+	binary.Write(buffer, binary.LittleEndian, newRootPageNumber)
+	return l.writeLogEntry(buffer, nextPosition)
+}
+
+func (l *RedoLog) RecoverDeleteRootShrink(tree *BPTree) {
+	oldRootPageNumber, _ := l.readOperands()
+	// 回收的旧根节点页面记有本条日志的序号
+	if l.applied(tree.DiskPager, oldRootPageNumber) {
+		return
+	}
+	oldRoot := ReadDisk(tree.order, tree.DiskPager, oldRootPageNumber, l, tree.compare).(*DiskInternalNode)
+	tree.shrinkRoot(oldRoot)
+}
+
+/*
+ * INSERT_LEAF_ENTRY / DELETE_LEAF_ENTRY log format:
+ * logSequenceNumber (4 bytes)
+ * nextPosition (4 bytes)
+ * operation (4 bytes)
+ * pageNumber (4 bytes)
+ * keyLength (4 bytes)
+ * key (keyLength bytes)
+ * valueLength (4 bytes)
+ * value (valueLength bytes)
+ */
+func (l *RedoLog) LogInsertLeafEntry(pageNumber int32, key []byte, value []byte) (int32, error) {
+	return l.logLeafEntry(INSERT_LEAF_ENTRY, pageNumber, key, value)
+}
+
+func (l *RedoLog) LogDeleteLeafEntry(pageNumber int32, key []byte, value []byte) (int32, error) {
+	return l.logLeafEntry(DELETE_LEAF_ENTRY, pageNumber, key, value)
+}
+
+func (l *RedoLog) logLeafEntry(operation int32, pageNumber int32, key []byte, value []byte) (int32, error) {
+	capacity := 4*6 + len(key) + len(value)
+	buffer := bytes.NewBuffer(make([]byte, 0, capacity))
+	nextPosition, err := l.logHeader(buffer, int32(capacity))
+	if err != nil {
+		return 0, err
+	}
+	binary.Write(buffer, binary.LittleEndian, operation)
+	binary.Write(buffer, binary.LittleEndian, pageNumber)
+	writeLogBytes(buffer, key)
+	writeLogBytes(buffer, value)
+	return l.writeLogEntry(buffer, nextPosition)
+}
+
+// RecoverLogLeafEntry 重做允许重复键的树中叶子节点条目的插入或删除
+func (l *RedoLog) RecoverLogLeafEntry(operation int32, order uint32, pager *DiskPager, compare Comparator) {
+	var pageNumber uint32
+	binary.Read(l.logFile, binary.LittleEndian, &pageNumber)
+	key := l.readLogBytes()
+	value := l.readLogBytes()
+	if l.applied(pager, pageNumber) {
+		return
+	}
+	disk := ReadDisk(order, pager, pageNumber, l, compare).(*DiskLeafNode)
+	if operation == INSERT_LEAF_ENTRY {
+		disk.InsertEntry(key, value)
+	} else {
+		disk.DeleteEntry(key, value)
+	}
+}
+
+// applied 判断正在重放的日志是否已经写入页面
+// 叶子、内部节点和空闲页的日志序号都紧跟在页面的第一个字节之后，页面被回收后序号同样不小于之前的修改
+func (l *RedoLog) applied(pager *DiskPager, pageNumber uint32) bool {
+	data, err := pager.ReadPage(int(pageNumber))
+	if err != nil {
+		throwIOError("read page", pageNumber, err)
+	}
+	return int32(binary.BigEndian.Uint32(data[1:5])) >= l.replayLogSequenceNumber
+}
+
+// readOperands 读取日志条目中 operation 之后的两个 4 字节操作数
+func (l *RedoLog) readOperands() (uint32, uint32) {
+	buffer := make([]byte, 4*2)
+	l.logFile.Read(buffer)
+	reader := bytes.NewReader(buffer)
+	var first, second uint32
+	binary.Read(reader, binary.LittleEndian, &first)
+	binary.Read(reader, binary.LittleEndian, &second)
+	return first, second
+}
+
+// writeLogBytes 写入变长的键或值：length (4 bytes) | data (length bytes)
+func writeLogBytes(buffer *bytes.Buffer, data []byte) {
+	binary.Write(buffer, binary.LittleEndian, int32(len(data)))
+	buffer.Write(data)
+}
+
+// readLogBytes 读取 writeLogBytes 写入的键或值
+func (l *RedoLog) readLogBytes() []byte {
+	var length int32
+	binary.Read(l.logFile, binary.LittleEndian, &length)
+	data := make([]byte, length)
+	io.ReadFull(l.logFile, data)
+	return data
+}
+
 func (l *RedoLog) writeLogEntry(buffer *bytes.Buffer, nextPosition int32) (int32, error) {
+	// 重放时不再写日志，否则会覆盖还没有重放的日志；页面记为正在重放的日志序号
+	if l.recovering {
+		return l.replayLogSequenceNumber, nil
+	}
 	if _, err := l.logFile.Seek(int64(l.currentPosition), io.SeekStart); err != nil {
 		l.logFile.Close()
 		return 0, fmt.Errorf("error seeking to start position: %w", err)
@@ -311,13 +517,9 @@ func (l *RedoLog) writeLogEntry(buffer *bytes.Buffer, nextPosition int32) (int32
 	}
 	l.logFile.Sync()
 	l.currentPosition = int32(nextPosition)
-	if l.recovering {
-		return -1, nil
-	} else {
-		oldLogSequenceNumber := l.logSequenceNumber
-		l.logSequenceNumber++
-		return oldLogSequenceNumber, nil
-	}
+	oldLogSequenceNumber := l.logSequenceNumber
+	l.logSequenceNumber++
+	return oldLogSequenceNumber, nil
 }
 
 // mark exec position is exec position
@@ -352,6 +554,7 @@ func (l *RedoLog) Recover(bpt *BPTree) error {
 	exeLogSeqNumber, err := l.ReadInt()
 	l.executedLogSequenceMumber = exeLogSeqNumber
 	l.currentPosition = LOG_METADATA_SIZE
+	lastLogSequenceNumber := l.executedLogSequenceMumber
 
 	for l.currentPosition < int32(l.fileInfo.Size()) {
 		_, err := l.logFile.Seek(int64(l.currentPosition), io.SeekStart)
@@ -359,37 +562,58 @@ func (l *RedoLog) Recover(bpt *BPTree) error {
 			return fmt.Errorf("error seeking to start position: %w", err)
 		}
 		buffer := make([]byte, 4*3)
-		l.logFile.Read(buffer)
+		if _, err := io.ReadFull(l.logFile, buffer); err != nil {
+			// 最后一条日志没有写完整
+			break
+		}
+		reader := bytes.NewReader(buffer)
 		var logSequenceNumber int32
 		var nextPosition int32
 		var operation int32
-		binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &logSequenceNumber)
-		binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &nextPosition)
-		binary.Read(bytes.NewBuffer(buffer), binary.LittleEndian, &operation)
-		if logSequenceNumber > int32(l.executedLogSequenceMumber) {
+		binary.Read(reader, binary.LittleEndian, &logSequenceNumber)
+		binary.Read(reader, binary.LittleEndian, &nextPosition)
+		binary.Read(reader, binary.LittleEndian, &operation)
+		if nextPosition <= l.currentPosition {
+			break
+		}
+		lastLogSequenceNumber = max(lastLogSequenceNumber, logSequenceNumber)
+		// 已经执行过的日志也可能只写入了部分页面，每一步都按页面的日志序号判断是否需要重做
+		if logSequenceNumber > 0 {
+			l.replayLogSequenceNumber = logSequenceNumber
 			order := bpt.order
-			pager := &bpt.DiskPager
+			pager := bpt.DiskPager
+			compare := bpt.compare
 			switch operation {
 			case INSERT_ROOT_NEW:
 				l.RecoverInsertRootNew(bpt)
 				break
 			case INSERT_LEAF_NORMAL:
-				l.RecoverLogInsertLeafNormal(order, pager)
+				l.RecoverLogInsertLeafNormal(order, pager, compare)
 				break
 			case INSERT_INTERNAL_NORMAL:
-				l.RecoverLogInsertInternalNormal(order, pager)
+				l.RecoverLogInsertInternalNormal(order, pager, compare)
 				break
 			case INSERT_LEAF_SPLIT:
-				l.RecoverLogInsertLeafSplit(order, pager)
+				l.RecoverLogInsertLeafSplit(order, pager, compare)
 				break
 			case INSERT_INTERNAL_SPLIT:
-				l.RecoverLogInsertInternalSplit(order, pager)
+				l.RecoverLogInsertInternalSplit(order, pager, compare)
 				break
+			case DELETE_LEAF_NORMAL:
+				l.RecoverLogDeleteLeafNormal(order, pager, compare)
+			case DELETE_BORROW_LEFT, DELETE_BORROW_RIGHT, DELETE_MERGE:
+				l.RecoverLogDeleteRebalance(operation, order, pager, compare)
+			case DELETE_ROOT_SHRINK:
+				l.RecoverDeleteRootShrink(bpt)
+			case INSERT_LEAF_ENTRY, DELETE_LEAF_ENTRY:
+				l.RecoverLogLeafEntry(operation, order, pager, compare)
 			}
-			l.currentPosition = nextPosition
 		}
+		l.currentPosition = nextPosition
 	}
 
+	// 新的日志接在已有的日志之后，序号继续递增
+	l.logSequenceNumber = lastLogSequenceNumber + 1
 	l.recovering = false
 	return nil
 }
@@ -5,7 +5,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"godb/logger"
-	"log"
 	"strings"
 )
 
@@ -13,18 +12,25 @@ import (
 type BPTree struct {
 	rootPageNumber uint32
 	order          uint32
-	DiskPager      DiskPager
+	DiskPager      *DiskPager
 	ValueLength    uint32
 	RedoLog        *RedoLog
+	// 键的比较函数，打开已有的树时必须与创建时相同
+	compare Comparator
 }
 
-// NewBPTree 创建新的 B+ 树
+// NewBPTree 创建新的 B+ 树，键按字节序比较
 func NewBPTree(order uint32, valueLength uint32, diskPager *DiskPager, redolog *RedoLog) *BPTree {
+	return NewBPTreeWithComparator(order, valueLength, diskPager, redolog, bytes.Compare)
+}
+
+// NewBPTreeWithComparator 创建用 compare 比较键的 B+ 树
+func NewBPTreeWithComparator(order uint32, valueLength uint32, diskPager *DiskPager, redolog *RedoLog, compare Comparator) *BPTree {
 
 	//diskPager, err := f.NewDiskPager(dbfileName, 80, 80)
 
 	//if err != nil {
-	//	log.Fatal("Failed to allocate new page")
+	//	log.Fatalf("Failed to allocate new page: %v", err)
 	//}
 
 	if order < 3 {
@@ -36,51 +42,54 @@ func NewBPTree(order uint32, valueLength uint32, diskPager *DiskPager, redolog *
 		rootPageNum, err := diskPager.AllocateNewPage()
 		//fmt.Println("root rootPageNum", rootPageNum)
 		if err != nil {
-			log.Fatal("Failed to allocate new page")
+			throwIOError("allocate root page", 0, err)
 		}
 		//fmt.Println("value length:", valueLength)
-		root := NewLeafNode(order, valueLength, diskPager, uint32(rootPageNum), redolog)
+		root := NewLeafNode(order, valueLength, diskPager, uint32(rootPageNum), redolog, compare)
 		if err := root.WriteDisk(-1); err != nil {
-			log.Fatal(err)
+			throwIOError("write root page", uint32(rootPageNum), err)
 		}
 		bp := &BPTree{
 			rootPageNumber: uint32(rootPageNum),
 			order:          order,
-			DiskPager:      *diskPager,
+			DiskPager:      diskPager,
 			ValueLength:    valueLength,
 			RedoLog:        redolog,
+			compare:        compare,
 		}
 		bp.writeMetadata()
 		return bp
 	} else {
 		// 检查读取到的数据是否足够
 		// 从数据的前 4 字节读取 rootPageNumber
-		rootPageNumber := readMetadata(*diskPager)
+		rootPageNumber := readMetadata(diskPager)
 
 		obp := &BPTree{
 			rootPageNumber: uint32(rootPageNumber),
 			order:          order,
-			DiskPager:      *diskPager,
+			DiskPager:      diskPager,
 			RedoLog:        redolog,
+			compare:        compare,
 		}
 		redolog.Recover(obp)
 		return obp
 	}
 }
 
-func readMetadata(diskPager DiskPager) int {
+func readMetadata(diskPager *DiskPager) int {
 	data, err := diskPager.ReadPage(0)
 	if err != nil {
-		log.Fatalf("Failed to read metadata: %v", err)
+		throwIOError("read metadata", 0, err)
 	}
 
-	if len(data) < 4 {
-		log.Fatalf("Metadata page size is too small: expected at least 4 bytes, got %d bytes", len(data))
+	if len(data) < 8 {
+		throwIOError("read metadata", 0, fmt.Errorf("metadata page size is too small: expected at least 8 bytes, got %d bytes", len(data)))
 	}
 
 	rootPageNumber := int(binary.BigEndian.Uint32(data[:4]))
 	//fmt.Println("read form metadata rootPageNumber:", rootPageNumber)
 	logger.Debug("read form metadata rootPageNumber: %v", rootPageNumber)
+	diskPager.freeListHead.Store(binary.BigEndian.Uint32(data[4:8]))
 	return rootPageNumber
 }
 
@@ -91,59 +100,98 @@ func (bp *BPTree) writeMetadata() {
 	// 使用 binary.Write 将 rootPageNumber 写入缓冲区
 	rootPageNumber := uint32(bp.rootPageNumber) // 假设 rootPageNumber 是 int 类型
 	binary.BigEndian.PutUint32(buffer[0:4], uint32(rootPageNumber))
+	// 空闲页链表头，删除回收的页面在重启后仍可复用
+	binary.BigEndian.PutUint32(buffer[4:8], bp.DiskPager.GetFreeListHead())
 
 	// 将缓冲区写入 pager 的第 0 页
 	if err := bp.DiskPager.WritePage(0, buffer, -1); err != nil {
-		log.Fatalf("Failed to write metadata: %v", err)
+		throwIOError("write metadata", 0, err)
 	}
 }
 
 // Insert 插入键值对
-func (t *BPTree) Insert(key uint32, value []byte) error {
-	logger.Debug("Attempting to insert key: %d, value: %s , value bytes: %x \n", key, value, value)
-	root := ReadDisk(t.order, &t.DiskPager, t.rootPageNumber, t.RedoLog)
+func (t *BPTree) Insert(key []byte, value []byte) (err error) {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	defer recoverIOError(&err)
+	logger.Debug("Attempting to insert key: %x, value: %s , value bytes: %x \n", key, value, value)
+	root := ReadDisk(t.order, t.DiskPager, t.rootPageNumber, t.RedoLog, t.compare)
+	freeListHead := t.DiskPager.GetFreeListHead()
 
-	result := root.Insert(key, value)
-	if result != nil {
-		t.InsertRootNew(key, root.GetPageNumber(), result.DiskNode.GetPageNumber())
-		return nil
+	t.finishInsert(root, root.Insert(key, value), freeListHead)
+	return nil
+}
+
+// InsertEntry 向允许重复键的树（非唯一二级索引）插入 (key, value) 条目
+// 键相同的条目全部保留，条目已经存在时不做任何事
+func (t *BPTree) InsertEntry(key []byte, value []byte) (err error) {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	// 插入时在键相等处进入右侧子树，相同键的条目可能在左侧的叶子中，先沿叶子链表检查
+	it := t.Range(key, key)
+	for it.Next() {
+		if bytes.Equal(it.Value(), padValue(value, uint32(len(it.Value())))) {
+			return nil
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
 	}
+
+	defer recoverIOError(&err)
+	root := ReadDisk(t.order, t.DiskPager, t.rootPageNumber, t.RedoLog, t.compare)
+	freeListHead := t.DiskPager.GetFreeListHead()
+
+	t.finishInsert(root, root.InsertEntry(key, value), freeListHead)
 	return nil
 }
 
-func (t *BPTree) InsertRootNew(key uint32, childPageNumber1 uint32, childPageNumber2 uint32) {
+// finishInsert 根节点分裂时创建新的根节点
+func (t *BPTree) finishInsert(root DiskNode, result *DiskInsertResult, freeListHead uint32) {
+	if result != nil {
+		t.InsertRootNew(result.Key, root.GetPageNumber(), result.DiskNode.GetPageNumber())
+		return
+	}
+	// 分裂复用了空闲页，需要更新元数据中的空闲链表头
+	if freeListHead != t.DiskPager.GetFreeListHead() {
+		t.writeMetadata()
+	}
+}
+
+func (t *BPTree) InsertRootNew(key []byte, childPageNumber1 uint32, childPageNumber2 uint32) {
 	logger.Debug("Split occurred, creating new root\n")
 	rootPageNum, err := t.DiskPager.AllocateNewPage()
-	_, _ = t.DiskPager.AllocateNewPage()
 	if err != nil {
-		log.Fatal("Failed to allocate new page")
+		throwIOError("allocate root page", t.rootPageNumber, err)
 	}
-	newRoot := NewInternalNode(t.order, &t.DiskPager, uint32(rootPageNum), t.RedoLog)
+	newRoot := NewInternalNode(t.order, t.DiskPager, uint32(rootPageNum), t.RedoLog, t.compare)
 
 	// 正确设置子节点页码和键
 	newRoot.ChildrenPageNumbers = []uint32{childPageNumber1, childPageNumber2}
-	newRoot.Keys = []uint32{key}
+	newRoot.Keys = [][]byte{key}
 
 	t.rootPageNumber = newRoot.PageNumber
 
-	logSequenceNumber, err := t.RedoLog.LogInsertRootNew(int32(key), int32(childPageNumber1), int32(childPageNumber2))
+	logSequenceNumber, err := t.RedoLog.LogInsertRootNew(key, int32(childPageNumber1), int32(childPageNumber2))
 	if err != nil {
 		logger.Error("Failed to insert new root log")
 	}
 	// 确保正确的写入顺序
 	if err := newRoot.WriteDisk(logSequenceNumber); err != nil {
-		log.Fatalf("Failed to write new root: %v", err)
+		throwIOError("write root page", newRoot.PageNumber, err)
 	}
 	t.writeMetadata()
 }
 
-// ReadDisk 从磁盘中读取节点并返回 DiskNode（InternalNode 或 LeafNode）
+// ReadDisk 从磁盘中读取节点并返回 DiskNode（InternalNode 或 LeafNode），节点用 compare 比较键
 
-func ReadDisk(order uint32, pager *DiskPager, pageNumber uint32, redolog *RedoLog) DiskNode {
+func ReadDisk(order uint32, pager *DiskPager, pageNumber uint32, redolog *RedoLog, compare Comparator) DiskNode {
 	// 从 pager 读取指定页的数据
 	data, err := pager.ReadPage(int(pageNumber))
 	if err != nil {
-		log.Fatalf("Failed to read page %d: %v", pageNumber, err)
+		throwIOError("read page", pageNumber, err)
 	}
 	//fmt.Println("Binary representation:")
 	//for _, b := range data {
@@ -158,23 +206,28 @@ func ReadDisk(order uint32, pager *DiskPager, pageNumber uint32, redolog *RedoLo
 	// 读取 isLeaf (1 byte)
 	isLeafByte := make([]byte, 1)
 	if _, err := buffer.Read(isLeafByte); err != nil {
-		log.Fatalf("Failed to read isLeaf byte: %v", err)
+		throwIOError("read isLeaf byte", pageNumber, err)
 	}
 	isLeaf := isLeafByte[0] != 0
 
+	// 读取 logSequenceNumber (4 bytes)
+	var logSequenceNumber int32
+	if err := binary.Read(buffer, binary.BigEndian, &logSequenceNumber); err != nil {
+		throwIOError("read logSequenceNumber", pageNumber, err)
+	}
+
 	// 读取 keyCount (4 bytes)
 	var keyCount uint32
 	if err := binary.Read(buffer, binary.BigEndian, &keyCount); err != nil {
-		log.Fatalf("Failed to read keyCount: %v", err)
+		throwIOError("read keyCount", pageNumber, err)
 	}
 
-	// 读取 Keys (keyCount 个键值对)
-	keys := make([]uint32, keyCount)
+	// 读取 Keys (keyCount 个变长的键)
+	keys := make([][]byte, keyCount)
 	for i := uint32(0); i < keyCount; i++ {
-		// 读取 Key (4 bytes)
-		var key uint32
-		if err := binary.Read(buffer, binary.BigEndian, &key); err != nil {
-			log.Fatalf("Failed to read key: %v", err)
+		key, err := readKey(buffer)
+		if err != nil {
+			throwIOError("read key", pageNumber, err)
 		}
 		keys[i] = key
 	}
@@ -186,7 +239,7 @@ func ReadDisk(order uint32, pager *DiskPager, pageNumber uint32, redolog *RedoLo
 		// 读取 valueLength (4 bytes)
 		var valueLength uint32
 		if err := binary.Read(buffer, binary.BigEndian, &valueLength); err != nil {
-			log.Fatalf("Failed to read keyCount: %v", err)
+			throwIOError("read valueLength", pageNumber, err)
 		}
 		//fmt.Println("read of valueLength:", valueLength)
 
@@ -197,7 +250,7 @@ func ReadDisk(order uint32, pager *DiskPager, pageNumber uint32, redolog *RedoLo
 			value := make([]byte, valueLength)
 			// 直接读取指定长度的字节
 			if _, err := buffer.Read(value); err != nil {
-				log.Fatalf("Failed to read value: %v", err)
+				throwIOError("read value", pageNumber, err)
 			}
 			values[i] = value
 		}
@@ -206,18 +259,21 @@ func ReadDisk(order uint32, pager *DiskPager, pageNumber uint32, redolog *RedoLo
 		// 解析 LeafNode 的特有字段
 		var nextPageNumber uint32
 		if err := binary.Read(buffer, binary.BigEndian, &nextPageNumber); err != nil {
-			log.Fatalf("Failed to read NextPageNumber: %v", err)
+			throwIOError("read NextPageNumber", pageNumber, err)
 		}
 
 		// 创建并返回 LeafNode
 		node := &DiskLeafNode{
-			Order:       order,
-			PageNumber:  pageNumber,
-			Keys:        keys,
-			Values:      values,
-			ValueLength: valueLength,
-			DiskPager:   pager,
-			RedoLog:     redolog,
+			Order:             order,
+			PageNumber:        pageNumber,
+			Keys:              keys,
+			Values:            values,
+			ValueLength:       valueLength,
+			DiskPager:         pager,
+			RedoLog:           redolog,
+			NextPageNumber:    nextPageNumber,
+			Compare:           compare,
+			LogSequenceNumber: logSequenceNumber,
 		}
 		return node
 	} else {
@@ -227,7 +283,7 @@ func ReadDisk(order uint32, pager *DiskPager, pageNumber uint32, redolog *RedoLo
 		for i := uint32(0); i < keyCount+1; i++ {
 			var childPageNumber uint32
 			if err := binary.Read(buffer, binary.BigEndian, &childPageNumber); err != nil {
-				log.Fatalf("Failed to read child page number: %v", err)
+				throwIOError("read child page number", pageNumber, err)
 			}
 			childrenPageNumbers[i] = childPageNumber
 			//fmt.Println("childPagenum:", childPageNumber)
@@ -241,28 +297,35 @@ func ReadDisk(order uint32, pager *DiskPager, pageNumber uint32, redolog *RedoLo
 			ChildrenPageNumbers: childrenPageNumbers,
 			DiskPager:           pager,
 			RedoLog:             redolog,
+			Compare:             compare,
+			LogSequenceNumber:   logSequenceNumber,
 		}
 		//fmt.Printf("Reading InternalNode: %+v\n", node)
 		return node
 	}
 }
 
-// Search 查找键对应的值
-func (t *BPTree) Search(key uint32) (interface{}, bool) {
-	root := ReadDisk(t.order, &t.DiskPager, t.rootPageNumber, t.RedoLog)
+// Search 查找键对应的值，读取页面失败时返回错误
+func (t *BPTree) Search(key []byte) (value interface{}, found bool, err error) {
+	defer recoverIOError(&err)
+	root := ReadDisk(t.order, t.DiskPager, t.rootPageNumber, t.RedoLog, t.compare)
 	//readDisk first
 	if root == nil {
-		return nil, false
+		return nil, false, nil
 	}
-	return root.Search(key)
+	value, found = root.Search(key)
+	return value, found, nil
 }
 
-func (t *BPTree) SearchAll(key uint32) ([][]byte, bool) {
-	root := ReadDisk(t.order, &t.DiskPager, t.rootPageNumber, t.RedoLog)
+// SearchAll 查找键对应的所有值，读取页面失败时返回错误
+func (t *BPTree) SearchAll(key []byte) (values [][]byte, found bool, err error) {
+	defer recoverIOError(&err)
+	root := ReadDisk(t.order, t.DiskPager, t.rootPageNumber, t.RedoLog, t.compare)
 	if root == nil {
-		return nil, false
+		return nil, false, nil
 	}
-	return root.SearchAll(key)
+	values, found = root.SearchAll(key)
+	return values, found, nil
 }
 
 // Print 打印树结构
@@ -274,7 +337,7 @@ func (t *BPTree) Print() {
 	fmt.Printf("Total Pages: %d\n", t.DiskPager.GetTotalPage())
 	fmt.Println("---------------------------------------------")
 
-	root := ReadDisk(t.order, &t.DiskPager, t.rootPageNumber, t.RedoLog)
+	root := ReadDisk(t.order, t.DiskPager, t.rootPageNumber, t.RedoLog, t.compare)
 	if root == nil {
 		fmt.Println("Empty Tree")
 		return
@@ -300,30 +363,78 @@ func (t *BPTree) printNodeDetailed(node DiskNode, depth int) {
 		//打印每个子节点
 		for i, childPage := range n.ChildrenPageNumbers {
 			fmt.Printf("%s├── Child %d:", indent, i)
-			child := ReadDisk(t.order, &t.DiskPager, childPage, t.RedoLog)
+			child := ReadDisk(t.order, t.DiskPager, childPage, t.RedoLog, t.compare)
 			t.printNodeDetailed(child, depth+1)
 		}
 
 	case *DiskLeafNode:
 		fmt.Printf("%s┌── Leaf Node (Page: %d)\n", prefix, n.PageNumber)
 		fmt.Printf("%s│   ├── key Count: %d\n", prefix, len(n.Keys))
-		//fmt.Printf("%s│   ├── Next Leaf: %d\n", prefix)
+		fmt.Printf("%s│   ├── Next Leaf: %d\n", prefix, n.NextPageNumber)
 		fmt.Printf("%s│   ├── Keys:\n", prefix)
 
 		//打印键值对
 		for i, key := range n.Keys {
-			fmt.Printf("%s│       [%d] Key: %d, Value: %s\n",
+			fmt.Printf("%s│       [%d] Key: %x, Value: %s\n",
 				prefix, i, key, n.Values[i])
 		}
 	}
 }
 
-// Delete 删除指定 key 的数据
-func (t *BPTree) Delete(key uint32) error {
-	root := ReadDisk(t.order, &t.DiskPager, t.rootPageNumber, t.RedoLog)
-	return root.Delete(key)
+// Delete 删除指定 key 的数据，根节点为空的内部节点时树高度减一
+func (t *BPTree) Delete(key []byte) (err error) {
+	defer recoverIOError(&err)
+	root := ReadDisk(t.order, t.DiskPager, t.rootPageNumber, t.RedoLog, t.compare)
+	freeListHead := t.DiskPager.GetFreeListHead()
+
+	if err := root.Delete(key); err != nil {
+		return err
+	}
+	return t.finishDelete(root, freeListHead)
+}
+
+// DeleteEntry 从允许重复键的树中删除与 (key, value) 完全相同的条目，返回是否找到
+func (t *BPTree) DeleteEntry(key []byte, value []byte) (found bool, err error) {
+	defer recoverIOError(&err)
+	root := ReadDisk(t.order, t.DiskPager, t.rootPageNumber, t.RedoLog, t.compare)
+	freeListHead := t.DiskPager.GetFreeListHead()
+
+	if found, err = root.DeleteEntry(key, value); err != nil || !found {
+		return found, err
+	}
+	return true, t.finishDelete(root, freeListHead)
+}
+
+// finishDelete 根节点为空的内部节点时树高度减一
+func (t *BPTree) finishDelete(root DiskNode, freeListHead uint32) error {
+	if internal, ok := root.(*DiskInternalNode); ok && len(internal.Keys) == 0 {
+		return t.shrinkRoot(internal)
+	}
+	// 合并回收了页面，需要更新元数据中的空闲链表头
+	if freeListHead != t.DiskPager.GetFreeListHead() {
+		t.writeMetadata()
+	}
+	return nil
+}
+
+// shrinkRoot 用根节点唯一的子节点替换根节点，并回收旧根节点的页面
+func (t *BPTree) shrinkRoot(oldRoot *DiskInternalNode) error {
+	logger.Debug("Root is empty after delete, shrinking tree\n")
+	newRootPageNumber := oldRoot.ChildrenPageNumbers[0]
+
+	logSequenceNumber, err := t.RedoLog.LogDeleteRootShrink(int32(oldRoot.PageNumber), int32(newRootPageNumber))
+	if err != nil {
+		logger.Error("Failed to insert root shrink log")
+	}
+	t.rootPageNumber = newRootPageNumber
+	if err := t.DiskPager.FreePage(int(oldRoot.PageNumber), logSequenceNumber); err != nil {
+		return err
+	}
+	t.writeMetadata()
+	return nil
 }
 
-func (t *BPTree) Flush() error {
+func (t *BPTree) Flush() (err error) {
+	defer recoverIOError(&err)
 	return t.DiskPager.Flush()
 }
@@ -1,7 +1,15 @@
 package disktree
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"godb/logger"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -37,14 +45,14 @@ func TestTree(t *testing.T) {
 		}
 
 		for _, insert := range inserts {
-			tree.Insert(insert.key, []byte(insert.value))
+			tree.Insert(intKey(insert.key), []byte(insert.value))
 		}
 	})
 
 	// 测试主键查询
 	t.Run("Query by Primary Key", func(t *testing.T) {
-		tree.Insert(1, []byte("tsdsd"))
-		value, found := tree.Search(1)
+		tree.Insert(intKey(1), []byte("tsdsd"))
+		value, found, _ := tree.Search(intKey(1))
 		if !found {
 			t.Fatalf("Failed to query by primary key")
 		}
@@ -54,11 +62,11 @@ func TestTree(t *testing.T) {
 	// 测试二级索引查询（相同值的查询）
 	t.Run("Query by Secondary Index", func(t *testing.T) {
 		// 先插入一些相同值的记录
-		tree.Insert(6, []byte("active"))
-		tree.Insert(7, []byte("active"))
-		tree.Insert(8, []byte("inactive"))
+		tree.Insert(intKey(6), []byte("active"))
+		tree.Insert(intKey(7), []byte("active"))
+		tree.Insert(intKey(8), []byte("inactive"))
 
-		result, found := tree.SearchAll(6)
+		result, found, _ := tree.SearchAll(intKey(6))
 		if !found {
 			t.Fatalf("Failed to query by secondary index")
 		}
@@ -67,11 +75,11 @@ func TestTree(t *testing.T) {
 
 	// 测试更新操作
 	t.Run("Update Records", func(t *testing.T) {
-		tree.Insert(2, []byte("updated@test.com"))
-		tree.Insert(2, []byte("updated02@test.com"))
+		tree.Insert(intKey(2), []byte("updated@test.com"))
+		tree.Insert(intKey(2), []byte("updated02@test.com"))
 
 		// 验证更新结果
-		result, found := tree.Search(2)
+		result, found, _ := tree.Search(intKey(2))
 		if !found {
 			t.Fatalf("Failed to verify update")
 		}
@@ -81,19 +89,582 @@ func TestTree(t *testing.T) {
 	// 测试大量数据插入
 	t.Run("Insert Large Dataset", func(t *testing.T) {
 		for i := uint32(10); i < 20; i++ {
-			tree.Insert(i, []byte("user@test.com"))
+			tree.Insert(intKey(i), []byte("user@test.com"))
 		}
 		tree.Print()
 	})
 
-	// 测试范围查询（如果支持的话）
+	// 测试范围查询
 	t.Run("Range Query", func(t *testing.T) {
-		// 注意：这里需要实现范围查询功能
-		// result := tree.RangeSearch(1, 5)
-		// logger.Info("Range query result: %v", result)
+		iterator := tree.Range(intKey(1), intKey(5))
+		keys := make([]uint32, 0)
+		for iterator.Next() {
+			keys = append(keys, keyInt(iterator.Key()))
+		}
+		logger.Info("Range query result: %v", keys)
 	})
 
 	// 打印最终的树结构
 	tree.Print()
 
 }
+
+func TestTreeDelete(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	redolog, err := NewRedoLog(filepath.Join(dir, "delete.log"))
+	if err != nil {
+		t.Fatalf("Failed to create redo log: %v", err)
+	}
+	diskPager, err := NewDiskPager(filepath.Join(dir, "delete.db"), 80, 80, redolog)
+	if err != nil {
+		t.Fatalf("Failed to create disk pager: %v", err)
+	}
+	tree := NewBPTree(4, 8, diskPager, redolog)
+
+	for i := uint32(1); i <= 40; i++ {
+		tree.Insert(intKey(i), []byte(fmt.Sprintf("v%d", i)))
+	}
+	pagesAfterInsert := diskPager.GetTotalPage()
+
+	// 删除偶数键，触发借键与合并
+	t.Run("Delete Even Keys", func(t *testing.T) {
+		for i := uint32(2); i <= 40; i += 2 {
+			if err := tree.Delete(intKey(i)); err != nil {
+				t.Fatalf("Failed to delete key %d: %v", i, err)
+			}
+		}
+		for i := uint32(1); i <= 40; i++ {
+			_, found, _ := tree.Search(intKey(i))
+			if found != (i%2 == 1) {
+				t.Errorf("key %d: found = %v, want %v", i, found, i%2 == 1)
+			}
+		}
+	})
+
+	// 全部删除后根节点收缩为空叶子
+	t.Run("Delete All Keys", func(t *testing.T) {
+		for i := uint32(1); i <= 40; i += 2 {
+			if err := tree.Delete(intKey(i)); err != nil {
+				t.Fatalf("Failed to delete key %d: %v", i, err)
+			}
+		}
+		root := ReadDisk(tree.order, tree.DiskPager, tree.rootPageNumber, tree.RedoLog, tree.compare)
+		leaf, ok := root.(*DiskLeafNode)
+		if !ok {
+			t.Fatalf("expected root to shrink to a leaf, got %T", root)
+		}
+		if len(leaf.Keys) != 0 {
+			t.Errorf("expected empty root, got keys %v", leaf.Keys)
+		}
+		if diskPager.GetFreeListHead() == 0 {
+			t.Errorf("expected merged pages to be put on the free list")
+		}
+	})
+
+	// 回收的页面被重新分配
+	t.Run("Reuse Freed Pages", func(t *testing.T) {
+		for i := uint32(1); i <= 40; i++ {
+			tree.Insert(intKey(i), []byte(fmt.Sprintf("v%d", i)))
+		}
+		if diskPager.GetTotalPage() > pagesAfterInsert {
+			t.Errorf("expected freed pages to be reused, total pages grew from %d to %d",
+				pagesAfterInsert, diskPager.GetTotalPage())
+		}
+		for i := uint32(1); i <= 40; i++ {
+			value, found, _ := tree.Search(intKey(i))
+			if !found || string(bytes.TrimRight(value.([]byte), "\x00")) != fmt.Sprintf("v%d", i) {
+				t.Errorf("key %d: got %v, %v", i, value, found)
+			}
+		}
+	})
+}
+
+func TestTreeSearchReadError(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	redolog, err := NewRedoLog(filepath.Join(dir, "search.log"))
+	if err != nil {
+		t.Fatalf("Failed to create redo log: %v", err)
+	}
+	// 缓存只有两页，查找时必须从文件中读取页面
+	diskPager, err := NewDiskPager(filepath.Join(dir, "search.db"), 80, 2, redolog)
+	if err != nil {
+		t.Fatalf("Failed to create disk pager: %v", err)
+	}
+	tree := NewBPTree(4, 8, diskPager, redolog)
+	for i := uint32(1); i <= 40; i++ {
+		tree.Insert(intKey(i), []byte(fmt.Sprintf("v%d", i)))
+	}
+	if err := tree.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	// 读取页面失败时返回错误，不会 panic
+	diskPager.file.Close()
+	var ioError *IOError
+	if _, _, err := tree.Search(intKey(1)); !errors.As(err, &ioError) {
+		t.Errorf("Search: expected IOError, got %v", err)
+	}
+	if _, _, err := tree.SearchAll(intKey(40)); !errors.As(err, &ioError) {
+		t.Errorf("SearchAll: expected IOError, got %v", err)
+	}
+}
+
+func TestTreeRecoverTwice(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "recover.log")
+	redolog, err := NewRedoLog(logPath)
+	if err != nil {
+		t.Fatalf("Failed to create redo log: %v", err)
+	}
+	diskPager, err := NewDiskPager(filepath.Join(dir, "recover.db"), 80, 80, redolog)
+	if err != nil {
+		t.Fatalf("Failed to create disk pager: %v", err)
+	}
+	tree := NewBPTree(4, 8, diskPager, redolog)
+
+	// 日志中包含分裂、借键、合并和根节点收缩
+	for i := uint32(1); i <= 40; i++ {
+		tree.Insert(intKey(i), []byte(fmt.Sprintf("v%d", i)))
+	}
+	for i := uint32(1); i <= 36; i++ {
+		if err := tree.Delete(intKey(i)); err != nil {
+			t.Fatalf("Failed to delete key %d: %v", i, err)
+		}
+	}
+	if err := tree.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	keys := func(tree *BPTree) []uint32 {
+		var keys []uint32
+		it := tree.Iterator()
+		for it.Next() {
+			keys = append(keys, keyInt(it.Key()))
+		}
+		if it.Err() != nil {
+			t.Fatalf("Failed to iterate: %v", it.Err())
+		}
+		return keys
+	}
+	want := keys(tree)
+	totalPage := diskPager.GetTotalPage()
+
+	// 从头重放整个日志两次，所有修改都已经写入页面，重放不能改变树
+	replayLog, err := NewRedoLog(logPath)
+	if err != nil {
+		t.Fatalf("Failed to open redo log: %v", err)
+	}
+	replayLog.logFile.Seek(0, io.SeekStart)
+	replayLog.WriteInt(EXECUTED_LOG_SEQUENCE_NUMBER)
+	replayed := &BPTree{
+		rootPageNumber: tree.rootPageNumber,
+		order:          tree.order,
+		DiskPager:      diskPager,
+		ValueLength:    tree.ValueLength,
+		RedoLog:        replayLog,
+		compare:        tree.compare,
+	}
+	for i := 0; i < 2; i++ {
+		if err := replayLog.Recover(replayed); err != nil {
+			t.Fatalf("Failed to recover: %v", err)
+		}
+		if replayed.rootPageNumber != tree.rootPageNumber {
+			t.Errorf("replay %d: root page = %d, want %d", i, replayed.rootPageNumber, tree.rootPageNumber)
+		}
+		if got := keys(replayed); !slices.Equal(got, want) {
+			t.Errorf("replay %d: keys = %v, want %v", i, got, want)
+		}
+		if diskPager.GetTotalPage() != totalPage {
+			t.Errorf("replay %d: total pages grew from %d to %d", i, totalPage, diskPager.GetTotalPage())
+		}
+	}
+
+	// 重放不写日志，之后的修改接在原有日志之后
+	info, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != replayLog.fileInfo.Size() {
+		t.Errorf("replay wrote to the log: size %d, want %d", info.Size(), replayLog.fileInfo.Size())
+	}
+	if replayLog.logSequenceNumber != redolog.logSequenceNumber {
+		t.Errorf("next log sequence number = %d, want %d", replayLog.logSequenceNumber, redolog.logSequenceNumber)
+	}
+}
+
+func TestTreeRange(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	redolog, err := NewRedoLog(filepath.Join(dir, "range.log"))
+	if err != nil {
+		t.Fatalf("Failed to create redo log: %v", err)
+	}
+	diskPager, err := NewDiskPager(filepath.Join(dir, "range.db"), 80, 80, redolog)
+	if err != nil {
+		t.Fatalf("Failed to create disk pager: %v", err)
+	}
+	tree := NewBPTree(4, 8, diskPager, redolog)
+
+	// 乱序插入偶数键
+	for _, i := range []uint32{20, 2, 38, 14, 8, 30, 26, 4, 12, 36, 40, 6, 18, 10, 24, 34, 16, 28, 22, 32} {
+		tree.Insert(intKey(i), []byte(fmt.Sprintf("v%d", i)))
+	}
+
+	collect := func(iterator *TreeIterator) []uint32 {
+		keys := make([]uint32, 0)
+		for iterator.Next() {
+			key := keyInt(iterator.Key())
+			keys = append(keys, key)
+			if string(bytes.TrimRight(iterator.Value(), "\x00")) != fmt.Sprintf("v%d", key) {
+				t.Errorf("key %d: unexpected value %q", key, iterator.Value())
+			}
+		}
+		return keys
+	}
+
+	t.Run("Full Scan In Order", func(t *testing.T) {
+		keys := collect(tree.Iterator())
+		if len(keys) != 20 {
+			t.Fatalf("expected 20 keys, got %d: %v", len(keys), keys)
+		}
+		for i, key := range keys {
+			if key != uint32(i+1)*2 {
+				t.Errorf("keys out of order: %v", keys)
+				break
+			}
+		}
+	})
+
+	t.Run("Bounded Range", func(t *testing.T) {
+		keys := collect(tree.Range(intKey(7), intKey(17)))
+		want := []uint32{8, 10, 12, 14, 16}
+		if fmt.Sprint(keys) != fmt.Sprint(want) {
+			t.Errorf("Range(7, 17) = %v, want %v", keys, want)
+		}
+	})
+
+	t.Run("Reverse Range", func(t *testing.T) {
+		keys := collect(tree.ReverseRange(nil, nil))
+		want := make([]uint32, 0, 20)
+		for i := uint32(40); i >= 2; i -= 2 {
+			want = append(want, i)
+		}
+		if !slices.Equal(keys, want) {
+			t.Errorf("ReverseRange(nil, nil) = %v, want %v", keys, want)
+		}
+		if keys := collect(tree.ReverseRange(intKey(7), intKey(17))); !slices.Equal(keys, []uint32{16, 14, 12, 10, 8}) {
+			t.Errorf("ReverseRange(7, 17) = %v, want [16 14 12 10 8]", keys)
+		}
+		if keys := collect(tree.ReverseRange(intKey(20), intKey(20))); !slices.Equal(keys, []uint32{20}) {
+			t.Errorf("ReverseRange(20, 20) = %v, want [20]", keys)
+		}
+		if keys := collect(tree.ReverseRange(nil, intKey(1))); len(keys) != 0 {
+			t.Errorf("ReverseRange(nil, 1) = %v, want no keys", keys)
+		}
+		if keys := collect(tree.ReverseRange(intKey(41), nil)); len(keys) != 0 {
+			t.Errorf("ReverseRange(41, nil) = %v, want no keys", keys)
+		}
+	})
+
+	t.Run("Count And Min Max", func(t *testing.T) {
+		count, err := tree.Count()
+		if err != nil || count != 20 {
+			t.Errorf("Count() = %d, %v, want 20", count, err)
+		}
+		if key, found, err := tree.MinKey(); err != nil || !found || keyInt(key) != 2 {
+			t.Errorf("MinKey() = %x, %v, %v, want 2", key, found, err)
+		}
+		if key, found, err := tree.MaxKey(); err != nil || !found || keyInt(key) != 40 {
+			t.Errorf("MaxKey() = %x, %v, %v, want 40", key, found, err)
+		}
+	})
+
+	t.Run("Empty Range", func(t *testing.T) {
+		if keys := collect(tree.Range(intKey(41), intKey(100))); len(keys) != 0 {
+			t.Errorf("expected no keys, got %v", keys)
+		}
+	})
+
+	// 删除合并后链表仍然连续
+	t.Run("Range After Delete", func(t *testing.T) {
+		for i := uint32(2); i <= 30; i += 2 {
+			tree.Delete(intKey(i))
+		}
+		keys := collect(tree.Iterator())
+		want := []uint32{32, 34, 36, 38, 40}
+		if fmt.Sprint(keys) != fmt.Sprint(want) {
+			t.Errorf("Iterator() = %v, want %v", keys, want)
+		}
+		keys = collect(tree.ReverseRange(nil, nil))
+		slices.Reverse(want)
+		if !slices.Equal(keys, want) {
+			t.Errorf("ReverseRange(nil, nil) = %v, want %v", keys, want)
+		}
+	})
+
+	t.Run("Empty Tree", func(t *testing.T) {
+		for i := uint32(32); i <= 40; i += 2 {
+			tree.Delete(intKey(i))
+		}
+		if count, err := tree.Count(); err != nil || count != 0 {
+			t.Errorf("Count() = %d, %v, want 0", count, err)
+		}
+		if _, found, _ := tree.MinKey(); found {
+			t.Errorf("MinKey() found a key in empty tree")
+		}
+		if _, found, _ := tree.MaxKey(); found {
+			t.Errorf("MaxKey() found a key in empty tree")
+		}
+	})
+}
+
+func TestTreeDuplicateEntries(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	redolog, err := NewRedoLog(filepath.Join(dir, "entry.log"))
+	if err != nil {
+		t.Fatalf("Failed to create redo log: %v", err)
+	}
+	diskPager, err := NewDiskPager(filepath.Join(dir, "entry.db"), 80, 80, redolog)
+	if err != nil {
+		t.Fatalf("Failed to create disk pager: %v", err)
+	}
+	tree := NewBPTree(4, 4, diskPager, redolog)
+
+	value := func(i uint32) []byte {
+		buf := make([]byte, 4)
+		binary.BigEndian.PutUint32(buf, i)
+		return buf
+	}
+	// 键为 i%3，值为 i，同一个键的条目跨越多个叶子
+	for _, i := range []uint32{7, 3, 12, 1, 9, 4, 15, 6, 10, 2, 13, 5, 8, 14, 11} {
+		if err := tree.InsertEntry(intKey(i%3), value(i)); err != nil {
+			t.Fatalf("Failed to insert entry %d: %v", i, err)
+		}
+	}
+	entries := func(key uint32) []uint32 {
+		values, _, _ := tree.SearchAll(intKey(key))
+		result := make([]uint32, 0, len(values))
+		for _, v := range values {
+			result = append(result, binary.BigEndian.Uint32(v))
+		}
+		slices.Sort(result)
+		return result
+	}
+
+	t.Run("Keep Every Duplicate", func(t *testing.T) {
+		for key, want := range [][]uint32{{3, 6, 9, 12, 15}, {1, 4, 7, 10, 13}, {2, 5, 8, 11, 14}} {
+			if got := entries(uint32(key)); !slices.Equal(got, want) {
+				t.Errorf("SearchAll(%d) = %v, want %v", key, got, want)
+			}
+		}
+		if count, _ := tree.Count(); count != 15 {
+			t.Errorf("Count() = %d, want 15", count)
+		}
+		// 重复插入相同的条目不会产生新条目
+		tree.InsertEntry(intKey(1), value(7))
+		if count, _ := tree.Count(); count != 15 {
+			t.Errorf("Count() after inserting an existing entry = %d, want 15", count)
+		}
+	})
+
+	// 降序遍历跨越多个叶子的重复键，条目顺序与升序遍历正好相反
+	t.Run("Reverse Duplicates", func(t *testing.T) {
+		collect := func(iterator *TreeIterator) []uint32 {
+			result := make([]uint32, 0)
+			for iterator.Next() {
+				result = append(result, keyInt(iterator.Key())*100+binary.BigEndian.Uint32(iterator.Value()))
+			}
+			return result
+		}
+		forward := collect(tree.Iterator())
+		slices.Reverse(forward)
+		if backward := collect(tree.ReverseRange(nil, nil)); !slices.Equal(backward, forward) {
+			t.Errorf("ReverseRange(nil, nil) = %v, want %v", backward, forward)
+		}
+		if got, want := collect(tree.ReverseRange(intKey(1), intKey(1))), []uint32{113, 110, 107, 104, 101}; !slices.Equal(got, want) {
+			t.Errorf("ReverseRange(1, 1) = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Delete Only The Matching Entry", func(t *testing.T) {
+		if found, err := tree.DeleteEntry(intKey(1), value(7)); err != nil || !found {
+			t.Fatalf("DeleteEntry(1, 7) = %v, %v", found, err)
+		}
+		if found, _ := tree.DeleteEntry(intKey(1), value(8)); found {
+			t.Errorf("DeleteEntry(1, 8) found an entry that does not exist")
+		}
+		if got, want := entries(1), []uint32{1, 4, 10, 13}; !slices.Equal(got, want) {
+			t.Errorf("SearchAll(1) = %v, want %v", got, want)
+		}
+	})
+
+	// 删除触发借键与合并后其余条目仍然可以找到
+	t.Run("Delete Across Leaves", func(t *testing.T) {
+		for _, i := range []uint32{3, 12, 6, 15, 9, 1, 13} {
+			if found, err := tree.DeleteEntry(intKey(i%3), value(i)); err != nil || !found {
+				t.Fatalf("DeleteEntry(%d, %d) = %v, %v", i%3, i, found, err)
+			}
+		}
+		for key, want := range [][]uint32{{}, {4, 10}, {2, 5, 8, 11, 14}} {
+			if got := entries(uint32(key)); !slices.Equal(got, want) {
+				t.Errorf("SearchAll(%d) = %v, want %v", key, got, want)
+			}
+		}
+	})
+}
+
+// intKey 把整数编码成大端序的键，字节序与数值顺序一致
+func intKey(k uint32) []byte {
+	key := make([]byte, 4)
+	binary.BigEndian.PutUint32(key, k)
+	return key
+}
+
+// keyInt 把 intKey 编码的键还原成整数
+func keyInt(key []byte) uint32 {
+	return binary.BigEndian.Uint32(key)
+}
+
+func TestTreeByteKeys(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	redolog, err := NewRedoLog(filepath.Join(dir, "bytes.log"))
+	if err != nil {
+		t.Fatalf("Failed to create redo log: %v", err)
+	}
+	diskPager, err := NewDiskPager(filepath.Join(dir, "bytes.db"), 256, 80, redolog)
+	if err != nil {
+		t.Fatalf("Failed to create disk pager: %v", err)
+	}
+	tree := NewBPTree(4, 8, diskPager, redolog)
+
+	// 长度不同的键按字节序排列，短键排在以它为前缀的长键之前
+	words := []string{"pear", "apple", "fig", "b", "banana", "app", "kiwi", "a", "plum", "cherry", "ba", "date"}
+	for _, word := range words {
+		if err := tree.Insert([]byte(word), []byte(word)); err != nil {
+			t.Fatalf("Failed to insert %q: %v", word, err)
+		}
+	}
+	collect := func(iterator *TreeIterator) []string {
+		keys := make([]string, 0)
+		for iterator.Next() {
+			keys = append(keys, string(iterator.Key()))
+		}
+		return keys
+	}
+
+	t.Run("Full Scan In Byte Order", func(t *testing.T) {
+		want := slices.Clone(words)
+		slices.Sort(want)
+		if got := collect(tree.Iterator()); !slices.Equal(got, want) {
+			t.Errorf("Iterator() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Prefix Range", func(t *testing.T) {
+		// [b, b\xff] 覆盖所有以 b 开头的键
+		got := collect(tree.Range([]byte("b"), []byte("b\xff")))
+		if want := []string{"b", "ba", "banana"}; !slices.Equal(got, want) {
+			t.Errorf("Range(b, b\\xff) = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Search And Delete", func(t *testing.T) {
+		if _, found, _ := tree.Search([]byte("ap")); found {
+			t.Errorf("Search(ap) found a key that was never inserted")
+		}
+		if err := tree.Delete([]byte("app")); err != nil {
+			t.Fatalf("Delete(app) = %v", err)
+		}
+		if _, found, _ := tree.Search([]byte("app")); found {
+			t.Errorf("Search(app) found a deleted key")
+		}
+		if value, found, _ := tree.Search([]byte("apple")); !found || string(bytes.TrimRight(value.([]byte), "\x00")) != "apple" {
+			t.Errorf("Search(apple) = %v, %v", value, found)
+		}
+	})
+
+	t.Run("Reject Long Key", func(t *testing.T) {
+		if err := tree.Insert(make([]byte, MAX_KEY_LENGTH+1), []byte("x")); err == nil {
+			t.Errorf("expected a key longer than %d bytes to be rejected", MAX_KEY_LENGTH)
+		}
+		if count, _ := tree.Count(); int(count) != len(words)-1 {
+			t.Errorf("Count() = %d, want %d", count, len(words)-1)
+		}
+	})
+}
+
+func TestTreeComparator(t *testing.T) {
+	logger.SetLevel(logger.INFO)
+	dir := t.TempDir()
+	redolog, err := NewRedoLog(filepath.Join(dir, "compare.log"))
+	if err != nil {
+		t.Fatalf("Failed to create redo log: %v", err)
+	}
+	diskPager, err := NewDiskPager(filepath.Join(dir, "compare.db"), 256, 80, redolog)
+	if err != nil {
+		t.Fatalf("Failed to create disk pager: %v", err)
+	}
+	// 不区分大小写的比较函数，只相差大小写的键视为同一个键
+	tree := NewBPTreeWithComparator(4, 8, diskPager, redolog, func(a, b []byte) int {
+		return bytes.Compare(bytes.ToLower(a), bytes.ToLower(b))
+	})
+
+	words := []string{"Pear", "apple", "Fig", "banana", "Cherry", "date", "Kiwi", "grape", "Lemon", "mango"}
+	for _, word := range words {
+		if err := tree.Insert([]byte(word), []byte(word)); err != nil {
+			t.Fatalf("Failed to insert %q: %v", word, err)
+		}
+	}
+	collect := func(iterator *TreeIterator) []string {
+		keys := make([]string, 0)
+		for iterator.Next() {
+			keys = append(keys, string(iterator.Key()))
+		}
+		return keys
+	}
+
+	t.Run("Scan In Comparator Order", func(t *testing.T) {
+		want := []string{"apple", "banana", "Cherry", "date", "Fig", "grape", "Kiwi", "Lemon", "mango", "Pear"}
+		if got := collect(tree.Iterator()); !slices.Equal(got, want) {
+			t.Errorf("Iterator() = %v, want %v", got, want)
+		}
+		if got, want := collect(tree.Range([]byte("CHERRY"), []byte("FIG"))), []string{"Cherry", "date", "Fig"}; !slices.Equal(got, want) {
+			t.Errorf("Range(CHERRY, FIG) = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Equal Keys Under Comparator", func(t *testing.T) {
+		if _, found, _ := tree.Search([]byte("KIWI")); !found {
+			t.Errorf("Search(KIWI) did not find Kiwi")
+		}
+		// 比较相等的键更新原有的条目，不会插入新条目
+		if err := tree.Insert([]byte("LEMON"), []byte("lime")); err != nil {
+			t.Fatalf("Insert(LEMON) = %v", err)
+		}
+		if count, _ := tree.Count(); int(count) != len(words) {
+			t.Errorf("Count() = %d, want %d", count, len(words))
+		}
+		if value, found, _ := tree.Search([]byte("lemon")); !found || string(bytes.TrimRight(value.([]byte), "\x00")) != "lime" {
+			t.Errorf("Search(lemon) = %v, %v", value, found)
+		}
+		if err := tree.Delete([]byte("pEaR")); err != nil {
+			t.Fatalf("Delete(pEaR) = %v", err)
+		}
+		if _, found, _ := tree.Search([]byte("Pear")); found {
+			t.Errorf("Search(Pear) found a deleted key")
+		}
+	})
+
+	t.Run("Min And Max", func(t *testing.T) {
+		if key, found, err := tree.MinKey(); err != nil || !found || string(key) != "apple" {
+			t.Errorf("MinKey() = %q, %v, %v", key, found, err)
+		}
+		if key, found, err := tree.MaxKey(); err != nil || !found || string(key) != "mango" {
+			t.Errorf("MaxKey() = %q, %v, %v", key, found, err)
+		}
+	})
+}
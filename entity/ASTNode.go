@@ -28,6 +28,19 @@ func NewBinaryOpNode(operator TokenType, left, right ASTNode) *BinaryOpNode {
 	}
 }
 
+// UnaryOpNode 一元运算，目前只有 NOT
+type UnaryOpNode struct {
+	Operator TokenType
+	Operand  ASTNode
+}
+
+func NewUnaryOpNode(operator TokenType, operand ASTNode) *UnaryOpNode {
+	return &UnaryOpNode{
+		Operator: operator,
+		Operand:  operand,
+	}
+}
+
 type IdentifierNode struct {
 	Name string
 }
@@ -47,10 +60,74 @@ type InsertNode struct {
 type UpdateNode struct {
 	TableName   string
 	Columns     []string
-	WhereClause []*BinaryOpNode
+	WhereClause ASTNode
 	Values      []interface{}
 }
 
+type DeleteNode struct {
+	TableName   string
+	WhereClause ASTNode
+}
+
+func NewDeleteNode(tableName string, whereClause ASTNode) *DeleteNode {
+	return &DeleteNode{
+		TableName:   tableName,
+		WhereClause: whereClause,
+	}
+}
+
+// AnalyzeNode ANALYZE [TABLE] table_name，重新计算表的统计信息
+type AnalyzeNode struct {
+	TableName string
+}
+
+func NewAnalyzeNode(tableName string) *AnalyzeNode {
+	return &AnalyzeNode{
+		TableName: tableName,
+	}
+}
+
+// ExplainNode EXPLAIN SELECT ...，返回查询的执行计划而不执行查询
+type ExplainNode struct {
+	Statement *SelectNode
+}
+
+func NewExplainNode(statement *SelectNode) *ExplainNode {
+	return &ExplainNode{
+		Statement: statement,
+	}
+}
+
+// CreateIndexNode CREATE [UNIQUE] INDEX index_name ON table_name (column1, column2, ...)
+type CreateIndexNode struct {
+	IndexName string
+	TableName string
+	Columns   []string
+	Unique    bool
+}
+
+func NewCreateIndexNode(indexName string, tableName string, columns []string, unique bool) *CreateIndexNode {
+	return &CreateIndexNode{
+		IndexName: indexName,
+		TableName: tableName,
+		Columns:   columns,
+		Unique:    unique,
+	}
+}
+
+// DropIndexNode DROP INDEX index_name ON table_name
+type DropIndexNode struct {
+	IndexName string
+	TableName string
+}
+
+func NewDropIndexNode(indexName string, tableName string) *DropIndexNode {
+	return &DropIndexNode{
+		IndexName: indexName,
+		TableName: tableName,
+	}
+}
+
 func newInsertNode(tableName string, columns []string, values []interface{}) *InsertNode {
 	return &InsertNode{
 		TableName: tableName,
@@ -62,12 +139,15 @@ func newInsertNode(tableName string, columns []string, values []interface{}) *In
 type SelectNode struct {
 	TableName      string
 	Columns        []*ColumnNode
-	WhereClause    []*BinaryOpNode
-	OrderByColumns []*ColumnNode
+	WhereClause    ASTNode
+	GroupBy        []*ColumnNode
+	Having         ASTNode
+	OrderByColumns []*OrderByNode
 	Join           []*JoinNode
+	Limit          *LimitNode
 }
 
-func NewSelectNode(tableName string, columns []*ColumnNode, whereCause []*BinaryOpNode, orderBy []*ColumnNode, join []*JoinNode) *SelectNode {
+func NewSelectNode(tableName string, columns []*ColumnNode, whereCause ASTNode, orderBy []*OrderByNode, join []*JoinNode) *SelectNode {
 	return &SelectNode{
 		TableName:      tableName,
 		Columns:        columns,
@@ -77,13 +157,67 @@ func NewSelectNode(tableName string, columns []*ColumnNode, whereCause []*Binary
 	}
 }
 
+// OrderByNode ORDER BY 中的一列，Desc 为 true 时降序
+type OrderByNode struct {
+	Column *ColumnNode
+	Desc   bool
+}
+
+func NewOrderByNode(column *ColumnNode, desc bool) *OrderByNode {
+	return &OrderByNode{
+		Column: column,
+		Desc:   desc,
+	}
+}
+
+// LimitNode LIMIT Count [OFFSET Offset]
+type LimitNode struct {
+	Count  uint32
+	Offset uint32
+}
+
+func NewLimitNode(count uint32, offset uint32) *LimitNode {
+	return &LimitNode{
+		Count:  count,
+		Offset: offset,
+	}
+}
+
+// JoinKind 连接的类型
+type JoinKind int
+
+const (
+	InnerJoin JoinKind = iota
+	LeftJoin
+	RightJoin
+	CrossJoin
+)
+
+func (k JoinKind) String() string {
+	switch k {
+	case InnerJoin:
+		return "JOIN"
+	case LeftJoin:
+		return "LEFT JOIN"
+	case RightJoin:
+		return "RIGHT JOIN"
+	case CrossJoin:
+		return "CROSS JOIN"
+	default:
+		return fmt.Sprintf("UNKNOWN_JOIN(%d)", int(k))
+	}
+}
+
+// JoinNode CROSS JOIN 没有 ON 条件，Condition 为 nil
 type JoinNode struct {
+	Kind      JoinKind
 	TableName string
 	Condition ASTNode
 }
 
-func NewJoinNode(tableName string, condition ASTNode) *JoinNode {
+func NewJoinNode(kind JoinKind, tableName string, condition ASTNode) *JoinNode {
 	return &JoinNode{
+		Kind:      kind,
 		TableName: tableName,
 		Condition: condition,
 	}
@@ -99,18 +233,34 @@ func NewLiteralNode(value interface{}) *LiteralNode {
 	}
 }
 
+// ListNode IN (v1, v2, ...) 右侧的字面量列表，保留书写的顺序
+type ListNode struct {
+	Values []*LiteralNode
+}
+
+func NewListNode(values []*LiteralNode) *ListNode {
+	return &ListNode{
+		Values: values,
+	}
+}
+
 type ColumnType int
 
 const (
 	WILDCARDN ColumnType = iota
 	PLAIN_STRING
 	TABLE_NAME_PREFIXED
+	FUNCTION_CALL
 )
 
+// ColumnNode ColumnType 为 FUNCTION_CALL 时表示聚合函数调用，Function 是大写的函数名，
+// Argument 是参数列，COUNT(*) 的参数是通配符列
 type ColumnNode struct {
 	TableName  string
 	ColumnName string
 	ColumnType ColumnType
+	Function   string
+	Argument   *ColumnNode
 }
 
 func NewColumnNode(tableName string, columnName string, columnType ColumnType) *ColumnNode {
@@ -121,9 +271,19 @@ func NewColumnNode(tableName string, columnName string, columnType ColumnType) *
 	}
 }
 
+func NewFunctionColumnNode(function string, argument *ColumnNode) *ColumnNode {
+	return &ColumnNode{
+		ColumnType: FUNCTION_CALL,
+		Function:   function,
+		Argument:   argument,
+	}
+}
+
 type CreateTableNode struct {
 	TableName string
 	Columns   []*ColumnDefinition
+	// PRIMARY KEY (a, b) 声明的主键列，在列上声明主键时为 nil
+	PrimaryKey []string
 }
 
 func NewCreateTableNode(tableName string, columns []*ColumnDefinition) *CreateTableNode {
@@ -141,6 +301,14 @@ func (n *BinaryOpNode) String() string {
 	return fmt.Sprintf("(%v %s %v)", n.Left, n.Operator, n.Right)
 }
 
+// UnaryOpNode
+func (n *UnaryOpNode) String() string {
+	if n == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("(%s %v)", n.Operator, n.Operand)
+}
+
 // IdentifierNode
 func (n *IdentifierNode) String() string {
 	if n == nil {
@@ -156,6 +324,21 @@ func (n *UpdateNode) String() string {
 	return fmt.Sprintf("UPDATE (%s, %s)", n.TableName, n.Columns)
 }
 
+// DeleteNode
+func (n *DeleteNode) String() string {
+	if n == nil {
+		return "<nil>"
+	}
+	var sb strings.Builder
+	sb.WriteString("DELETE FROM ")
+	sb.WriteString(n.TableName)
+	if n.WhereClause != nil {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(n.WhereClause.String())
+	}
+	return sb.String()
+}
+
 // InsertNode
 func (n *InsertNode) String() string {
 	if n == nil {
@@ -220,13 +403,25 @@ func (n *SelectNode) String() string {
 	}
 
 	// Where clause
-	if len(n.WhereClause) > 0 {
+	if n.WhereClause != nil {
 		sb.WriteString(" WHERE ")
-		conditions := make([]string, len(n.WhereClause))
-		for i, cond := range n.WhereClause {
-			conditions[i] = cond.String()
+		sb.WriteString(n.WhereClause.String())
+	}
+
+	// Group by
+	if len(n.GroupBy) > 0 {
+		sb.WriteString(" GROUP BY ")
+		cols := make([]string, len(n.GroupBy))
+		for i, col := range n.GroupBy {
+			cols[i] = col.String()
 		}
-		sb.WriteString(strings.Join(conditions, " AND "))
+		sb.WriteString(strings.Join(cols, ", "))
+	}
+
+	// Having
+	if n.Having != nil {
+		sb.WriteString(" HAVING ")
+		sb.WriteString(n.Having.String())
 	}
 
 	// Order by
@@ -239,15 +434,45 @@ func (n *SelectNode) String() string {
 		sb.WriteString(strings.Join(cols, ", "))
 	}
 
+	if n.Limit != nil {
+		sb.WriteString(" ")
+		sb.WriteString(n.Limit.String())
+	}
+
 	return sb.String()
 }
 
+// LimitNode
+func (n *LimitNode) String() string {
+	if n == nil {
+		return "<nil>"
+	}
+	if n.Offset == 0 {
+		return fmt.Sprintf("LIMIT %d", n.Count)
+	}
+	return fmt.Sprintf("LIMIT %d OFFSET %d", n.Count, n.Offset)
+}
+
+// OrderByNode
+func (n *OrderByNode) String() string {
+	if n == nil {
+		return "<nil>"
+	}
+	if n.Desc {
+		return n.Column.String() + " DESC"
+	}
+	return n.Column.String()
+}
+
 // JoinNode
 func (n *JoinNode) String() string {
 	if n == nil {
 		return "<nil>"
 	}
-	return fmt.Sprintf("JOIN %s ON %v", n.TableName, n.Condition)
+	if n.Condition == nil {
+		return fmt.Sprintf("%v %s", n.Kind, n.TableName)
+	}
+	return fmt.Sprintf("%v %s ON %v", n.Kind, n.TableName, n.Condition)
 }
 
 // LiteralNode
@@ -258,6 +483,18 @@ func (n *LiteralNode) String() string {
 	return fmt.Sprintf("%v", n.Value)
 }
 
+// ListNode
+func (n *ListNode) String() string {
+	if n == nil {
+		return "<nil>"
+	}
+	values := make([]string, len(n.Values))
+	for i, value := range n.Values {
+		values[i] = value.String()
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
+
 // ColumnNode
 func (n *ColumnNode) String() string {
 	if n == nil {
@@ -270,11 +507,49 @@ func (n *ColumnNode) String() string {
 		return n.ColumnName
 	case TABLE_NAME_PREFIXED:
 		return fmt.Sprintf("%s.%s", n.TableName, n.ColumnName)
+	case FUNCTION_CALL:
+		return fmt.Sprintf("%s(%v)", n.Function, n.Argument)
 	default:
 		return fmt.Sprintf("UNKNOWN_COLUMN_TYPE(%s.%s)", n.TableName, n.ColumnName)
 	}
 }
 
+// AnalyzeNode
+func (n *AnalyzeNode) String() string {
+	if n == nil {
+		return "<nil>"
+	}
+	return "ANALYZE " + n.TableName
+}
+
+// ExplainNode
+func (n *ExplainNode) String() string {
+	if n == nil {
+		return "<nil>"
+	}
+	return "EXPLAIN " + n.Statement.String()
+}
+
+// CreateIndexNode
+func (n *CreateIndexNode) String() string {
+	if n == nil {
+		return "<nil>"
+	}
+	unique := ""
+	if n.Unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, n.IndexName, n.TableName, strings.Join(n.Columns, ", "))
+}
+
+// DropIndexNode
+func (n *DropIndexNode) String() string {
+	if n == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("DROP INDEX %s ON %s", n.IndexName, n.TableName)
+}
+
 // CreateTableNode
 func (n *CreateTableNode) String() string {
 	if n == nil {
@@ -290,6 +565,9 @@ func (n *CreateTableNode) String() string {
 		cols[i] = "  " + col.String()
 	}
 
+	if len(n.PrimaryKey) > 0 {
+		cols = append(cols, "  PRIMARY KEY ("+strings.Join(n.PrimaryKey, ", ")+")")
+	}
 	sb.WriteString(strings.Join(cols, ",\n"))
 	sb.WriteString("\n)")
 
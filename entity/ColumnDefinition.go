@@ -15,6 +15,8 @@ type ColumnDefinition struct {
 	Name      string    `json:"name"`
 	DataType  DataType  `json:"dataType"`
 	IndexType IndexType `json:"indexType"`
+	// 建表时声明为 UNIQUE 的列，通过唯一的二级索引保证取值不重复
+	Unique bool `json:"unique,omitempty"`
 }
 
 type IndexType int
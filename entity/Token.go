@@ -15,9 +15,18 @@ const (
 	FROM
 	WHERE
 	JOIN
+	LEFT_JOIN
+	RIGHT_JOIN
+	CROSS_JOIN
 	ON
 	VALUES
+	GROUP_BY
+	HAVING
 	ORDER_BY
+	ASC
+	DESC
+	LIMIT
+	OFFSET
 	INSERT_INTO
 	CREATE_TABLE
 	PRIMARY_KEY
@@ -32,11 +41,26 @@ const (
 	STRING
 	INT
 	CHAR
+	VARCHAR
 	EQUALS
+	NOT_EQUALS
+	LESS_THAN
+	LESS_EQUALS
+	GREATER_THAN
+	GREATER_EQUALS
+	BETWEEN
 	AND
+	OR
+	NOT
 	IN
 	UPDATE
 	SET
+	DELETE_FROM
+	ANALYZE
+	EXPLAIN
+	CREATE
+	DROP
+	UNIQUE
 	ILLEGAL
 	EOF
 )
@@ -68,12 +92,30 @@ func (t TokenType) String() string {
 		return "WHERE"
 	case JOIN:
 		return "JOIN"
+	case LEFT_JOIN:
+		return "LEFT_JOIN"
+	case RIGHT_JOIN:
+		return "RIGHT_JOIN"
+	case CROSS_JOIN:
+		return "CROSS_JOIN"
 	case ON:
 		return "ON"
 	case VALUES:
 		return "VALUES"
+	case GROUP_BY:
+		return "GROUP_BY"
+	case HAVING:
+		return "HAVING"
 	case ORDER_BY:
 		return "ORDER_BY"
+	case ASC:
+		return "ASC"
+	case DESC:
+		return "DESC"
+	case LIMIT:
+		return "LIMIT"
+	case OFFSET:
+		return "OFFSET"
 	case INSERT_INTO:
 		return "INSERT_INTO"
 	case CREATE_TABLE:
@@ -100,16 +142,46 @@ func (t TokenType) String() string {
 		return "INT"
 	case CHAR:
 		return "CHAR"
+	case VARCHAR:
+		return "VARCHAR"
 	case EQUALS:
 		return "EQUALS"
+	case NOT_EQUALS:
+		return "NOT_EQUALS"
+	case LESS_THAN:
+		return "LESS_THAN"
+	case LESS_EQUALS:
+		return "LESS_EQUALS"
+	case GREATER_THAN:
+		return "GREATER_THAN"
+	case GREATER_EQUALS:
+		return "GREATER_EQUALS"
+	case BETWEEN:
+		return "BETWEEN"
 	case AND:
 		return "AND"
+	case OR:
+		return "OR"
+	case NOT:
+		return "NOT"
 	case IN:
 		return "IN"
 	case UPDATE:
 		return "UPDATE"
 	case SET:
 		return "SET"
+	case DELETE_FROM:
+		return "DELETE_FROM"
+	case ANALYZE:
+		return "ANALYZE"
+	case EXPLAIN:
+		return "EXPLAIN"
+	case CREATE:
+		return "CREATE"
+	case DROP:
+		return "DROP"
+	case UNIQUE:
+		return "UNIQUE"
 	case ILLEGAL:
 		return "ILLEGAL"
 	case EOF:
@@ -134,6 +206,8 @@ func (t *TokenType) UnmarshalJSON(data []byte) error {
 		*t = INT
 	case "CHAR":
 		*t = CHAR
+	case "VARCHAR":
+		*t = VARCHAR
 	case "STRING":
 		*t = STRING
 	// 如果需要支持其他数据类型，在这里添加
@@ -148,7 +222,7 @@ func (t *TokenType) UnmarshalJSON(data []byte) error {
 func (t TokenType) MarshalJSON() ([]byte, error) {
 	// 只序列化数据类型相关的 Token
 	switch t {
-	case INT, CHAR, STRING:
+	case INT, CHAR, VARCHAR, STRING:
 		return json.Marshal(t.String())
 	default:
 		return nil, fmt.Errorf("token type %s cannot be used as data type", t)
@@ -158,7 +232,17 @@ func (t TokenType) MarshalJSON() ([]byte, error) {
 // 添加辅助函数，用于检查是否是有效的数据类型
 func (t TokenType) IsDataType() bool {
 	switch t {
-	case INT, CHAR, STRING:
+	case INT, CHAR, VARCHAR, STRING:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsComparison 判断是否是比较运算符
+func (t TokenType) IsComparison() bool {
+	switch t {
+	case EQUALS, NOT_EQUALS, LESS_THAN, LESS_EQUALS, GREATER_THAN, GREATER_EQUALS:
 		return true
 	default:
 		return false
@@ -8,6 +8,18 @@ package entity
 type SqlTableDefinition struct {
 	TableName string              `json:"tableName"`
 	Columns   []*ColumnDefinition `json:"columns"`
+	// PRIMARY KEY (a, b) 声明的多列主键，按声明的顺序；在列上声明的单列主键只记录在列定义中
+	PrimaryKey []string `json:"primaryKey,omitempty"`
+	// CREATE INDEX 创建的二级索引，建表时用 INDEX 声明的索引只记录在列定义中
+	Indexes []*IndexDefinition `json:"indexes,omitempty"`
+}
+
+// IndexDefinition 一个命名的二级索引，单列索引的列的 IndexType 同时为 Secondary
+// 多列索引的键依次由 Columns 中的列组成，只记录在这里
+type IndexDefinition struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
 }
 
 func NewSqlTableDefinition(tableName string, columns []*ColumnDefinition) *SqlTableDefinition {
@@ -20,3 +32,74 @@ func NewSqlTableDefinition(tableName string, columns []*ColumnDefinition) *SqlTa
 func (sd *SqlTableDefinition) String() string {
 	return sd.TableName
 }
+
+// GetColumn 按列名查找列定义，不存在时返回 nil
+func (sd *SqlTableDefinition) GetColumn(name string) *ColumnDefinition {
+	for _, column := range sd.Columns {
+		if column.Name == name {
+			return column
+		}
+	}
+	return nil
+}
+
+// GetIndex 按索引名查找 CREATE INDEX 创建的索引，不存在时返回 nil
+func (sd *SqlTableDefinition) GetIndex(name string) *IndexDefinition {
+	for _, index := range sd.Indexes {
+		if index.Name == name {
+			return index
+		}
+	}
+	return nil
+}
+
+// PrimaryKeyColumns 返回主键依次包含的列，没有主键时返回 nil
+func (sd *SqlTableDefinition) PrimaryKeyColumns() []string {
+	if len(sd.PrimaryKey) > 0 {
+		return sd.PrimaryKey
+	}
+	for _, column := range sd.Columns {
+		if column.IndexType == Primary {
+			return []string{column.Name}
+		}
+	}
+	return nil
+}
+
+// SecondaryIndexes 返回所有二级索引的列：先按列的顺序列出单列索引，再按创建的顺序列出多列索引
+func (sd *SqlTableDefinition) SecondaryIndexes() [][]string {
+	indexes := make([][]string, 0)
+	for _, column := range sd.Columns {
+		if column.IndexType == Secondary {
+			indexes = append(indexes, []string{column.Name})
+		}
+	}
+	for _, index := range sd.Indexes {
+		if len(index.Columns) > 1 {
+			indexes = append(indexes, index.Columns)
+		}
+	}
+	return indexes
+}
+
+// UniqueKeys 返回所有唯一约束的列：UNIQUE 列和每个唯一索引各是一个约束，不包含主键
+func (sd *SqlTableDefinition) UniqueKeys() [][]string {
+	keys := make([][]string, 0)
+	for _, column := range sd.Columns {
+		if column.Unique {
+			keys = append(keys, []string{column.Name})
+		}
+	}
+	for _, index := range sd.Indexes {
+		if !index.Unique {
+			continue
+		}
+		if len(index.Columns) == 1 {
+			if column := sd.GetColumn(index.Columns[0]); column != nil && column.Unique {
+				continue
+			}
+		}
+		keys = append(keys, index.Columns)
+	}
+	return keys
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"encoding/binary"
 	"fmt"
 	"godb/disktree"
 	"godb/logger"
@@ -56,7 +57,7 @@ func useBP() {
 
 	// 插入数据并打印树的状态
 	for k, v := range testData {
-		tree.Insert(k, []byte(v))
+		tree.Insert(binary.BigEndian.AppendUint32(nil, k), []byte(v))
 		fmt.Printf("\n插入 %d:%s 后的树结构:\n", k, v)
 		tree.Print()
 	}
@@ -64,11 +65,11 @@ func useBP() {
 	// 搜索测试
 	fmt.Println("\n搜索测试:")
 	for k := 1; k <= 10; k++ {
-		if v, found := tree.Search(uint32(k)); found {
+		if v, found, _ := tree.Search(binary.BigEndian.AppendUint32(nil, uint32(k))); found {
 			fmt.Printf("找到键 %d，值为: %s\n", k, v)
 		}
 	}
-	search, _ := tree.Search(3)
+	search, _, _ := tree.Search(binary.BigEndian.AppendUint32(nil, 3))
 	fmt.Println("search:", search)
 
 	db := disktree.NewSimpleDB("users.db")
@@ -0,0 +1,20 @@
+package sqlparser
+
+import "fmt"
+
+// @Title        errors.go
+// @Description  errors reported while lexing and parsing sql
+
+// SyntaxError SQL 语法错误，Position 是出错 token 在原始 SQL 中的字符偏移
+type SyntaxError struct {
+	Position int
+	Near     string
+	Message  string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Near == "" {
+		return fmt.Sprintf("syntax error at position %d: %s", e.Position, e.Message)
+	}
+	return fmt.Sprintf("syntax error at position %d near %q: %s", e.Position, e.Near, e.Message)
+}
@@ -9,9 +9,11 @@ import (
 )
 
 type SQLLexer struct {
-	input    []rune // 用 rune 切片存储字符
-	position int
-	ch       rune // 用 rune 存储当前字符
+	input     []rune // 用 rune 切片存储字符
+	position  int
+	ch        rune  // 用 rune 存储当前字符
+	start     int   // 当前 token 在 input 中的起始位置
+	positions []int // tokenize 得到的每个 token 的起始位置，用于报告语法错误
 }
 
 func NewLexer(input string) *SQLLexer {
@@ -25,6 +27,7 @@ func (l *SQLLexer) tokenize() []Token {
 	for {
 		token := l.NextToken()
 		tokens = append(tokens, token)
+		l.positions = append(l.positions, l.start)
 
 		if token.Type == EOF {
 			break
@@ -35,6 +38,7 @@ func (l *SQLLexer) tokenize() []Token {
 
 func (l *SQLLexer) NextToken() Token {
 	l.skipWhitespace()
+	l.start = min(l.position-1, len(l.input))
 
 	if l.ch == 0 {
 		return NewToken(EOF, "")
@@ -55,9 +59,39 @@ func (l *SQLLexer) NextToken() Token {
 	case '=':
 		l.readChar()
 		return NewToken(EQUALS, "=")
+	case '<':
+		l.readChar()
+		if l.ch == '=' {
+			l.readChar()
+			return NewToken(LESS_EQUALS, "<=")
+		}
+		if l.ch == '>' {
+			l.readChar()
+			return NewToken(NOT_EQUALS, "<>")
+		}
+		return NewToken(LESS_THAN, "<")
+	case '>':
+		l.readChar()
+		if l.ch == '=' {
+			l.readChar()
+			return NewToken(GREATER_EQUALS, ">=")
+		}
+		return NewToken(GREATER_THAN, ">")
+	case '!':
+		l.readChar()
+		if l.ch == '=' {
+			l.readChar()
+			return NewToken(NOT_EQUALS, "!=")
+		}
+		// 单独的 ! 不是合法的运算符
+		return NewToken(ILLEGAL, "!")
 	case '*':
 		l.readChar()
 		return NewToken(WILDCARD, "*")
+	case ';':
+		// 语句结束符，忽略
+		l.readChar()
+		return l.NextToken()
 	case '\'', '"':
 		return l.readString()
 	default:
@@ -67,9 +101,10 @@ func (l *SQLLexer) NextToken() Token {
 		if isDigit(l.ch) {
 			return l.readNumber()
 		}
-		// 对于无法识别的字符，直接跳过并继续读取下一个字符
+		// 无法识别的字符交给 parser 报告语法错误
+		illegal := string(l.ch)
 		l.readChar()
-		return l.NextToken()
+		return NewToken(ILLEGAL, illegal)
 	}
 }
 
@@ -96,6 +131,10 @@ func (l *SQLLexer) readKeywordOrIdent() Token {
 			if l.tryReadNextWord("BY") {
 				return NewToken(ORDER_BY, "ORDER BY")
 			}
+		case "GROUP":
+			if l.tryReadNextWord("BY") {
+				return NewToken(GROUP_BY, "GROUP BY")
+			}
 		case "INSERT":
 			if l.tryReadNextWord("INTO") {
 				return NewToken(INSERT_INTO, "INSERT INTO")
@@ -108,6 +147,38 @@ func (l *SQLLexer) readKeywordOrIdent() Token {
 			if l.tryReadNextWord("KEY") {
 				return NewToken(PRIMARY_KEY, "PRIMARY KEY")
 			}
+		case "DELETE":
+			if l.tryReadNextWord("FROM") {
+				return NewToken(DELETE_FROM, "DELETE FROM")
+			}
+		case "LEFT":
+			if l.tryReadNextWord("JOIN") {
+				return NewToken(LEFT_JOIN, "LEFT JOIN")
+			}
+			if l.tryReadNextWord("OUTER") {
+				if l.tryReadNextWord("JOIN") {
+					return NewToken(LEFT_JOIN, "LEFT OUTER JOIN")
+				}
+				return NewToken(ILLEGAL, "LEFT OUTER")
+			}
+		case "RIGHT":
+			if l.tryReadNextWord("JOIN") {
+				return NewToken(RIGHT_JOIN, "RIGHT JOIN")
+			}
+			if l.tryReadNextWord("OUTER") {
+				if l.tryReadNextWord("JOIN") {
+					return NewToken(RIGHT_JOIN, "RIGHT OUTER JOIN")
+				}
+				return NewToken(ILLEGAL, "RIGHT OUTER")
+			}
+		case "CROSS":
+			if l.tryReadNextWord("JOIN") {
+				return NewToken(CROSS_JOIN, "CROSS JOIN")
+			}
+		case "ANALYZE":
+			if l.tryReadNextWord("TABLE") {
+				return NewToken(ANALYZE, "ANALYZE TABLE")
+			}
 		}
 	}
 
@@ -125,20 +196,48 @@ func (l *SQLLexer) readKeywordOrIdent() Token {
 		return NewToken(ON, word)
 	case "VALUES":
 		return NewToken(VALUES, word)
+	case "HAVING":
+		return NewToken(HAVING, word)
+	case "ASC":
+		return NewToken(ASC, word)
+	case "DESC":
+		return NewToken(DESC, word)
+	case "LIMIT":
+		return NewToken(LIMIT, word)
+	case "OFFSET":
+		return NewToken(OFFSET, word)
 	case "AND":
 		return NewToken(AND, word)
+	case "OR":
+		return NewToken(OR, word)
+	case "NOT":
+		return NewToken(NOT, word)
 	case "IN":
 		return NewToken(IN, word)
+	case "BETWEEN":
+		return NewToken(BETWEEN, word)
 	case "INT":
 		return NewToken(INT, word)
 	case "CHAR":
 		return NewToken(CHAR, word)
+	case "VARCHAR":
+		return NewToken(VARCHAR, word)
 	case "INDEX":
 		return NewToken(INDEX, word)
 	case "UPDATE":
 		return NewToken(UPDATE, word)
 	case "SET":
 		return NewToken(SET, word)
+	case "ANALYZE":
+		return NewToken(ANALYZE, word)
+	case "EXPLAIN":
+		return NewToken(EXPLAIN, word)
+	case "CREATE":
+		return NewToken(CREATE, word)
+	case "DROP":
+		return NewToken(DROP, word)
+	case "UNIQUE":
+		return NewToken(UNIQUE, word)
 	default:
 		return NewToken(IDENTIFIER, word)
 	}
@@ -181,7 +280,8 @@ func (l *SQLLexer) readString() Token {
 		l.readChar()
 		return NewToken(STRING, str)
 	}
-	return NewToken(EOF, "")
+	// 字符串没有闭合
+	return NewToken(ILLEGAL, string(l.input[position-1:]))
 }
 
 func (l *SQLLexer) readNumber() Token {
@@ -15,6 +15,12 @@ func TestLexer_BasicTokens(t *testing.T) {
 		{"(", entity.Token{Type: entity.LEFT_PARENTHESIS, Value: "("}},
 		{")", entity.Token{Type: entity.RIGHT_PARENTHESIS, Value: ")"}},
 		{"=", entity.Token{Type: entity.EQUALS, Value: "="}},
+		{"!=", entity.Token{Type: entity.NOT_EQUALS, Value: "!="}},
+		{"<>", entity.Token{Type: entity.NOT_EQUALS, Value: "<>"}},
+		{"<", entity.Token{Type: entity.LESS_THAN, Value: "<"}},
+		{"<=", entity.Token{Type: entity.LESS_EQUALS, Value: "<="}},
+		{">", entity.Token{Type: entity.GREATER_THAN, Value: ">"}},
+		{">=", entity.Token{Type: entity.GREATER_EQUALS, Value: ">="}},
 	}
 
 	for _, tt := range tests {
@@ -40,6 +46,22 @@ func TestLexer_Keywords(t *testing.T) {
 		{"CREATE TABLE", entity.Token{Type: entity.CREATE_TABLE, Value: "CREATE TABLE"}},
 		{"ORDER BY", entity.Token{Type: entity.ORDER_BY, Value: "ORDER BY"}},
 		{"PRIMARY KEY", entity.Token{Type: entity.PRIMARY_KEY, Value: "PRIMARY KEY"}},
+		{"DELETE FROM", entity.Token{Type: entity.DELETE_FROM, Value: "DELETE FROM"}},
+		{"BETWEEN", entity.Token{Type: entity.BETWEEN, Value: "BETWEEN"}},
+		{"LEFT JOIN", entity.Token{Type: entity.LEFT_JOIN, Value: "LEFT JOIN"}},
+		{"LEFT OUTER JOIN", entity.Token{Type: entity.LEFT_JOIN, Value: "LEFT OUTER JOIN"}},
+		{"RIGHT JOIN", entity.Token{Type: entity.RIGHT_JOIN, Value: "RIGHT JOIN"}},
+		{"CROSS JOIN", entity.Token{Type: entity.CROSS_JOIN, Value: "CROSS JOIN"}},
+		{"ASC", entity.Token{Type: entity.ASC, Value: "ASC"}},
+		{"DESC", entity.Token{Type: entity.DESC, Value: "DESC"}},
+		{"LIMIT", entity.Token{Type: entity.LIMIT, Value: "LIMIT"}},
+		{"OFFSET", entity.Token{Type: entity.OFFSET, Value: "OFFSET"}},
+		{"ANALYZE", entity.Token{Type: entity.ANALYZE, Value: "ANALYZE"}},
+		{"ANALYZE TABLE", entity.Token{Type: entity.ANALYZE, Value: "ANALYZE TABLE"}},
+		{"EXPLAIN", entity.Token{Type: entity.EXPLAIN, Value: "EXPLAIN"}},
+		{"CREATE INDEX", entity.Token{Type: entity.CREATE, Value: "CREATE"}},
+		{"DROP", entity.Token{Type: entity.DROP, Value: "DROP"}},
+		{"UNIQUE", entity.Token{Type: entity.UNIQUE, Value: "UNIQUE"}},
 	}
 
 	for _, tt := range tests {
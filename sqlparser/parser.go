@@ -1,7 +1,6 @@
 package sqlparser
 
 import (
-	"errors"
 	"fmt"
 	. "godb/entity"
 	"strconv"
@@ -14,18 +13,20 @@ import (
 // @Update       2024-12-26 17:16
 
 type SQLParser struct {
-	tokens   []Token // 用 rune 切片存储字符
-	position int
+	tokens    []Token // 用 rune 切片存储字符
+	positions []int   // 每个 token 在原始 SQL 中的位置
+	position  int
 }
 
 func NewSQLParser(tokens []Token) *SQLParser {
-	return &SQLParser{tokens, 0}
+	return &SQLParser{tokens: tokens}
 }
 
 func Parse(sql string) (ASTNode, error) {
 	lexer := NewLexer(sql)
 	tokens := lexer.tokenize()
 	sqlparser := NewSQLParser(tokens)
+	sqlparser.positions = lexer.positions
 	return sqlparser.parse()
 }
 
@@ -33,18 +34,41 @@ func (p *SQLParser) peek() Token {
 	if p.position < len(p.tokens) {
 		return p.tokens[p.position]
 	}
-	return Token{EOF, ""}
+	return Token{Type: EOF}
+}
+
+// peekAt 查看当前位置之后第 offset 个 token
+func (p *SQLParser) peekAt(offset int) Token {
+	if p.position+offset < len(p.tokens) {
+		return p.tokens[p.position+offset]
+	}
+	return Token{Type: EOF}
 }
 
 func (p *SQLParser) next() {
 	p.position++
 }
 
-func (p *SQLParser) consume(typ TokenType) {
+func (p *SQLParser) consume(typ TokenType) error {
 	if p.peek().Type == typ {
 		p.next()
-	} else {
-		panic(fmt.Sprintf("expect %v but got %v", typ, p.peek().Type))
+		return nil
+	}
+	return p.errorf("expect %v but got %v", typ, p.peek().Type)
+}
+
+// errorf 生成指向当前 token 的语法错误
+func (p *SQLParser) errorf(format string, args ...interface{}) error {
+	position := 0
+	if p.position < len(p.positions) {
+		position = p.positions[p.position]
+	} else if len(p.positions) > 0 {
+		position = p.positions[len(p.positions)-1]
+	}
+	return &SyntaxError{
+		Position: position,
+		Near:     p.peek().Value,
+		Message:  fmt.Sprintf(format, args...),
 	}
 }
 
@@ -56,24 +80,49 @@ func (p *SQLParser) match(typ TokenType) bool {
 }
 
 func (p *SQLParser) parse() (ASTNode, error) {
+	var node ASTNode
+	var err error
+
 	token := p.peek()
 	switch token.Type {
 	case SELECT:
-		return p.parseSelect()
+		node, err = p.parseSelect()
 	case INSERT_INTO:
-		return p.parseInsert(), nil
+		node, err = p.parseInsert()
 	case CREATE_TABLE:
-		return p.parseCreateTable(), nil
+		node, err = p.parseCreateTable()
 	case UPDATE:
-		return p.parseUpdate(), nil
+		node, err = p.parseUpdate()
+	case DELETE_FROM:
+		node, err = p.parseDelete()
+	case ANALYZE:
+		node, err = p.parseAnalyze()
+	case EXPLAIN:
+		node, err = p.parseExplain()
+	case CREATE:
+		node, err = p.parseCreateIndex()
+	case DROP:
+		node, err = p.parseDropIndex()
 	default:
-		return nil, fmt.Errorf("unsupported SQL statement: %v", token)
+		return nil, p.errorf("unsupported SQL statement")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 语句解析完后不能有多余的 token
+	if !p.match(EOF) {
+		return nil, p.errorf("unexpected %v after end of statement", p.peek().Type)
 	}
+	return node, nil
 }
 
-// SELECT column1, column2, column3, ... FROM table_name [JOIN table_name ON condition] [WHERE condition] [ORDER BY column1, column2, column3, ...];
+// SELECT column1, column2, column3, ... FROM table_name [JOIN table_name ON condition] [WHERE condition]
+// [GROUP BY column1, ...] [HAVING condition] [ORDER BY column1, column2, column3, ...] [LIMIT n [OFFSET m]];
 func (p *SQLParser) parseSelect() (*SelectNode, error) {
-	p.consume(SELECT)
+	if err := p.consume(SELECT); err != nil {
+		return nil, err
+	}
 
 	// columnlist parse
 	columns, err := p.parseColumnList()
@@ -82,9 +131,9 @@ func (p *SQLParser) parseSelect() (*SelectNode, error) {
 	}
 
 	if !p.match(FROM) {
-		return nil, fmt.Errorf("expected FROM clause after SELECT")
+		return nil, p.errorf("expected FROM clause after SELECT")
 	}
-	p.consume(FROM)
+	p.next()
 
 	// tablename parse
 	tablename, err := p.parsePlainString()
@@ -94,14 +143,14 @@ func (p *SQLParser) parseSelect() (*SelectNode, error) {
 
 	// join ?
 	var joins []*JoinNode
-	if p.match(JOIN) {
+	if p.matchJoin() {
 		joins, err = p.parseJoin()
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	var wheres []*BinaryOpNode
+	var wheres ASTNode
 	if p.match(WHERE) {
 		p.next()
 		wheres, err = p.parseWhereCondition()
@@ -110,16 +159,44 @@ func (p *SQLParser) parseSelect() (*SelectNode, error) {
 		}
 	}
 
-	var orderColumns []*ColumnNode
+	var groupBy []*ColumnNode
+	if p.match(GROUP_BY) {
+		p.next()
+		groupBy, err = p.parseGroupBy()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var having ASTNode
+	if p.match(HAVING) {
+		p.next()
+		having, err = p.parseWhereCondition()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var orderColumns []*OrderByNode
 	if p.match(ORDER_BY) {
 		p.next()
-		orderColumns, err = p.parseColumnList()
+		orderColumns, err = p.parseOrderBy()
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	return NewSelectNode(tablename, columns, wheres, orderColumns, joins), err
+	selectNode := NewSelectNode(tablename, columns, wheres, orderColumns, joins)
+	selectNode.GroupBy = groupBy
+	selectNode.Having = having
+	if p.match(LIMIT) {
+		p.next()
+		selectNode.Limit, err = p.parseLimit()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return selectNode, nil
 }
 
 func (p *SQLParser) parseColumnList() ([]*ColumnNode, error) {
@@ -131,7 +208,7 @@ func (p *SQLParser) parseColumnList() ([]*ColumnNode, error) {
 		for {
 			column, err := p.parseColumn()
 			if err != nil {
-
+				return nil, err
 			}
 			columnList = append(columnList, column)
 			if p.match(COMMA) {
@@ -142,17 +219,88 @@ func (p *SQLParser) parseColumnList() ([]*ColumnNode, error) {
 			}
 		}
 	}
-	if columnList[0] == nil {
-		return nil, fmt.Errorf("no columns specified")
+	return columnList, nil
+}
+
+// parseLimit 解析 LIMIT 之后的 n [OFFSET m]
+func (p *SQLParser) parseLimit() (*LimitNode, error) {
+	count, err := p.parseUint32()
+	if err != nil {
+		return nil, err
 	}
+	offset := uint32(0)
+	if p.match(OFFSET) {
+		p.next()
+		offset, err = p.parseUint32()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return NewLimitNode(count, offset), nil
+}
 
-	return columnList, nil
+// parseUint32 解析一个非负整数
+func (p *SQLParser) parseUint32() (uint32, error) {
+	if !p.match(INTEGER) {
+		return 0, p.errorf("expected integer but got %v", p.peek().Type)
+	}
+	value, err := strconv.ParseUint(p.peek().Value, 10, 32)
+	if err != nil {
+		return 0, p.errorf("Invalid integer value: %s", p.peek().Value)
+	}
+	p.next()
+	return uint32(value), nil
+}
+
+// parseGroupBy 解析 GROUP BY 之后的列列表，分组列不能是聚合函数
+func (p *SQLParser) parseGroupBy() ([]*ColumnNode, error) {
+	groupBy := []*ColumnNode{}
+	for {
+		column, err := p.parseColumn()
+		if err != nil {
+			return nil, err
+		}
+		if column.ColumnType == FUNCTION_CALL {
+			return nil, p.errorf("aggregate function %s is not allowed in GROUP BY", column)
+		}
+		groupBy = append(groupBy, column)
+		if !p.match(COMMA) {
+			return groupBy, nil
+		}
+		p.next()
+	}
+}
+
+// parseOrderBy 解析 ORDER BY 之后的 col [ASC|DESC], ... 列表，默认升序
+func (p *SQLParser) parseOrderBy() ([]*OrderByNode, error) {
+	orderBy := []*OrderByNode{}
+	for {
+		column, err := p.parseColumn()
+		if err != nil {
+			return nil, err
+		}
+		desc := false
+		if p.match(ASC) {
+			p.next()
+		} else if p.match(DESC) {
+			p.next()
+			desc = true
+		}
+		orderBy = append(orderBy, NewOrderByNode(column, desc))
+		if !p.match(COMMA) {
+			return orderBy, nil
+		}
+		p.next()
+	}
 }
 
 func (p *SQLParser) parseColumn() (*ColumnNode, error) {
 	if p.match(IDENTIFIER) {
 		identifier := p.peek().Value
 		p.next()
+		if p.match(LEFT_PARENTHESIS) {
+			return p.parseFunctionCall(identifier)
+		}
 		if strings.Contains(identifier, ".") {
 			parts := strings.Split(identifier, ".")
 			return NewColumnNode(parts[0], parts[1], TABLE_NAME_PREFIXED), nil
@@ -160,35 +308,102 @@ func (p *SQLParser) parseColumn() (*ColumnNode, error) {
 			return NewColumnNode("", identifier, PLAIN_STRING), nil
 		}
 	} else {
-		return nil, fmt.Errorf("Expected identifier but got %v", p.peek().Type)
+		return nil, p.errorf("Expected identifier but got %v", p.peek().Type)
 	}
 }
 
+// aggregateFunctions 支持的聚合函数
+var aggregateFunctions = map[string]bool{
+	"COUNT": true,
+	"SUM":   true,
+	"MIN":   true,
+	"MAX":   true,
+	"AVG":   true,
+}
+
+// parseFunctionCall 解析函数名之后的 (column) 或 (*)，只有 COUNT 可以使用 *
+func (p *SQLParser) parseFunctionCall(name string) (*ColumnNode, error) {
+	function := strings.ToUpper(name)
+	if !aggregateFunctions[function] {
+		return nil, p.errorf("unknown function %s", name)
+	}
+	if err := p.consume(LEFT_PARENTHESIS); err != nil {
+		return nil, err
+	}
+
+	var argument *ColumnNode
+	if p.match(WILDCARD) {
+		if function != "COUNT" {
+			return nil, p.errorf("%s(*) is not supported", function)
+		}
+		p.next()
+		argument = NewColumnNode("*", "", WILDCARDN)
+	} else {
+		if !p.match(IDENTIFIER) {
+			return nil, p.errorf("Expected column in %s() but got %v", function, p.peek().Type)
+		}
+		column, err := p.parseColumn()
+		if err != nil {
+			return nil, err
+		}
+		if column.ColumnType == FUNCTION_CALL {
+			return nil, p.errorf("nested function call in %s()", function)
+		}
+		argument = column
+	}
+
+	if err := p.consume(RIGHT_PARENTHESIS); err != nil {
+		return nil, err
+	}
+	return NewFunctionColumnNode(function, argument), nil
+}
+
 func (p *SQLParser) parsePlainString() (string, error) {
 	if p.match(IDENTIFIER) {
 		identifier := p.peek().Value
 		p.next()
 		return identifier, nil
 	} else {
-		return "", fmt.Errorf("Expected identifier but got %v", p.peek().Type)
+		return "", p.errorf("Expected identifier but got %v", p.peek().Type)
 	}
 }
 
+// joinKinds 连接关键字对应的连接类型
+var joinKinds = map[TokenType]JoinKind{
+	JOIN:       InnerJoin,
+	LEFT_JOIN:  LeftJoin,
+	RIGHT_JOIN: RightJoin,
+	CROSS_JOIN: CrossJoin,
+}
+
+func (p *SQLParser) matchJoin() bool {
+	_, ok := joinKinds[p.peek().Type]
+	return ok
+}
+
 func (p *SQLParser) parseJoin() ([]*JoinNode, error) {
 	joins := []*JoinNode{}
 
-	for p.match(JOIN) {
+	for p.matchJoin() {
+		kind := joinKinds[p.peek().Type]
 		p.next()
 		plainString, err := p.parsePlainString()
 		if err != nil {
 			return nil, err
 		}
-		p.consume(ON)
-		condition, err := p.parseExpression()
+		// CROSS JOIN 没有连接条件
+		if kind == CrossJoin {
+			joins = append(joins, NewJoinNode(kind, plainString, nil))
+			continue
+		}
+		if err := p.consume(ON); err != nil {
+			return nil, err
+		}
+		condition, err := p.parseWhereCondition()
 		if err != nil {
 			return nil, err
 		}
-		joins = append(joins, &JoinNode{plainString, condition})
+		joins = append(joins, NewJoinNode(kind, plainString, condition))
 	}
 	return joins, nil
 }
@@ -196,21 +411,49 @@ func (p *SQLParser) parseJoin() ([]*JoinNode, error) {
 func (p *SQLParser) parseExpression() (*BinaryOpNode, error) {
 	left, err := p.parseColumnOrLiteralOrSubquery()
 	if err != nil {
-		return nil, fmt.Errorf("incomplete where clause")
+		return nil, err
 	}
-	if p.match(EQUALS) {
+	if operator := p.peek().Type; operator.IsComparison() {
 		p.next()
 		right, err := p.parseColumnOrLiteralOrSubquery()
 		if err != nil {
+			return nil, err
+		}
+		node := NewBinaryOpNode(operator, left, right)
+		return node, nil
+	} else if p.match(BETWEEN) {
+		// BETWEEN low AND high 解析为 (left BETWEEN (low AND high))
+		p.next()
+		low, err := p.parseColumnOrLiteralOrSubquery()
+		if err != nil {
+			return nil, err
+		}
+		if !p.match(AND) {
+			return nil, p.errorf("Expected AND in BETWEEN but got %s", p.peek().Type)
 		}
-		node := NewBinaryOpNode(EQUALS, left, right)
+		p.next()
+		high, err := p.parseColumnOrLiteralOrSubquery()
+		if err != nil {
+			return nil, err
+		}
+		node := NewBinaryOpNode(BETWEEN, left, NewBinaryOpNode(AND, low, high))
 		return node, nil
 	} else if p.match(IN) {
-		right := p.parseSubquery()
+		// IN (SELECT ...) 是子查询，否则是字面量列表
+		p.next()
+		var right ASTNode
+		if p.peekAt(1).Type == SELECT {
+			right, err = p.parseSubquery()
+		} else {
+			right, err = p.parseLiteralList()
+		}
+		if err != nil {
+			return nil, err
+		}
 		node := NewBinaryOpNode(IN, left, right)
 		return node, nil
 	} else {
-		return nil, fmt.Errorf("Expected = or IN but got %s", p.peek().Type)
+		return nil, p.errorf("Expected comparison operator, BETWEEN or IN but got %s", p.peek().Type)
 	}
 }
 
@@ -218,7 +461,10 @@ func (p *SQLParser) parseColumnOrLiteralOrSubquery() (ASTNode, error) {
 	if p.peek().Type == IDENTIFIER {
 		return p.parseColumn()
 	} else if p.match(INTEGER) {
-		value, _ := strconv.Atoi(p.peek().Value)
+		value, err := strconv.ParseUint(p.peek().Value, 10, 32)
+		if err != nil {
+			return nil, p.errorf("Invalid integer value: %s", p.peek().Value)
+		}
 		literal := NewLiteralNode(uint32(value))
 		p.next()
 		return literal, nil
@@ -227,67 +473,166 @@ func (p *SQLParser) parseColumnOrLiteralOrSubquery() (ASTNode, error) {
 		p.next()
 		return literal, nil
 	} else if p.match(LEFT_PARENTHESIS) {
-		return p.parseSubquery(), nil
+		return p.parseSubquery()
 	} else {
-		return nil, fmt.Errorf("expected IDENTIFIER, INTEGER, STRING, or subquery, got %v", p.peek().Type)
+		return nil, p.errorf("expected IDENTIFIER, INTEGER, STRING, or subquery, got %v", p.peek().Type)
+	}
+}
+
+// parseLiteralList 解析 IN 之后的 (v1, v2, ...)，至少有一个 INTEGER 或 STRING
+func (p *SQLParser) parseLiteralList() (*ListNode, error) {
+	if err := p.consume(LEFT_PARENTHESIS); err != nil {
+		return nil, err
+	}
+	values := []*LiteralNode{}
+	for {
+		if !p.match(INTEGER) && !p.match(STRING) {
+			return nil, p.errorf("expected INTEGER or STRING in IN list, got %v", p.peek().Type)
+		}
+		literal, err := p.parseColumnOrLiteralOrSubquery()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, literal.(*LiteralNode))
+		if !p.match(COMMA) {
+			break
+		}
+		p.next()
+	}
+	if err := p.consume(RIGHT_PARENTHESIS); err != nil {
+		return nil, err
 	}
+	return NewListNode(values), nil
 }
 
-func (p *SQLParser) parseSubquery() *SelectNode {
-	p.consume(LEFT_PARENTHESIS)
-	subquery, _ := p.parseSelect()
-	p.consume(RIGHT_PARENTHESIS)
-	return subquery
+func (p *SQLParser) parseSubquery() (*SelectNode, error) {
+	if err := p.consume(LEFT_PARENTHESIS); err != nil {
+		return nil, err
+	}
+	subquery, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(RIGHT_PARENTHESIS); err != nil {
+		return nil, err
+	}
+	return subquery, nil
 }
 
-func (p *SQLParser) parseWhereCondition() ([]*BinaryOpNode, error) {
-	conditions := make([]*BinaryOpNode, 0)
+// 布尔运算符的优先级，数值越大结合越紧密
+var booleanPrecedence = map[TokenType]int{
+	OR:  1,
+	AND: 2,
+}
+
+func (p *SQLParser) parseWhereCondition() (ASTNode, error) {
+	return p.parseBooleanExpression(1)
+}
+
+// parseBooleanExpression 使用优先级爬升解析由 AND / OR 连接的条件，两者都是左结合
+func (p *SQLParser) parseBooleanExpression(minPrecedence int) (ASTNode, error) {
+	left, err := p.parseUnaryCondition()
+	if err != nil {
+		return nil, err
+	}
 
 	for {
-		expression, err := p.parseExpression()
+		operator := p.peek().Type
+		precedence, ok := booleanPrecedence[operator]
+		if !ok || precedence < minPrecedence {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBooleanExpression(precedence + 1)
 		if err != nil {
 			return nil, err
 		}
-		conditions = append(conditions, expression)
-		if p.match(AND) {
-			p.next()
-		} else {
-			break
+		left = NewBinaryOpNode(operator, left, right)
+	}
+}
+
+// parseUnaryCondition 解析 NOT、括号包裹的条件或单个比较表达式
+func (p *SQLParser) parseUnaryCondition() (ASTNode, error) {
+	if p.match(NOT) {
+		p.next()
+		operand, err := p.parseUnaryCondition()
+		if err != nil {
+			return nil, err
+		}
+		return NewUnaryOpNode(NOT, operand), nil
+	}
+
+	// 括号后面不是 SELECT 时是分组的条件，否则交给 parseExpression 当作子查询处理
+	if p.match(LEFT_PARENTHESIS) && p.peekAt(1).Type != SELECT {
+		p.next()
+		condition, err := p.parseBooleanExpression(1)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.consume(RIGHT_PARENTHESIS); err != nil {
+			return nil, err
 		}
+		return condition, nil
 	}
 
-	return conditions, nil
+	expression, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return expression, nil
 }
 
-func (p *SQLParser) parseInsert() ASTNode {
-	p.consume(INSERT_INTO)
-	tableName, _ := p.parsePlainString()
+func (p *SQLParser) parseInsert() (*InsertNode, error) {
+	if err := p.consume(INSERT_INTO); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parsePlainString()
+	if err != nil {
+		return nil, err
+	}
 
 	columns := make([]string, 0)
 
 	if p.match(LEFT_PARENTHESIS) {
 		p.next()
-		columns = p.parsePlainStringList()
-		p.consume(RIGHT_PARENTHESIS)
+		columns, err = p.parsePlainStringList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.consume(RIGHT_PARENTHESIS); err != nil {
+			return nil, err
+		}
 	}
 
-	p.consume(VALUES)
-	p.consume(LEFT_PARENTHESIS)
-	values := p.parseValueList()
-	p.consume(RIGHT_PARENTHESIS)
+	if err := p.consume(VALUES); err != nil {
+		return nil, err
+	}
+	if err := p.consume(LEFT_PARENTHESIS); err != nil {
+		return nil, err
+	}
+	values, err := p.parseValueList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(RIGHT_PARENTHESIS); err != nil {
+		return nil, err
+	}
 
 	return &InsertNode{
 		TableName: tableName,
 		Columns:   columns,
 		Values:    values,
-	}
+	}, nil
 }
 
-func (p *SQLParser) parsePlainStringList() []string {
+func (p *SQLParser) parsePlainStringList() ([]string, error) {
 	stringList := make([]string, 0)
 
 	for {
-		plainString, _ := p.parsePlainString()
+		plainString, err := p.parsePlainString()
+		if err != nil {
+			return nil, err
+		}
 		stringList = append(stringList, plainString)
 		if p.match(COMMA) {
 			p.next()
@@ -297,10 +642,10 @@ func (p *SQLParser) parsePlainStringList() []string {
 		}
 	}
 
-	return stringList
+	return stringList, nil
 }
 
-func (p *SQLParser) parseValueList() []interface{} {
+func (p *SQLParser) parseValueList() ([]interface{}, error) {
 	values := make([]interface{}, 0)
 
 	for {
@@ -309,7 +654,7 @@ func (p *SQLParser) parseValueList() []interface{} {
 			// 直接转换为整数类型
 			intVal, err := strconv.ParseUint(token.Value, 10, 32)
 			if err != nil {
-				panic("Invalid integer value: " + token.Value)
+				return nil, p.errorf("Invalid integer value: %s", token.Value)
 			}
 			values = append(values, uint32(intVal))
 			p.next()
@@ -318,7 +663,7 @@ func (p *SQLParser) parseValueList() []interface{} {
 			values = append(values, p.peek().Value)
 			p.next()
 		} else {
-			panic("Expected INTEGER or STRING in VALUES clause")
+			return nil, p.errorf("Expected INTEGER or STRING in VALUES clause but got %v", p.peek().Type)
 		}
 
 		if p.match(COMMA) {
@@ -329,44 +674,60 @@ func (p *SQLParser) parseValueList() []interface{} {
 		}
 	}
 
-	return values
+	return values, nil
 }
 
 /*
- * CREATE TABLE table_name (column1 datatype PRIMARY KEY, column2 datatype, ...);
+ * CREATE TABLE table_name (column1 datatype PRIMARY KEY, column2 datatype [INDEX | UNIQUE], ...);
+ * CREATE TABLE table_name (column1 datatype, column2 datatype, ..., PRIMARY KEY (column1, column2));
  */
-func (p *SQLParser) parseCreateTable() ASTNode {
-	p.consume(CREATE_TABLE)
-	tableName, _ := p.parsePlainString()
-	p.consume(LEFT_PARENTHESIS)
-	columns := p.parseColumnDefinitions()
-	p.consume(RIGHT_PARENTHESIS)
+func (p *SQLParser) parseCreateTable() (*CreateTableNode, error) {
+	if err := p.consume(CREATE_TABLE); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parsePlainString()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(LEFT_PARENTHESIS); err != nil {
+		return nil, err
+	}
+	columns, primaryKey, err := p.parseColumnDefinitions()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(RIGHT_PARENTHESIS); err != nil {
+		return nil, err
+	}
 
-	return NewCreateTableNode(tableName, columns)
+	node := NewCreateTableNode(tableName, columns)
+	node.PrimaryKey = primaryKey
+	return node, nil
 }
 
-func (p *SQLParser) parseColumnDefinitions() []*ColumnDefinition {
+// parseColumnDefinitions 解析列定义列表，其中可以有一项 PRIMARY KEY (column1, column2, ...) 表约束
+func (p *SQLParser) parseColumnDefinitions() ([]*ColumnDefinition, []string, error) {
 	columns := make([]*ColumnDefinition, 0)
+	var primaryKey []string
 
 	for {
-		columnName, _ := p.parsePlainString()
-		dataType, _ := p.parseDataType()
-
-		indexType := None
 		if p.match(PRIMARY_KEY) {
-			indexType = Primary
-			p.next()
-		} else if p.match(INDEX) {
-			indexType = Secondary
-			p.next()
+			if primaryKey != nil {
+				return nil, nil, p.errorf("PRIMARY KEY declared more than once")
+			}
+			keyColumns, err := p.parsePrimaryKeyConstraint()
+			if err != nil {
+				return nil, nil, err
+			}
+			primaryKey = keyColumns
+		} else {
+			column, err := p.parseColumnDefinition()
+			if err != nil {
+				return nil, nil, err
+			}
+			columns = append(columns, column)
 		}
 
-		columns = append(columns, &ColumnDefinition{
-			Name:      columnName,
-			DataType:  dataType,
-			IndexType: indexType,
-		})
-
 		if p.match(COMMA) {
 			p.next()
 			continue
@@ -375,7 +736,58 @@ func (p *SQLParser) parseColumnDefinitions() []*ColumnDefinition {
 		}
 	}
 
-	return columns
+	return columns, primaryKey, nil
+}
+
+func (p *SQLParser) parseColumnDefinition() (*ColumnDefinition, error) {
+	columnName, err := p.parsePlainString()
+	if err != nil {
+		return nil, err
+	}
+	dataType, err := p.parseDataType()
+	if err != nil {
+		return nil, err
+	}
+
+	indexType := None
+	unique := false
+	if p.match(PRIMARY_KEY) {
+		indexType = Primary
+		p.next()
+	} else if p.match(INDEX) {
+		indexType = Secondary
+		p.next()
+	} else if p.match(UNIQUE) {
+		// UNIQUE 约束由列上的唯一二级索引实现
+		indexType = Secondary
+		unique = true
+		p.next()
+	}
+
+	return &ColumnDefinition{
+		Name:      columnName,
+		DataType:  dataType,
+		IndexType: indexType,
+		Unique:    unique,
+	}, nil
+}
+
+// parsePrimaryKeyConstraint 解析 PRIMARY KEY (column1, column2, ...)
+func (p *SQLParser) parsePrimaryKeyConstraint() ([]string, error) {
+	if err := p.consume(PRIMARY_KEY); err != nil {
+		return nil, err
+	}
+	if err := p.consume(LEFT_PARENTHESIS); err != nil {
+		return nil, err
+	}
+	columns, err := p.parsePlainStringList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(RIGHT_PARENTHESIS); err != nil {
+		return nil, err
+	}
+	return columns, nil
 }
 
 func (p *SQLParser) parseDataType() (DataType, error) {
@@ -385,30 +797,48 @@ func (p *SQLParser) parseDataType() (DataType, error) {
 	} else if p.match(CHAR) {
 		p.next()
 		return TypeChar, nil
+	} else if p.match(VARCHAR) {
+		p.next()
+		return TypeVarchar, nil
 	} else {
-		return 0, errors.New("unsupported data type")
+		return 0, p.errorf("unsupported data type")
 	}
 }
 
-func (p *SQLParser) parseUpdate() *UpdateNode {
-	p.consume(UPDATE)
-	tableName, _ := p.parsePlainString()
-	p.consume(SET)
+func (p *SQLParser) parseUpdate() (*UpdateNode, error) {
+	if err := p.consume(UPDATE); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parsePlainString()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(SET); err != nil {
+		return nil, err
+	}
 
 	columns := make([]string, 0)
 	values := make([]interface{}, 0)
 
 	// Parse SET clause
 	for {
-		column, _ := p.parsePlainString()
-		p.consume(EQUALS)
-		value, _ := p.parseColumnOrLiteralOrSubquery()
+		column, err := p.parsePlainString()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.consume(EQUALS); err != nil {
+			return nil, err
+		}
+		value, err := p.parseColumnOrLiteralOrSubquery()
+		if err != nil {
+			return nil, err
+		}
 
 		columns = append(columns, column)
 		if literal, ok := value.(*LiteralNode); ok {
 			values = append(values, literal.Value)
 		} else {
-			panic("Expected literal value in SET clause")
+			return nil, p.errorf("Expected literal value in SET clause")
 		}
 
 		if p.match(COMMA) {
@@ -420,10 +850,13 @@ func (p *SQLParser) parseUpdate() *UpdateNode {
 	}
 
 	// Parse WHERE clause
-	var whereClause []*BinaryOpNode
+	var whereClause ASTNode
 	if p.match(WHERE) {
 		p.next()
-		whereClause, _ = p.parseWhereCondition()
+		whereClause, err = p.parseWhereCondition()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &UpdateNode{
@@ -431,5 +864,123 @@ func (p *SQLParser) parseUpdate() *UpdateNode {
 		Columns:     columns,
 		Values:      values,
 		WhereClause: whereClause,
+	}, nil
+}
+
+/*
+ * DELETE FROM table_name [WHERE condition];
+ */
+func (p *SQLParser) parseDelete() (*DeleteNode, error) {
+	if err := p.consume(DELETE_FROM); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parsePlainString()
+	if err != nil {
+		return nil, err
+	}
+
+	var whereClause ASTNode
+	if p.match(WHERE) {
+		p.next()
+		whereClause, err = p.parseWhereCondition()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewDeleteNode(tableName, whereClause), nil
+}
+
+/*
+ * ANALYZE [TABLE] table_name;
+ */
+func (p *SQLParser) parseAnalyze() (*AnalyzeNode, error) {
+	if err := p.consume(ANALYZE); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parsePlainString()
+	if err != nil {
+		return nil, err
+	}
+	return NewAnalyzeNode(tableName), nil
+}
+
+/*
+ * EXPLAIN SELECT ...;
+ */
+func (p *SQLParser) parseExplain() (*ExplainNode, error) {
+	if err := p.consume(EXPLAIN); err != nil {
+		return nil, err
+	}
+	if !p.match(SELECT) {
+		return nil, p.errorf("EXPLAIN only supports SELECT, got %v", p.peek().Type)
+	}
+	statement, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	return NewExplainNode(statement), nil
+}
+
+/*
+ * CREATE [UNIQUE] INDEX index_name ON table_name (column1, column2, ...);
+ */
+func (p *SQLParser) parseCreateIndex() (*CreateIndexNode, error) {
+	if err := p.consume(CREATE); err != nil {
+		return nil, err
+	}
+	unique := false
+	if p.match(UNIQUE) {
+		unique = true
+		p.next()
+	}
+	if err := p.consume(INDEX); err != nil {
+		return nil, err
+	}
+	indexName, err := p.parsePlainString()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(ON); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parsePlainString()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(LEFT_PARENTHESIS); err != nil {
+		return nil, err
+	}
+	columns, err := p.parsePlainStringList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(RIGHT_PARENTHESIS); err != nil {
+		return nil, err
+	}
+	return NewCreateIndexNode(indexName, tableName, columns, unique), nil
+}
+
+/*
+ * DROP INDEX index_name ON table_name;
+ */
+func (p *SQLParser) parseDropIndex() (*DropIndexNode, error) {
+	if err := p.consume(DROP); err != nil {
+		return nil, err
+	}
+	if err := p.consume(INDEX); err != nil {
+		return nil, err
+	}
+	indexName, err := p.parsePlainString()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(ON); err != nil {
+		return nil, err
+	}
+	tableName, err := p.parsePlainString()
+	if err != nil {
+		return nil, err
 	}
+	return NewDropIndexNode(indexName, tableName), nil
 }
@@ -53,15 +53,23 @@ func diffNode(got, want entity.ASTNode, path string) string {
 		}
 
 		// 比较 WhereClause
-		if len(g.WhereClause) != len(w.WhereClause) {
-			diffs = append(diffs, fmt.Sprintf("%s.WhereClause: length mismatch: got %d, want %d", path, len(g.WhereClause), len(w.WhereClause)))
+		if d := diffNode(g.WhereClause, w.WhereClause, path+".WhereClause"); d != "" {
+			diffs = append(diffs, d)
+		}
+
+		// 比较 GroupBy 和 Having
+		if len(g.GroupBy) != len(w.GroupBy) {
+			diffs = append(diffs, fmt.Sprintf("%s.GroupBy: length mismatch: got %d, want %d", path, len(g.GroupBy), len(w.GroupBy)))
 		} else {
-			for i := range w.WhereClause {
-				if d := diffNode(g.WhereClause[i], w.WhereClause[i], fmt.Sprintf("%s.WhereClause[%d]", path, i)); d != "" {
+			for i := range w.GroupBy {
+				if d := diffNode(g.GroupBy[i], w.GroupBy[i], fmt.Sprintf("%s.GroupBy[%d]", path, i)); d != "" {
 					diffs = append(diffs, d)
 				}
 			}
 		}
+		if d := diffNode(g.Having, w.Having, path+".Having"); d != "" {
+			diffs = append(diffs, d)
+		}
 
 		// 比较 Join
 		if len(g.Join) != len(w.Join) {
@@ -74,6 +82,13 @@ func diffNode(got, want entity.ASTNode, path string) string {
 			}
 		}
 
+		// 比较 Limit
+		if (g.Limit == nil) != (w.Limit == nil) {
+			diffs = append(diffs, fmt.Sprintf("%s.Limit: got %v, want %v", path, g.Limit, w.Limit))
+		} else if g.Limit != nil && *g.Limit != *w.Limit {
+			diffs = append(diffs, fmt.Sprintf("%s.Limit: got %v, want %v", path, g.Limit, w.Limit))
+		}
+
 		// 比较 OrderByColumns
 		if len(g.OrderByColumns) != len(w.OrderByColumns) {
 			diffs = append(diffs, fmt.Sprintf("%s.OrderByColumns: length mismatch: got %d, want %d", path, len(g.OrderByColumns), len(w.OrderByColumns)))
@@ -85,6 +100,18 @@ func diffNode(got, want entity.ASTNode, path string) string {
 			}
 		}
 
+	case *entity.OrderByNode:
+		g, ok := got.(*entity.OrderByNode)
+		if !ok {
+			return fmt.Sprintf("%s: type mismatch: got %T, want OrderByNode", path, got)
+		}
+		if g.Desc != w.Desc {
+			diffs = append(diffs, fmt.Sprintf("%s.Desc: got %v, want %v", path, g.Desc, w.Desc))
+		}
+		if d := diffNode(g.Column, w.Column, path+".Column"); d != "" {
+			diffs = append(diffs, d)
+		}
+
 	case *entity.ColumnNode:
 		g, ok := got.(*entity.ColumnNode)
 		if !ok {
@@ -99,6 +126,16 @@ func diffNode(got, want entity.ASTNode, path string) string {
 		if g.ColumnType != w.ColumnType {
 			diffs = append(diffs, fmt.Sprintf("%s.ColumnType: got %v, want %v", path, g.ColumnType, w.ColumnType))
 		}
+		if g.Function != w.Function {
+			diffs = append(diffs, fmt.Sprintf("%s.Function: got %q, want %q", path, g.Function, w.Function))
+		}
+		if (g.Argument == nil) != (w.Argument == nil) {
+			diffs = append(diffs, fmt.Sprintf("%s.Argument: got %v, want %v", path, g.Argument, w.Argument))
+		} else if g.Argument != nil {
+			if d := diffNode(g.Argument, w.Argument, path+".Argument"); d != "" {
+				diffs = append(diffs, d)
+			}
+		}
 
 	case *entity.BinaryOpNode:
 		g, ok := got.(*entity.BinaryOpNode)
@@ -115,11 +152,26 @@ func diffNode(got, want entity.ASTNode, path string) string {
 			diffs = append(diffs, d)
 		}
 
+	case *entity.UnaryOpNode:
+		g, ok := got.(*entity.UnaryOpNode)
+		if !ok {
+			return fmt.Sprintf("%s: type mismatch: got %T, want UnaryOpNode", path, got)
+		}
+		if g.Operator != w.Operator {
+			diffs = append(diffs, fmt.Sprintf("%s.Operator: got %q, want %q", path, g.Operator, w.Operator))
+		}
+		if d := diffNode(g.Operand, w.Operand, path+".Operand"); d != "" {
+			diffs = append(diffs, d)
+		}
+
 	case *entity.JoinNode:
 		g, ok := got.(*entity.JoinNode)
 		if !ok {
 			return fmt.Sprintf("%s: type mismatch: got %T, want JoinNode", path, got)
 		}
+		if g.Kind != w.Kind {
+			diffs = append(diffs, fmt.Sprintf("%s.Kind: got %v, want %v", path, g.Kind, w.Kind))
+		}
 		if g.TableName != w.TableName {
 			diffs = append(diffs, fmt.Sprintf("%s.TableName: got %q, want %q", path, g.TableName, w.TableName))
 		}
@@ -127,6 +179,19 @@ func diffNode(got, want entity.ASTNode, path string) string {
 			diffs = append(diffs, d)
 		}
 
+	case *entity.ListNode:
+		g, ok := got.(*entity.ListNode)
+		if !ok {
+			return fmt.Sprintf("%s: type mismatch: got %T, want ListNode", path, got)
+		}
+		if len(g.Values) != len(w.Values) {
+			return fmt.Sprintf("%s.Values: length mismatch: got %d, want %d", path, len(g.Values), len(w.Values))
+		}
+		for i := range w.Values {
+			if d := diffNode(g.Values[i], w.Values[i], fmt.Sprintf("%s.Values[%d]", path, i)); d != "" {
+				diffs = append(diffs, d)
+			}
+		}
 	case *entity.LiteralNode:
 		g, ok := got.(*entity.LiteralNode)
 		if !ok {
@@ -170,12 +235,10 @@ func TestSQLParser_Parse(t *testing.T) {
 				Columns: []*entity.ColumnNode{
 					entity.NewColumnNode("", "id", entity.PLAIN_STRING),
 				},
-				WhereClause: []*entity.BinaryOpNode{
-					entity.NewBinaryOpNode(entity.EQUALS,
-						entity.NewColumnNode("", "id", entity.PLAIN_STRING),
-						entity.NewLiteralNode(1),
-					),
-				},
+				WhereClause: entity.NewBinaryOpNode(entity.EQUALS,
+					entity.NewColumnNode("", "id", entity.PLAIN_STRING),
+					entity.NewLiteralNode(1),
+				),
 				OrderByColumns: nil,
 				Join:           nil,
 			},
@@ -191,7 +254,7 @@ func TestSQLParser_Parse(t *testing.T) {
 					entity.NewColumnNode("departments", "name", entity.TABLE_NAME_PREFIXED),
 				},
 				Join: []*entity.JoinNode{
-					entity.NewJoinNode("departments",
+					entity.NewJoinNode(entity.InnerJoin, "departments",
 						entity.NewBinaryOpNode(entity.EQUALS,
 							entity.NewColumnNode("users", "dept_id", entity.TABLE_NAME_PREFIXED),
 							entity.NewColumnNode("departments", "id", entity.TABLE_NAME_PREFIXED),
@@ -201,6 +264,157 @@ func TestSQLParser_Parse(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "select with outer and cross joins",
+			sql:  "SELECT * FROM users LEFT OUTER JOIN depts ON users.dept_id = depts.id AND depts.floor > 1 RIGHT JOIN teams ON teams.id = users.team_id CROSS JOIN regions",
+			want: &entity.SelectNode{
+				TableName: "users",
+				Columns: []*entity.ColumnNode{
+					entity.NewColumnNode("*", "", entity.WILDCARDN),
+				},
+				Join: []*entity.JoinNode{
+					entity.NewJoinNode(entity.LeftJoin, "depts",
+						entity.NewBinaryOpNode(entity.AND,
+							entity.NewBinaryOpNode(entity.EQUALS,
+								entity.NewColumnNode("users", "dept_id", entity.TABLE_NAME_PREFIXED),
+								entity.NewColumnNode("depts", "id", entity.TABLE_NAME_PREFIXED),
+							),
+							entity.NewBinaryOpNode(entity.GREATER_THAN,
+								entity.NewColumnNode("depts", "floor", entity.TABLE_NAME_PREFIXED),
+								entity.NewLiteralNode(uint32(1)),
+							),
+						),
+					),
+					entity.NewJoinNode(entity.RightJoin, "teams",
+						entity.NewBinaryOpNode(entity.EQUALS,
+							entity.NewColumnNode("teams", "id", entity.TABLE_NAME_PREFIXED),
+							entity.NewColumnNode("users", "team_id", entity.TABLE_NAME_PREFIXED),
+						),
+					),
+					entity.NewJoinNode(entity.CrossJoin, "regions", nil),
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "select with order by direction",
+			sql:  "SELECT id, name FROM users ORDER BY age DESC, name ASC, id",
+			want: &entity.SelectNode{
+				TableName: "users",
+				Columns: []*entity.ColumnNode{
+					entity.NewColumnNode("", "id", entity.PLAIN_STRING),
+					entity.NewColumnNode("", "name", entity.PLAIN_STRING),
+				},
+				OrderByColumns: []*entity.OrderByNode{
+					entity.NewOrderByNode(entity.NewColumnNode("", "age", entity.PLAIN_STRING), true),
+					entity.NewOrderByNode(entity.NewColumnNode("", "name", entity.PLAIN_STRING), false),
+					entity.NewOrderByNode(entity.NewColumnNode("", "id", entity.PLAIN_STRING), false),
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "select with limit and offset",
+			sql:  "SELECT id FROM users WHERE id > 1 ORDER BY id DESC LIMIT 10 OFFSET 20",
+			want: &entity.SelectNode{
+				TableName: "users",
+				Columns: []*entity.ColumnNode{
+					entity.NewColumnNode("", "id", entity.PLAIN_STRING),
+				},
+				WhereClause: entity.NewBinaryOpNode(entity.GREATER_THAN,
+					entity.NewColumnNode("", "id", entity.PLAIN_STRING),
+					entity.NewLiteralNode(uint32(1)),
+				),
+				OrderByColumns: []*entity.OrderByNode{
+					entity.NewOrderByNode(entity.NewColumnNode("", "id", entity.PLAIN_STRING), true),
+				},
+				Limit: entity.NewLimitNode(10, 20),
+			},
+			wantErr: false,
+		},
+		{
+			name: "select with limit",
+			sql:  "SELECT * FROM users LIMIT 5",
+			want: &entity.SelectNode{
+				TableName: "users",
+				Columns: []*entity.ColumnNode{
+					entity.NewColumnNode("*", "", entity.WILDCARDN),
+				},
+				Limit: entity.NewLimitNode(5, 0),
+			},
+			wantErr: false,
+		},
+		{
+			name: "select with aggregates",
+			sql:  "SELECT COUNT(*), sum(age), MAX(users.id) FROM users WHERE age > 18",
+			want: &entity.SelectNode{
+				TableName: "users",
+				Columns: []*entity.ColumnNode{
+					entity.NewFunctionColumnNode("COUNT", entity.NewColumnNode("*", "", entity.WILDCARDN)),
+					entity.NewFunctionColumnNode("SUM", entity.NewColumnNode("", "age", entity.PLAIN_STRING)),
+					entity.NewFunctionColumnNode("MAX", entity.NewColumnNode("users", "id", entity.TABLE_NAME_PREFIXED)),
+				},
+				WhereClause: entity.NewBinaryOpNode(entity.GREATER_THAN,
+					entity.NewColumnNode("", "age", entity.PLAIN_STRING),
+					entity.NewLiteralNode(uint32(18)),
+				),
+			},
+			wantErr: false,
+		},
+		{
+			name: "select with group by and having",
+			sql:  "SELECT dept, COUNT(*) FROM users WHERE age > 18 GROUP BY dept HAVING COUNT(*) >= 2 ORDER BY dept",
+			want: &entity.SelectNode{
+				TableName: "users",
+				Columns: []*entity.ColumnNode{
+					entity.NewColumnNode("", "dept", entity.PLAIN_STRING),
+					entity.NewFunctionColumnNode("COUNT", entity.NewColumnNode("*", "", entity.WILDCARDN)),
+				},
+				WhereClause: entity.NewBinaryOpNode(entity.GREATER_THAN,
+					entity.NewColumnNode("", "age", entity.PLAIN_STRING),
+					entity.NewLiteralNode(uint32(18)),
+				),
+				GroupBy: []*entity.ColumnNode{
+					entity.NewColumnNode("", "dept", entity.PLAIN_STRING),
+				},
+				Having: entity.NewBinaryOpNode(entity.GREATER_EQUALS,
+					entity.NewFunctionColumnNode("COUNT", entity.NewColumnNode("*", "", entity.WILDCARDN)),
+					entity.NewLiteralNode(uint32(2)),
+				),
+				OrderByColumns: []*entity.OrderByNode{
+					entity.NewOrderByNode(entity.NewColumnNode("", "dept", entity.PLAIN_STRING), false),
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "select with in list",
+			sql:  "SELECT id FROM users WHERE id IN (9, 1, 5) AND name IN ('a', 'b')",
+			want: &entity.SelectNode{
+				TableName: "users",
+				Columns: []*entity.ColumnNode{
+					entity.NewColumnNode("", "id", entity.PLAIN_STRING),
+				},
+				WhereClause: entity.NewBinaryOpNode(entity.AND,
+					entity.NewBinaryOpNode(entity.IN,
+						entity.NewColumnNode("", "id", entity.PLAIN_STRING),
+						entity.NewListNode([]*entity.LiteralNode{
+							entity.NewLiteralNode(uint32(9)),
+							entity.NewLiteralNode(uint32(1)),
+							entity.NewLiteralNode(uint32(5)),
+						}),
+					),
+					entity.NewBinaryOpNode(entity.IN,
+						entity.NewColumnNode("", "name", entity.PLAIN_STRING),
+						entity.NewListNode([]*entity.LiteralNode{
+							entity.NewLiteralNode("a"),
+							entity.NewLiteralNode("b"),
+						}),
+					),
+				),
+			},
+			wantErr: false,
+		},
 		{
 			name: "select with order by",
 			sql:  "SELECT id, name FROM users ORDER BY name",
@@ -210,8 +424,8 @@ func TestSQLParser_Parse(t *testing.T) {
 					entity.NewColumnNode("", "id", entity.PLAIN_STRING),
 					entity.NewColumnNode("", "name", entity.PLAIN_STRING),
 				},
-				OrderByColumns: []*entity.ColumnNode{
-					entity.NewColumnNode("", "name", entity.PLAIN_STRING),
+				OrderByColumns: []*entity.OrderByNode{
+					entity.NewOrderByNode(entity.NewColumnNode("", "name", entity.PLAIN_STRING), false),
 				},
 			},
 			wantErr: false,
@@ -267,12 +481,10 @@ func TestASTNodeCreation(t *testing.T) {
 
 	t.Run("test select node", func(t *testing.T) {
 		columns := []*entity.ColumnNode{entity.NewColumnNode("", "id", entity.PLAIN_STRING)}
-		whereClause := []*entity.BinaryOpNode{
-			entity.NewBinaryOpNode(entity.EQUALS,
-				entity.NewColumnNode("", "id", entity.PLAIN_STRING),
-				entity.NewLiteralNode(1),
-			),
-		}
+		whereClause := entity.NewBinaryOpNode(entity.EQUALS,
+			entity.NewColumnNode("", "id", entity.PLAIN_STRING),
+			entity.NewLiteralNode(1),
+		)
 		node := entity.NewSelectNode("users", columns, whereClause, nil, nil)
 
 		if node.TableName != "users" {
@@ -281,8 +493,8 @@ func TestASTNodeCreation(t *testing.T) {
 		if len(node.Columns) != 1 {
 			t.Errorf("Expected 1 column, got %d", len(node.Columns))
 		}
-		if len(node.WhereClause) != 1 {
-			t.Errorf("Expected 1 where clause, got %d", len(node.WhereClause))
+		if node.WhereClause != whereClause {
+			t.Errorf("Expected where clause %v, got %v", whereClause, node.WhereClause)
 		}
 	})
 }
@@ -361,6 +573,51 @@ func TestEdgeCases(t *testing.T) {
 			sql:     "SELECT id FROM users WHERE",
 			wantErr: true,
 		},
+		{
+			name:    "unknown function",
+			sql:     "SELECT LENGTH(name) FROM users",
+			wantErr: true,
+		},
+		{
+			name:    "sum of wildcard",
+			sql:     "SELECT SUM(*) FROM users",
+			wantErr: true,
+		},
+		{
+			name:    "unclosed function call",
+			sql:     "SELECT COUNT(id FROM users",
+			wantErr: true,
+		},
+		{
+			name:    "aggregate in group by",
+			sql:     "SELECT dept FROM users GROUP BY COUNT(*)",
+			wantErr: true,
+		},
+		{
+			name:    "group by without columns",
+			sql:     "SELECT dept FROM users GROUP BY HAVING COUNT(*) > 1",
+			wantErr: true,
+		},
+		{
+			name:    "empty in list",
+			sql:     "SELECT id FROM users WHERE id IN ()",
+			wantErr: true,
+		},
+		{
+			name:    "column in in list",
+			sql:     "SELECT id FROM users WHERE id IN (1, age)",
+			wantErr: true,
+		},
+		{
+			name:    "limit without count",
+			sql:     "SELECT id FROM users LIMIT",
+			wantErr: true,
+		},
+		{
+			name:    "offset without limit",
+			sql:     "SELECT id FROM users OFFSET 1",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -483,6 +740,18 @@ func TestSQLParser_Parse_CreateTable(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "create table with varchar columns",
+			sql:  "CREATE TABLE tags (name VARCHAR PRIMARY KEY, label VARCHAR INDEX)",
+			want: &entity.CreateTableNode{
+				TableName: "tags",
+				Columns: []*entity.ColumnDefinition{
+					{Name: "name", DataType: entity.TypeVarchar, IndexType: entity.Primary},
+					{Name: "label", DataType: entity.TypeVarchar, IndexType: entity.Secondary},
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "create table with multiple columns",
 			sql:  "CREATE TABLE employees (id INT PRIMARY KEY, name CHAR, age INT, dept_id INT)",
@@ -497,6 +766,43 @@ func TestSQLParser_Parse_CreateTable(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "create table with unique column",
+			sql:  "CREATE TABLE accounts (id INT PRIMARY KEY, email INT UNIQUE, age INT INDEX)",
+			want: &entity.CreateTableNode{
+				TableName: "accounts",
+				Columns: []*entity.ColumnDefinition{
+					{Name: "id", DataType: entity.TypeInt, IndexType: entity.Primary},
+					{Name: "email", DataType: entity.TypeInt, IndexType: entity.Secondary, Unique: true},
+					{Name: "age", DataType: entity.TypeInt, IndexType: entity.Secondary},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "create table with composite primary key",
+			sql:  "CREATE TABLE enrollments (student INT, course INT, grade INT, PRIMARY KEY (student, course))",
+			want: &entity.CreateTableNode{
+				TableName: "enrollments",
+				Columns: []*entity.ColumnDefinition{
+					{Name: "student", DataType: entity.TypeInt, IndexType: entity.None},
+					{Name: "course", DataType: entity.TypeInt, IndexType: entity.None},
+					{Name: "grade", DataType: entity.TypeInt, IndexType: entity.None},
+				},
+				PrimaryKey: []string{"student", "course"},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "create table with two primary key constraints",
+			sql:     "CREATE TABLE enrollments (student INT, course INT, PRIMARY KEY (student), PRIMARY KEY (course))",
+			wantErr: true,
+		},
+		{
+			name:    "create table with empty primary key constraint",
+			sql:     "CREATE TABLE enrollments (student INT, PRIMARY KEY ())",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -518,6 +824,9 @@ func TestSQLParser_Parse_CreateTable(t *testing.T) {
 				if !reflect.DeepEqual(gotNode.Columns, tt.want.(*entity.CreateTableNode).Columns) {
 					t.Errorf("Columns = %v, want %v", gotNode.Columns, tt.want.(*entity.CreateTableNode).Columns)
 				}
+				if !reflect.DeepEqual(gotNode.PrimaryKey, tt.want.(*entity.CreateTableNode).PrimaryKey) {
+					t.Errorf("PrimaryKey = %v, want %v", gotNode.PrimaryKey, tt.want.(*entity.CreateTableNode).PrimaryKey)
+				}
 			}
 		})
 	}
@@ -574,16 +883,14 @@ func TestParser_Update(t *testing.T) {
 				TableName: "users",
 				Columns:   []string{"name", "age"},
 				Values:    []interface{}{"John", uint32(25)},
-				WhereClause: []*entity.BinaryOpNode{
-					{
-						Operator: entity.EQUALS,
-						Left: &entity.ColumnNode{
-							ColumnName: "id",
-							ColumnType: entity.PLAIN_STRING,
-						},
-						Right: &entity.LiteralNode{
-							Value: uint32(1),
-						},
+				WhereClause: &entity.BinaryOpNode{
+					Operator: entity.EQUALS,
+					Left: &entity.ColumnNode{
+						ColumnName: "id",
+						ColumnType: entity.PLAIN_STRING,
+					},
+					Right: &entity.LiteralNode{
+						Value: uint32(1),
 					},
 				},
 			},
@@ -626,33 +933,269 @@ func TestParser_Update(t *testing.T) {
 				}
 			}
 
-			if len(updateNode.WhereClause) != len(tt.expected.WhereClause) {
-				t.Errorf("wrong number of where conditions. got=%d, want=%d", len(updateNode.WhereClause), len(tt.expected.WhereClause))
+			if d := diffNode(updateNode.WhereClause, tt.expected.WhereClause, "root.WhereClause"); d != "" {
+				t.Errorf("WhereClause differences:\n%s", d)
 			}
+		})
+	}
+}
 
-			for i, where := range updateNode.WhereClause {
-				expectedWhere := tt.expected.WhereClause[i]
-				if where.Operator != expectedWhere.Operator {
-					t.Errorf("wrong operator at index %d. got=%v, want=%v", i, where.Operator, expectedWhere.Operator)
-				}
+func TestParser_Delete(t *testing.T) {
+	node, err := Parse("DELETE FROM users WHERE id = 1 AND name = 'John'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
-				leftCol, ok := where.Left.(*entity.ColumnNode)
-				if !ok {
-					t.Errorf("expected ColumnNode for left operand at index %d", i)
-				}
-				expectedLeftCol := expectedWhere.Left.(*entity.ColumnNode)
-				if leftCol.ColumnName != expectedLeftCol.ColumnName {
-					t.Errorf("wrong column name at index %d. got=%s, want=%s", i, leftCol.ColumnName, expectedLeftCol.ColumnName)
-				}
+	deleteNode, ok := node.(*entity.DeleteNode)
+	if !ok {
+		t.Fatalf("expected DeleteNode, got %T", node)
+	}
+	if deleteNode.TableName != "users" {
+		t.Errorf("wrong table name. got=%s, want=users", deleteNode.TableName)
+	}
 
-				rightLit, ok := where.Right.(*entity.LiteralNode)
-				if !ok {
-					t.Errorf("expected LiteralNode for right operand at index %d", i)
-				}
-				expectedRightLit := expectedWhere.Right.(*entity.LiteralNode)
-				if rightLit.Value != expectedRightLit.Value {
-					t.Errorf("wrong literal value at index %d. got=%v, want=%v", i, rightLit.Value, expectedRightLit.Value)
-				}
+	want := entity.NewBinaryOpNode(entity.AND,
+		entity.NewBinaryOpNode(entity.EQUALS,
+			entity.NewColumnNode("", "id", entity.PLAIN_STRING),
+			entity.NewLiteralNode(uint32(1)),
+		),
+		entity.NewBinaryOpNode(entity.EQUALS,
+			entity.NewColumnNode("", "name", entity.PLAIN_STRING),
+			entity.NewLiteralNode("John"),
+		),
+	)
+	if d := diffNode(deleteNode.WhereClause, want, "root.WhereClause"); d != "" {
+		t.Errorf("WhereClause differences:\n%s", d)
+	}
+
+	node, err = Parse("DELETE FROM users")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deleteNode := node.(*entity.DeleteNode); deleteNode.WhereClause != nil {
+		t.Errorf("expected no where clause, got %v", deleteNode.WhereClause)
+	}
+}
+
+func TestParser_Analyze(t *testing.T) {
+	for _, sql := range []string{"ANALYZE users", "ANALYZE TABLE users"} {
+		node, err := Parse(sql)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", sql, err)
+		}
+		analyzeNode, ok := node.(*entity.AnalyzeNode)
+		if !ok {
+			t.Fatalf("%s: expected AnalyzeNode, got %T", sql, node)
+		}
+		if analyzeNode.TableName != "users" {
+			t.Errorf("%s: wrong table name. got=%s, want=users", sql, analyzeNode.TableName)
+		}
+	}
+
+	for _, sql := range []string{"ANALYZE", "ANALYZE users orders"} {
+		if _, err := Parse(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+}
+
+func TestParser_Explain(t *testing.T) {
+	node, err := Parse("EXPLAIN SELECT name FROM users WHERE id = 1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	explainNode, ok := node.(*entity.ExplainNode)
+	if !ok {
+		t.Fatalf("expected ExplainNode, got %T", node)
+	}
+	if explainNode.Statement.TableName != "users" {
+		t.Errorf("wrong table name. got=%s, want=users", explainNode.Statement.TableName)
+	}
+	want := entity.NewBinaryOpNode(entity.EQUALS,
+		entity.NewColumnNode("", "id", entity.PLAIN_STRING),
+		entity.NewLiteralNode(uint32(1)),
+	)
+	if d := diffNode(explainNode.Statement.WhereClause, want, "root.WhereClause"); d != "" {
+		t.Errorf("WhereClause differences:\n%s", d)
+	}
+
+	for _, sql := range []string{"EXPLAIN", "EXPLAIN DELETE FROM users WHERE id = 1", "EXPLAIN EXPLAIN SELECT id FROM users"} {
+		if _, err := Parse(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+}
+
+func TestParser_CreateAndDropIndex(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want *entity.CreateIndexNode
+	}{
+		{"CREATE INDEX idx_age ON users (age)", entity.NewCreateIndexNode("idx_age", "users", []string{"age"}, false)},
+		{"CREATE UNIQUE INDEX idx_email ON users(email);", entity.NewCreateIndexNode("idx_email", "users", []string{"email"}, true)},
+		{"CREATE INDEX idx_team_age ON users (team, age)", entity.NewCreateIndexNode("idx_team_age", "users", []string{"team", "age"}, false)},
+	}
+	for _, tt := range tests {
+		node, err := Parse(tt.sql)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.sql, err)
+		}
+		createNode, ok := node.(*entity.CreateIndexNode)
+		if !ok {
+			t.Fatalf("%s: expected CreateIndexNode, got %T", tt.sql, node)
+		}
+		if !reflect.DeepEqual(createNode, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.sql, createNode, tt.want)
+		}
+	}
+
+	node, err := Parse("DROP INDEX idx_age ON users")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dropNode, ok := node.(*entity.DropIndexNode)
+	if !ok {
+		t.Fatalf("expected DropIndexNode, got %T", node)
+	}
+	if dropNode.IndexName != "idx_age" || dropNode.TableName != "users" {
+		t.Errorf("got %+v", dropNode)
+	}
+
+	for _, sql := range []string{
+		"CREATE INDEX idx_age ON users",
+		"CREATE INDEX ON users (age)",
+		"CREATE UNIQUE idx_age ON users (age)",
+		"CREATE INDEX idx_age ON users (age,)",
+		"CREATE INDEX idx_age ON users ()",
+		"DROP INDEX idx_age",
+		"DROP TABLE users",
+	} {
+		if _, err := Parse(sql); err == nil {
+			t.Errorf("%s: expected error", sql)
+		}
+	}
+}
+
+func TestParser_ComparisonAndBetween(t *testing.T) {
+	node, err := Parse("SELECT id FROM users WHERE age >= 18 AND id BETWEEN 1 AND 10 AND name <> 'John'")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	selectNode, ok := node.(*entity.SelectNode)
+	if !ok {
+		t.Fatalf("expected SelectNode, got %T", node)
+	}
+
+	want := entity.NewBinaryOpNode(entity.AND,
+		entity.NewBinaryOpNode(entity.AND,
+			entity.NewBinaryOpNode(entity.GREATER_EQUALS,
+				entity.NewColumnNode("", "age", entity.PLAIN_STRING),
+				entity.NewLiteralNode(uint32(18)),
+			),
+			entity.NewBinaryOpNode(entity.BETWEEN,
+				entity.NewColumnNode("", "id", entity.PLAIN_STRING),
+				entity.NewBinaryOpNode(entity.AND,
+					entity.NewLiteralNode(uint32(1)),
+					entity.NewLiteralNode(uint32(10)),
+				),
+			),
+		),
+		entity.NewBinaryOpNode(entity.NOT_EQUALS,
+			entity.NewColumnNode("", "name", entity.PLAIN_STRING),
+			entity.NewLiteralNode("John"),
+		),
+	)
+	if d := diffNode(selectNode.WhereClause, want, "root.WhereClause"); d != "" {
+		t.Errorf("WhereClause differences:\n%s", d)
+	}
+
+	if _, err := Parse("SELECT id FROM users WHERE id BETWEEN 1"); err == nil {
+		t.Errorf("expected error for BETWEEN without AND")
+	}
+}
+
+func TestParser_BooleanExpression(t *testing.T) {
+	id := func(v uint32) *entity.BinaryOpNode {
+		return entity.NewBinaryOpNode(entity.EQUALS,
+			entity.NewColumnNode("", "id", entity.PLAIN_STRING),
+			entity.NewLiteralNode(v),
+		)
+	}
+
+	tests := []struct {
+		name string
+		sql  string
+		want entity.ASTNode
+	}{
+		{
+			name: "AND binds tighter than OR",
+			sql:  "SELECT id FROM users WHERE id = 1 OR id = 2 AND id = 3",
+			want: entity.NewBinaryOpNode(entity.OR, id(1), entity.NewBinaryOpNode(entity.AND, id(2), id(3))),
+		},
+		{
+			name: "left associative OR",
+			sql:  "SELECT id FROM users WHERE id = 1 OR id = 2 OR id = 3",
+			want: entity.NewBinaryOpNode(entity.OR, entity.NewBinaryOpNode(entity.OR, id(1), id(2)), id(3)),
+		},
+		{
+			name: "parentheses",
+			sql:  "SELECT id FROM users WHERE (id = 1 OR id = 2) AND id = 3",
+			want: entity.NewBinaryOpNode(entity.AND, entity.NewBinaryOpNode(entity.OR, id(1), id(2)), id(3)),
+		},
+		{
+			name: "NOT",
+			sql:  "SELECT id FROM users WHERE NOT id = 1 AND NOT (id = 2 OR id = 3)",
+			want: entity.NewBinaryOpNode(entity.AND,
+				entity.NewUnaryOpNode(entity.NOT, id(1)),
+				entity.NewUnaryOpNode(entity.NOT, entity.NewBinaryOpNode(entity.OR, id(2), id(3))),
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := Parse(tt.sql)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			selectNode := node.(*entity.SelectNode)
+			if d := diffNode(selectNode.WhereClause, tt.want, "root.WhereClause"); d != "" {
+				t.Errorf("WhereClause differences:\n%s", d)
+			}
+		})
+	}
+
+	if _, err := Parse("SELECT id FROM users WHERE (id = 1 OR id = 2"); err == nil {
+		t.Errorf("expected error for unbalanced parentheses")
+	}
+}
+
+func TestParser_SyntaxErrorPosition(t *testing.T) {
+	tests := []struct {
+		sql      string
+		position int
+		near     string
+	}{
+		{"SELECT id FORM users", 10, "FORM"},
+		{"INSERT INTO users VALUES (1, @)", 29, "@"},
+		{"UPDATE users SET name = 'a' WHERE id = 1 name", 41, "name"},
+		{"CREATE TABLE users (id INVALID_TYPE)", 23, "INVALID_TYPE"},
+		{"SELECT id FROM users WHERE", 26, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			_, err := Parse(tt.sql)
+			syntaxError, ok := err.(*SyntaxError)
+			if !ok {
+				t.Fatalf("expected *SyntaxError, got %T (%v)", err, err)
+			}
+			if syntaxError.Position != tt.position {
+				t.Errorf("wrong position. got=%d, want=%d (%v)", syntaxError.Position, tt.position, err)
+			}
+			if syntaxError.Near != tt.near {
+				t.Errorf("wrong near. got=%q, want=%q", syntaxError.Near, tt.near)
 			}
 		})
 	}